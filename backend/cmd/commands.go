@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charleshuang3/autoget/backend/internal/config"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"gorm.io/gorm"
+)
+
+const commandsUsage = `Commands:
+  migrate status        show applied and pending migrations
+  migrate up [version]  apply pending migrations up to version, default all
+
+Without command the server starts after applying pending migrations.
+`
+
+func openDB(cfg *config.DatabaseConfig) (*gorm.DB, error) {
+	if cfg.Type == config.DatabaseSqlite {
+		return db.Sqlite(cfg.Path)
+	}
+	return db.Pg(cfg.DSN)
+}
+
+func runCommand(d *gorm.DB, args []string) error {
+	if args[0] != "migrate" || len(args) < 2 {
+		return fmt.Errorf("unknown command: %s, see -h", strings.Join(args, " "))
+	}
+
+	switch args[1] {
+	case "status":
+		return migrateStatus(d)
+	case "up":
+		to := uint64(0)
+		if len(args) > 2 {
+			var err error
+			to, err = strconv.ParseUint(args[2], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid version: %s", args[2])
+			}
+		}
+		if err := migrateUp(d, uint(to)); err != nil {
+			return err
+		}
+		return migrateStatus(d)
+	}
+	return fmt.Errorf("unknown command: %s, see -h", strings.Join(args, " "))
+}
+
+func migrateUp(d *gorm.DB, to uint) error {
+	return db.Migrate(d, to)
+}
+
+func migrateStatus(d *gorm.DB) error {
+	statuses, err := db.MigrationStatuses(d)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
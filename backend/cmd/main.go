@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,11 +14,17 @@ import (
 	"github.com/charleshuang3/autoget/backend/indexers"
 	"github.com/charleshuang3/autoget/backend/indexers/mteam"
 	"github.com/charleshuang3/autoget/backend/indexers/nyaa"
+	"github.com/charleshuang3/autoget/backend/indexers/rsshelper"
 	"github.com/charleshuang3/autoget/backend/indexers/sukebei"
+	"github.com/charleshuang3/autoget/backend/indexers/torznab"
 	"github.com/charleshuang3/autoget/backend/internal/config"
-	"github.com/charleshuang3/autoget/backend/internal/db"
 	"github.com/charleshuang3/autoget/backend/internal/handlers"
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+	"github.com/charleshuang3/autoget/backend/internal/notify/discord"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"github.com/charleshuang3/autoget/backend/internal/notify/slack"
 	"github.com/charleshuang3/autoget/backend/internal/notify/telegram"
+	"github.com/charleshuang3/autoget/backend/internal/notify/webhook"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog/log"
@@ -25,6 +32,10 @@ import (
 
 func main() {
 	configPath := flag.String("c", os.Getenv("CONFIG_PATH"), "path to the configuration file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-c config] [command]\n\n%s\nFlags:\n", os.Args[0], commandsUsage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if *configPath == "" {
@@ -36,14 +47,45 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to read config")
 	}
 
-	tg, err := telegram.New(cfg.Telegram)
+	db, err := openDB(cfg.Database)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to create telegram notifier")
+		log.Fatal().Err(err).Msg("failed to connect to database")
+	}
+
+	if flag.NArg() > 0 {
+		if err := runCommand(db, flag.Args()); err != nil {
+			log.Fatal().Err(err).Msg("command failed")
+		}
+		return
+	}
+
+	if err := migrateUp(db, 0); err != nil {
+		log.Fatal().Err(err).Msg("failed to migrate database")
+	}
+
+	notifiers := []notify.INotifier{}
+	var tg *telegram.Notifier
+	if cfg.Telegram != nil {
+		tg, err = telegram.New(cfg.Telegram)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to create telegram notifier")
+		}
+		notifiers = append(notifiers, notify.Instrument("telegram", tg))
 	}
+	if cfg.Discord != nil {
+		notifiers = append(notifiers, notify.Instrument("discord", discord.New(cfg.Discord)))
+	}
+	if cfg.Slack != nil {
+		notifiers = append(notifiers, notify.Instrument("slack", slack.New(cfg.Slack)))
+	}
+	if cfg.Webhook != nil {
+		notifiers = append(notifiers, notify.Instrument("webhook", webhook.New(cfg.Webhook)))
+	}
+	notifier := notify.NewFanout(notifiers...)
 
-	db, err := db.Pg(cfg.PgDSN)
+	eventNotifier, err := events.New(cfg.DownloadEvents, notifier)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to connect to database")
+		log.Fatal().Err(err).Msg("failed to create download event notifier")
 	}
 
 	cronjob := cron.New()
@@ -51,40 +93,61 @@ func main() {
 
 	downloaderMap := map[string]downloaders.IDownloader{}
 	for name, dlCfg := range cfg.Downloaders {
-		downloader, err := downloaders.New(name, dlCfg, db)
+		downloader, err := downloaders.New(name, dlCfg, db, eventNotifier)
 		if err != nil {
 			log.Fatal().Err(err).Msg("failed to create downloader")
 		}
-		downloaderMap[name] = downloader
+		downloaderMap[name] = downloaders.Instrument(name, downloader)
 		downloader.RegisterCronjobs(cronjob)
 	}
 
 	indexerMap := map[string]indexers.IIndexer{}
 	if cfg.MTeam != nil {
-		normal := mteam.NewMTeam(cfg.MTeam, mteam.MTeamTypeNormal, downloaderMap[cfg.MTeam.Downloader].TorrentsDir(), db, tg)
-		normal.RegisterRSSCronjob(cronjob)
+		m := mteam.NewMTeam(cfg.MTeam, mteam.MTeamTypeNormal, downloaderMap[cfg.MTeam.Downloader], db, notifier)
+		normal := indexers.Instrument(m)
+		if m.HasRSS() {
+			normal.RegisterRSSCronjob(cronjob)
+		}
 		indexerMap[normal.Name()] = normal
 
-		adult := mteam.NewMTeam(cfg.MTeam, mteam.MTeamTypeAdult, downloaderMap[cfg.MTeam.Downloader].TorrentsDir(), db, tg)
+		adult := indexers.Instrument(mteam.NewMTeam(cfg.MTeam, mteam.MTeamTypeAdult, downloaderMap[cfg.MTeam.Downloader], db, notifier))
 		indexerMap[adult.Name()] = adult
 	}
 	if cfg.Nyaa != nil {
-		i := nyaa.NewClient(cfg.Nyaa, downloaderMap[cfg.Nyaa.Downloader].TorrentsDir(), db, tg)
+		i := indexers.Instrument(nyaa.NewClient(cfg.Nyaa, downloaderMap[cfg.Nyaa.Downloader], db, notifier))
 		i.RegisterRSSCronjob(cronjob)
 		indexerMap[i.Name()] = i
 	}
 	if cfg.Sukebei != nil {
-		i := sukebei.NewClient(cfg.Sukebei, downloaderMap[cfg.Sukebei.Downloader].TorrentsDir(), db, tg)
+		i := indexers.Instrument(sukebei.NewClient(cfg.Sukebei, downloaderMap[cfg.Sukebei.Downloader], db, notifier))
 		i.RegisterRSSCronjob(cronjob)
 		indexerMap[i.Name()] = i
 	}
 
+	for _, tCfg := range cfg.TorznabIndexers {
+		i := indexers.Instrument(torznab.NewClient(tCfg, downloaderMap[tCfg.Downloader], db, notifier))
+		i.RegisterRSSCronjob(cronjob)
+		indexerMap[i.Name()] = i
+	}
+
+	rsshelper.RegisterHistoryCleanup(cronjob, db, cfg.RSSHistoryDays)
+
 	service := handlers.NewService(cfg, db, indexerMap, downloaderMap)
+	service.SetNotifier(notifier)
+
+	botCtx, stopBot := context.WithCancel(context.Background())
+	defer stopBot()
+	if tg != nil {
+		tg.SetPendingDownloadHandler(service.HandlePendingDownload)
+		tg.SetService(service)
+		go tg.Start(botCtx)
+	}
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
 	rg := r.Group("/api/v1")
 	service.SetupRouter(rg)
+	service.SetupMetricsRouter(r)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
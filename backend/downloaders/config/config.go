@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/charleshuang3/autoget/backend/internal/db"
 )
@@ -31,42 +32,326 @@ func (c *TransmissionConfig) Validate() error {
 	return nil
 }
 
-// SeedingPolicy we use at least X MB uploaded in last Y days as
-// a condition to continue seeding.
-type SeedingPolicy struct {
+type QBittorrentConfig struct {
+	URL         string `yaml:"url"`
+	TorrentsDir string `yaml:"torrents_dir"`
+	DownloadDir string `yaml:"download_dir"`
+	FinishedDir string `yaml:"finished_dir"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+}
+
+func (c *QBittorrentConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("qbittorrent WebUI URL is required")
+	}
+	if c.TorrentsDir == "" {
+		return fmt.Errorf("torrents directory is required")
+	}
+	if c.DownloadDir == "" {
+		return fmt.Errorf("download directory is required")
+	}
+	if c.FinishedDir == "" {
+		return fmt.Errorf("finished directory is required")
+	}
+	return nil
+}
+
+// EmbeddedConfig configures the in-process torrent client. It watches
+// TorrentsDir for new .torrent files like the other downloaders do.
+type EmbeddedConfig struct {
+	TorrentsDir string `yaml:"torrents_dir"`
+	DownloadDir string `yaml:"download_dir"`
+	FinishedDir string `yaml:"finished_dir"`
+	ListenPort  int    `yaml:"listen_port"`
+}
+
+func (c *EmbeddedConfig) Validate() error {
+	if c.TorrentsDir == "" {
+		return fmt.Errorf("torrents directory is required")
+	}
+	if c.DownloadDir == "" {
+		return fmt.Errorf("download directory is required")
+	}
+	if c.FinishedDir == "" {
+		return fmt.Errorf("finished directory is required")
+	}
+	if c.ListenPort < 0 || c.ListenPort > 65535 {
+		return fmt.Errorf("invalid listen port: %d", c.ListenPort)
+	}
+	return nil
+}
+
+// UploadRule continues seeding if at least X MB uploaded in last Y days.
+type UploadRule struct {
 	IntervalInDays    int   `yaml:"interval_in_days"`
 	UploadAtLeastInMB int64 `yaml:"upload_at_least_in_mb"`
 }
 
-func (p *SeedingPolicy) Validate() error {
-	if p.IntervalInDays == 0 {
+func (r *UploadRule) Validate() error {
+	if r.IntervalInDays == 0 {
 		return fmt.Errorf("interval in days is required")
 	}
-	if p.IntervalInDays > db.StoreMaxDays {
+	if r.IntervalInDays > db.StoreMaxDays {
 		return fmt.Errorf("interval in days should be less than 30")
 	}
-	if p.UploadAtLeastInMB == 0 {
+	if r.UploadAtLeastInMB == 0 {
 		return fmt.Errorf("upload at least in MB is required")
 	}
 	return nil
 }
 
+// SeedingPolicy stops seeding torrents. Torrents seed until both the min
+// ratio and the min seed time are reached, e.g. for H&R rules of private
+// trackers, then they are stopped by the max seed time or any upload rule not
+// met.
+type SeedingPolicy struct {
+	// The upload rule inline, see UploadRule.
+	IntervalInDays    int   `yaml:"interval_in_days"`
+	UploadAtLeastInMB int64 `yaml:"upload_at_least_in_mb"`
+	// UploadRules in addition to the inline one, e.g. for different windows.
+	UploadRules []UploadRule `yaml:"upload_rules"`
+
+	MinRatio           float64 `yaml:"min_ratio"`
+	MinSeedTimeInHours int     `yaml:"min_seed_time_in_hours"`
+	MaxSeedTimeInHours int     `yaml:"max_seed_time_in_hours"`
+
+	// Indexers overrides the whole policy for torrents of the indexer.
+	Indexers map[string]*SeedingPolicy `yaml:"indexers"`
+}
+
+// AllUploadRules returns the inline upload rule if set and UploadRules.
+func (p *SeedingPolicy) AllUploadRules() []UploadRule {
+	rules := []UploadRule{}
+	if p.IntervalInDays != 0 || p.UploadAtLeastInMB != 0 {
+		rules = append(rules, UploadRule{IntervalInDays: p.IntervalInDays, UploadAtLeastInMB: p.UploadAtLeastInMB})
+	}
+	return append(rules, p.UploadRules...)
+}
+
+// ForIndexer returns the policy for torrents of the indexer.
+func (p *SeedingPolicy) ForIndexer(indexer string) *SeedingPolicy {
+	if o, ok := p.Indexers[indexer]; ok {
+		return o
+	}
+	return p
+}
+
+func (p *SeedingPolicy) Validate() error {
+	rules := p.AllUploadRules()
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	if p.MinRatio < 0 {
+		return fmt.Errorf("min ratio should not be negative")
+	}
+	if p.MinSeedTimeInHours < 0 || p.MaxSeedTimeInHours < 0 {
+		return fmt.Errorf("seed time should not be negative")
+	}
+	if p.MaxSeedTimeInHours != 0 && p.MaxSeedTimeInHours < p.MinSeedTimeInHours {
+		return fmt.Errorf("max seed time should not be less than min seed time")
+	}
+	if len(rules) == 0 && p.MaxSeedTimeInHours == 0 {
+		return fmt.Errorf("upload rule or max seed time is required")
+	}
+
+	for indexer, o := range p.Indexers {
+		if o == nil {
+			return fmt.Errorf("seeding policy of indexer %s is empty", indexer)
+		}
+		if len(o.Indexers) > 0 {
+			return fmt.Errorf("seeding policy of indexer %s can not override indexers", indexer)
+		}
+		if err := o.Validate(); err != nil {
+			return fmt.Errorf("seeding policy of indexer %s: %w", indexer, err)
+		}
+	}
+	return nil
+}
+
+// Eviction policies of DiskSpacePolicy.
+const (
+	EvictNone    = "none"
+	EvictStopped = "stopped"
+	EvictSeeding = "seeding"
+)
+
+// DiskSpacePolicy keeps at least the free space in GB in the download dir and
+// the finished dir, 0 disables the check of the dir.
+type DiskSpacePolicy struct {
+	DownloadDirMinFreeInGB uint64 `yaml:"download_dir_min_free_in_gb"`
+	FinishedDirMinFreeInGB uint64 `yaml:"finished_dir_min_free_in_gb"`
+	// Queue new downloads until there is enough space instead of refusing them.
+	Queue bool `yaml:"queue"`
+	// Evict moved torrents to free the download dir: none, stopped, or seeding
+	// which also evicts stopped torrents. Default none.
+	Evict string `yaml:"evict"`
+}
+
+func (p *DiskSpacePolicy) Validate() error {
+	if p.DownloadDirMinFreeInGB == 0 && p.FinishedDirMinFreeInGB == 0 {
+		return fmt.Errorf("min free space of download dir or finished dir is required")
+	}
+	switch p.Evict {
+	case "", EvictNone, EvictStopped, EvictSeeding:
+	default:
+		return fmt.Errorf("unknown evict policy: %s", p.Evict)
+	}
+	return nil
+}
+
+// Busy policies of ProgressCheckPolicy.
+const (
+	BusySpeed = "speed"
+	BusyNever = "never"
+)
+
+// ProgressCheckPolicy schedules the progress check, which updates progress
+// and transfers finished downloads.
+type ProgressCheckPolicy struct {
+	// IntervalInMinutes between checks, default 5.
+	IntervalInMinutes uint `yaml:"interval_in_minutes"`
+	// Busy postpones transfers while the client is busy: speed, downloading
+	// faster than BusySpeedInMB per second, or never. Default speed.
+	Busy string `yaml:"busy"`
+	// BusySpeedInMB per second, default 2.
+	BusySpeedInMB float64 `yaml:"busy_speed_in_mb"`
+}
+
+func (p *ProgressCheckPolicy) Validate() error {
+	if p.BusySpeedInMB < 0 {
+		return fmt.Errorf("busy speed should not be negative")
+	}
+	switch p.Busy {
+	case "", BusySpeed, BusyNever:
+	default:
+		return fmt.Errorf("unknown busy policy: %s", p.Busy)
+	}
+	return nil
+}
+
 type DownloaderConfig struct {
 	Transmission  *TransmissionConfig `yaml:"transmission"`
+	QBittorrent   *QBittorrentConfig  `yaml:"qbittorrent"`
+	Embedded      *EmbeddedConfig     `yaml:"embedded"`
 	SeedingPolicy *SeedingPolicy      `yaml:"seeding_policy"`
+	// TransferMode of finished files to the finished dir, default copy. The
+	// move mode waits until seeding is stopped.
+	TransferMode db.TransferMode `yaml:"transfer_mode"`
+	// VerifyTransfer checks copied files against the piece hashes of the
+	// torrent, if the client can export the metainfo.
+	VerifyTransfer bool                 `yaml:"verify_transfer"`
+	DiskSpace      *DiskSpacePolicy     `yaml:"disk_space"`
+	ProgressCheck  *ProgressCheckPolicy `yaml:"progress_check"`
 }
 
 func (c *DownloaderConfig) Validate() error {
-	if c.Transmission == nil {
-		return fmt.Errorf("transmission config is required")
+	configured := 0
+	for _, set := range []bool{c.Transmission != nil, c.QBittorrent != nil, c.Embedded != nil} {
+		if set {
+			configured++
+		}
 	}
-	if err := c.Transmission.Validate(); err != nil {
-		return err
+	if configured == 0 {
+		return fmt.Errorf("transmission, qbittorrent or embedded config is required")
+	}
+	if configured > 1 {
+		return fmt.Errorf("only one of transmission, qbittorrent or embedded config is allowed")
+	}
+
+	switch {
+	case c.Transmission != nil:
+		if err := c.Transmission.Validate(); err != nil {
+			return err
+		}
+	case c.QBittorrent != nil:
+		if err := c.QBittorrent.Validate(); err != nil {
+			return err
+		}
+	case c.Embedded != nil:
+		if err := c.Embedded.Validate(); err != nil {
+			return err
+		}
 	}
 	if c.SeedingPolicy != nil {
 		if err := c.SeedingPolicy.Validate(); err != nil {
 			return err
 		}
 	}
+	if c.DiskSpace != nil {
+		if err := c.DiskSpace.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.ProgressCheck != nil {
+		if err := c.ProgressCheck.Validate(); err != nil {
+			return err
+		}
+	}
+	switch c.TransferMode {
+	case "", db.TransferCopy, db.TransferHardlink, db.TransferReflink, db.TransferSymlink, db.TransferMove:
+	default:
+		return fmt.Errorf("unknown transfer mode: %s", c.TransferMode)
+	}
 	return nil
 }
+
+// TorrentsDir returns the torrents directory of the configured downloader.
+func (c *DownloaderConfig) TorrentsDir() string {
+	switch {
+	case c.QBittorrent != nil:
+		return c.QBittorrent.TorrentsDir
+	case c.Embedded != nil:
+		return c.Embedded.TorrentsDir
+	}
+	return c.Transmission.TorrentsDir
+}
+
+// CheckInterval returns the interval of the progress check.
+func (c *DownloaderConfig) CheckInterval() time.Duration {
+	if c.ProgressCheck == nil || c.ProgressCheck.IntervalInMinutes == 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.ProgressCheck.IntervalInMinutes) * time.Minute
+}
+
+// Busy returns true if transfers should be postponed at the download speed
+// in bytes per second.
+func (c *DownloaderConfig) Busy(speed int64) bool {
+	p := c.ProgressCheck
+	if p == nil {
+		p = &ProgressCheckPolicy{}
+	}
+	if p.Busy == BusyNever {
+		return false
+	}
+	busySpeed := p.BusySpeedInMB
+	if busySpeed == 0 {
+		busySpeed = 2
+	}
+	return float64(speed) > busySpeed*1000*1000
+}
+
+// DownloadDir returns the download directory of the configured downloader.
+func (c *DownloaderConfig) DownloadDir() string {
+	switch {
+	case c.QBittorrent != nil:
+		return c.QBittorrent.DownloadDir
+	case c.Embedded != nil:
+		return c.Embedded.DownloadDir
+	}
+	return c.Transmission.DownloadDir
+}
+
+// FinishedDir returns the directory finished downloads are copied to.
+func (c *DownloaderConfig) FinishedDir() string {
+	switch {
+	case c.QBittorrent != nil:
+		return c.QBittorrent.FinishedDir
+	case c.Embedded != nil:
+		return c.Embedded.FinishedDir
+	}
+	return c.Transmission.FinishedDir
+}
@@ -0,0 +1,14 @@
+//go:build embedded
+
+package downloaders
+
+import (
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/downloaders/embedded"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"gorm.io/gorm"
+)
+
+func newEmbedded(name string, cfg *config.DownloaderConfig, db *gorm.DB, notifier events.IEventNotifier) (IDownloader, error) {
+	return embedded.New(name, cfg, db, notifier)
+}
@@ -0,0 +1,397 @@
+//go:build embedded
+
+// Package embedded runs an in-process anacrolix/torrent client, so AutoGet
+// can download without an external torrent client.
+//
+// The client pulls in webrtc, utp and other heavy dependencies, so it is
+// only compiled with `go build -tags embedded`.
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	_ lifecycle.TorrentClient  = (*Client)(nil)
+	_ lifecycle.MetaInfoClient = (*Client)(nil)
+
+	logger = log.With().Str("component", "embedded").Logger()
+)
+
+type Client struct {
+	*lifecycle.Manager
+
+	name string
+	cfg  *config.EmbeddedConfig
+	db   *gorm.DB
+
+	client  *torrent.Client
+	storage storage.ClientImplCloser
+
+	mu sync.Mutex
+	// torrent files added from TorrentsDir, by hash.
+	torrentFiles map[string]string
+	// torrents stopped by the seeding policy.
+	stopped map[string]bool
+	// uploaded bytes before this process started, the client only counts
+	// bytes uploaded by itself.
+	uploadedBefore map[string]int64
+	// time torrents completed, the client does not track the seeding time.
+	seedingSince map[string]time.Time
+
+	lastRead     int64
+	lastReadTime time.Time
+}
+
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, notifier events.IEventNotifier) (*Client, error) {
+	if err := os.MkdirAll(cfg.Embedded.DownloadDir, 0755); err != nil {
+		return nil, err
+	}
+
+	st := storage.NewFile(cfg.Embedded.DownloadDir)
+
+	clientCfg := torrent.NewDefaultClientConfig()
+	clientCfg.DataDir = cfg.Embedded.DownloadDir
+	clientCfg.DefaultStorage = st
+	clientCfg.Seed = true
+	if cfg.Embedded.ListenPort != 0 {
+		clientCfg.ListenPort = cfg.Embedded.ListenPort
+	}
+
+	tc, err := torrent.NewClient(clientCfg)
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		name:           name,
+		cfg:            cfg.Embedded,
+		db:             db,
+		client:         tc,
+		storage:        st,
+		torrentFiles:   map[string]string{},
+		stopped:        map[string]bool{},
+		uploadedBefore: map[string]int64{},
+		seedingSince:   map[string]time.Time{},
+		lastReadTime:   time.Now(),
+	}
+	c.Manager = lifecycle.NewManager(name, cfg, db, c, notifier)
+
+	c.scanTorrentsDir()
+
+	return c, nil
+}
+
+func (c *Client) RegisterCronjobs(cron *cron.Cron) {
+	cron.AddFunc("@every 10s", c.scanTorrentsDir)
+
+	c.Manager.RegisterCronjobs(cron)
+}
+
+// scanTorrentsDir adds .torrent files in TorrentsDir which are not known yet.
+func (c *Client) scanTorrentsDir() {
+	entries, err := os.ReadDir(c.cfg.TorrentsDir)
+	if err != nil {
+		logger.Error().Err(err).Str("name", c.name).Msg("failed to read torrents dir")
+		return
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".torrent") {
+			continue
+		}
+
+		p := filepath.Join(c.cfg.TorrentsDir, e.Name())
+		if err := c.addTorrentFile(p); err != nil {
+			logger.Error().Err(err).Str("name", c.name).Str("file", p).Msg("failed to add torrent")
+		}
+	}
+}
+
+func (c *Client) addTorrentFile(p string) error {
+	mi, err := metainfo.LoadFromFile(p)
+	if err != nil {
+		return err
+	}
+
+	hash := mi.HashInfoBytes().HexString()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.torrentFiles[hash]; ok {
+		return nil
+	}
+
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return err
+	}
+
+	// continue from the state recorded in db, torrents stopped by the seeding
+	// policy stay stopped after restart.
+	s, err := db.GetDownloadStatus(c.db, hash)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil {
+		if s.State == db.DownloadDeleted {
+			return nil
+		}
+		if s.State == db.DownloadStopped {
+			c.stopped[hash] = true
+			spec.DisallowDataDownload = true
+			spec.DisallowDataUpload = true
+		}
+		c.uploadedBefore[hash] = latestUploaded(s.UploadHistories)
+		if s.SeedingSince != nil {
+			c.seedingSince[hash] = *s.SeedingSince
+		}
+	}
+
+	t, _, err := c.client.AddTorrentSpec(spec)
+	if err != nil {
+		return err
+	}
+	c.torrentFiles[hash] = p
+
+	go func() {
+		<-t.GotInfo()
+		t.DownloadAll()
+	}()
+
+	return nil
+}
+
+// AddMetaInfo adds the torrent through TorrentsDir, so it is loaded again on
+// restart. All torrents share the storage in DownloadDir, the per torrent
+// download dir and labels are not supported.
+func (c *Client) AddMetaInfo(ctx context.Context, t *lifecycle.NewTorrent) error {
+	p := t.FilePath
+	if p == "" || filepath.Dir(p) != filepath.Clean(c.cfg.TorrentsDir) {
+		mi, err := metainfo.Load(bytes.NewReader(t.MetaInfo))
+		if err != nil {
+			return err
+		}
+		p = filepath.Join(c.cfg.TorrentsDir, mi.HashInfoBytes().HexString()+".torrent")
+		if err := os.WriteFile(p, t.MetaInfo, 0644); err != nil {
+			return err
+		}
+	}
+
+	return c.addTorrentFile(p)
+}
+
+func latestUploaded(histories map[string]int64) int64 {
+	latest := ""
+	for k := range histories {
+		if k > latest {
+			latest = k
+		}
+	}
+	return histories[latest]
+}
+
+func (c *Client) torrentByHash(hash string) (*torrent.Torrent, bool) {
+	var h metainfo.Hash
+	if err := h.FromHexString(hash); err != nil {
+		return nil, false
+	}
+	return c.client.Torrent(h)
+}
+
+func (c *Client) Torrents(ctx context.Context) ([]*lifecycle.Torrent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := []*lifecycle.Torrent{}
+	for _, t := range c.client.Torrents() {
+		hash := t.InfoHash().HexString()
+
+		lt := &lifecycle.Torrent{
+			Hash:        hash,
+			Name:        t.Name(),
+			DownloadDir: c.cfg.DownloadDir,
+		}
+
+		if t.Info() != nil {
+			if t.Length() > 0 {
+				lt.PercentDone = float64(t.BytesCompleted()) / float64(t.Length())
+			}
+			lt.Seeding = t.BytesMissing() == 0 && !c.stopped[hash]
+
+			if t.BytesMissing() == 0 {
+				since, ok := c.seedingSince[hash]
+				if !ok {
+					since = time.Now()
+					c.seedingSince[hash] = since
+				}
+				lt.SeedingTime = time.Since(since)
+			}
+		}
+
+		stats := t.Stats()
+		lt.UploadedEver = c.uploadedBefore[hash] + stats.BytesWrittenData.Int64()
+		if t.Info() != nil && t.Length() > 0 {
+			lt.Ratio = float64(lt.UploadedEver) / float64(t.Length())
+		}
+
+		res = append(res, lt)
+	}
+
+	return res, nil
+}
+
+func (c *Client) Files(ctx context.Context, lt *lifecycle.Torrent) ([]lifecycle.File, error) {
+	t, ok := c.torrentByHash(lt.Hash)
+	if !ok || t.Info() == nil {
+		return nil, nil
+	}
+
+	files := []lifecycle.File{}
+	for _, f := range t.Files() {
+		files = append(files, lifecycle.File{Name: f.Path(), Length: f.Length()})
+	}
+	return files, nil
+}
+
+func (c *Client) MetaInfo(ctx context.Context, lt *lifecycle.Torrent) ([]byte, error) {
+	t, ok := c.torrentByHash(lt.Hash)
+	if !ok || t.Info() == nil {
+		return nil, lifecycle.ErrTorrentNotFound
+	}
+
+	mi := t.Metainfo()
+	buf := &bytes.Buffer{}
+	if err := mi.Write(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.client.Stats()
+	read := stats.BytesReadUsefulData.Int64()
+	now := time.Now()
+
+	elapsed := now.Sub(c.lastReadTime).Seconds()
+	speed := int64(0)
+	if elapsed > 0 {
+		speed = int64(float64(read-c.lastRead) / elapsed)
+	}
+
+	c.lastRead = read
+	c.lastReadTime = now
+	return speed, nil
+}
+
+func (c *Client) StartTorrents(ctx context.Context, torrents []*lifecycle.Torrent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, lt := range torrents {
+		t, ok := c.torrentByHash(lt.Hash)
+		if !ok {
+			continue
+		}
+		t.AllowDataUpload()
+		t.AllowDataDownload()
+		delete(c.stopped, lt.Hash)
+	}
+	return nil
+}
+
+func (c *Client) StopTorrents(ctx context.Context, torrents []*lifecycle.Torrent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, lt := range torrents {
+		t, ok := c.torrentByHash(lt.Hash)
+		if !ok {
+			continue
+		}
+		t.DisallowDataUpload()
+		t.DisallowDataDownload()
+		c.stopped[lt.Hash] = true
+	}
+	return nil
+}
+
+func (c *Client) RemoveTorrents(ctx context.Context, torrents []*lifecycle.Torrent, deleteData bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, lt := range torrents {
+		t, ok := c.torrentByHash(lt.Hash)
+		if !ok {
+			continue
+		}
+
+		var files []string
+		isDir := false
+		if info := t.Info(); info != nil {
+			isDir = info.IsDir()
+			for _, f := range t.Files() {
+				files = append(files, filepath.Join(c.cfg.DownloadDir, f.Path()))
+			}
+		}
+
+		t.Drop()
+
+		// remove the torrent file, otherwise it is added back by the next scan.
+		if p, ok := c.torrentFiles[lt.Hash]; ok {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+		delete(c.torrentFiles, lt.Hash)
+		delete(c.stopped, lt.Hash)
+		delete(c.uploadedBefore, lt.Hash)
+		delete(c.seedingSince, lt.Hash)
+
+		if !deleteData {
+			continue
+		}
+		for _, f := range files {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+		if isDir {
+			// multi-file torrents are stored in a directory named after the torrent.
+			if err := os.RemoveAll(filepath.Join(c.cfg.DownloadDir, t.Name())); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Client) Close() {
+	c.client.Close()
+	c.storage.Close()
+}
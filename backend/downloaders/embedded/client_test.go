@@ -0,0 +1,256 @@
+//go:build embedded
+
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// freePort which is free for both TCP and UDP on all interfaces, the client
+// listens on both with the same port.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	for {
+		l, err := net.Listen("tcp", ":0")
+		require.NoError(t, err)
+		port := l.Addr().(*net.TCPAddr).Port
+		pc, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+		l.Close()
+		if err == nil {
+			pc.Close()
+			return port
+		}
+	}
+}
+
+func setup(t *testing.T) (*Client, *config.EmbeddedConfig, *gorm.DB) {
+	t.Helper()
+
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	conf := &config.DownloaderConfig{
+		Embedded: &config.EmbeddedConfig{
+			TorrentsDir: t.TempDir(),
+			DownloadDir: t.TempDir(),
+			FinishedDir: t.TempDir(),
+			ListenPort:  freePort(t),
+		},
+	}
+
+	c, err := New("test", conf, d, nil)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c, conf.Embedded, d
+}
+
+// testMetaInfo of a tracker-less torrent with a single file of data, the data
+// is written to downloadDir if set, so the torrent is complete.
+func testMetaInfo(t *testing.T, name string, data []byte, downloadDir string) ([]byte, string) {
+	t.Helper()
+
+	p := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(p, data, 0644))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(t, info.BuildFromFilePath(p))
+
+	mi := &metainfo.MetaInfo{}
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, mi.Write(buf))
+
+	if downloadDir != "" {
+		require.NoError(t, os.WriteFile(filepath.Join(downloadDir, name), data, 0644))
+	}
+	return buf.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+func findTorrent(t *testing.T, c *Client, hash string) *lifecycle.Torrent {
+	t.Helper()
+
+	torrents, err := c.Torrents(context.Background())
+	require.NoError(t, err)
+	for _, lt := range torrents {
+		if lt.Hash == hash {
+			return lt
+		}
+	}
+	return nil
+}
+
+func mustHash(t *testing.T, b []byte) string {
+	t.Helper()
+
+	mi, err := metainfo.Load(bytes.NewReader(b))
+	require.NoError(t, err)
+	return mi.HashInfoBytes().HexString()
+}
+
+func TestAddTorrent(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		c, cfg, _ := setup(t)
+		mi, hash := testMetaInfo(t, "show.mkv", []byte("episode data"), cfg.DownloadDir)
+
+		res, err := c.AddTorrent(&lifecycle.NewTorrent{MetaInfo: mi, Title: "Show"})
+		require.NoError(t, err)
+		assert.Equal(t, hash, res.Hash)
+		assert.False(t, res.Queued)
+
+		// kept in TorrentsDir to be loaded again on restart.
+		assert.FileExists(t, filepath.Join(cfg.TorrentsDir, hash+".torrent"))
+
+		lt := findTorrent(t, c, hash)
+		require.NotNil(t, lt)
+		assert.Equal(t, cfg.DownloadDir, lt.DownloadDir)
+
+		files, err := c.Files(context.Background(), lt)
+		require.NoError(t, err)
+		assert.Equal(t, []lifecycle.File{{Name: "show.mkv", Length: 12}}, files)
+
+		// the data in DownloadDir completes the torrent.
+		assert.Eventually(t, func() bool {
+			lt := findTorrent(t, c, hash)
+			return lt.PercentDone == 1 && lt.Seeding
+		}, 10*time.Second, 50*time.Millisecond)
+
+		got, err := c.MetaInfo(context.Background(), lt)
+		require.NoError(t, err)
+		assert.Equal(t, hash, mustHash(t, got))
+	})
+
+	t.Run("added twice", func(t *testing.T) {
+		c, cfg, _ := setup(t)
+		mi, hash := testMetaInfo(t, "show.mkv", []byte("episode data"), "")
+
+		_, err := c.AddTorrent(&lifecycle.NewTorrent{MetaInfo: mi})
+		require.NoError(t, err)
+		_, err = c.AddTorrent(&lifecycle.NewTorrent{MetaInfo: mi})
+		require.NoError(t, err)
+
+		torrents, err := c.Torrents(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, torrents, 1)
+		assert.Equal(t, hash, torrents[0].Hash)
+
+		entries, err := os.ReadDir(cfg.TorrentsDir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("invalid metainfo", func(t *testing.T) {
+		c, _, _ := setup(t)
+
+		_, err := c.AddTorrent(&lifecycle.NewTorrent{MetaInfo: []byte("invalid")})
+		assert.ErrorContains(t, err, "invalid metainfo")
+	})
+}
+
+func TestScanTorrentsDir(t *testing.T) {
+	c, cfg, d := setup(t)
+
+	newMI, newHash := testMetaInfo(t, "new.mkv", []byte("new"), "")
+	stoppedMI, stoppedHash := testMetaInfo(t, "stopped.mkv", []byte("stopped"), cfg.DownloadDir)
+	deletedMI, deletedHash := testMetaInfo(t, "deleted.mkv", []byte("deleted"), "")
+	for name, mi := range map[string][]byte{"new.torrent": newMI, "stopped.torrent": stoppedMI, "deleted.torrent": deletedMI, "other.txt": newMI} {
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.TorrentsDir, name), mi, 0644))
+	}
+
+	// state recorded before restart.
+	seedingSince := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:              stoppedHash,
+		Downloader:      "test",
+		State:           db.DownloadStopped,
+		UploadHistories: map[string]int64{"2025-06-04": 10, "2025-06-05": 14},
+		SeedingSince:    &seedingSince,
+	}).Error)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: deletedHash, Downloader: "test", State: db.DownloadDeleted}).Error)
+
+	c.scanTorrentsDir()
+	// scanned again.
+	c.scanTorrentsDir()
+
+	torrents, err := c.Torrents(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, torrents, 2)
+	assert.NotNil(t, findTorrent(t, c, newHash))
+	assert.Nil(t, findTorrent(t, c, deletedHash))
+
+	// stopped torrents stay stopped, the ratio counts uploads before restart.
+	stopped := findTorrent(t, c, stoppedHash)
+	require.NotNil(t, stopped)
+	assert.Equal(t, int64(14), stopped.UploadedEver)
+	assert.Equal(t, float64(2), stopped.Ratio)
+	assert.Eventually(t, func() bool {
+		return findTorrent(t, c, stoppedHash).PercentDone == 1
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.False(t, findTorrent(t, c, stoppedHash).Seeding)
+
+	// the seeding time continues from the time completed before restart.
+	assert.GreaterOrEqual(t, findTorrent(t, c, stoppedHash).SeedingTime, 2*time.Hour)
+	assert.Zero(t, findTorrent(t, c, newHash).SeedingTime)
+}
+
+func TestStopAndRemoveTorrents(t *testing.T) {
+	c, cfg, _ := setup(t)
+	ctx := context.Background()
+
+	mi, hash := testMetaInfo(t, "show.mkv", []byte("episode data"), cfg.DownloadDir)
+	_, err := c.AddTorrent(&lifecycle.NewTorrent{MetaInfo: mi})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return findTorrent(t, c, hash).Seeding
+	}, 10*time.Second, 50*time.Millisecond)
+
+	lt := findTorrent(t, c, hash)
+
+	require.NoError(t, c.StopTorrents(ctx, []*lifecycle.Torrent{lt}))
+	assert.False(t, findTorrent(t, c, hash).Seeding)
+
+	require.NoError(t, c.StartTorrents(ctx, []*lifecycle.Torrent{lt}))
+	assert.True(t, findTorrent(t, c, hash).Seeding)
+
+	t.Run("keep data", func(t *testing.T) {
+		require.NoError(t, c.RemoveTorrents(ctx, []*lifecycle.Torrent{lt}, false))
+
+		assert.Nil(t, findTorrent(t, c, hash))
+		assert.NoFileExists(t, filepath.Join(cfg.TorrentsDir, hash+".torrent"))
+		assert.FileExists(t, filepath.Join(cfg.DownloadDir, "show.mkv"))
+
+		// not added back by the next scan.
+		c.scanTorrentsDir()
+		assert.Nil(t, findTorrent(t, c, hash))
+	})
+
+	t.Run("delete data", func(t *testing.T) {
+		_, err := c.AddTorrent(&lifecycle.NewTorrent{MetaInfo: mi})
+		require.NoError(t, err)
+		lt := findTorrent(t, c, hash)
+		require.NotNil(t, lt)
+
+		require.NoError(t, c.RemoveTorrents(ctx, []*lifecycle.Torrent{lt}, true))
+
+		assert.Nil(t, findTorrent(t, c, hash))
+		assert.NoFileExists(t, filepath.Join(cfg.DownloadDir, "show.mkv"))
+	})
+}
@@ -0,0 +1,15 @@
+//go:build !embedded
+
+package downloaders
+
+import (
+	"fmt"
+
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"gorm.io/gorm"
+)
+
+func newEmbedded(name string, cfg *config.DownloaderConfig, db *gorm.DB, notifier events.IEventNotifier) (IDownloader, error) {
+	return nil, fmt.Errorf("downloader %s: embedded downloader is not compiled in, build with -tags embedded", name)
+}
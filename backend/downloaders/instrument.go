@@ -0,0 +1,51 @@
+package downloaders
+
+import (
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+)
+
+var _ IDownloader = (*instrumented)(nil)
+
+// instrumented records request metrics of the downloader.
+type instrumented struct {
+	IDownloader
+	name string
+}
+
+// Instrument wraps the downloader to record request count and errors. The
+// background jobs of the downloader are recorded in lifecycle/metrics.go.
+func Instrument(name string, d IDownloader) IDownloader {
+	return &instrumented{IDownloader: d, name: name}
+}
+
+func (d *instrumented) AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error) {
+	res, err := d.IDownloader.AddTorrent(t)
+	metrics.ObserveDownloader(d.name, "add", err)
+	return res, err
+}
+
+func (d *instrumented) PauseTorrent(s *db.DownloadStatus) error {
+	err := d.IDownloader.PauseTorrent(s)
+	metrics.ObserveDownloader(d.name, "pause", err)
+	return err
+}
+
+func (d *instrumented) ResumeTorrent(s *db.DownloadStatus) error {
+	err := d.IDownloader.ResumeTorrent(s)
+	metrics.ObserveDownloader(d.name, "resume", err)
+	return err
+}
+
+func (d *instrumented) StopTorrent(s *db.DownloadStatus) error {
+	err := d.IDownloader.StopTorrent(s)
+	metrics.ObserveDownloader(d.name, "stop", err)
+	return err
+}
+
+func (d *instrumented) DeleteTorrent(s *db.DownloadStatus, deleteData bool) error {
+	err := d.IDownloader.DeleteTorrent(s, deleteData)
+	metrics.ObserveDownloader(d.name, "delete", err)
+	return err
+}
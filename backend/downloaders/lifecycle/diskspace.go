@@ -0,0 +1,279 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+)
+
+const gb = 1024 * 1024 * 1024
+
+func formatGB(b uint64) string {
+	return fmt.Sprintf("%.1f GB", float64(b)/gb)
+}
+
+// spaceBelow returns the free space of dir and whether it is below
+// minFreeInGB after using need bytes. It is never below if the check is
+// disabled or the free space is unknown.
+func spaceBelow(dir string, minFreeInGB, need uint64) (uint64, bool) {
+	if minFreeInGB == 0 {
+		return 0, false
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		logger.Warn().Err(err).Str("dir", dir).Msg("failed to get free space")
+		return 0, false
+	}
+	return free, free < need || free-need < minFreeInGB*gb
+}
+
+// checkDir returns the free space of dir and whether it is below the
+// threshold, crossing the threshold is notified once.
+func (m *Manager) checkDir(dir string, minFreeInGB uint64) (uint64, bool) {
+	free, low := spaceBelow(dir, minFreeInGB, 0)
+
+	m.lowSpaceMu.Lock()
+	changed := m.lowSpace[dir] != low
+	m.lowSpace[dir] = low
+	m.lowSpaceMu.Unlock()
+
+	if changed {
+		typ := events.DiskSpaceRecovered
+		if low {
+			typ = events.LowDiskSpace
+			logger.Warn().Str("name", m.name).Str("dir", dir).Uint64("free", free).Msg("low disk space")
+		}
+		if m.events != nil {
+			m.events.Notify(&events.Event{Type: typ, Downloader: m.name, Dir: dir, Free: formatGB(free)})
+		}
+	}
+	return free, low
+}
+
+// CheckDiskSpace checks the dirs of the disk space policy. Torrents are
+// evicted if the download dir is low, queued torrents are started otherwise.
+func (m *Manager) CheckDiskSpace() {
+	p := m.cfg.DiskSpace
+	if p == nil {
+		return
+	}
+
+	m.checkDir(m.cfg.FinishedDir(), p.FinishedDirMinFreeInGB)
+
+	free, low := m.checkDir(m.cfg.DownloadDir(), p.DownloadDirMinFreeInGB)
+	if !low {
+		m.startQueuedTorrents()
+		return
+	}
+	m.evictTorrents(p.DownloadDirMinFreeInGB*gb - free)
+}
+
+// freesSpace returns true if deleting the data of the torrent frees space,
+// files linked, cloned or moved to the finished dir share or keep the data.
+func freesSpace(mode db.TransferMode) bool {
+	return mode == "" || mode == db.TransferCopy
+}
+
+// evictTorrents removes moved torrents with their data until need bytes are
+// freed, stopped and least recently updated torrents first. Torrents below the
+// minimums of the seeding policy are kept.
+func (m *Manager) evictTorrents(need uint64) {
+	var states []db.DownloadState
+	switch m.cfg.DiskSpace.Evict {
+	case config.EvictStopped:
+		states = []db.DownloadState{db.DownloadStopped}
+	case config.EvictSeeding:
+		states = []db.DownloadState{db.DownloadSeeding, db.DownloadStopped}
+	default:
+		return
+	}
+
+	torrents, err := m.client.Torrents(context.Background())
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to get all torrents")
+		return
+	}
+	torrentsByHash := toTorrentsByHash(torrents)
+
+	statuses, err := db.GetEvictableDownloadStatusByDownloader(m.db, m.name, states)
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to get evictable download status")
+		return
+	}
+
+	evict := []*db.DownloadStatus{}
+	freed := uint64(0)
+	for _, s := range statuses {
+		if freed >= need {
+			break
+		}
+		t, ok := torrentsByHash[s.ID]
+		if !ok || !freesSpace(s.TransferMode) {
+			continue
+		}
+		// keep torrents below the seeding minimums, e.g. for hit and run rules.
+		if p := m.cfg.SeedingPolicy; p != nil && !minimumsReached(p.ForIndexer(s.ResIndexer), t) {
+			continue
+		}
+
+		files, err := m.client.Files(context.Background(), t)
+		if err != nil {
+			logger.Error().Err(err).Str("name", m.name).Msg("failed to get torrent files")
+			continue
+		}
+		for _, f := range files {
+			freed += uint64(f.Length)
+		}
+		evict = append(evict, &s)
+	}
+
+	if freed < need {
+		logger.Warn().Str("name", m.name).Uint64("need", need).Uint64("freed", freed).Msg("not enough torrents to evict")
+	}
+	m.removeTorrentsOf(torrentsByHash, evict, true, metrics.ActionEvict)
+}
+
+// queueTorrent until the download dir has enough space.
+func (m *Manager) queueTorrent(t *NewTorrent) error {
+	q := &db.QueuedTorrent{
+		Downloader:  m.name,
+		MetaInfo:    t.MetaInfo,
+		DownloadDir: t.DownloadDir,
+		Labels:      t.Labels,
+		Title:       t.Title,
+	}
+	if err := db.AddQueuedTorrent(m.db, q); err != nil {
+		return fmt.Errorf("downloader %s: failed to queue torrent: %w", m.name, err)
+	}
+	logger.Info().Str("name", m.name).Str("title", t.Title).Msg("torrent queued for disk space")
+	return nil
+}
+
+// maxQueuedAttempts to start a queued torrent before it is dropped.
+const maxQueuedAttempts = 3
+
+// fits returns true if the download dir stays above the threshold after
+// using need bytes, crossing the threshold is notified once.
+func (m *Manager) fits(dir string, need uint64) bool {
+	minFree := m.cfg.DiskSpace.DownloadDirMinFreeInGB
+	if _, low := m.checkDir(dir, minFree); low {
+		return false
+	}
+	_, low := spaceBelow(dir, minFree, need)
+	return !low
+}
+
+// startQueuedTorrents in order while the download dir has space for them, the
+// space of torrents started in the pass is reserved as the client has not
+// allocated it yet. Torrents failed to start are retried in next check and
+// dropped after maxQueuedAttempts, torrents of deleted downloads are dropped.
+func (m *Manager) startQueuedTorrents() {
+	queued, err := db.GetQueuedTorrentsByDownloader(m.db, m.name)
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to get queued torrents")
+		return
+	}
+
+	started := map[string]uint64{}
+	for _, q := range queued {
+		hash, size, err := parseMetaInfo(q.MetaInfo)
+		if err != nil {
+			m.queuedFailed(q, "", fmt.Errorf("invalid metainfo: %w", err))
+			continue
+		}
+
+		indexer := ""
+		if s, err := db.GetDownloadStatus(m.db, hash); err == nil {
+			if s.State == db.DownloadDeleted {
+				m.deleteQueued(q)
+				continue
+			}
+			indexer = s.ResIndexer
+		}
+
+		if !m.fits(q.DownloadDir, started[q.DownloadDir]+uint64(size)) {
+			return
+		}
+
+		err = m.startTorrent(&NewTorrent{
+			MetaInfo:    q.MetaInfo,
+			DownloadDir: q.DownloadDir,
+			Labels:      q.Labels,
+			Title:       q.Title,
+			Indexer:     indexer,
+		}, hash)
+		if err != nil {
+			m.queuedFailed(q, hash, err)
+			continue
+		}
+		started[q.DownloadDir] += uint64(size)
+
+		m.deleteQueued(q)
+		m.updateQueuedStatus(hash, db.DownloadStarted)
+	}
+}
+
+func (m *Manager) deleteQueued(q *db.QueuedTorrent) {
+	if err := db.DeleteQueuedTorrent(m.db, q.ID); err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to delete queued torrent")
+	}
+}
+
+// updateQueuedStatus updates the state of the status of the queued torrent,
+// torrents queued without a status are ignored.
+func (m *Manager) updateQueuedStatus(hash string, state db.DownloadState) {
+	s, err := db.GetDownloadStatus(m.db, hash)
+	if err != nil || s.State != db.DownloadQueued {
+		return
+	}
+	s.State = state
+	if err := db.SaveDownloadStatus(m.db, s); err != nil {
+		logger.Error().Err(err).Str("name", m.name).Str("hash", hash).Msg("failed to update download status")
+	}
+}
+
+// queuedFailed records the failed attempt, the torrent is dropped and notified
+// once it reaches maxQueuedAttempts. Subscription episodes of a dropped torrent
+// are fetched again.
+func (m *Manager) queuedFailed(q *db.QueuedTorrent, hash string, err error) {
+	logger.Error().Err(err).Str("name", m.name).Str("title", q.Title).Msg("failed to start queued torrent")
+
+	if dbErr := db.IncQueuedTorrentAttempts(m.db, q); dbErr != nil {
+		logger.Error().Err(dbErr).Str("name", m.name).Msg("failed to update queued torrent")
+		return
+	}
+	if q.Attempts < maxQueuedAttempts {
+		return
+	}
+
+	m.deleteQueued(q)
+	if hash != "" {
+		m.updateQueuedStatus(hash, db.DownloadDeleted)
+		if err := db.DeleteSubscriptionEpisodesByTorrent(m.db, hash); err != nil {
+			logger.Error().Err(err).Str("name", m.name).Str("hash", hash).Msg("failed to delete subscription episodes")
+		}
+	}
+	if m.events != nil {
+		m.events.Notify(&events.Event{Type: events.StartFailed, Downloader: m.name, Hash: hash, Title: q.Title, Error: err.Error()})
+	}
+}
+
+// finishedDirLow returns true if transferring the files takes the finished dir
+// below the threshold, links need no space.
+func (m *Manager) finishedDirLow(mode db.TransferMode, files []File) bool {
+	p := m.cfg.DiskSpace
+	if p == nil || mode == db.TransferHardlink || mode == db.TransferSymlink {
+		return false
+	}
+
+	need := uint64(0)
+	for _, f := range files {
+		need += uint64(f.Length)
+	}
+	_, low := spaceBelow(m.cfg.FinishedDir(), p.FinishedDirMinFreeInGB, need)
+	return low
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package lifecycle
+
+import (
+	"errors"
+)
+
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
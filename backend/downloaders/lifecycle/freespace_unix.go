@@ -0,0 +1,16 @@
+//go:build unix
+
+package lifecycle
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace of the filesystem of dir available to unprivileged users, in bytes.
+func freeSpace(dir string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
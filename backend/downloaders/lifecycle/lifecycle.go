@@ -0,0 +1,682 @@
+// Package lifecycle drives downloads through the states stored in
+// db.DownloadStatus: progress updates, copying finished files and the
+// seeding policy. Torrent clients only need to implement TorrentClient.
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/hub"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	logger = log.With().Str("component", "lifecycle").Logger()
+
+	ErrTorrentNotFound = errors.New("torrent not found in downloader")
+	// ErrLowDiskSpace is returned by AddTorrent if the download dir is below
+	// the threshold of the disk space policy and queueing is disabled.
+	ErrLowDiskSpace = errors.New("low disk space")
+	// ErrCheckRunning is returned by ProgressChecker if a check is running.
+	ErrCheckRunning = errors.New("progress check is running")
+)
+
+type File struct {
+	Name   string // relative to Torrent.DownloadDir
+	Length int64
+}
+
+// Torrent is the client independent view of a torrent.
+type Torrent struct {
+	// ID is the client side id, for clients which address torrents by number.
+	ID           int64
+	Hash         string
+	Name         string
+	PercentDone  float64
+	Seeding      bool
+	UploadedEver int64
+	DownloadDir  string
+	// Ratio of uploaded to downloaded data.
+	Ratio float64
+	// SeedingTime since finished, 0 if the client does not report it.
+	SeedingTime time.Duration
+}
+
+// NewTorrent is a torrent to add to the client, from a .torrent file or its
+// metainfo.
+type NewTorrent struct {
+	FilePath string
+	MetaInfo []byte
+	// DownloadDir overrides the downloader's download dir if set.
+	DownloadDir string
+	Labels      []string
+	// Title for notifications, the file name is used if empty.
+	Title string
+	// Indexer of the resource for notifications.
+	Indexer string
+}
+
+// AddResult of AddTorrent.
+type AddResult struct {
+	// Hash of the torrent.
+	Hash string
+	// Queued for disk space, it is started by CheckDiskSpace.
+	Queued bool
+}
+
+// CheckResult is what a progress check did, by hashes of downloads.
+type CheckResult struct {
+	Updated   []string
+	Completed []string
+	Moved     []string
+	Failed    []string
+	// Postponed transfers, for low space in the finished dir.
+	Postponed []string
+	// Busy is true if transfers were skipped as the client is busy.
+	Busy bool
+}
+
+type TorrentClient interface {
+	// AddMetaInfo adds a torrent to the client, MetaInfo and DownloadDir are
+	// always set.
+	AddMetaInfo(ctx context.Context, t *NewTorrent) error
+
+	// Torrents returns all torrents in the client.
+	Torrents(ctx context.Context) ([]*Torrent, error)
+
+	// Files of the given torrent.
+	Files(ctx context.Context, t *Torrent) ([]File, error)
+
+	// DownloadSpeed of the client in bytes per second.
+	DownloadSpeed(ctx context.Context) (int64, error)
+
+	StartTorrents(ctx context.Context, torrents []*Torrent) error
+
+	StopTorrents(ctx context.Context, torrents []*Torrent) error
+
+	RemoveTorrents(ctx context.Context, torrents []*Torrent, deleteData bool) error
+}
+
+type Manager struct {
+	name   string
+	db     *gorm.DB
+	cfg    *config.DownloaderConfig
+	client TorrentClient
+	events events.IEventNotifier
+
+	// checkMu prevents progress checks from overlapping.
+	checkMu sync.Mutex
+
+	// torrents failed to move, to notify the failure once.
+	moveFailedMu sync.Mutex
+	moveFailed   map[string]bool
+
+	// dirs below the threshold of the disk space policy, to notify crossing
+	// the threshold once.
+	lowSpaceMu sync.Mutex
+	lowSpace   map[string]bool
+}
+
+// NewManager creates a Manager, notifier is optional.
+func NewManager(name string, cfg *config.DownloaderConfig, db *gorm.DB, client TorrentClient, notifier events.IEventNotifier) *Manager {
+	return &Manager{
+		name:       name,
+		db:         db,
+		cfg:        cfg,
+		client:     client,
+		events:     notifier,
+		moveFailed: map[string]bool{},
+		lowSpace:   map[string]bool{},
+	}
+}
+
+// notify the event to the event notifier and the hub.
+func (m *Manager) notify(typ events.Type, s *db.DownloadStatus, err error) {
+	m.notifyReason(typ, s, err, "")
+}
+
+// notifyReason notifies stopped and deleted events with the reason, see
+// events.Event.
+func (m *Manager) notifyReason(typ events.Type, s *db.DownloadStatus, err error, reason string) {
+	e := &events.Event{
+		Type:       typ,
+		Downloader: m.name,
+		Hash:       s.ID,
+		Title:      s.ResTitle,
+		Indexer:    s.ResIndexer,
+		Reason:     reason,
+	}
+	if e.Title == "" {
+		e.Title = s.ID
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	hub.Publish(hub.DownloadEvent, &hub.DownloadEventData{
+		Type:       string(e.Type),
+		ID:         e.Hash,
+		Downloader: e.Downloader,
+		Title:      e.Title,
+		Indexer:    e.Indexer,
+		Error:      e.Error,
+		Reason:     e.Reason,
+	})
+
+	if m.events != nil {
+		m.events.Notify(e)
+	}
+}
+
+func (m *Manager) RegisterCronjobs(cron *cron.Cron) {
+	m.RegisterDailySeedingChecker(cron)
+	if m.cfg.DiskSpace != nil {
+		cron.AddFunc("@every 5m", m.CheckDiskSpace)
+	}
+
+	cron.AddFunc(fmt.Sprintf("@every %s", m.cfg.CheckInterval()), m.scheduledProgressCheck)
+
+	go func() {
+		time.Sleep(time.Minute)
+		m.scheduledProgressCheck()
+	}()
+}
+
+func (m *Manager) scheduledProgressCheck() {
+	if _, err := m.ProgressChecker(); errors.Is(err, ErrCheckRunning) {
+		logger.Warn().Str("name", m.name).Msg("progress check is still running, skipped")
+	}
+}
+
+// AddTorrent adds the torrent to the client instead of relying on the client
+// watching TorrentsDir. If the download dir is low on space, or the torrent
+// takes it below the threshold, the torrent is queued or ErrLowDiskSpace is
+// returned by the disk space policy.
+func (m *Manager) AddTorrent(t *NewTorrent) (*AddResult, error) {
+	nt := *t
+	if len(nt.MetaInfo) == 0 {
+		if nt.FilePath == "" {
+			return nil, errors.New("torrent file path or metainfo is required")
+		}
+		b, err := os.ReadFile(nt.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		nt.MetaInfo = b
+	}
+	if nt.DownloadDir == "" {
+		nt.DownloadDir = m.cfg.DownloadDir()
+	}
+	if nt.Title == "" {
+		nt.Title = filepath.Base(nt.FilePath)
+	}
+
+	hash, size, err := parseMetaInfo(nt.MetaInfo)
+	if err != nil {
+		return nil, fmt.Errorf("downloader %s: invalid metainfo: %w", m.name, err)
+	}
+	res := &AddResult{Hash: hash}
+
+	if p := m.cfg.DiskSpace; p != nil && !m.fits(nt.DownloadDir, uint64(size)) {
+		if !p.Queue {
+			return nil, fmt.Errorf("downloader %s: %w", m.name, ErrLowDiskSpace)
+		}
+		if err := m.queueTorrent(&nt); err != nil {
+			return nil, err
+		}
+		res.Queued = true
+		return res, nil
+	}
+
+	if err := m.startTorrent(&nt, hash); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// parseMetaInfo returns the info hash and the total length of the files.
+func parseMetaInfo(b []byte) (string, int64, error) {
+	mi, err := metainfo.Load(bytes.NewReader(b))
+	if err != nil {
+		return "", 0, err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return "", 0, err
+	}
+	return mi.HashInfoBytes().HexString(), info.TotalLength(), nil
+}
+
+func (m *Manager) startTorrent(nt *NewTorrent, hash string) error {
+	if err := m.client.AddMetaInfo(context.Background(), nt); err != nil {
+		return fmt.Errorf("downloader %s: failed to add torrent: %w", m.name, err)
+	}
+
+	m.notify(events.Started, &db.DownloadStatus{ID: hash, ResTitle: nt.Title, ResIndexer: nt.Indexer}, nil)
+	return nil
+}
+
+func toTorrentsByHash(torrents []*Torrent) map[string]*Torrent {
+	torrentsByHash := make(map[string]*Torrent)
+	for _, t := range torrents {
+		torrentsByHash[t.Hash] = t
+	}
+	return torrentsByHash
+}
+
+// ProgressChecker updates the progress of downloads and transfers finished
+// downloads, it returns ErrCheckRunning if a check is running.
+func (m *Manager) ProgressChecker() (*CheckResult, error) {
+	if !m.checkMu.TryLock() {
+		return nil, ErrCheckRunning
+	}
+	defer m.checkMu.Unlock()
+
+	defer m.observeProgressCheck(time.Now())
+
+	torrents, err := m.client.Torrents(context.Background())
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to get all torrents")
+		return nil, err
+	}
+
+	torrentsByHash := toTorrentsByHash(torrents)
+
+	statuses, err := db.GetUnfinishedDownloadStatusByDownloader(m.db, m.name)
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to get download status")
+		return nil, err
+	}
+
+	res := &CheckResult{}
+
+	for _, s := range statuses {
+		t, ok := torrentsByHash[s.ID]
+		if !ok {
+			continue
+		}
+
+		s.DownloadProgress = int32(t.PercentDone * 1000)
+		if t.Seeding {
+			now := time.Now()
+			s.State = db.DownloadSeeding
+			s.SeedingSince = &now
+		}
+		db.SaveDownloadStatus(m.db, &s)
+		res.Updated = append(res.Updated, s.ID)
+
+		hub.Publish(hub.DownloadProgress, &hub.DownloadProgressData{
+			ID:         s.ID,
+			Downloader: m.name,
+			Title:      s.ResTitle,
+			Progress:   s.DownloadProgress,
+			State:      s.State.String(),
+		})
+		if s.State == db.DownloadSeeding {
+			res.Completed = append(res.Completed, s.ID)
+			m.notify(events.Completed, &s, nil)
+		}
+	}
+
+	m.updateDownloadsMetrics()
+
+	// check if the client is actively downloading.
+	speed, err := m.client.DownloadSpeed(context.Background())
+	if err != nil {
+		logger.Err(err).Str("name", m.name).Msg("failed to get download speed")
+	}
+
+	if m.cfg.Busy(speed) {
+		res.Busy = true
+		return res, nil
+	}
+
+	// start transfers
+	statuses, err = db.GetFinishedUnmoveedDownloadStatusByDownloader(m.db, m.name)
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to get seeding download status")
+		return nil, err
+	}
+
+	mode := m.transferMode()
+	for _, s := range statuses {
+		t, ok := torrentsByHash[s.ID]
+		if !ok {
+			continue
+		}
+		// files can not be moved while seeding.
+		if mode == db.TransferMove && s.State < db.DownloadStopped {
+			continue
+		}
+
+		files, err := m.client.Files(context.Background(), t)
+		if err != nil {
+			logger.Error().Err(err).Str("name", m.name).Msg("failed to get torrent files")
+			m.moveFailedOnce(&s, err)
+			res.Failed = append(res.Failed, s.ID)
+			continue
+		}
+		if m.finishedDirLow(mode, files) {
+			logger.Warn().Str("name", m.name).Str("hash", s.ID).Msg("not enough space in finished dir, transfer postponed")
+			res.Postponed = append(res.Postponed, s.ID)
+			continue
+		}
+
+		copyStart := time.Now()
+		used, moveErr := m.transferTorrent(&s, t, files, mode)
+		m.observeCopy(copyStart)
+		if moveErr != nil {
+			logger.Error().Err(moveErr).Str("name", m.name).Str("mode", string(mode)).Msg("failed to transfer files")
+			m.moveFailedOnce(&s, moveErr)
+			res.Failed = append(res.Failed, s.ID)
+			continue
+		}
+
+		s.MoveState = db.Moved
+		s.TransferMode = used
+		db.SaveDownloadStatus(m.db, &s)
+		m.notify(events.Moved, &s, nil)
+		res.Moved = append(res.Moved, s.ID)
+
+		m.moveFailedMu.Lock()
+		delete(m.moveFailed, s.ID)
+		m.moveFailedMu.Unlock()
+	}
+
+	return res, nil
+}
+
+func (m *Manager) transferMode() db.TransferMode {
+	if m.cfg.TransferMode == "" {
+		return db.TransferCopy
+	}
+	return m.cfg.TransferMode
+}
+
+// moveFailedOnce notifies the move failure, the move is retried in next check
+// without notifying again.
+func (m *Manager) moveFailedOnce(s *db.DownloadStatus, err error) {
+	m.moveFailedMu.Lock()
+	notified := m.moveFailed[s.ID]
+	m.moveFailed[s.ID] = true
+	m.moveFailedMu.Unlock()
+
+	if !notified {
+		m.notify(events.MoveFailed, s, err)
+	}
+}
+
+func (m *Manager) RegisterDailySeedingChecker(cron *cron.Cron) {
+	if m.cfg.SeedingPolicy == nil {
+		return
+	}
+
+	cron.AddFunc("0 0 8 * * *", func() {
+		m.CheckDailySeeding()
+	})
+}
+
+func (m *Manager) CheckDailySeeding() {
+	torrents, err := m.client.Torrents(context.Background())
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to get all torrents")
+		return
+	}
+
+	torrentsByHash := toTorrentsByHash(torrents)
+
+	m.stopTorrents(torrents)
+	m.removeTorrents(torrentsByHash)
+}
+
+func (m *Manager) stopTorrents(torrents []*Torrent) {
+	stopIDs := []string{}
+	stopTorrents := []*Torrent{}
+	stopStatuses := []*db.DownloadStatus{}
+
+	for _, t := range torrents {
+		// only check seeding torrents
+		if !t.Seeding {
+			continue
+		}
+
+		hash := t.Hash
+		uploaded := t.UploadedEver
+
+		ss, err := db.GetDownloadStatus(m.db, hash)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ss.ID = hash
+			ss.Downloader = m.name
+			ss.State = db.DownloadSeeding
+			ss.UploadHistories = make(map[string]int64)
+			ss.ResTitle = t.Name
+			ss.AddToday(uploaded)
+			db.SaveDownloadStatus(m.db, ss)
+
+			continue
+		}
+		ss.CleanupHistory()
+		ss.AddToday(uploaded)
+
+		db.SaveDownloadStatus(m.db, ss)
+
+		reason := stopReason(m.cfg.SeedingPolicy.ForIndexer(ss.ResIndexer), ss, t)
+		if reason == "" {
+			continue
+		}
+
+		// stop this torrent
+		logger.Info().Str("name", m.name).Str("hash", hash).Str("rule", string(reason)).Msg("stop seeding")
+		ss.StopReason = reason
+		stopTorrents = append(stopTorrents, t)
+		stopIDs = append(stopIDs, hash)
+		stopStatuses = append(stopStatuses, ss)
+	}
+
+	// nothing to stop
+	if len(stopTorrents) == 0 {
+		return
+	}
+
+	// stop torrents
+	if err := m.client.StopTorrents(context.Background(), stopTorrents); err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to stop torrents")
+		return
+	}
+
+	// update state in db
+	if err := db.UpdateDownloadStateForStatuses(m.db, stopIDs, db.DownloadStopped); err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to update download status")
+		return
+	}
+	for _, s := range stopStatuses {
+		if err := db.UpdateDownloadStopReason(m.db, s.ID, s.StopReason); err != nil {
+			logger.Error().Err(err).Str("name", m.name).Msg("failed to update stop reason")
+		}
+	}
+
+	m.addSeedingActions(metrics.ActionStop, len(stopStatuses))
+	for _, s := range stopStatuses {
+		m.notifyReason(events.Stopped, s, nil, string(s.StopReason))
+	}
+}
+
+func (m *Manager) removeTorrents(torrentsByHash map[string]*Torrent) {
+	statuses, err := db.GetStoppedMovedDownloadStatusByDownloader(m.db, m.name)
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to get stopped download status")
+		return
+	}
+
+	// data of the finished files linked to or moved away is not deleted.
+	keepData := []*db.DownloadStatus{}
+	deleteData := []*db.DownloadStatus{}
+	for _, s := range statuses {
+		if _, ok := torrentsByHash[s.ID]; !ok {
+			continue
+		}
+
+		if s.TransferMode.KeepsSource() {
+			keepData = append(keepData, &s)
+		} else {
+			deleteData = append(deleteData, &s)
+		}
+	}
+
+	m.removeTorrentsOf(torrentsByHash, deleteData, true, metrics.ActionRemove)
+	m.removeTorrentsOf(torrentsByHash, keepData, false, metrics.ActionRemove)
+}
+
+// removeTorrentsOf the statuses and marks them deleted, action is counted in
+// metrics.SeedingPolicyActions. Torrents removed by the seeding policy are
+// notified with their stop reason, evicted ones with events.ReasonDiskSpace.
+func (m *Manager) removeTorrentsOf(torrentsByHash map[string]*Torrent, statuses []*db.DownloadStatus, deleteData bool, action string) {
+	// nothing to delete
+	if len(statuses) == 0 {
+		return
+	}
+
+	deleteStatusIDs := []string{}
+	deleteTorrents := []*Torrent{}
+	for _, s := range statuses {
+		deleteTorrents = append(deleteTorrents, torrentsByHash[s.ID])
+		deleteStatusIDs = append(deleteStatusIDs, s.ID)
+	}
+
+	// delete torrents
+	if err := m.client.RemoveTorrents(context.Background(), deleteTorrents, deleteData); err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to delete torrents")
+		return
+	}
+
+	if err := db.UpdateDownloadStateForStatuses(m.db, deleteStatusIDs, db.DownloadDeleted); err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to update download status")
+		return
+	}
+
+	m.addSeedingActions(action, len(statuses))
+	for _, s := range statuses {
+		reason := string(s.StopReason)
+		if action == metrics.ActionEvict {
+			reason = events.ReasonDiskSpace
+		}
+		m.notifyReason(events.Deleted, s, nil, reason)
+	}
+}
+
+func (m *Manager) findTorrent(ctx context.Context, hash string) (*Torrent, error) {
+	torrents, err := m.client.Torrents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range torrents {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return nil, ErrTorrentNotFound
+}
+
+// PauseTorrent stops the torrent in the client until ResumeTorrent, the state
+// is kept.
+func (m *Manager) PauseTorrent(s *db.DownloadStatus) error {
+	ctx := context.Background()
+	t, err := m.findTorrent(ctx, s.ID)
+	if err != nil {
+		return err
+	}
+	if err := m.client.StopTorrents(ctx, []*Torrent{t}); err != nil {
+		return err
+	}
+
+	s.Paused = true
+	return db.SaveDownloadStatus(m.db, s)
+}
+
+// ResumeTorrent starts a paused or stopped torrent.
+func (m *Manager) ResumeTorrent(s *db.DownloadStatus) error {
+	ctx := context.Background()
+	t, err := m.findTorrent(ctx, s.ID)
+	if err != nil {
+		return err
+	}
+	if err := m.client.StartTorrents(ctx, []*Torrent{t}); err != nil {
+		return err
+	}
+
+	s.Paused = false
+	if s.State == db.DownloadStopped {
+		s.StopReason = ""
+		s.State = db.DownloadStarted
+		if s.DownloadProgress == 1000 {
+			s.State = db.DownloadSeeding
+		}
+	}
+	return db.SaveDownloadStatus(m.db, s)
+}
+
+// StopTorrent stops the torrent like the seeding policy does, it is removed
+// by the daily seeding check once moved.
+func (m *Manager) StopTorrent(s *db.DownloadStatus) error {
+	ctx := context.Background()
+	t, err := m.findTorrent(ctx, s.ID)
+	if err != nil {
+		return err
+	}
+	if err := m.client.StopTorrents(ctx, []*Torrent{t}); err != nil {
+		return err
+	}
+
+	s.Paused = false
+	s.State = db.DownloadStopped
+	s.StopReason = db.StopUser
+	if err := db.SaveDownloadStatus(m.db, s); err != nil {
+		return err
+	}
+	m.notifyReason(events.Stopped, s, nil, events.ReasonUser)
+	return nil
+}
+
+// DeleteTorrent removes the torrent from the client. The status is marked as
+// deleted even if the torrent is already gone from the client.
+func (m *Manager) DeleteTorrent(s *db.DownloadStatus, deleteData bool) error {
+	ctx := context.Background()
+	t, err := m.findTorrent(ctx, s.ID)
+	if err != nil && !errors.Is(err, ErrTorrentNotFound) {
+		return err
+	}
+	if t != nil {
+		if err := m.client.RemoveTorrents(ctx, []*Torrent{t}, deleteData); err != nil {
+			return err
+		}
+	}
+
+	s.Paused = false
+	s.State = db.DownloadDeleted
+	if err := db.SaveDownloadStatus(m.db, s); err != nil {
+		return err
+	}
+	m.notifyReason(events.Deleted, s, nil, events.ReasonUser)
+	return nil
+}
+
+func (m *Manager) TorrentsDir() string {
+	return m.cfg.TorrentsDir()
+}
+
+func (m *Manager) DownloadDir() string {
+	return m.cfg.DownloadDir()
+}
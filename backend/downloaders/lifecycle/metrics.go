@@ -0,0 +1,41 @@
+package lifecycle
+
+import (
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+)
+
+// Metrics of the background jobs, requests to the downloader are recorded by
+// downloaders.Instrument.
+
+func (m *Manager) observeProgressCheck(start time.Time) {
+	metrics.ProgressCheckDuration.WithLabelValues(m.name).Observe(time.Since(start).Seconds())
+}
+
+func (m *Manager) observeCopy(start time.Time) {
+	metrics.CopyDuration.WithLabelValues(m.name).Observe(time.Since(start).Seconds())
+}
+
+func (m *Manager) addCopyBytes(n int64) {
+	metrics.CopyBytes.WithLabelValues(m.name).Add(float64(n))
+}
+
+// addSeedingActions counts n torrents stopped, removed or evicted.
+func (m *Manager) addSeedingActions(action string, n int) {
+	metrics.SeedingPolicyActions.WithLabelValues(m.name, action).Add(float64(n))
+}
+
+// updateDownloadsMetrics sets the downloads by state of the downloader.
+func (m *Manager) updateDownloadsMetrics() {
+	counts, err := db.CountDownloadStatusByState(m.db, m.name)
+	if err != nil {
+		logger.Error().Err(err).Str("name", m.name).Msg("failed to count download status")
+		return
+	}
+
+	for _, state := range []db.DownloadState{db.DownloadQueued, db.DownloadStarted, db.DownloadSeeding, db.DownloadStopped, db.DownloadDeleted} {
+		metrics.Downloads.WithLabelValues(m.name, state.String()).Set(float64(counts[state]))
+	}
+}
@@ -0,0 +1,29 @@
+package lifecycle
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile clones the file sharing the data blocks, on filesystems
+// supporting it like btrfs and xfs.
+func reflinkFile(from, target string) error {
+	fromFile, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer fromFile.Close()
+
+	targetFile, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer targetFile.Close()
+
+	if err := unix.IoctlFileClone(int(targetFile.Fd()), int(fromFile.Fd())); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return targetFile.Sync()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package lifecycle
+
+import (
+	"errors"
+)
+
+func reflinkFile(from, target string) error {
+	return errors.ErrUnsupported
+}
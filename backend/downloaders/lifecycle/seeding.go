@@ -0,0 +1,44 @@
+package lifecycle
+
+import (
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+)
+
+// minimumsReached returns true if the torrent reached the min ratio and the
+// min seed time of the policy.
+func minimumsReached(p *config.SeedingPolicy, t *Torrent) bool {
+	if p.MinRatio > 0 && t.Ratio < p.MinRatio {
+		return false
+	}
+	if p.MinSeedTimeInHours > 0 && t.SeedingTime < time.Duration(p.MinSeedTimeInHours)*time.Hour {
+		return false
+	}
+	return true
+}
+
+// stopReason returns the rule of the policy stopping the torrent, empty to
+// continue seeding. The upload history of today must be added.
+func stopReason(p *config.SeedingPolicy, s *db.DownloadStatus, t *Torrent) db.StopReason {
+	// seed until all minimums are reached.
+	if !minimumsReached(p, t) {
+		return ""
+	}
+
+	if p.MaxSeedTimeInHours > 0 && t.SeedingTime >= time.Duration(p.MaxSeedTimeInHours)*time.Hour {
+		return db.StopMaxSeedTime
+	}
+
+	for _, r := range p.AllUploadRules() {
+		before, ok := s.GetXDayBefore(r.IntervalInDays)
+		if !ok {
+			continue
+		}
+		if t.UploadedEver-before <= r.UploadAtLeastInMB*1024*1024 {
+			return db.StopUploadRule
+		}
+	}
+	return ""
+}
@@ -0,0 +1,331 @@
+package lifecycle
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/charleshuang3/autoget/backend/internal/db"
+)
+
+// partSuffix of files being written, they are renamed to the target once
+// complete so the finished dir never has partial files.
+const partSuffix = ".part"
+
+// progressBytes copied between saves of the progress.
+var progressBytes int64 = 64 * 1024 * 1024
+
+// MetaInfoClient is implemented by clients which can export the metainfo of
+// torrents, to verify transferred files against the piece hashes.
+type MetaInfoClient interface {
+	MetaInfo(ctx context.Context, t *Torrent) ([]byte, error)
+}
+
+// transferTorrent transfers the files of the torrent to the finished dir,
+// files already transferred are skipped. The progress of copies is saved to
+// the status while copying, so a failed transfer resumes from where it
+// stopped. It returns the mode used, copy if a reflink fell back to copy.
+func (m *Manager) transferTorrent(s *db.DownloadStatus, t *Torrent, files []File, mode db.TransferMode) (db.TransferMode, error) {
+	if s.FileTransfers == nil {
+		s.FileTransfers = map[string]*db.FileTransfer{}
+	}
+
+	used := mode
+
+	dir := filepath.Join(m.cfg.FinishedDir(), s.ID)
+	for _, f := range files {
+		from := filepath.Join(t.DownloadDir, f.Name)
+		target := filepath.Join(dir, f.Name)
+
+		done, err := transferred(s.FileTransfers[f.Name], from, target, f.Length)
+		if err != nil {
+			return used, fmt.Errorf("failed to check %s: %w", f.Name, err)
+		}
+		if done {
+			s.FileTransfers[f.Name] = &db.FileTransfer{Size: f.Length, Transferred: f.Length}
+			continue
+		}
+
+		resume := int64(0)
+		if ft := s.FileTransfers[f.Name]; ft != nil && ft.Size == f.Length {
+			resume = ft.Transferred
+		}
+		save := func(transferred int64) {
+			s.FileTransfers[f.Name] = &db.FileTransfer{Size: f.Length, Transferred: transferred}
+			db.SaveDownloadStatus(m.db, s)
+		}
+
+		fileMode, n, err := transferFile(mode, from, target, resume, save)
+		m.addCopyBytes(n)
+		if fileMode == db.TransferCopy {
+			used = db.TransferCopy
+		}
+		if err != nil {
+			// the saved progress is kept, it is synced to the part file.
+			return used, fmt.Errorf("failed to transfer %s: %w", f.Name, err)
+		}
+		save(f.Length)
+	}
+
+	// links share the data with the client, which verifies it.
+	if m.cfg.VerifyTransfer && (mode == db.TransferCopy || mode == db.TransferReflink) {
+		return used, m.verifyTransfer(s, t, dir)
+	}
+	return used, nil
+}
+
+// verifyTransfer checks the files in dir against the piece hashes, files
+// failed the check are removed to transfer again.
+func (m *Manager) verifyTransfer(s *db.DownloadStatus, t *Torrent, dir string) error {
+	c, ok := m.client.(MetaInfoClient)
+	if !ok {
+		logger.Warn().Str("name", m.name).Str("hash", s.ID).Msg("client can not export metainfo, transfer not verified")
+		return nil
+	}
+
+	b, err := c.MetaInfo(context.Background(), t)
+	if err != nil {
+		return fmt.Errorf("failed to get metainfo: %w", err)
+	}
+	bad, err := verifyPieces(b, dir)
+	if err != nil {
+		return fmt.Errorf("failed to verify: %w", err)
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+
+	for _, name := range bad {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Error().Err(err).Str("name", m.name).Str("file", name).Msg("failed to remove unverified file")
+		}
+		delete(s.FileTransfers, name)
+	}
+	db.SaveDownloadStatus(m.db, s)
+	return fmt.Errorf("files failed verification: %s", strings.Join(bad, ", "))
+}
+
+// transferred returns true if target is a complete transfer of from: of the
+// expected size and recorded as transferred, the same file, or the same
+// content.
+func transferred(ft *db.FileTransfer, from, target string, size int64) (bool, error) {
+	targetInfo, err := os.Stat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if targetInfo.Size() != size {
+		return false, nil
+	}
+	if ft.Done() && ft.Size == size {
+		return true, nil
+	}
+
+	fromInfo, err := os.Stat(from)
+	if err != nil {
+		// let the transfer report it, or skip a moved file.
+		return false, nil
+	}
+	if os.SameFile(fromInfo, targetInfo) {
+		return true, nil
+	}
+	if fromInfo.Size() != size {
+		return false, nil
+	}
+
+	fromSum, err := sha256File(from)
+	if err != nil {
+		return false, err
+	}
+	targetSum, err := sha256File(target)
+	if err != nil {
+		return false, err
+	}
+	return fromSum == targetSum, nil
+}
+
+func sha256File(name string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	f, err := os.Open(name)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// transferFile from the download dir to target, it returns the mode used and
+// the bytes written, 0 if no data is written like for links. A reflink falls
+// back to copy. An existing target from a failed transfer is replaced, copies
+// resume and save the progress, see copyFile.
+func transferFile(mode db.TransferMode, from, target string, resume int64, save func(int64)) (db.TransferMode, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return mode, 0, err
+	}
+
+	switch mode {
+	case db.TransferHardlink:
+		return mode, 0, replace(target, func() error { return os.Link(from, target) })
+	case db.TransferSymlink:
+		abs, err := filepath.Abs(from)
+		if err != nil {
+			return mode, 0, err
+		}
+		return mode, 0, replace(target, func() error { return os.Symlink(abs, target) })
+	case db.TransferReflink:
+		// a part file is from a copy fallback, resume it.
+		tmp := target + partSuffix
+		if _, err := os.Lstat(tmp); errors.Is(err, os.ErrNotExist) {
+			if err := reflinkFile(from, tmp); err == nil {
+				return mode, 0, commit(tmp, target)
+			}
+		}
+		n, err := copyFile(from, target, resume, save)
+		return db.TransferCopy, n, err
+	case db.TransferMove:
+		n, err := moveFile(from, target, resume, save)
+		return mode, n, err
+	}
+	n, err := copyFile(from, target, resume, save)
+	return db.TransferCopy, n, err
+}
+
+func replace(target string, create func() error) error {
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return create()
+}
+
+// copyFile to the part file of target and renames it once synced. It resumes
+// from resume bytes of an existing part file, the progress is saved every
+// progressBytes once synced. It returns the bytes copied.
+func copyFile(from, target string, resume int64, save func(int64)) (int64, error) {
+	fromFile, err := os.Open(from)
+	if err != nil {
+		return 0, err
+	}
+	defer fromFile.Close()
+
+	fromInfo, err := fromFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := target + partSuffix
+	tmpFile, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := resumeCopy(tmpFile, fromFile, fromInfo.Size(), resume, save)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, commit(tmp, target)
+}
+
+// resumeCopy copies from resume bytes of dst, the saved progress which is
+// synced. Bytes after it may be lost in a crash and are copied again, dst
+// shorter than it or resume beyond size is not a part of src and is copied
+// from start. The data before resume is checked by the verification of the
+// transfer if enabled.
+func resumeCopy(dst *os.File, src *os.File, size, resume int64, save func(int64)) (int64, error) {
+	end, err := dst.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	offset := resume
+	if end < resume || resume > size {
+		offset = 0
+	}
+	if err := dst.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n := int64(0)
+	for {
+		c, err := io.CopyN(dst, src, progressBytes)
+		n += c
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := dst.Sync(); err != nil {
+			return n, err
+		}
+		save(offset + n)
+	}
+}
+
+// commit renames the part file to target.
+func commit(tmp, target string) error {
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(target))
+	return nil
+}
+
+// syncDir persists the rename, best effort as not all platforms support
+// syncing dirs.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// moveFile renames the file, or copies and removes it across filesystems. A
+// file moved by a failed transfer is skipped.
+func moveFile(from, target string, resume int64, save func(int64)) (int64, error) {
+	err := os.Rename(from, target)
+	if err == nil {
+		return 0, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		if _, statErr := os.Stat(target); statErr == nil {
+			return 0, nil
+		}
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return 0, err
+	}
+
+	n, err := copyFile(from, target, resume, save)
+	if err != nil {
+		return n, err
+	}
+	return n, os.Remove(from)
+}
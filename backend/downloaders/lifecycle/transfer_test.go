@@ -0,0 +1,86 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeCopy(t *testing.T) {
+	before := progressBytes
+	progressBytes = 4
+	t.Cleanup(func() { progressBytes = before })
+
+	open := func(t *testing.T, name, content string) *os.File {
+		t.Helper()
+
+		p := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+		f, err := os.OpenFile(p, os.O_RDWR, 0644)
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	read := func(t *testing.T, f *os.File) string {
+		t.Helper()
+
+		b, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	tests := []struct {
+		name      string
+		part      string
+		resume    int64
+		wantN     int64
+		wantSaved []int64
+	}{
+		{
+			name:      "new",
+			wantN:     11,
+			wantSaved: []int64{4, 8},
+		},
+		{
+			name:      "resume",
+			part:      "hello",
+			resume:    5,
+			wantN:     6,
+			wantSaved: []int64{9},
+		},
+		{
+			name:      "truncate unsaved",
+			part:      "helloXXXX",
+			resume:    5,
+			wantN:     6,
+			wantSaved: []int64{9},
+		},
+		{
+			name:      "shorter than saved",
+			part:      "hel",
+			resume:    5,
+			wantN:     11,
+			wantSaved: []int64{4, 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := open(t, "src", "hello world")
+			dst := open(t, "dst", tt.part)
+
+			saved := []int64{}
+			n, err := resumeCopy(dst, src, 11, tt.resume, func(transferred int64) {
+				saved = append(saved, transferred)
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantN, n)
+			assert.Equal(t, tt.wantSaved, saved)
+			assert.Equal(t, "hello world", read(t, dst))
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package lifecycle
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// pieceFile is a file of the torrent in the concatenated data of pieces.
+type pieceFile struct {
+	name    string // relative to the dir, like File.Name
+	offset  int64
+	length  int64
+	padding bool
+}
+
+// verifyPieces checks the files in dir against the v1 piece hashes of the
+// metainfo and returns the names of files in bad pieces. Pieces with files
+// not in dir, like unwanted files, are skipped.
+func verifyPieces(b []byte, dir string) ([]string, error) {
+	mi, err := metainfo.Load(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, err
+	}
+	if !info.HasV1() {
+		return nil, errors.New("only v1 torrents can be verified")
+	}
+
+	files := []*pieceFile{}
+	for fi := range info.UpvertedV1Files() {
+		name := info.BestName()
+		if info.IsDir() {
+			name = path.Join(append([]string{name}, fi.BestPath()...)...)
+		}
+		files = append(files, &pieceFile{
+			name:    name,
+			offset:  fi.TorrentOffset,
+			length:  fi.Length,
+			padding: strings.Contains(fi.Attr, "p"),
+		})
+	}
+
+	opened := map[string]*os.File{}
+	defer func() {
+		for _, f := range opened {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	open := func(name string) *os.File {
+		f, ok := opened[name]
+		if !ok {
+			f, _ = os.Open(filepath.Join(dir, name))
+			opened[name] = f
+		}
+		return f
+	}
+
+	bad := map[string]bool{}
+	buf := make([]byte, info.PieceLength)
+	first := 0
+	for i := range info.NumPieces() {
+		start := int64(i) * info.PieceLength
+		length := info.Piece(i).V1Length()
+		end := start + length
+
+		for first < len(files) && files[first].offset+files[first].length <= start {
+			first++
+		}
+		inPiece := []*pieceFile{}
+		for j := first; j < len(files) && files[j].offset < end; j++ {
+			if files[j].length > 0 {
+				inPiece = append(inPiece, files[j])
+			}
+		}
+
+		data := buf[:length]
+		ok := true
+		for _, f := range inPiece {
+			from := max(start, f.offset)
+			to := min(end, f.offset+f.length)
+			seg := data[from-start : to-start]
+			if f.padding {
+				clear(seg)
+				continue
+			}
+			file := open(f.name)
+			if file == nil {
+				ok = false
+				break
+			}
+			if _, err := file.ReadAt(seg, from-f.offset); err != nil {
+				if !errors.Is(err, io.EOF) {
+					return nil, err
+				}
+				// a short file fails the check.
+				clear(seg)
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		sum := sha1.Sum(data)
+		if !bytes.Equal(sum[:], info.Pieces[i*sha1.Size:(i+1)*sha1.Size]) {
+			for _, f := range inPiece {
+				if !f.padding {
+					bad[f.name] = true
+				}
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range bad {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
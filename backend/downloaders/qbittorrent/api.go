@@ -0,0 +1,257 @@
+package qbittorrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// torrentInfo is an item of /api/v2/torrents/info.
+type torrentInfo struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	Progress    float64 `json:"progress"`
+	State       string  `json:"state"`
+	SavePath    string  `json:"save_path"`
+	Uploaded    int64   `json:"uploaded"`
+	Size        int64   `json:"size"`
+	Ratio       float64 `json:"ratio"`
+	SeedingTime int64   `json:"seeding_time"` // in seconds
+	Category    string  `json:"category"`
+	Tags        string  `json:"tags"`
+}
+
+// torrentFile is an item of /api/v2/torrents/files.
+type torrentFile struct {
+	Name     string  `json:"name"`
+	Size     int64   `json:"size"`
+	Progress float64 `json:"progress"`
+}
+
+// transferInfo is the response of /api/v2/transfer/info.
+type transferInfo struct {
+	DlInfoSpeed int64 `json:"dl_info_speed"`
+	UpInfoSpeed int64 `json:"up_info_speed"`
+}
+
+// seedingStates are torrent states of a finished and seeding torrent.
+// See https://github.com/qbittorrent/qBittorrent/wiki/WebUI-API-(qBittorrent-4.1)#get-torrent-list
+var seedingStates = map[string]bool{
+	"uploading":  true,
+	"stalledUP":  true,
+	"queuedUP":   true,
+	"forcedUP":   true,
+	"checkingUP": true,
+}
+
+type statusError struct {
+	code int
+	path string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("qbittorrent %s: HTTP status %d", e.path, e.code)
+}
+
+type api struct {
+	baseURL  string
+	username string
+	password string
+
+	httpClient *http.Client
+}
+
+func (a *api) login(ctx context.Context) error {
+	form := url.Values{}
+	form.Set("username", a.username)
+	form.Set("password", a.password)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/api/v2/auth/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// qBittorrent rejects login without a matching Referer when CSRF protection is on.
+	req.Header.Set("Referer", a.baseURL)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode, path: "/api/v2/auth/login"}
+	}
+	if strings.TrimSpace(string(body)) != "Ok." {
+		return fmt.Errorf("qbittorrent login failed: %s", string(body))
+	}
+
+	return nil
+}
+
+// do sends the request, login and retry once if the session is expired.
+func (a *api) do(ctx context.Context, method, path string, form url.Values) ([]byte, error) {
+	u := a.baseURL + path
+	contentType := ""
+	var body []byte
+	if method == http.MethodGet {
+		if len(form) > 0 {
+			u += "?" + form.Encode()
+		}
+	} else {
+		contentType = "application/x-www-form-urlencoded"
+		body = []byte(form.Encode())
+	}
+
+	return a.send(ctx, method, path, u, contentType, body)
+}
+
+// postMultipart posts fields and a file as multipart/form-data.
+func (a *api) postMultipart(ctx context.Context, path string, fields map[string]string, fileField, fileName string, file []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+	fw, err := w.CreateFormFile(fileField, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(file); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return a.send(ctx, http.MethodPost, path, a.baseURL+path, w.FormDataContentType(), buf.Bytes())
+}
+
+func (a *api) send(ctx context.Context, method, path, u, contentType string, body []byte) ([]byte, error) {
+	resp, err := a.sendOnce(ctx, method, path, u, contentType, body)
+	var se *statusError
+	if errors.As(err, &se) && se.code == http.StatusForbidden {
+		if err := a.login(ctx); err != nil {
+			return nil, err
+		}
+		return a.sendOnce(ctx, method, path, u, contentType, body)
+	}
+	return resp, err
+}
+
+func (a *api) sendOnce(ctx context.Context, method, path, u, contentType string, body []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Referer", a.baseURL)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{code: resp.StatusCode, path: path}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (a *api) getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	body, err := a.do(ctx, http.MethodGet, path, query)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (a *api) torrentsInfo(ctx context.Context, hashes ...string) ([]torrentInfo, error) {
+	var query url.Values
+	if len(hashes) > 0 {
+		query = url.Values{"hashes": {strings.Join(hashes, "|")}}
+	}
+	torrents := []torrentInfo{}
+	err := a.getJSON(ctx, "/api/v2/torrents/info", query, &torrents)
+	return torrents, err
+}
+
+func (a *api) torrentFiles(ctx context.Context, hash string) ([]torrentFile, error) {
+	files := []torrentFile{}
+	err := a.getJSON(ctx, "/api/v2/torrents/files", url.Values{"hash": {hash}}, &files)
+	return files, err
+}
+
+// exportTorrent returns the metainfo of the torrent.
+func (a *api) exportTorrent(ctx context.Context, hash string) ([]byte, error) {
+	return a.do(ctx, http.MethodGet, "/api/v2/torrents/export", url.Values{"hash": {hash}})
+}
+
+func (a *api) transferInfo(ctx context.Context) (*transferInfo, error) {
+	info := &transferInfo{}
+	err := a.getJSON(ctx, "/api/v2/transfer/info", nil, info)
+	return info, err
+}
+
+// torrentsAction calls a torrents/* action, falling back to the pre-5.0
+// endpoint name if the current one does not exist (e.g. stop -> pause).
+func (a *api) torrentsAction(ctx context.Context, action, legacyAction string, form url.Values) error {
+	_, err := a.do(ctx, http.MethodPost, "/api/v2/torrents/"+action, form)
+	var se *statusError
+	if legacyAction != "" && errors.As(err, &se) && se.code == http.StatusNotFound {
+		_, err = a.do(ctx, http.MethodPost, "/api/v2/torrents/"+legacyAction, form)
+	}
+	return err
+}
+
+func (a *api) startTorrents(ctx context.Context, hashes []string) error {
+	return a.torrentsAction(ctx, "start", "resume", url.Values{"hashes": {strings.Join(hashes, "|")}})
+}
+
+func (a *api) stopTorrents(ctx context.Context, hashes []string) error {
+	return a.torrentsAction(ctx, "stop", "pause", url.Values{"hashes": {strings.Join(hashes, "|")}})
+}
+
+func (a *api) deleteTorrents(ctx context.Context, hashes []string, deleteFiles bool) error {
+	return a.torrentsAction(ctx, "delete", "", url.Values{
+		"hashes":      {strings.Join(hashes, "|")},
+		"deleteFiles": {fmt.Sprintf("%t", deleteFiles)},
+	})
+}
+
+func (a *api) addTorrent(ctx context.Context, name string, metainfo []byte, savePath string, tags []string) error {
+	fields := map[string]string{"savepath": savePath}
+	if len(tags) > 0 {
+		fields["tags"] = strings.Join(tags, ",")
+	}
+
+	body, err := a.postMultipart(ctx, "/api/v2/torrents/add", fields, "torrents", name, metainfo)
+	if err != nil {
+		return err
+	}
+	// qBittorrent responds "Fails." with status 200 if the torrent is invalid.
+	if strings.TrimSpace(string(body)) != "Ok." {
+		return fmt.Errorf("qbittorrent failed to add torrent %s: %s", name, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package qbittorrent
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"gorm.io/gorm"
+)
+
+var (
+	_ lifecycle.TorrentClient  = (*Client)(nil)
+	_ lifecycle.MetaInfoClient = (*Client)(nil)
+)
+
+type Client struct {
+	*lifecycle.Manager
+
+	api *api
+}
+
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, notifier events.IEventNotifier) (*Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		api: &api{
+			baseURL:    strings.TrimSuffix(cfg.QBittorrent.URL, "/"),
+			username:   cfg.QBittorrent.Username,
+			password:   cfg.QBittorrent.Password,
+			httpClient: &http.Client{Jar: jar},
+		},
+	}
+	c.Manager = lifecycle.NewManager(name, cfg, db, c, notifier)
+
+	return c, nil
+}
+
+func (c *Client) AddMetaInfo(ctx context.Context, t *lifecycle.NewTorrent) error {
+	mi, err := metainfo.Load(bytes.NewReader(t.MetaInfo))
+	if err != nil {
+		return err
+	}
+	hash := mi.HashInfoBytes().HexString()
+
+	// qBittorrent fails on duplicates, e.g. the torrent is also picked up from
+	// a watched TorrentsDir.
+	existing, err := c.api.torrentsInfo(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+
+	return c.api.addTorrent(ctx, hash+".torrent", t.MetaInfo, t.DownloadDir, t.Labels)
+}
+
+func (c *Client) Torrents(ctx context.Context) ([]*lifecycle.Torrent, error) {
+	torrents, err := c.api.torrentsInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*lifecycle.Torrent{}
+	for _, t := range torrents {
+		res = append(res, &lifecycle.Torrent{
+			Hash:         t.Hash,
+			Name:         t.Name,
+			PercentDone:  t.Progress,
+			Seeding:      seedingStates[t.State],
+			UploadedEver: t.Uploaded,
+			DownloadDir:  t.SavePath,
+			Ratio:        t.Ratio,
+			SeedingTime:  time.Duration(t.SeedingTime) * time.Second,
+		})
+	}
+
+	return res, nil
+}
+
+func (c *Client) Files(ctx context.Context, t *lifecycle.Torrent) ([]lifecycle.File, error) {
+	files, err := c.api.torrentFiles(ctx, t.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []lifecycle.File{}
+	for _, f := range files {
+		res = append(res, lifecycle.File{Name: f.Name, Length: f.Size})
+	}
+	return res, nil
+}
+
+func (c *Client) MetaInfo(ctx context.Context, t *lifecycle.Torrent) ([]byte, error) {
+	return c.api.exportTorrent(ctx, t.Hash)
+}
+
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	info, err := c.api.transferInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return info.DlInfoSpeed, nil
+}
+
+func torrentHashes(torrents []*lifecycle.Torrent) []string {
+	hashes := []string{}
+	for _, t := range torrents {
+		hashes = append(hashes, t.Hash)
+	}
+	return hashes
+}
+
+func (c *Client) StartTorrents(ctx context.Context, torrents []*lifecycle.Torrent) error {
+	return c.api.startTorrents(ctx, torrentHashes(torrents))
+}
+
+func (c *Client) StopTorrents(ctx context.Context, torrents []*lifecycle.Torrent) error {
+	return c.api.stopTorrents(ctx, torrentHashes(torrents))
+}
+
+func (c *Client) RemoveTorrents(ctx context.Context, torrents []*lifecycle.Torrent, deleteData bool) error {
+	return c.api.deleteTorrents(ctx, torrentHashes(torrents), deleteData)
+}
@@ -0,0 +1,563 @@
+package qbittorrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/hub"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type request struct {
+	Path string
+	Form url.Values
+	File []byte
+}
+
+// fake qBittorrent WebUI API server
+type fakeQBittorrent struct {
+	reqs []*request
+
+	torrents []torrentInfo
+	files    map[string][]torrentFile
+	transfer *transferInfo
+	metaInfo map[string][]byte
+
+	// paths respond 404, to simulate older versions of qBittorrent.
+	notFound map[string]bool
+	// torrents/add responds "Fails.".
+	addFails bool
+
+	loggedIn bool
+}
+
+func (f *fakeQBittorrent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &request{Path: r.URL.Path}
+	if err := r.ParseMultipartForm(1 << 20); err == nil {
+		if file, _, err := r.FormFile("torrents"); err == nil {
+			req.File, _ = io.ReadAll(file)
+		}
+	} else {
+		r.ParseForm()
+	}
+	req.Form = r.Form
+	f.reqs = append(f.reqs, req)
+
+	if r.URL.Path == "/api/v2/auth/login" {
+		if r.Form.Get("username") != "admin" || r.Form.Get("password") != "pass" {
+			w.Write([]byte("Fails."))
+			return
+		}
+		f.loggedIn = true
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: "sid", Path: "/"})
+		w.Write([]byte("Ok."))
+		return
+	}
+
+	if c, err := r.Cookie("SID"); !f.loggedIn || err != nil || c.Value != "sid" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if f.notFound[r.URL.Path] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/v2/torrents/info":
+		torrents := []torrentInfo{}
+		for _, t := range f.torrents {
+			if h := r.Form.Get("hashes"); h == "" || h == t.Hash {
+				torrents = append(torrents, t)
+			}
+		}
+		json.NewEncoder(w).Encode(torrents)
+	case "/api/v2/torrents/add":
+		if f.addFails {
+			w.Write([]byte("Fails."))
+			return
+		}
+		w.Write([]byte("Ok."))
+	case "/api/v2/torrents/files":
+		json.NewEncoder(w).Encode(f.files[r.Form.Get("hash")])
+	case "/api/v2/torrents/export":
+		b, ok := f.metaInfo[r.Form.Get("hash")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	case "/api/v2/transfer/info":
+		json.NewEncoder(w).Encode(f.transfer)
+	default:
+		w.Write([]byte("Ok."))
+	}
+}
+
+func (f *fakeQBittorrent) paths() []string {
+	paths := []string{}
+	for _, r := range f.reqs {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+func setup(t *testing.T, fake *fakeQBittorrent, conf *config.DownloaderConfig) (*Client, *gorm.DB) {
+	t.Helper()
+
+	serv := httptest.NewServer(fake)
+	t.Cleanup(serv.Close)
+
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	conf.QBittorrent.URL = serv.URL
+	conf.QBittorrent.Username = "admin"
+	conf.QBittorrent.Password = "pass"
+
+	client, err := New("test", conf, d, nil)
+	require.NoError(t, err)
+
+	return client, d
+}
+
+func TestLogin(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fake := &fakeQBittorrent{}
+		client, _ := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{}})
+
+		_, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+
+		// first request is rejected, then login and retry.
+		assert.Equal(t, []string{
+			"/api/v2/torrents/info",
+			"/api/v2/auth/login",
+			"/api/v2/torrents/info",
+		}, fake.paths())
+
+		// session cookie is reused.
+		_, err = client.Torrents(t.Context())
+		require.NoError(t, err)
+		assert.Len(t, fake.reqs, 4)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		fake := &fakeQBittorrent{}
+		client, _ := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{}})
+		client.api.password = "wrong"
+
+		_, err := client.Torrents(t.Context())
+		assert.ErrorContains(t, err, "qbittorrent login failed")
+	})
+}
+
+func TestTorrents(t *testing.T) {
+	fake := &fakeQBittorrent{
+		torrents: []torrentInfo{
+			{Hash: "1", Name: "Torrent 1", State: "uploading", Progress: 1, Uploaded: 100, SavePath: "/downloads", Ratio: 1.5, SeedingTime: 3600},
+		},
+	}
+	client, _ := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{}})
+
+	torrents, err := client.Torrents(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []*lifecycle.Torrent{{
+		Hash:         "1",
+		Name:         "Torrent 1",
+		PercentDone:  1,
+		Seeding:      true,
+		UploadedEver: 100,
+		DownloadDir:  "/downloads",
+		Ratio:        1.5,
+		SeedingTime:  time.Hour,
+	}}, torrents)
+}
+
+func TestMetaInfo(t *testing.T) {
+	b, hash := testTorrent(t)
+	fake := &fakeQBittorrent{metaInfo: map[string][]byte{hash: b}}
+	client, _ := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{}})
+
+	t.Run("success", func(t *testing.T) {
+		got, err := client.MetaInfo(context.Background(), &lifecycle.Torrent{Hash: hash})
+		require.NoError(t, err)
+		assert.Equal(t, b, got)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := client.MetaInfo(context.Background(), &lifecycle.Torrent{Hash: "unknown"})
+		assert.Error(t, err)
+	})
+}
+
+func TestCheckDailySeeding(t *testing.T) {
+	fake := &fakeQBittorrent{
+		torrents: []torrentInfo{
+			{Hash: "1", Name: "Torrent 1", State: "uploading", Progress: 1, Uploaded: 100},
+			{Hash: "2", Name: "Torrent 2", State: "stalledUP", Progress: 1, Uploaded: 1025 * 1024},
+			{Hash: "3", Name: "Torrent 3", State: "uploading", Progress: 1, Uploaded: 1000 * 1024},
+			{Hash: "4", Name: "Torrent 4", State: "stoppedUP", Progress: 1, Uploaded: 1000 * 1024},
+			// 5 is brand new, insert to db
+			{Hash: "5", Name: "Torrent 5", State: "uploading", Progress: 1, Uploaded: 1000 * 1024},
+		},
+		// qBittorrent < 5.0 only has pause.
+		notFound: map[string]bool{"/api/v2/torrents/stop": true},
+	}
+
+	client, d := setup(t, fake, &config.DownloaderConfig{
+		QBittorrent: &config.QBittorrentConfig{},
+		SeedingPolicy: &config.SeedingPolicy{
+			IntervalInDays:    3,
+			UploadAtLeastInMB: 1,
+		},
+	})
+
+	today := time.Now().Format("2006-01-02")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	threeDaysAgo := time.Now().AddDate(0, 0, -3).Format("2006-01-02")
+
+	// r1 is current seeding, less then 3 day
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:              "1",
+		Downloader:      "test",
+		UploadHistories: map[string]int64{yesterday: 0},
+		State:           db.DownloadSeeding,
+	}).Error)
+
+	// r2 is current seeding, uploaded more than 1MB in 3 days, it will continue seeding
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:              "2",
+		Downloader:      "test",
+		UploadHistories: map[string]int64{threeDaysAgo: 0},
+		State:           db.DownloadSeeding,
+	}).Error)
+
+	// r3 is current seeding, uploaded less than 1MB in 3 days, it will stop seeding
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:              "3",
+		Downloader:      "test",
+		UploadHistories: map[string]int64{threeDaysAgo: 0},
+		State:           db.DownloadSeeding,
+	}).Error)
+
+	// r4 is stopped and moved, it will be deleted
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:              "4",
+		Downloader:      "test",
+		UploadHistories: map[string]int64{threeDaysAgo: 0},
+		State:           db.DownloadStopped,
+		MoveState:       db.Moved,
+	}).Error)
+
+	client.CheckDailySeeding()
+
+	assert.Equal(t, []string{
+		"/api/v2/torrents/info",
+		"/api/v2/auth/login",
+		"/api/v2/torrents/info",
+		"/api/v2/torrents/stop",
+		"/api/v2/torrents/pause",
+		"/api/v2/torrents/delete",
+	}, fake.paths())
+	assert.Equal(t, "3", fake.reqs[4].Form.Get("hashes"))
+	assert.Equal(t, "4", fake.reqs[5].Form.Get("hashes"))
+	assert.Equal(t, "true", fake.reqs[5].Form.Get("deleteFiles"))
+
+	{
+		r, err := db.GetDownloadStatus(d, "1")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{yesterday: 0, today: 100}, r.UploadHistories)
+		assert.Equal(t, db.DownloadSeeding, r.State)
+	}
+
+	{
+		r, err := db.GetDownloadStatus(d, "2")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadSeeding, r.State)
+	}
+
+	{
+		r, err := db.GetDownloadStatus(d, "3")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadStopped, r.State)
+	}
+
+	{
+		r, err := db.GetDownloadStatus(d, "4")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadDeleted, r.State)
+	}
+
+	{
+		r, err := db.GetDownloadStatus(d, "5")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{today: 1000 * 1024}, r.UploadHistories)
+		assert.Equal(t, "Torrent 5", r.ResTitle)
+	}
+}
+
+func TestProgressChecker(t *testing.T) {
+	tmpDir := t.TempDir()
+	downloadDir := filepath.Join(tmpDir, "download")
+	finishedDir := filepath.Join(tmpDir, "finished")
+	require.NoError(t, os.Mkdir(downloadDir, 0755))
+	require.NoError(t, os.Mkdir(finishedDir, 0755))
+
+	// files of r2
+	require.NoError(t, os.WriteFile(filepath.Join(downloadDir, "r2.txt"), []byte("hello world"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(downloadDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(downloadDir, "sub", "r2.txt"), []byte("hello sub world"), 0644))
+
+	fake := &fakeQBittorrent{
+		torrents: []torrentInfo{
+			{Hash: "1", Name: "Torrent 1", State: "downloading", Progress: 0.5, SavePath: downloadDir},
+			{Hash: "2", Name: "Torrent 2", State: "uploading", Progress: 1, SavePath: downloadDir},
+		},
+		files: map[string][]torrentFile{
+			"2": {
+				{Name: "r2.txt", Size: 11, Progress: 1},
+				{Name: "sub/r2.txt", Size: 15, Progress: 1},
+			},
+		},
+		transfer: &transferInfo{DlInfoSpeed: 1000},
+	}
+
+	client, d := setup(t, fake, &config.DownloaderConfig{
+		QBittorrent: &config.QBittorrentConfig{
+			DownloadDir: downloadDir,
+			FinishedDir: finishedDir,
+		},
+	})
+
+	// r1 is downloading
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:         "1",
+		Downloader: "test",
+		State:      db.DownloadStarted,
+	}).Error)
+
+	// r2 finished downloading but the status is not updated yet
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:         "2",
+		Downloader: "test",
+		State:      db.DownloadStarted,
+		MoveState:  db.UnMoved,
+	}).Error)
+
+	client.ProgressChecker()
+
+	assert.Equal(t, []string{
+		"/api/v2/torrents/info",
+		"/api/v2/auth/login",
+		"/api/v2/torrents/info",
+		"/api/v2/transfer/info",
+		"/api/v2/torrents/files",
+	}, fake.paths())
+
+	{
+		// r1 progress updated
+		r, err := db.GetDownloadStatus(d, "1")
+		require.NoError(t, err)
+		assert.Equal(t, int32(500), r.DownloadProgress)
+		assert.Equal(t, db.DownloadStarted, r.State)
+	}
+
+	{
+		// r2 seeding and moved
+		r, err := db.GetDownloadStatus(d, "2")
+		require.NoError(t, err)
+		assert.Equal(t, int32(1000), r.DownloadProgress)
+		assert.Equal(t, db.DownloadSeeding, r.State)
+		assert.Equal(t, db.Moved, r.MoveState)
+
+		content, err := os.ReadFile(filepath.Join(finishedDir, "2", "r2.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(content))
+
+		content, err = os.ReadFile(filepath.Join(finishedDir, "2", "sub", "r2.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello sub world", string(content))
+	}
+}
+
+func testTorrent(t *testing.T) ([]byte, string) {
+	t.Helper()
+
+	info := metainfo.Info{
+		Name:        "test.txt",
+		PieceLength: 16 * 1024,
+		Length:      11,
+		Pieces:      make([]byte, 20),
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+	buf := &bytes.Buffer{}
+	require.NoError(t, mi.Write(buf))
+
+	return buf.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+func TestAddTorrent(t *testing.T) {
+	torrent, hash := testTorrent(t)
+
+	t.Run("success", func(t *testing.T) {
+		fake := &fakeQBittorrent{}
+		client, _ := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{DownloadDir: "/downloads"}})
+
+		added, err := client.AddTorrent(&lifecycle.NewTorrent{
+			MetaInfo: torrent,
+			Labels:   []string{"nyaa", "anime"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, &lifecycle.AddResult{Hash: hash}, added)
+
+		assert.Equal(t, []string{
+			"/api/v2/torrents/info",
+			"/api/v2/auth/login",
+			"/api/v2/torrents/info",
+			"/api/v2/torrents/add",
+		}, fake.paths())
+		assert.Equal(t, hash, fake.reqs[2].Form.Get("hashes"))
+		assert.Equal(t, "/downloads", fake.reqs[3].Form.Get("savepath"))
+		assert.Equal(t, "nyaa,anime", fake.reqs[3].Form.Get("tags"))
+		assert.Equal(t, torrent, fake.reqs[3].File)
+	})
+
+	t.Run("already added", func(t *testing.T) {
+		fake := &fakeQBittorrent{
+			torrents: []torrentInfo{{Hash: hash, Name: "test.txt", State: "downloading"}},
+		}
+		client, _ := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{}})
+
+		_, err := client.AddTorrent(&lifecycle.NewTorrent{MetaInfo: torrent})
+		require.NoError(t, err)
+		assert.NotContains(t, fake.paths(), "/api/v2/torrents/add")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			metainfo []byte
+			addFails bool
+			wantErr  string
+		}{
+			{
+				name:     "invalid metainfo",
+				metainfo: []byte("invalid"),
+				wantErr:  "invalid metainfo",
+			},
+			{
+				name:     "rejected",
+				metainfo: torrent,
+				addFails: true,
+				wantErr:  "qbittorrent failed to add torrent",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fake := &fakeQBittorrent{addFails: tt.addFails}
+				client, _ := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{}})
+
+				_, err := client.AddTorrent(&lifecycle.NewTorrent{MetaInfo: tt.metainfo})
+				assert.ErrorContains(t, err, tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestTorrentActions(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fake := &fakeQBittorrent{
+			torrents: []torrentInfo{
+				{Hash: "1", Name: "Torrent 1", State: "downloading", Progress: 0.5},
+			},
+		}
+		client, d := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{}})
+
+		s := &db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadStarted, DownloadProgress: 500}
+		require.NoError(t, d.Create(s).Error)
+
+		get := func() *db.DownloadStatus {
+			r, err := db.GetDownloadStatus(d, "1")
+			require.NoError(t, err)
+			return r
+		}
+
+		require.NoError(t, client.PauseTorrent(s))
+		assert.Equal(t, "/api/v2/torrents/stop", fake.reqs[len(fake.reqs)-1].Path)
+		assert.True(t, get().Paused)
+		assert.Equal(t, db.DownloadStarted, get().State)
+
+		require.NoError(t, client.ResumeTorrent(s))
+		assert.Equal(t, "/api/v2/torrents/start", fake.reqs[len(fake.reqs)-1].Path)
+		assert.False(t, get().Paused)
+
+		published, unsubscribe := hub.Default.Subscribe()
+		t.Cleanup(unsubscribe)
+
+		require.NoError(t, client.StopTorrent(s))
+		assert.Equal(t, "/api/v2/torrents/stop", fake.reqs[len(fake.reqs)-1].Path)
+		assert.Equal(t, db.DownloadStopped, get().State)
+		assert.Equal(t, db.StopUser, get().StopReason)
+		assert.Equal(t, &hub.Event{Type: hub.DownloadEvent, Data: &hub.DownloadEventData{
+			Type: "stopped", ID: "1", Downloader: "test", Title: "1", Reason: events.ReasonUser,
+		}}, <-published)
+
+		// resume a stopped torrent continues downloading.
+		require.NoError(t, client.ResumeTorrent(s))
+		assert.Equal(t, db.DownloadStarted, get().State)
+		assert.Empty(t, get().StopReason)
+
+		require.NoError(t, client.DeleteTorrent(s, true))
+		last := fake.reqs[len(fake.reqs)-1]
+		assert.Equal(t, "/api/v2/torrents/delete", last.Path)
+		assert.Equal(t, "1", last.Form.Get("hashes"))
+		assert.Equal(t, "true", last.Form.Get("deleteFiles"))
+		assert.Equal(t, db.DownloadDeleted, get().State)
+		assert.Equal(t, &hub.Event{Type: hub.DownloadEvent, Data: &hub.DownloadEventData{
+			Type: "deleted", ID: "1", Downloader: "test", Title: "1", Reason: events.ReasonUser,
+		}}, <-published)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		fake := &fakeQBittorrent{}
+		client, d := setup(t, fake, &config.DownloaderConfig{QBittorrent: &config.QBittorrentConfig{}})
+
+		s := &db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadStarted}
+		require.NoError(t, d.Create(s).Error)
+
+		assert.ErrorIs(t, client.PauseTorrent(s), lifecycle.ErrTorrentNotFound)
+		assert.ErrorIs(t, client.ResumeTorrent(s), lifecycle.ErrTorrentNotFound)
+		assert.ErrorIs(t, client.StopTorrent(s), lifecycle.ErrTorrentNotFound)
+
+		// deleting a torrent already removed from the client only updates the state.
+		require.NoError(t, client.DeleteTorrent(s, false))
+		assert.NotContains(t, fake.paths(), "/api/v2/torrents/delete")
+
+		r, err := db.GetDownloadStatus(d, "1")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadDeleted, r.State)
+	})
+}
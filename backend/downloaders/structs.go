@@ -4,7 +4,11 @@ import (
 	"fmt"
 
 	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/downloaders/qbittorrent"
 	"github.com/charleshuang3/autoget/backend/downloaders/transmission"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
 	"github.com/robfig/cron/v3"
 	"gorm.io/gorm"
 )
@@ -12,15 +16,33 @@ import (
 type IDownloader interface {
 	RegisterCronjobs(cron *cron.Cron)
 	RegisterDailySeedingChecker(cron *cron.Cron)
-	ProgressChecker()
+	// ProgressChecker runs a progress check, it is also scheduled by
+	// RegisterCronjobs.
+	ProgressChecker() (*lifecycle.CheckResult, error)
 	TorrentsDir() string
 	DownloadDir() string
+	// AddTorrent to the torrent client, errors if the client rejects it. The
+	// torrent is queued if the download dir is low on space.
+	AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error)
+
+	// Actions on a torrent, they update the given status in db.
+	PauseTorrent(s *db.DownloadStatus) error
+	ResumeTorrent(s *db.DownloadStatus) error
+	StopTorrent(s *db.DownloadStatus) error
+	DeleteTorrent(s *db.DownloadStatus, deleteData bool) error
 }
 
-func New(name string, cfg *config.DownloaderConfig, db *gorm.DB) (IDownloader, error) {
-	if cfg.Transmission == nil {
-		return nil, fmt.Errorf("Unknown downloader %s", name)
+// New creates the configured downloader, notifier is optional.
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, notifier events.IEventNotifier) (IDownloader, error) {
+	if cfg.Transmission != nil {
+		return transmission.New(name, cfg, db, notifier)
+	}
+	if cfg.QBittorrent != nil {
+		return qbittorrent.New(name, cfg, db, notifier)
+	}
+	if cfg.Embedded != nil {
+		return newEmbedded(name, cfg, db, notifier)
 	}
 
-	return transmission.New(name, cfg, db)
+	return nil, fmt.Errorf("Unknown downloader %s", name)
 }
@@ -2,36 +2,40 @@ package transmission
 
 import (
 	"context"
-	"errors"
-	"io"
+	"encoding/base64"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
-	"time"
+	"sync"
 
 	"github.com/charleshuang3/autoget/backend/downloaders/config"
-	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
 	"github.com/hekmon/transmissionrpc/v3"
-	"github.com/robfig/cron/v3"
-	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 )
 
 var (
-	logger = log.With().Str("component", "transmission").Logger()
+	_ lifecycle.TorrentClient  = (*Client)(nil)
+	_ lifecycle.MetaInfoClient = (*Client)(nil)
 
 	httpClient = http.DefaultClient
 )
 
 type Client struct {
+	*lifecycle.Manager
+
 	client *transmissionrpc.Client
-	name   string
-	db     *gorm.DB
-	cfg    *config.DownloaderConfig
+
+	// files of torrents from the last Torrents() call, transmission returns
+	// them with torrent-get so no extra request is needed.
+	filesMu sync.Mutex
+	files   map[string][]lifecycle.File
+	// torrentFiles are the .torrent files kept by transmission.
+	torrentFiles map[string]string
 }
 
-func New(name string, cfg *config.DownloaderConfig, db *gorm.DB) (*Client, error) {
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, notifier events.IEventNotifier) (*Client, error) {
 	u, err := url.Parse(cfg.Transmission.URL)
 	if err != nil {
 		return nil, err
@@ -48,249 +52,120 @@ func New(name string, cfg *config.DownloaderConfig, db *gorm.DB) (*Client, error
 		return nil, err
 	}
 
-	return &Client{
-		client: client,
-		name:   name,
-		db:     db,
-		cfg:    cfg,
-	}, nil
-}
-
-func (c *Client) RegisterCronjobs(cron *cron.Cron) {
-	c.RegisterDailySeedingChecker(cron)
+	c := &Client{
+		client:       client,
+		files:        map[string][]lifecycle.File{},
+		torrentFiles: map[string]string{},
+	}
+	c.Manager = lifecycle.NewManager(name, cfg, db, c, notifier)
 
-	go func() {
-		time.Sleep(time.Minute)
-		c.ProgressChecker()
-	}()
+	return c, nil
 }
 
-func toTorrentsByHash(torrents []transmissionrpc.Torrent) map[string]*transmissionrpc.Torrent {
-	torrentsByHash := make(map[string]*transmissionrpc.Torrent)
-	for _, t := range torrents {
-		torrentsByHash[*t.HashString] = &t
-	}
-	return torrentsByHash
+func (c *Client) AddMetaInfo(ctx context.Context, t *lifecycle.NewTorrent) error {
+	metainfo := base64.StdEncoding.EncodeToString(t.MetaInfo)
+	_, err := c.client.TorrentAdd(ctx, transmissionrpc.TorrentAddPayload{
+		MetaInfo:    &metainfo,
+		DownloadDir: &t.DownloadDir,
+		Labels:      t.Labels,
+	})
+	return err
 }
 
-func (c *Client) ProgressChecker() {
-	torrents, err := c.client.TorrentGetAll(context.Background())
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get all torrents")
-		return
-	}
-
-	torrentsByHash := toTorrentsByHash(torrents)
-
-	statuses, err := db.GetUnfinishedDownloadStatusByDownloader(c.db, c.name)
+func (c *Client) Torrents(ctx context.Context) ([]*lifecycle.Torrent, error) {
+	torrents, err := c.client.TorrentGetAll(ctx)
 	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get download status")
-		return
+		return nil, err
 	}
 
-	for _, s := range statuses {
-		t, ok := torrentsByHash[s.ID]
-		if !ok {
-			continue
+	files := map[string][]lifecycle.File{}
+	torrentFiles := map[string]string{}
+	res := []*lifecycle.Torrent{}
+	for _, t := range torrents {
+		lt := &lifecycle.Torrent{
+			ID:      *t.ID,
+			Hash:    *t.HashString,
+			Seeding: *t.Status == transmissionrpc.TorrentStatusSeed,
 		}
-
-		s.DownloadProgress = int32(*t.PercentDone * 1000)
-		if *t.Status == transmissionrpc.TorrentStatusSeed {
-			s.State = db.DownloadSeeding
+		if t.Name != nil {
+			lt.Name = *t.Name
 		}
-		db.SaveDownloadStatus(c.db, &s)
-	}
-
-	// check if transmission is actively downloading.
-	stats, err := c.client.SessionStats(context.Background())
-	if err != nil {
-		logger.Err(err).Str("name", c.name).Msg("failed to get session stats")
-	}
-
-	// if downloadSpeed > 2M/s, consider transimission is still busy
-	if stats.DownloadSpeed > 2*1000*1000 {
-		return
-	}
-
-	// start copys
-	statuses, err = db.GetFinishedUnmoveedDownloadStatusByDownloader(c.db, c.name)
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get seeding download status")
-		return
-	}
-
-	for _, s := range statuses {
-		t, ok := torrentsByHash[s.ID]
-		if !ok {
-			continue
+		if t.PercentDone != nil {
+			lt.PercentDone = *t.PercentDone
 		}
-
-		success := true
-		for _, f := range t.Files {
-			from := filepath.Join(*t.DownloadDir, f.Name)
-			target := filepath.Join(c.cfg.Transmission.FinishedDir, s.ID, f.Name)
-
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				success = false
-				logger.Error().Err(err).Str("name", c.name).Msg("failed to create parent directory for copied file")
-				break
-			}
-
-			fromFile, err := os.Open(from)
-			if err != nil {
-				success = false
-				logger.Error().Err(err).Str("name", c.name).Msg("failed to open file")
-				break
-			}
-			defer fromFile.Close()
-
-			targetFile, err := os.Create(target)
-			if err != nil {
-				success = false
-				logger.Error().Err(err).Str("name", c.name).Msg("failed to create file")
-				break
-			}
-			defer targetFile.Close()
-
-			_, err = io.Copy(targetFile, fromFile)
-			if err != nil {
-				success = false
-				logger.Error().Err(err).Str("name", c.name).Msg("failed to copy file")
-				break
-			}
+		if t.UploadedEver != nil {
+			lt.UploadedEver = *t.UploadedEver
 		}
-
-		if success {
-			s.MoveState = db.Moved
-			db.SaveDownloadStatus(c.db, &s)
+		if t.DownloadDir != nil {
+			lt.DownloadDir = *t.DownloadDir
 		}
-	}
-}
-
-func (c *Client) RegisterDailySeedingChecker(cron *cron.Cron) {
-	if c.cfg.SeedingPolicy == nil {
-		return
-	}
-
-	cron.AddFunc("0 0 8 * * *", func() {
-		c.checkDailySeeding()
-	})
-}
-
-func (c *Client) checkDailySeeding() {
-	torrents, err := c.client.TorrentGetAll(context.Background())
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get all torrents")
-		return
-	}
-
-	torrentsByHash := toTorrentsByHash(torrents)
-
-	c.stopTorrents(torrents)
-	c.removeTorrents(torrentsByHash)
-}
-
-func (c *Client) stopTorrents(torrents []transmissionrpc.Torrent) {
-	stopIDs := []string{}
-	stopTorIDs := []int64{}
-
-	for _, t := range torrents {
-		// only check seeding torrents
-		if *t.Status != transmissionrpc.TorrentStatusSeed {
-			continue
+		// the ratio is negative if nothing is downloaded.
+		if t.UploadRatio != nil && *t.UploadRatio > 0 {
+			lt.Ratio = *t.UploadRatio
 		}
-
-		hash := (*t.HashString)
-		uploaded := *t.UploadedEver
-
-		ss, err := db.GetDownloadStatus(c.db, hash)
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ss.ID = hash
-			ss.Downloader = c.name
-			ss.State = db.DownloadSeeding
-			ss.UploadHistories = make(map[string]int64)
-			ss.ResTitle = *t.Name
-			ss.AddToday(uploaded)
-			db.SaveDownloadStatus(c.db, ss)
-
-			continue
+		if t.TimeSeeding != nil {
+			lt.SeedingTime = *t.TimeSeeding
 		}
-		ss.CleanupHistory()
-		ss.AddToday(uploaded)
-
-		db.SaveDownloadStatus(c.db, ss)
-
-		before, ok := ss.GetXDayBefore(int(c.cfg.SeedingPolicy.IntervalInDays))
-		if !ok {
-			continue
+		if t.TorrentFile != nil {
+			torrentFiles[lt.Hash] = *t.TorrentFile
 		}
+		res = append(res, lt)
 
-		if (uploaded - before) > c.cfg.SeedingPolicy.UploadAtLeastInMB*1024*1024 {
-			continue
+		for _, f := range t.Files {
+			files[lt.Hash] = append(files[lt.Hash], lifecycle.File{Name: f.Name, Length: f.Length})
 		}
-
-		// stop this torrent
-		stopTorIDs = append(stopTorIDs, *t.ID)
-		stopIDs = append(stopIDs, hash)
 	}
 
-	// nothing to stop
-	if len(stopTorIDs) == 0 {
-		return
-	}
-
-	// stop torrents
-	if err := c.client.TorrentStopIDs(context.Background(), stopTorIDs); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to stop torrents")
-		return
-	}
+	c.filesMu.Lock()
+	c.files = files
+	c.torrentFiles = torrentFiles
+	c.filesMu.Unlock()
 
-	// update state in db
-	if err := db.UpdateDownloadStateForStatuses(c.db, stopIDs, db.DownloadStopped); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to update download status")
-		return
-	}
+	return res, nil
 }
 
-func (c *Client) removeTorrents(torrentsByHash map[string]*transmissionrpc.Torrent) {
-	statuses, err := db.GetStoppedMovedDownloadStatusByDownloader(c.db, c.name)
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get stopped download status")
-		return
-	}
-
-	deleteStatusIDs := []string{}
-	deleteTorIDs := []int64{}
-	for _, s := range statuses {
-		t, ok := torrentsByHash[s.ID]
-		if !ok {
-			continue
-		}
+func (c *Client) Files(ctx context.Context, t *lifecycle.Torrent) ([]lifecycle.File, error) {
+	c.filesMu.Lock()
+	defer c.filesMu.Unlock()
+	return c.files[t.Hash], nil
+}
 
-		deleteTorIDs = append(deleteTorIDs, *t.ID)
-		deleteStatusIDs = append(deleteStatusIDs, s.ID)
+// MetaInfo reads the .torrent file kept by transmission, it needs to be
+// accessible at the same path.
+func (c *Client) MetaInfo(ctx context.Context, t *lifecycle.Torrent) ([]byte, error) {
+	c.filesMu.Lock()
+	p, ok := c.torrentFiles[t.Hash]
+	c.filesMu.Unlock()
+	if !ok {
+		return nil, lifecycle.ErrTorrentNotFound
 	}
+	return os.ReadFile(p)
+}
 
-	// nothing to delete
-	if len(deleteTorIDs) == 0 {
-		return
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	stats, err := c.client.SessionStats(ctx)
+	if err != nil {
+		return 0, err
 	}
+	return stats.DownloadSpeed, nil
+}
 
-	// delete torrents
-	if err := c.client.TorrentRemove(context.Background(), transmissionrpc.TorrentRemovePayload{IDs: deleteTorIDs, DeleteLocalData: true}); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to delete torrents")
-		return
+func torrentIDs(torrents []*lifecycle.Torrent) []int64 {
+	ids := []int64{}
+	for _, t := range torrents {
+		ids = append(ids, t.ID)
 	}
+	return ids
+}
 
-	if err := db.UpdateDownloadStateForStatuses(c.db, deleteStatusIDs, db.DownloadDeleted); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to update download status")
-	}
+func (c *Client) StartTorrents(ctx context.Context, torrents []*lifecycle.Torrent) error {
+	return c.client.TorrentStartIDs(ctx, torrentIDs(torrents))
 }
 
-func (c *Client) TorrentsDir() string {
-	return c.cfg.Transmission.TorrentsDir
+func (c *Client) StopTorrents(ctx context.Context, torrents []*lifecycle.Torrent) error {
+	return c.client.TorrentStopIDs(ctx, torrentIDs(torrents))
 }
 
-func (c *Client) DownloadDir() string {
-	return c.cfg.Transmission.DownloadDir
+func (c *Client) RemoveTorrents(ctx context.Context, torrents []*lifecycle.Torrent, deleteData bool) error {
+	return c.client.TorrentRemove(ctx, transmissionrpc.TorrentRemovePayload{IDs: torrentIDs(torrents), DeleteLocalData: deleteData})
 }
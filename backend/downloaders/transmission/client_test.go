@@ -1,6 +1,8 @@
 package transmission
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,11 +12,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
 	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/hub"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
 	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 type requestPayload struct {
@@ -37,6 +47,8 @@ type answerPayload struct {
 type fakeTransmission struct {
 	reqs []*requestPayload
 	resp []any
+	// result overrides "success" to make the rpc fail.
+	result string
 }
 
 func (f *fakeTransmission) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -56,10 +68,21 @@ func (f *fakeTransmission) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Result:    "success",
 		Tag:       req.Tag,
 	}
+	if f.result != "" {
+		resp.Result = f.result
+	}
 
 	json.NewEncoder(w).Encode(resp)
 }
 
+type fakeEvents struct {
+	events []*events.Event
+}
+
+func (f *fakeEvents) Notify(e *events.Event) {
+	f.events = append(f.events, e)
+}
+
 func newTorrent(id int64, hash string, status transmissionrpc.TorrentStatus, uploaded int64) transmissionrpc.Torrent {
 	name := fmt.Sprintf("Torrent %d", id)
 	return transmissionrpc.Torrent{
@@ -82,7 +105,7 @@ func TestCheckDailySeeding(t *testing.T) {
 		serv.Close()
 	})
 
-	d, err := db.SqliteForTest()
+	d, err := db.ForTest(t)
 	require.NoError(t, err)
 
 	conf := &config.DownloaderConfig{
@@ -95,9 +118,14 @@ func TestCheckDailySeeding(t *testing.T) {
 		},
 	}
 
-	client, err := New("test", conf, d)
+	ev := &fakeEvents{}
+	client, err := New("test", conf, d, ev)
 	require.NoError(t, err)
 
+	stopped := metrics.SeedingPolicyActions.WithLabelValues("test", metrics.ActionStop)
+	removed := metrics.SeedingPolicyActions.WithLabelValues("test", metrics.ActionRemove)
+	stoppedBefore, removedBefore := testutil.ToFloat64(stopped), testutil.ToFloat64(removed)
+
 	today := time.Now().Format("2006-01-02")
 	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
 	threeDaysAgo := time.Now().AddDate(0, 0, -3).Format("2006-01-02")
@@ -130,6 +158,7 @@ func TestCheckDailySeeding(t *testing.T) {
 	r3 := &db.DownloadStatus{
 		ID:         "3",
 		Downloader: "test",
+		ResTitle:   "Title 3",
 		UploadHistories: map[string]int64{
 			threeDaysAgo: 0,
 		},
@@ -145,8 +174,9 @@ func TestCheckDailySeeding(t *testing.T) {
 		UploadHistories: map[string]int64{
 			threeDaysAgo: 0,
 		},
-		State:     db.DownloadStopped,
-		MoveState: db.Moved,
+		State:      db.DownloadStopped,
+		MoveState:  db.Moved,
+		StopReason: db.StopMaxSeedTime,
 	}
 	require.NoError(t, d.Create(r4).Error)
 
@@ -165,7 +195,7 @@ func TestCheckDailySeeding(t *testing.T) {
 		&struct{}{},
 	}
 
-	client.checkDailySeeding()
+	client.CheckDailySeeding()
 
 	assert.Len(t, fake.reqs, 3)
 	assert.Equal(t, "torrent-get", fake.reqs[0].Method)
@@ -195,13 +225,15 @@ func TestCheckDailySeeding(t *testing.T) {
 	}
 
 	{
-		// r3 new history item added.
+		// r3 new history item added and stopped by the upload rule.
 		r := &db.DownloadStatus{}
 		require.NoError(t, d.First(r, "id = ?", "3").Error)
 		assert.Equal(t, map[string]int64{
 			threeDaysAgo: 0,
 			today:        1000 * 1024,
 		}, r.UploadHistories)
+		assert.Equal(t, db.DownloadStopped, r.State)
+		assert.Equal(t, db.StopUploadRule, r.StopReason)
 	}
 
 	{
@@ -220,6 +252,152 @@ func TestCheckDailySeeding(t *testing.T) {
 			today: 1000 * 1024,
 		}, r.UploadHistories)
 	}
+
+	assert.Equal(t, []*events.Event{
+		{Type: events.Stopped, Downloader: "test", Hash: "3", Title: "Title 3", Reason: "upload_rule"},
+		{Type: events.Deleted, Downloader: "test", Hash: "4", Title: "4", Reason: "max_seed_time"},
+	}, ev.events)
+
+	assert.Equal(t, stoppedBefore+1, testutil.ToFloat64(stopped))
+	assert.Equal(t, removedBefore+1, testutil.ToFloat64(removed))
+}
+
+func TestCheckDailySeedingRules(t *testing.T) {
+	threeDaysAgo := time.Now().AddDate(0, 0, -3).Format("2006-01-02")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	uploadRule := config.SeedingPolicy{IntervalInDays: 3, UploadAtLeastInMB: 1}
+
+	tests := []struct {
+		name        string
+		policy      config.SeedingPolicy
+		indexer     string
+		histories   map[string]int64
+		ratio       float64
+		seedingTime time.Duration
+		want        db.StopReason
+	}{
+		{
+			name:      "upload rule",
+			policy:    uploadRule,
+			histories: map[string]int64{threeDaysAgo: 0},
+			want:      db.StopUploadRule,
+		},
+		{
+			name:      "upload rules",
+			policy:    config.SeedingPolicy{UploadRules: []config.UploadRule{{IntervalInDays: 1, UploadAtLeastInMB: 1}}},
+			histories: map[string]int64{yesterday: 0},
+			want:      db.StopUploadRule,
+		},
+		{
+			name:      "min ratio not reached",
+			policy:    config.SeedingPolicy{IntervalInDays: 3, UploadAtLeastInMB: 1, MinRatio: 1},
+			histories: map[string]int64{threeDaysAgo: 0},
+			ratio:     0.5,
+		},
+		{
+			name:        "min seed time not reached",
+			policy:      config.SeedingPolicy{IntervalInDays: 3, UploadAtLeastInMB: 1, MinSeedTimeInHours: 72},
+			histories:   map[string]int64{threeDaysAgo: 0},
+			seedingTime: 24 * time.Hour,
+		},
+		{
+			name:        "minimums reached",
+			policy:      config.SeedingPolicy{IntervalInDays: 3, UploadAtLeastInMB: 1, MinRatio: 1, MinSeedTimeInHours: 72},
+			histories:   map[string]int64{threeDaysAgo: 0},
+			ratio:       1.2,
+			seedingTime: 100 * time.Hour,
+			want:        db.StopUploadRule,
+		},
+		{
+			name:        "max seed time",
+			policy:      config.SeedingPolicy{MaxSeedTimeInHours: 48},
+			histories:   map[string]int64{},
+			seedingTime: 50 * time.Hour,
+			want:        db.StopMaxSeedTime,
+		},
+		{
+			name: "indexer override",
+			policy: config.SeedingPolicy{
+				IntervalInDays:    3,
+				UploadAtLeastInMB: 1,
+				Indexers: map[string]*config.SeedingPolicy{
+					"mteam": {MinSeedTimeInHours: 72, MaxSeedTimeInHours: 240},
+				},
+			},
+			indexer:     "mteam",
+			histories:   map[string]int64{threeDaysAgo: 0},
+			seedingTime: 100 * time.Hour,
+		},
+		{
+			name: "other indexer",
+			policy: config.SeedingPolicy{
+				IntervalInDays:    3,
+				UploadAtLeastInMB: 1,
+				Indexers: map[string]*config.SeedingPolicy{
+					"mteam": {MinSeedTimeInHours: 72, MaxSeedTimeInHours: 240},
+				},
+			},
+			indexer:     "nyaa",
+			histories:   map[string]int64{threeDaysAgo: 0},
+			seedingTime: 100 * time.Hour,
+			want:        db.StopUploadRule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeTransmission{}
+
+			serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+			httpClient = &http.Client{}
+			t.Cleanup(func() {
+				httpClient = http.DefaultClient
+				serv.Close()
+			})
+
+			d, err := db.ForTest(t)
+			require.NoError(t, err)
+
+			policy := tt.policy
+			conf := &config.DownloaderConfig{
+				Transmission:  &config.TransmissionConfig{URL: serv.URL},
+				SeedingPolicy: &policy,
+			}
+			client, err := New("test", conf, d, &fakeEvents{})
+			require.NoError(t, err)
+
+			require.NoError(t, d.Create(&db.DownloadStatus{
+				ID:              "1",
+				Downloader:      "test",
+				ResIndexer:      tt.indexer,
+				UploadHistories: tt.histories,
+				State:           db.DownloadSeeding,
+			}).Error)
+
+			torrent := newTorrent(1, "1", transmissionrpc.TorrentStatusSeed, 0)
+			torrent.UploadRatio = &tt.ratio
+			torrent.TimeSeeding = &tt.seedingTime
+			fake.resp = []any{
+				&torrentGetResults{Torrents: []transmissionrpc.Torrent{torrent}},
+				&struct{}{},
+			}
+
+			client.CheckDailySeeding()
+
+			r := &db.DownloadStatus{}
+			require.NoError(t, d.First(r, "id = ?", "1").Error)
+			assert.Equal(t, tt.want, r.StopReason)
+			if tt.want == "" {
+				assert.Len(t, fake.reqs, 1)
+				assert.Equal(t, db.DownloadSeeding, r.State)
+			} else {
+				require.Len(t, fake.reqs, 2)
+				assert.Equal(t, "torrent-stop", fake.reqs[1].Method)
+				assert.Equal(t, db.DownloadStopped, r.State)
+			}
+		})
+	}
 }
 
 func newTorrentWithProgress(id int64, hash string, status transmissionrpc.TorrentStatus, percentDone float64, downloadDir string, files []transmissionrpc.TorrentFile) transmissionrpc.Torrent {
@@ -248,7 +426,7 @@ func TestProgressChecker(t *testing.T) {
 		serv.Close()
 	})
 
-	d, err := db.SqliteForTest()
+	d, err := db.ForTest(t)
 	require.NoError(t, err)
 
 	tmpDir, err := os.MkdirTemp("", "autoget-test")
@@ -268,7 +446,8 @@ func TestProgressChecker(t *testing.T) {
 		},
 	}
 
-	client, err := New("test", conf, d)
+	ev := &fakeEvents{}
+	client, err := New("test", conf, d, ev)
 	require.NoError(t, err)
 
 	// r1 is downloading
@@ -321,17 +500,25 @@ func TestProgressChecker(t *testing.T) {
 		},
 	}
 
+	copied := metrics.CopyBytes.WithLabelValues("test")
+	copiedBefore := testutil.ToFloat64(copied)
+
 	client.ProgressChecker()
 
 	assert.Len(t, fake.reqs, 2)
 	assert.Equal(t, "torrent-get", fake.reqs[0].Method)
 	assert.Equal(t, "session-stats", fake.reqs[1].Method)
 
+	assert.Equal(t, copiedBefore+float64(len(r2FileContent)+len(r2SubFileContent)), testutil.ToFloat64(copied))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.Downloads.WithLabelValues("test", "started")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.Downloads.WithLabelValues("test", "seeding")))
+
 	{
 		// r1 progress updated
 		r := &db.DownloadStatus{}
 		require.NoError(t, d.First(r, "id = ?", "1").Error)
 		assert.Equal(t, int32(percentDone1*1000), r.DownloadProgress)
+		assert.Nil(t, r.SeedingSince)
 	}
 
 	{
@@ -350,4 +537,1126 @@ func TestProgressChecker(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, r2SubFileContent, string(copiedSubContent))
 	}
+
+	assert.Equal(t, []*events.Event{
+		{Type: events.Moved, Downloader: "test", Hash: "2", Title: "2"},
+	}, ev.events)
+}
+
+func TestProgressCheckerEvents(t *testing.T) {
+	fake := &fakeTransmission{}
+
+	serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	downloadDir := t.TempDir()
+	conf := &config.DownloaderConfig{
+		Transmission: &config.TransmissionConfig{
+			URL:         serv.URL,
+			DownloadDir: downloadDir,
+			FinishedDir: t.TempDir(),
+		},
+	}
+
+	ev := &fakeEvents{}
+	client, err := New("test", conf, d, ev)
+	require.NoError(t, err)
+
+	// r1 finishes downloading, but its file is missing.
+	r1 := &db.DownloadStatus{
+		ID:         "1",
+		Downloader: "test",
+		State:      db.DownloadStarted,
+		ResTitle:   "Title 1",
+		ResIndexer: "nyaa",
+	}
+	require.NoError(t, d.Create(r1).Error)
+
+	torrents := func() *torrentGetResults {
+		return &torrentGetResults{
+			Torrents: []transmissionrpc.Torrent{
+				newTorrentWithProgress(1, "1", transmissionrpc.TorrentStatusSeed, 1.0, downloadDir, []transmissionrpc.TorrentFile{
+					{Name: "missing.txt", Length: 1},
+				}),
+			},
+		}
+	}
+	fake.resp = []any{torrents(), &transmissionrpc.SessionStats{}}
+
+	published, unsubscribe := hub.Default.Subscribe()
+	t.Cleanup(unsubscribe)
+
+	client.ProgressChecker()
+
+	require.Len(t, published, 3)
+	assert.Equal(t, &hub.Event{Type: hub.DownloadProgress, Data: &hub.DownloadProgressData{
+		ID: "1", Downloader: "test", Title: "Title 1", Progress: 1000, State: "seeding",
+	}}, <-published)
+	assert.Equal(t, hub.DownloadEvent, (<-published).Type)
+	assert.Equal(t, &hub.Event{Type: hub.DownloadEvent, Data: &hub.DownloadEventData{
+		Type: "move_failed", ID: "1", Downloader: "test", Title: "Title 1", Indexer: "nyaa", Error: ev.events[1].Error,
+	}}, <-published)
+
+	s, err := db.GetDownloadStatus(d, "1")
+	require.NoError(t, err)
+	assert.NotNil(t, s.SeedingSince)
+
+	require.Len(t, ev.events, 2)
+	assert.Equal(t, &events.Event{Type: events.Completed, Downloader: "test", Hash: "1", Title: "Title 1", Indexer: "nyaa"}, ev.events[0])
+	assert.Equal(t, events.MoveFailed, ev.events[1].Type)
+	assert.Contains(t, ev.events[1].Error, "no such file or directory")
+
+	// the move failure is notified once.
+	fake.resp = []any{torrents(), &transmissionrpc.SessionStats{}}
+	client.ProgressChecker()
+	assert.Len(t, ev.events, 2)
+}
+
+func TestAddTorrent(t *testing.T) {
+	setup := func(t *testing.T, fake *fakeTransmission, ev *fakeEvents) *Client {
+		serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+		httpClient = &http.Client{}
+		t.Cleanup(func() {
+			httpClient = http.DefaultClient
+			serv.Close()
+		})
+
+		d, err := db.ForTest(t)
+		require.NoError(t, err)
+
+		client, err := New("test", &config.DownloaderConfig{
+			Transmission: &config.TransmissionConfig{
+				URL:         serv.URL,
+				DownloadDir: "/downloads",
+			},
+		}, d, ev)
+		require.NoError(t, err)
+		return client
+	}
+
+	t.Run("success", func(t *testing.T) {
+		id := int64(1)
+		hash := "hash"
+		fake := &fakeTransmission{
+			resp: []any{
+				map[string]any{"torrent-added": transmissionrpc.Torrent{ID: &id, HashString: &hash}},
+			},
+		}
+		ev := &fakeEvents{}
+		client := setup(t, fake, ev)
+
+		torrent := testMetaInfo(t, "a.txt", 1)
+		torrentFile := filepath.Join(t.TempDir(), "a.torrent")
+		require.NoError(t, os.WriteFile(torrentFile, torrent, 0644))
+
+		added, err := client.AddTorrent(&lifecycle.NewTorrent{
+			FilePath: torrentFile,
+			Labels:   []string{"nyaa"},
+			Indexer:  "nyaa",
+		})
+		require.NoError(t, err)
+		assert.False(t, added.Queued)
+		assert.Len(t, added.Hash, 40)
+
+		require.Len(t, fake.reqs, 1)
+		assert.Equal(t, "torrent-add", fake.reqs[0].Method)
+		assert.Equal(t, map[string]any{
+			"metainfo":     base64.StdEncoding.EncodeToString(torrent),
+			"download-dir": "/downloads",
+			"labels":       []any{"nyaa"},
+		}, fake.reqs[0].Arguments)
+
+		assert.Equal(t, []*events.Event{
+			{Type: events.Started, Downloader: "test", Hash: added.Hash, Title: "a.torrent", Indexer: "nyaa"},
+		}, ev.events)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			torrent *lifecycle.NewTorrent
+			result  string
+			wantErr string
+		}{
+			{
+				name:    "no torrent",
+				torrent: &lifecycle.NewTorrent{},
+				wantErr: "torrent file path or metainfo is required",
+			},
+			{
+				name:    "file not found",
+				torrent: &lifecycle.NewTorrent{FilePath: "/not/exists.torrent"},
+				wantErr: "no such file or directory",
+			},
+			{
+				name:    "invalid metainfo",
+				torrent: &lifecycle.NewTorrent{MetaInfo: []byte("torrent")},
+				wantErr: "invalid metainfo",
+			},
+			{
+				name:    "rpc error",
+				torrent: &lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "a.txt", 1)},
+				result:  "invalid or corrupt torrent file",
+				wantErr: "invalid or corrupt torrent file",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fake := &fakeTransmission{resp: []any{map[string]any{}}, result: tt.result}
+				ev := &fakeEvents{}
+				client := setup(t, fake, ev)
+
+				_, err := client.AddTorrent(tt.torrent)
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Empty(t, ev.events)
+			})
+		}
+	})
+}
+
+func TestProgressCheckerTransferModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  db.TransferMode
+		state db.DownloadState
+		moved bool
+		// wantModes recorded, the mode if empty.
+		wantModes []db.TransferMode
+		check     func(t *testing.T, from, target string)
+	}{
+		{
+			name:  "hardlink",
+			mode:  db.TransferHardlink,
+			state: db.DownloadSeeding,
+			moved: true,
+			check: func(t *testing.T, from, target string) {
+				fromInfo, err := os.Stat(from)
+				require.NoError(t, err)
+				targetInfo, err := os.Stat(target)
+				require.NoError(t, err)
+				assert.True(t, os.SameFile(fromInfo, targetInfo))
+			},
+		},
+		{
+			name:  "symlink",
+			mode:  db.TransferSymlink,
+			state: db.DownloadSeeding,
+			moved: true,
+			check: func(t *testing.T, from, target string) {
+				link, err := os.Readlink(target)
+				require.NoError(t, err)
+				assert.Equal(t, from, link)
+			},
+		},
+		{
+			name:  "reflink",
+			mode:  db.TransferReflink,
+			state: db.DownloadSeeding,
+			moved: true,
+			// copy on filesystems without reflink.
+			wantModes: []db.TransferMode{db.TransferReflink, db.TransferCopy},
+			check: func(t *testing.T, from, target string) {
+				fromInfo, err := os.Stat(from)
+				require.NoError(t, err)
+				targetInfo, err := os.Stat(target)
+				require.NoError(t, err)
+				assert.False(t, os.SameFile(fromInfo, targetInfo))
+			},
+		},
+		{
+			name:  "move",
+			mode:  db.TransferMove,
+			state: db.DownloadStopped,
+			moved: true,
+			check: func(t *testing.T, from, target string) {
+				_, err := os.Stat(from)
+				assert.ErrorIs(t, err, os.ErrNotExist)
+			},
+		},
+		{
+			name:  "move waits for seeding",
+			mode:  db.TransferMove,
+			state: db.DownloadSeeding,
+			moved: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeTransmission{}
+
+			serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+			httpClient = &http.Client{}
+			t.Cleanup(func() {
+				httpClient = http.DefaultClient
+				serv.Close()
+			})
+
+			d, err := db.ForTest(t)
+			require.NoError(t, err)
+
+			downloadDir := t.TempDir()
+			finishedDir := t.TempDir()
+			conf := &config.DownloaderConfig{
+				Transmission: &config.TransmissionConfig{
+					URL:         serv.URL,
+					DownloadDir: downloadDir,
+					FinishedDir: finishedDir,
+				},
+				TransferMode: tt.mode,
+			}
+
+			client, err := New("test", conf, d, &fakeEvents{})
+			require.NoError(t, err)
+
+			r := &db.DownloadStatus{
+				ID:         "1",
+				Downloader: "test",
+				State:      tt.state,
+				MoveState:  db.UnMoved,
+			}
+			require.NoError(t, d.Create(r).Error)
+
+			content := "hello world"
+			fileName := filepath.Join("sub", "r1.txt")
+			from := filepath.Join(downloadDir, fileName)
+			target := filepath.Join(finishedDir, "1", fileName)
+			require.NoError(t, os.MkdirAll(filepath.Dir(from), 0755))
+			require.NoError(t, os.WriteFile(from, []byte(content), 0644))
+
+			status := transmissionrpc.TorrentStatusSeed
+			if tt.state == db.DownloadStopped {
+				status = transmissionrpc.TorrentStatusStopped
+			}
+			fake.resp = []any{
+				&torrentGetResults{
+					Torrents: []transmissionrpc.Torrent{
+						newTorrentWithProgress(1, "1", status, 1.0, downloadDir, []transmissionrpc.TorrentFile{
+							{Name: fileName, Length: int64(len(content))},
+						}),
+					},
+				},
+				&transmissionrpc.SessionStats{},
+			}
+
+			client.ProgressChecker()
+
+			got := &db.DownloadStatus{}
+			require.NoError(t, d.First(got, "id = ?", "1").Error)
+			if !tt.moved {
+				assert.Equal(t, db.UnMoved, got.MoveState)
+				assert.NoFileExists(t, target)
+				return
+			}
+
+			assert.Equal(t, db.Moved, got.MoveState)
+			if tt.wantModes == nil {
+				tt.wantModes = []db.TransferMode{tt.mode}
+			}
+			assert.Contains(t, tt.wantModes, got.TransferMode)
+
+			targetContent, err := os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, content, string(targetContent))
+
+			tt.check(t, from, target)
+		})
+	}
+}
+
+func TestRemoveTorrentsKeepsLinkedData(t *testing.T) {
+	fake := &fakeTransmission{}
+
+	serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	conf := &config.DownloaderConfig{
+		Transmission: &config.TransmissionConfig{
+			URL: serv.URL,
+		},
+		SeedingPolicy: &config.SeedingPolicy{
+			IntervalInDays:    3,
+			UploadAtLeastInMB: 1,
+		},
+	}
+
+	client, err := New("test", conf, d, &fakeEvents{})
+	require.NoError(t, err)
+
+	// r1 was copied before transfer modes, r2 was symlinked.
+	r1 := &db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadStopped, MoveState: db.Moved}
+	r2 := &db.DownloadStatus{ID: "2", Downloader: "test", State: db.DownloadStopped, MoveState: db.Moved, TransferMode: db.TransferSymlink}
+	require.NoError(t, d.Create(r1).Error)
+	require.NoError(t, d.Create(r2).Error)
+
+	fake.resp = []any{
+		&torrentGetResults{
+			Torrents: []transmissionrpc.Torrent{
+				newTorrent(1, "1", transmissionrpc.TorrentStatusStopped, 0),
+				newTorrent(2, "2", transmissionrpc.TorrentStatusStopped, 0),
+			},
+		},
+		&struct{}{},
+		&struct{}{},
+	}
+
+	client.CheckDailySeeding()
+
+	require.Len(t, fake.reqs, 3)
+	assert.Equal(t, "torrent-remove", fake.reqs[1].Method)
+	assert.Equal(t, map[string]interface{}{"ids": []interface{}{float64(1)}, "delete-local-data": true}, fake.reqs[1].Arguments)
+	assert.Equal(t, "torrent-remove", fake.reqs[2].Method)
+	assert.Equal(t, map[string]interface{}{"ids": []interface{}{float64(2)}, "delete-local-data": false}, fake.reqs[2].Arguments)
+
+	for _, id := range []string{"1", "2"} {
+		r := &db.DownloadStatus{}
+		require.NoError(t, d.First(r, "id = ?", id).Error)
+		assert.Equal(t, db.DownloadDeleted, r.State)
+	}
+}
+
+// more than any disk has, so the dirs are always low.
+const alwaysLow = 1 << 30
+
+func mustAddTorrent(t *testing.T, client *Client, nt *lifecycle.NewTorrent) *lifecycle.AddResult {
+	t.Helper()
+
+	res, err := client.AddTorrent(nt)
+	require.NoError(t, err)
+	return res
+}
+
+func setupDiskSpace(t *testing.T, fake *fakeTransmission, policy *config.DiskSpacePolicy) (*Client, *config.DownloaderConfig, *fakeEvents, *gorm.DB) {
+	t.Helper()
+
+	serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	conf := &config.DownloaderConfig{
+		Transmission: &config.TransmissionConfig{
+			URL:         serv.URL,
+			DownloadDir: t.TempDir(),
+			FinishedDir: t.TempDir(),
+		},
+		DiskSpace: policy,
+	}
+
+	ev := &fakeEvents{}
+	client, err := New("test", conf, d, ev)
+	require.NoError(t, err)
+	return client, conf, ev, d
+}
+
+func TestDiskSpace(t *testing.T) {
+	t.Run("refuse", func(t *testing.T) {
+		fake := &fakeTransmission{}
+		client, conf, ev, _ := setupDiskSpace(t, fake, &config.DiskSpacePolicy{DownloadDirMinFreeInGB: alwaysLow})
+
+		_, err := client.AddTorrent(&lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "a.txt", 1), Title: "Title 1"})
+		assert.ErrorIs(t, err, lifecycle.ErrLowDiskSpace)
+		_, err = client.AddTorrent(&lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "b.txt", 1), Title: "Title 2"})
+		assert.ErrorIs(t, err, lifecycle.ErrLowDiskSpace)
+
+		assert.Empty(t, fake.reqs)
+
+		// crossing the threshold is notified once.
+		require.Len(t, ev.events, 1)
+		assert.Equal(t, events.LowDiskSpace, ev.events[0].Type)
+		assert.Equal(t, "test", ev.events[0].Downloader)
+		assert.Equal(t, conf.DownloadDir(), ev.events[0].Dir)
+		assert.Contains(t, ev.events[0].Free, "GB")
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		id := int64(1)
+		hash := "hash"
+		fake := &fakeTransmission{
+			resp: []any{
+				map[string]any{"torrent-added": transmissionrpc.Torrent{ID: &id, HashString: &hash}},
+			},
+		}
+		client, conf, ev, d := setupDiskSpace(t, fake, &config.DiskSpacePolicy{DownloadDirMinFreeInGB: alwaysLow, Queue: true})
+
+		torrent := testMetaInfo(t, "a.txt", 1)
+		added := mustAddTorrent(t, client, &lifecycle.NewTorrent{MetaInfo: torrent, Labels: []string{"nyaa"}, Title: "Title 1"})
+		assert.True(t, added.Queued)
+		assert.Empty(t, fake.reqs)
+		require.NoError(t, d.Create(&db.DownloadStatus{ID: added.Hash, Downloader: "test", State: db.DownloadQueued, ResIndexer: "nyaa"}).Error)
+
+		queued, err := db.GetQueuedTorrentsByDownloader(d, "test")
+		require.NoError(t, err)
+		require.Len(t, queued, 1)
+		assert.Equal(t, "Title 1", queued[0].Title)
+
+		// still low, nothing started.
+		client.CheckDiskSpace()
+		assert.Empty(t, fake.reqs)
+
+		// space is back.
+		conf.DiskSpace.DownloadDirMinFreeInGB = 0
+		client.CheckDiskSpace()
+
+		require.Len(t, fake.reqs, 1)
+		assert.Equal(t, "torrent-add", fake.reqs[0].Method)
+		assert.Equal(t, map[string]any{
+			"metainfo":     base64.StdEncoding.EncodeToString(torrent),
+			"download-dir": conf.DownloadDir(),
+			"labels":       []any{"nyaa"},
+		}, fake.reqs[0].Arguments)
+
+		queued, err = db.GetQueuedTorrentsByDownloader(d, "test")
+		require.NoError(t, err)
+		assert.Empty(t, queued)
+
+		s, err := db.GetDownloadStatus(d, added.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadStarted, s.State)
+
+		require.Len(t, ev.events, 3)
+		assert.Equal(t, events.LowDiskSpace, ev.events[0].Type)
+		assert.Equal(t, events.DiskSpaceRecovered, ev.events[1].Type)
+		assert.Equal(t, &events.Event{Type: events.Started, Downloader: "test", Hash: added.Hash, Title: "Title 1", Indexer: "nyaa"}, ev.events[2])
+	})
+
+	t.Run("queued download deleted", func(t *testing.T) {
+		fake := &fakeTransmission{}
+		client, conf, _, d := setupDiskSpace(t, fake, &config.DiskSpacePolicy{DownloadDirMinFreeInGB: alwaysLow, Queue: true})
+
+		added := mustAddTorrent(t, client, &lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "a.txt", 1), Title: "Title 1"})
+		require.NoError(t, d.Create(&db.DownloadStatus{ID: added.Hash, Downloader: "test", State: db.DownloadDeleted}).Error)
+
+		conf.DiskSpace.DownloadDirMinFreeInGB = 0
+		client.CheckDiskSpace()
+		assert.Empty(t, fake.reqs)
+
+		queued, err := db.GetQueuedTorrentsByDownloader(d, "test")
+		require.NoError(t, err)
+		assert.Empty(t, queued)
+	})
+
+	t.Run("queued torrent failed to start", func(t *testing.T) {
+		fake := &fakeTransmission{result: "invalid or corrupt torrent file"}
+		client, conf, ev, d := setupDiskSpace(t, fake, &config.DiskSpacePolicy{DownloadDirMinFreeInGB: alwaysLow, Queue: true})
+
+		added := mustAddTorrent(t, client, &lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "a.txt", 1), Title: "Title 1"})
+		require.NoError(t, d.Create(&db.DownloadStatus{ID: added.Hash, Downloader: "test", State: db.DownloadQueued}).Error)
+		sub := &db.Subscription{Indexer: "nyaa", Show: "Show"}
+		require.NoError(t, db.AddSubscription(d, sub))
+		require.NoError(t, db.AddSubscriptionEpisode(d, &db.SubscriptionEpisode{SubscriptionID: sub.ID, Episode: 1, TorrentHash: added.Hash}))
+
+		conf.DiskSpace.DownloadDirMinFreeInGB = 0
+		for i := 1; i <= 3; i++ {
+			fake.resp = []any{map[string]any{}}
+			client.CheckDiskSpace()
+			require.Len(t, fake.reqs, i)
+		}
+
+		// dropped after 3 attempts.
+		queued, err := db.GetQueuedTorrentsByDownloader(d, "test")
+		require.NoError(t, err)
+		assert.Empty(t, queued)
+
+		client.CheckDiskSpace()
+		assert.Len(t, fake.reqs, 3)
+
+		s, err := db.GetDownloadStatus(d, added.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadDeleted, s.State)
+
+		// the episode is fetched again.
+		has, err := db.HasSubscriptionEpisode(d, sub.ID, 1)
+		require.NoError(t, err)
+		assert.False(t, has)
+
+		require.Len(t, ev.events, 3)
+		assert.Equal(t, events.StartFailed, ev.events[2].Type)
+		assert.Equal(t, "Title 1", ev.events[2].Title)
+		assert.Contains(t, ev.events[2].Error, "invalid or corrupt torrent file")
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		fake := &fakeTransmission{}
+		client, conf, ev, d := setupDiskSpace(t, fake, &config.DiskSpacePolicy{DownloadDirMinFreeInGB: alwaysLow, Evict: config.EvictStopped})
+		downloadDir := conf.DownloadDir()
+
+		// r1 is copied and stopped, r2 is symlinked, r3 is seeding.
+		r1 := &db.DownloadStatus{ID: "1", Downloader: "test", ResTitle: "Title 1", State: db.DownloadStopped, MoveState: db.Moved}
+		r2 := &db.DownloadStatus{ID: "2", Downloader: "test", State: db.DownloadStopped, MoveState: db.Moved, TransferMode: db.TransferSymlink}
+		r3 := &db.DownloadStatus{ID: "3", Downloader: "test", State: db.DownloadSeeding, MoveState: db.Moved}
+		for _, r := range []*db.DownloadStatus{r1, r2, r3} {
+			require.NoError(t, d.Create(r).Error)
+		}
+
+		files := []transmissionrpc.TorrentFile{{Name: "a.mkv", Length: 1024}}
+		fake.resp = []any{
+			&torrentGetResults{
+				Torrents: []transmissionrpc.Torrent{
+					newTorrentWithProgress(1, "1", transmissionrpc.TorrentStatusStopped, 1.0, downloadDir, files),
+					newTorrentWithProgress(2, "2", transmissionrpc.TorrentStatusStopped, 1.0, downloadDir, files),
+					newTorrentWithProgress(3, "3", transmissionrpc.TorrentStatusSeed, 1.0, downloadDir, files),
+				},
+			},
+			&struct{}{},
+		}
+
+		evicted := metrics.SeedingPolicyActions.WithLabelValues("test", metrics.ActionEvict)
+		evictedBefore := testutil.ToFloat64(evicted)
+
+		client.CheckDiskSpace()
+
+		require.Len(t, fake.reqs, 2)
+		assert.Equal(t, "torrent-get", fake.reqs[0].Method)
+		assert.Equal(t, "torrent-remove", fake.reqs[1].Method)
+		assert.Equal(t, map[string]interface{}{"ids": []interface{}{float64(1)}, "delete-local-data": true}, fake.reqs[1].Arguments)
+
+		for id, state := range map[string]db.DownloadState{"1": db.DownloadDeleted, "2": db.DownloadStopped, "3": db.DownloadSeeding} {
+			r := &db.DownloadStatus{}
+			require.NoError(t, d.First(r, "id = ?", id).Error)
+			assert.Equal(t, state, r.State, id)
+		}
+
+		require.Len(t, ev.events, 2)
+		assert.Equal(t, events.LowDiskSpace, ev.events[0].Type)
+		assert.Equal(t, &events.Event{Type: events.Deleted, Downloader: "test", Hash: "1", Title: "Title 1", Reason: events.ReasonDiskSpace}, ev.events[1])
+		assert.Equal(t, evictedBefore+1, testutil.ToFloat64(evicted))
+	})
+
+	t.Run("evict seeding", func(t *testing.T) {
+		fake := &fakeTransmission{}
+		client, conf, _, d := setupDiskSpace(t, fake, &config.DiskSpacePolicy{DownloadDirMinFreeInGB: alwaysLow, Evict: config.EvictSeeding})
+		conf.SeedingPolicy = &config.SeedingPolicy{MinRatio: 1}
+		downloadDir := conf.DownloadDir()
+
+		// r1 is below the min ratio, r2 reached it.
+		r1 := &db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadSeeding, MoveState: db.Moved}
+		r2 := &db.DownloadStatus{ID: "2", Downloader: "test", State: db.DownloadSeeding, MoveState: db.Moved}
+		for _, r := range []*db.DownloadStatus{r1, r2} {
+			require.NoError(t, d.Create(r).Error)
+		}
+
+		files := []transmissionrpc.TorrentFile{{Name: "a.mkv", Length: 1024}}
+		t1 := newTorrentWithProgress(1, "1", transmissionrpc.TorrentStatusSeed, 1.0, downloadDir, files)
+		t2 := newTorrentWithProgress(2, "2", transmissionrpc.TorrentStatusSeed, 1.0, downloadDir, files)
+		ratio1, ratio2 := 0.5, 1.5
+		t1.UploadRatio = &ratio1
+		t2.UploadRatio = &ratio2
+		fake.resp = []any{
+			&torrentGetResults{Torrents: []transmissionrpc.Torrent{t1, t2}},
+			&struct{}{},
+		}
+
+		client.CheckDiskSpace()
+
+		require.Len(t, fake.reqs, 2)
+		assert.Equal(t, "torrent-remove", fake.reqs[1].Method)
+		assert.Equal(t, map[string]interface{}{"ids": []interface{}{float64(2)}, "delete-local-data": true}, fake.reqs[1].Arguments)
+
+		for id, state := range map[string]db.DownloadState{"1": db.DownloadSeeding, "2": db.DownloadDeleted} {
+			r := &db.DownloadStatus{}
+			require.NoError(t, d.First(r, "id = ?", id).Error)
+			assert.Equal(t, state, r.State, id)
+		}
+	})
+
+	t.Run("finished dir low", func(t *testing.T) {
+		fake := &fakeTransmission{}
+		client, conf, _, d := setupDiskSpace(t, fake, &config.DiskSpacePolicy{FinishedDirMinFreeInGB: alwaysLow})
+		downloadDir := conf.DownloadDir()
+
+		require.NoError(t, d.Create(&db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadSeeding, MoveState: db.UnMoved}).Error)
+		require.NoError(t, os.WriteFile(filepath.Join(downloadDir, "a.txt"), []byte("hello"), 0644))
+
+		torrents := func() *torrentGetResults {
+			return &torrentGetResults{
+				Torrents: []transmissionrpc.Torrent{
+					newTorrentWithProgress(1, "1", transmissionrpc.TorrentStatusSeed, 1.0, downloadDir, []transmissionrpc.TorrentFile{
+						{Name: "a.txt", Length: 5},
+					}),
+				},
+			}
+		}
+		fake.resp = []any{torrents(), &transmissionrpc.SessionStats{}}
+
+		client.ProgressChecker()
+
+		// the copy is postponed.
+		r := &db.DownloadStatus{}
+		require.NoError(t, d.First(r, "id = ?", "1").Error)
+		assert.Equal(t, db.UnMoved, r.MoveState)
+		assert.NoFileExists(t, filepath.Join(conf.FinishedDir(), "1", "a.txt"))
+
+		// links need no space.
+		conf.TransferMode = db.TransferHardlink
+		fake.resp = []any{torrents(), &transmissionrpc.SessionStats{}}
+
+		client.ProgressChecker()
+
+		require.NoError(t, d.First(r, "id = ?", "1").Error)
+		assert.Equal(t, db.Moved, r.MoveState)
+		assert.FileExists(t, filepath.Join(conf.FinishedDir(), "1", "a.txt"))
+	})
+}
+
+// transferTest has a status of seeding torrent "1" with files in the download
+// dir.
+type transferTest struct {
+	fake        *fakeTransmission
+	db          *gorm.DB
+	conf        *config.DownloaderConfig
+	client      *Client
+	events      *fakeEvents
+	downloadDir string
+	finishedDir string
+	torrent     transmissionrpc.Torrent
+	// speed is the download speed of session stats.
+	speed int64
+	// beforeServe is called before responding rpc requests.
+	beforeServe func()
+}
+
+func newTransferTest(t *testing.T, verify bool, files map[string]string) *transferTest {
+	t.Helper()
+
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	tt := &transferTest{
+		fake:        &fakeTransmission{},
+		db:          d,
+		events:      &fakeEvents{},
+		downloadDir: t.TempDir(),
+		finishedDir: t.TempDir(),
+	}
+
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tt.beforeServe != nil {
+			tt.beforeServe()
+		}
+		tt.fake.ServeHTTP(w, r)
+	}))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
+	tt.conf = &config.DownloaderConfig{
+		Transmission: &config.TransmissionConfig{
+			URL:         serv.URL,
+			DownloadDir: tt.downloadDir,
+			FinishedDir: tt.finishedDir,
+		},
+		VerifyTransfer: verify,
+	}
+	tt.client, err = New("test", tt.conf, d, tt.events)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:         "1",
+		Downloader: "test",
+		State:      db.DownloadSeeding,
+	}).Error)
+
+	torrentFiles := []transmissionrpc.TorrentFile{}
+	for name, content := range files {
+		p := filepath.Join(tt.downloadDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+		torrentFiles = append(torrentFiles, transmissionrpc.TorrentFile{Name: name, Length: int64(len(content))})
+	}
+	tt.torrent = newTorrentWithProgress(1, "1", transmissionrpc.TorrentStatusSeed, 1.0, tt.downloadDir, torrentFiles)
+	return tt
+}
+
+func (tt *transferTest) check(t *testing.T) *db.DownloadStatus {
+	t.Helper()
+
+	tt.fake.resp = []any{
+		&torrentGetResults{Torrents: []transmissionrpc.Torrent{tt.torrent}},
+		&transmissionrpc.SessionStats{DownloadSpeed: tt.speed},
+	}
+	_, err := tt.client.ProgressChecker()
+	require.NoError(t, err)
+
+	got := &db.DownloadStatus{}
+	require.NoError(t, tt.db.First(got, "id = ?", "1").Error)
+	return got
+}
+
+func (tt *transferTest) recordTransfers(t *testing.T, transfers map[string]*db.FileTransfer) {
+	t.Helper()
+
+	s, err := db.GetDownloadStatus(tt.db, "1")
+	require.NoError(t, err)
+	s.FileTransfers = transfers
+	require.NoError(t, db.SaveDownloadStatus(tt.db, s))
+}
+
+func (tt *transferTest) target(name string) string {
+	return filepath.Join(tt.finishedDir, "1", name)
+}
+
+func TestProgressCheckerResumableTransfer(t *testing.T) {
+	t.Run("resume part file", func(t *testing.T) {
+		tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello world"})
+		tt.recordTransfers(t, map[string]*db.FileTransfer{"r1.txt": {Size: 11, Transferred: 5}})
+		target := tt.target("r1.txt")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+		// bytes after the saved progress may be lost in a crash.
+		require.NoError(t, os.WriteFile(target+".part", []byte("helloXX"), 0644))
+
+		before := testutil.ToFloat64(metrics.CopyBytes.WithLabelValues("test"))
+		got := tt.check(t)
+
+		assert.Equal(t, db.Moved, got.MoveState)
+		assert.Equal(t, map[string]*db.FileTransfer{"r1.txt": {Size: 11, Transferred: 11}}, got.FileTransfers)
+		assert.Equal(t, float64(6), testutil.ToFloat64(metrics.CopyBytes.WithLabelValues("test"))-before)
+
+		b, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(b))
+		assert.NoFileExists(t, target+".part")
+	})
+
+	t.Run("part file not saved", func(t *testing.T) {
+		tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello world"})
+		target := tt.target("r1.txt")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+		require.NoError(t, os.WriteFile(target+".part", []byte("HELLO"), 0644))
+
+		before := testutil.ToFloat64(metrics.CopyBytes.WithLabelValues("test"))
+		got := tt.check(t)
+
+		assert.Equal(t, db.Moved, got.MoveState)
+		assert.Equal(t, float64(11), testutil.ToFloat64(metrics.CopyBytes.WithLabelValues("test"))-before)
+		b, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(b))
+	})
+
+	t.Run("part file shorter than saved", func(t *testing.T) {
+		tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello world"})
+		tt.recordTransfers(t, map[string]*db.FileTransfer{"r1.txt": {Size: 11, Transferred: 8}})
+		target := tt.target("r1.txt")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+		require.NoError(t, os.WriteFile(target+".part", []byte("HELLO"), 0644))
+
+		got := tt.check(t)
+
+		assert.Equal(t, db.Moved, got.MoveState)
+		b, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(b))
+	})
+
+	t.Run("reflink resumes copy", func(t *testing.T) {
+		tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello world"})
+		tt.conf.TransferMode = db.TransferReflink
+		tt.recordTransfers(t, map[string]*db.FileTransfer{"r1.txt": {Size: 11, Transferred: 5}})
+		target := tt.target("r1.txt")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+		require.NoError(t, os.WriteFile(target+".part", []byte("hello"), 0644))
+
+		got := tt.check(t)
+
+		// the copy does not share the data, deleting the torrent frees space.
+		assert.Equal(t, db.Moved, got.MoveState)
+		assert.Equal(t, db.TransferCopy, got.TransferMode)
+		b, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(b))
+	})
+
+	t.Run("part file larger than source", func(t *testing.T) {
+		tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello"})
+		target := tt.target("r1.txt")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+		require.NoError(t, os.WriteFile(target+".part", []byte("stale data"), 0644))
+
+		got := tt.check(t)
+
+		assert.Equal(t, db.Moved, got.MoveState)
+		b, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(b))
+	})
+
+	t.Run("skip transferred", func(t *testing.T) {
+		tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello world", "r2.txt": "hello"})
+		tt.recordTransfers(t, map[string]*db.FileTransfer{
+			"r1.txt": {Size: 11, Transferred: 11},
+		})
+		// recorded as transferred.
+		require.NoError(t, os.MkdirAll(filepath.Dir(tt.target("r1.txt")), 0755))
+		require.NoError(t, os.WriteFile(tt.target("r1.txt"), []byte("HELLO WORLD"), 0644))
+		// same content.
+		require.NoError(t, os.WriteFile(tt.target("r2.txt"), []byte("hello"), 0644))
+
+		before := testutil.ToFloat64(metrics.CopyBytes.WithLabelValues("test"))
+		got := tt.check(t)
+
+		assert.Equal(t, db.Moved, got.MoveState)
+		assert.Equal(t, float64(0), testutil.ToFloat64(metrics.CopyBytes.WithLabelValues("test"))-before)
+		b, err := os.ReadFile(tt.target("r1.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "HELLO WORLD", string(b))
+	})
+
+	t.Run("replace different content", func(t *testing.T) {
+		tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello world"})
+		require.NoError(t, os.MkdirAll(filepath.Dir(tt.target("r1.txt")), 0755))
+		require.NoError(t, os.WriteFile(tt.target("r1.txt"), []byte("HELLO WORLD"), 0644))
+
+		got := tt.check(t)
+
+		assert.Equal(t, db.Moved, got.MoveState)
+		b, err := os.ReadFile(tt.target("r1.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(b))
+	})
+
+	t.Run("failure keeps progress", func(t *testing.T) {
+		tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello world"})
+		tt.recordTransfers(t, map[string]*db.FileTransfer{"r1.txt": {Size: 11, Transferred: 5}})
+		target := tt.target("r1.txt")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+		require.NoError(t, os.WriteFile(target+".part", []byte("hello"), 0644))
+		require.NoError(t, os.Remove(filepath.Join(tt.downloadDir, "r1.txt")))
+
+		got := tt.check(t)
+
+		assert.Equal(t, db.UnMoved, got.MoveState)
+		assert.Equal(t, map[string]*db.FileTransfer{"r1.txt": {Size: 11, Transferred: 5}}, got.FileTransfers)
+		assert.NoFileExists(t, target)
+		require.Len(t, tt.events.events, 1)
+		assert.Equal(t, events.MoveFailed, tt.events.events[0].Type)
+	})
+}
+
+// testMetaInfo of a single file torrent of the length.
+func testMetaInfo(t *testing.T, name string, length int64) []byte {
+	t.Helper()
+
+	info := metainfo.Info{Name: name, PieceLength: 16 * 1024, Length: length, Pieces: make([]byte, 20)}
+	mi := &metainfo.MetaInfo{}
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, mi.Write(buf))
+	return buf.Bytes()
+}
+
+// writeTorrentFile creates the .torrent file of the dir in the download dir.
+func writeTorrentFile(t *testing.T, dir string) string {
+	t.Helper()
+
+	info := metainfo.Info{PieceLength: 4}
+	require.NoError(t, info.BuildFromFilePath(dir))
+	mi := &metainfo.MetaInfo{}
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	require.NoError(t, err)
+
+	p := filepath.Join(t.TempDir(), "1.torrent")
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, mi.Write(f))
+	return p
+}
+
+func TestProgressCheckerVerifyTransfer(t *testing.T) {
+	// a.txt ends at a piece boundary, so pieces of b.txt only have b.txt.
+	files := map[string]string{
+		"data/a.txt": "hello world!",
+		"data/b.txt": "goodbye",
+	}
+
+	t.Run("success", func(t *testing.T) {
+		tt := newTransferTest(t, true, files)
+		torrentFile := writeTorrentFile(t, filepath.Join(tt.downloadDir, "data"))
+		tt.torrent.TorrentFile = &torrentFile
+
+		got := tt.check(t)
+
+		assert.Equal(t, db.Moved, got.MoveState)
+		assert.Empty(t, tt.events.events[1:])
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tt := newTransferTest(t, true, files)
+		torrentFile := writeTorrentFile(t, filepath.Join(tt.downloadDir, "data"))
+		tt.torrent.TorrentFile = &torrentFile
+
+		// a corrupted file recorded as transferred.
+		tt.recordTransfers(t, map[string]*db.FileTransfer{
+			"data/b.txt": {Size: 7, Transferred: 7},
+		})
+		require.NoError(t, os.MkdirAll(filepath.Dir(tt.target("data/b.txt")), 0755))
+		require.NoError(t, os.WriteFile(tt.target("data/b.txt"), []byte("GOODBYE"), 0644))
+
+		got := tt.check(t)
+
+		assert.Equal(t, db.UnMoved, got.MoveState)
+		assert.NotContains(t, got.FileTransfers, "data/b.txt")
+		assert.NoFileExists(t, tt.target("data/b.txt"))
+		assert.FileExists(t, tt.target("data/a.txt"))
+		require.Len(t, tt.events.events, 1)
+		assert.Equal(t, events.MoveFailed, tt.events.events[0].Type)
+		assert.Contains(t, tt.events.events[0].Error, "data/b.txt")
+		assert.NotContains(t, tt.events.events[0].Error, "data/a.txt")
+
+		// transferred again in next check.
+		got = tt.check(t)
+
+		assert.Equal(t, db.Moved, got.MoveState)
+		b, err := os.ReadFile(tt.target("data/b.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "goodbye", string(b))
+	})
+
+	t.Run("client without metainfo", func(t *testing.T) {
+		tt := newTransferTest(t, true, files)
+
+		got := tt.check(t)
+
+		assert.Equal(t, db.UnMoved, got.MoveState)
+		require.Len(t, tt.events.events, 1)
+		assert.Equal(t, events.MoveFailed, tt.events.events[0].Type)
+	})
+}
+
+func TestProgressCheckerResult(t *testing.T) {
+	tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello"})
+	require.NoError(t, tt.db.Create(&db.DownloadStatus{
+		ID:         "2",
+		Downloader: "test",
+		State:      db.DownloadStarted,
+	}).Error)
+	torrent2 := newTorrentWithProgress(2, "2", transmissionrpc.TorrentStatusSeed, 1.0, tt.downloadDir, nil)
+
+	tt.fake.resp = []any{
+		&torrentGetResults{Torrents: []transmissionrpc.Torrent{tt.torrent, torrent2}},
+		&transmissionrpc.SessionStats{},
+	}
+	res, err := tt.client.ProgressChecker()
+	require.NoError(t, err)
+
+	// the torrent completed in this check is transferred in this check too.
+	assert.Equal(t, &lifecycle.CheckResult{
+		Updated:   []string{"2"},
+		Completed: []string{"2"},
+		Moved:     []string{"1", "2"},
+	}, res)
+}
+
+func TestProgressCheckerBusy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *config.ProgressCheckPolicy
+		speed  int64
+		busy   bool
+	}{
+		{
+			name:  "default",
+			speed: 3 * 1000 * 1000,
+			busy:  true,
+		},
+		{
+			name:  "default not busy",
+			speed: 1000 * 1000,
+		},
+		{
+			name:   "speed",
+			policy: &config.ProgressCheckPolicy{BusySpeedInMB: 5},
+			speed:  3 * 1000 * 1000,
+		},
+		{
+			name:   "never",
+			policy: &config.ProgressCheckPolicy{Busy: config.BusyNever},
+			speed:  100 * 1000 * 1000,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello"})
+			tt.conf.ProgressCheck = tc.policy
+			tt.speed = tc.speed
+
+			got := tt.check(t)
+
+			if tc.busy {
+				assert.Equal(t, db.UnMoved, got.MoveState)
+				assert.NoFileExists(t, tt.target("r1.txt"))
+			} else {
+				assert.Equal(t, db.Moved, got.MoveState)
+			}
+		})
+	}
+}
+
+func TestProgressCheckerRunning(t *testing.T) {
+	tt := newTransferTest(t, false, map[string]string{"r1.txt": "hello"})
+
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	tt.beforeServe = func() {
+		select {
+		case arrived <- struct{}{}:
+		default:
+		}
+		<-release
+	}
+	tt.fake.resp = []any{
+		&torrentGetResults{Torrents: []transmissionrpc.Torrent{tt.torrent}},
+		&transmissionrpc.SessionStats{},
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := tt.client.ProgressChecker()
+		done <- err
+	}()
+	<-arrived
+
+	_, err := tt.client.ProgressChecker()
+	assert.ErrorIs(t, err, lifecycle.ErrCheckRunning)
+
+	close(release)
+	require.NoError(t, <-done)
+
+	// runs again once the check is finished.
+	got := tt.check(t)
+	assert.Equal(t, db.Moved, got.MoveState)
 }
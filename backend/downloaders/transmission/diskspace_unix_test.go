@@ -0,0 +1,85 @@
+//go:build unix
+
+package transmission
+
+import (
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/downloaders/config"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/hekmon/transmissionrpc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	"gorm.io/gorm"
+)
+
+const gb = 1024 * 1024 * 1024
+
+func freeSpace(t *testing.T, dir string) uint64 {
+	t.Helper()
+
+	var st unix.Statfs_t
+	require.NoError(t, unix.Statfs(dir, &st))
+	return uint64(st.Bavail) * uint64(st.Bsize)
+}
+
+func TestDiskSpaceTorrentSize(t *testing.T) {
+	setup := func(t *testing.T, fake *fakeTransmission) (*Client, *config.DownloaderConfig, *gorm.DB) {
+		client, conf, _, d := setupDiskSpace(t, fake, &config.DiskSpacePolicy{Queue: true})
+
+		// leave 1 to 2 GB above the threshold.
+		free := freeSpace(t, conf.DownloadDir())
+		if free < 3*gb {
+			t.Skip("not enough free space")
+		}
+		conf.DiskSpace.DownloadDirMinFreeInGB = free/gb - 1
+		return client, conf, d
+	}
+
+	added := func() map[string]any {
+		id := int64(1)
+		hash := "hash"
+		return map[string]any{"torrent-added": transmissionrpc.Torrent{ID: &id, HashString: &hash}}
+	}
+
+	t.Run("admission", func(t *testing.T) {
+		fake := &fakeTransmission{resp: []any{added()}}
+		client, _, d := setup(t, fake)
+
+		mustAddTorrent(t, client, &lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "a.txt", 1), Title: "Title 1"})
+		require.Len(t, fake.reqs, 1)
+
+		// the dir is above the threshold, but not after the download.
+		mustAddTorrent(t, client, &lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "b.txt", 3*gb), Title: "Title 2"})
+		assert.Len(t, fake.reqs, 1)
+
+		queued, err := db.GetQueuedTorrentsByDownloader(d, "test")
+		require.NoError(t, err)
+		require.Len(t, queued, 1)
+		assert.Equal(t, "Title 2", queued[0].Title)
+	})
+
+	t.Run("queued in a pass", func(t *testing.T) {
+		fake := &fakeTransmission{resp: []any{added()}}
+		client, conf, d := setup(t, fake)
+
+		// queue both while low.
+		minFree := conf.DiskSpace.DownloadDirMinFreeInGB
+		conf.DiskSpace.DownloadDirMinFreeInGB = alwaysLow
+		mustAddTorrent(t, client, &lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "a.txt", gb), Title: "Title 1"})
+		mustAddTorrent(t, client, &lifecycle.NewTorrent{MetaInfo: testMetaInfo(t, "b.txt", gb), Title: "Title 2"})
+		assert.Empty(t, fake.reqs)
+
+		// each fits, but not both.
+		conf.DiskSpace.DownloadDirMinFreeInGB = minFree
+		client.CheckDiskSpace()
+		assert.Len(t, fake.reqs, 1)
+
+		queued, err := db.GetQueuedTorrentsByDownloader(d, "test")
+		require.NoError(t, err)
+		require.Len(t, queued, 1)
+		assert.Equal(t, "Title 2", queued[0].Title)
+	})
+}
@@ -0,0 +1,63 @@
+package indexers
+
+import (
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/robfig/cron/v3"
+)
+
+var _ IIndexer = (*instrumented)(nil)
+
+// instrumented records request metrics of the indexer.
+type instrumented struct {
+	IIndexer
+}
+
+// Instrument wraps the indexer to record request count, latency and errors.
+func Instrument(i IIndexer) IIndexer {
+	return &instrumented{IIndexer: i}
+}
+
+func (i *instrumented) Categories() ([]Category, *errors.HTTPStatusError) {
+	start := time.Now()
+	res, err := i.IIndexer.Categories()
+	metrics.ObserveIndexer(i.Name(), "categories", start, err != nil)
+	return res, err
+}
+
+func (i *instrumented) List(req *ListRequest) (*ListResult, *errors.HTTPStatusError) {
+	start := time.Now()
+	res, err := i.IIndexer.List(req)
+	metrics.ObserveIndexer(i.Name(), "list", start, err != nil)
+	return res, err
+}
+
+func (i *instrumented) Detail(id string, fileList bool) (*ResourceDetail, *errors.HTTPStatusError) {
+	start := time.Now()
+	res, err := i.IIndexer.Detail(id, fileList)
+	metrics.ObserveIndexer(i.Name(), "detail", start, err != nil)
+	return res, err
+}
+
+func (i *instrumented) Download(id, dir string) (*DownloadResult, *errors.HTTPStatusError) {
+	start := time.Now()
+	res, err := i.IIndexer.Download(id, dir)
+	metrics.ObserveIndexer(i.Name(), "download", start, err != nil)
+	return res, err
+}
+
+func (i *instrumented) PullRSS() ([]*RSSItem, error) {
+	start := time.Now()
+	items, err := i.IIndexer.PullRSS()
+	metrics.ObserveIndexer(i.Name(), "rss", start, err != nil)
+	metrics.RSSItemsSeen.WithLabelValues(i.Name()).Add(float64(len(items)))
+	return items, err
+}
+
+// RegisterRSSCronjob runs the RSS cronjob through the wrapper, so RSS pulls and
+// the downloads of matched items are recorded.
+func (i *instrumented) RegisterRSSCronjob(cron *cron.Cron) {
+	RegisterRSSCronjob(cron, i)
+}
@@ -0,0 +1,73 @@
+package indexers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeIndexer struct {
+	IIndexer
+	name  string
+	items []*RSSItem
+	err   error
+
+	searchIndex IIndexer
+	searched    []*RSSItem
+}
+
+func (f *fakeIndexer) Name() string {
+	return f.name
+}
+
+func (f *fakeIndexer) PullRSS() ([]*RSSItem, error) {
+	return f.items, f.err
+}
+
+func (f *fakeIndexer) SearchRSS(index IIndexer, items []*RSSItem) {
+	f.searchIndex = index
+	f.searched = items
+}
+
+func TestInstrumentPullRSS(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		i := Instrument(&fakeIndexer{name: "pull-ok", items: []*RSSItem{{ResID: "1"}, {ResID: "2"}}})
+
+		items, err := i.PullRSS()
+		require.NoError(t, err)
+		assert.Len(t, items, 2)
+
+		assert.Equal(t, float64(2), testutil.ToFloat64(metrics.RSSItemsSeen.WithLabelValues("pull-ok")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(metrics.IndexerRequests.WithLabelValues("pull-ok", "rss")))
+		assert.Equal(t, float64(0), testutil.ToFloat64(metrics.IndexerErrors.WithLabelValues("pull-ok", "rss")))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		i := Instrument(&fakeIndexer{name: "pull-failed", err: errors.New("failed")})
+
+		_, err := i.PullRSS()
+		assert.EqualError(t, err, "failed")
+
+		assert.Equal(t, float64(1), testutil.ToFloat64(metrics.IndexerErrors.WithLabelValues("pull-failed", "rss")))
+	})
+}
+
+func TestInstrumentRegisterRSSCronjob(t *testing.T) {
+	f := &fakeIndexer{name: "cron", items: []*RSSItem{{ResID: "1"}}}
+	i := Instrument(f)
+
+	c := cron.New()
+	i.RegisterRSSCronjob(c)
+	require.Len(t, c.Entries(), 1)
+	c.Entries()[0].Job.Run()
+
+	// pulled and searched through the wrapper.
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.IndexerRequests.WithLabelValues("cron", "rss")))
+	assert.Same(t, i, f.searchIndex)
+	assert.Equal(t, f.items, f.searched)
+}
@@ -70,10 +70,10 @@ type MTeam struct {
 	prefetched *prefetcheddata.Data
 	standards  map[string]string
 
-	torrentsDir string
+	downloader indexers.IDownloader
 }
 
-func NewMTeam(config *Config, mType MTeamType, torrentsDir string, db *gorm.DB, notify notify.INotifier) *MTeam {
+func NewMTeam(config *Config, mType MTeamType, downloader indexers.IDownloader, db *gorm.DB, notify notify.INotifier) *MTeam {
 	if config.APIKey == "" {
 		return nil
 	}
@@ -89,7 +89,7 @@ func NewMTeam(config *Config, mType MTeamType, torrentsDir string, db *gorm.DB,
 		config:           config,
 		db:               db,
 		standards:        map[string]string{},
-		torrentsDir:      torrentsDir,
+		downloader:       downloader,
 		notify:           notify,
 	}
 
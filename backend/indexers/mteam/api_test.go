@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/anacrolix/torrent/metainfo"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
 	"github.com/charleshuang3/autoget/backend/indexers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -23,7 +24,7 @@ func TestCategories(t *testing.T) {
 
 	m := NewMTeam(&Config{
 		APIKey: apiKey,
-	}, MTeamTypeNormal, "", nil, nil)
+	}, MTeamTypeNormal, nil, nil, nil)
 	require.NotNil(t, m)
 
 	got, err := m.Categories()
@@ -38,7 +39,7 @@ func TestList(t *testing.T) {
 
 	m := NewMTeam(&Config{
 		APIKey: apiKey,
-	}, MTeamTypeNormal, "", nil, nil)
+	}, MTeamTypeNormal, nil, nil, nil)
 	require.NotNil(t, m)
 
 	tests := []struct {
@@ -145,7 +146,7 @@ func TestDetail(t *testing.T) {
 
 	m := NewMTeam(&Config{
 		APIKey: apiKey,
-	}, MTeamTypeNormal, "", nil, nil)
+	}, MTeamTypeNormal, nil, nil, nil)
 	require.NotNil(t, m)
 
 	res, err := m.Detail("947796", true)
@@ -153,6 +154,18 @@ func TestDetail(t *testing.T) {
 	assert.NotNil(t, res)
 }
 
+type fakeDownloader struct {
+	torrentsDir string
+}
+
+func (f *fakeDownloader) TorrentsDir() string {
+	return f.torrentsDir
+}
+
+func (f *fakeDownloader) AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error) {
+	return &lifecycle.AddResult{}, nil
+}
+
 func TestDownload(t *testing.T) {
 	if apiKey == "" {
 		t.Skip("MTEAM_API_KEY not set")
@@ -161,10 +174,10 @@ func TestDownload(t *testing.T) {
 	dir := t.TempDir()
 	m := NewMTeam(&Config{
 		APIKey: apiKey,
-	}, MTeamTypeNormal, dir, nil, nil)
+	}, MTeamTypeNormal, &fakeDownloader{torrentsDir: dir}, nil, nil)
 	require.NotNil(t, m)
 
-	res, err := m.Download("947796")
+	res, err := m.Download("947796", dir)
 	require.Nil(t, err)
 
 	assert.NotEmpty(t, res.TorrentFilePath)
@@ -16,7 +16,7 @@ type genDownloadLinkResponse struct {
 	Data    string      `json:"data"`
 }
 
-func (m *MTeam) Download(id string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
+func (m *MTeam) Download(id, dir string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
 	_, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
 		return nil, errors.NewHTTPStatusError(http.StatusBadRequest, "invalid id")
@@ -35,7 +35,7 @@ func (m *MTeam) Download(id string) (*indexers.DownloadResult, *errors.HTTPStatu
 		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, resp.Message)
 	}
 
-	destFilePath := filepath.Join(m.torrentsDir, name+"."+id+".torrent")
+	destFilePath := filepath.Join(dir, name+"."+id+".torrent")
 
 	me, _, err := helpers.DownloadTorrentFileFromURL(http.DefaultClient, resp.Data, destFilePath)
 	if err != nil {
@@ -2,6 +2,7 @@ package mteam
 
 import (
 	"net/url"
+	"strconv"
 
 	"github.com/charleshuang3/autoget/backend/indexers"
 	"github.com/charleshuang3/autoget/backend/indexers/rsshelper"
@@ -10,22 +11,23 @@ import (
 )
 
 func (m *MTeam) RegisterRSSCronjob(cron *cron.Cron) {
-	if m.config.RSS == "" {
+	if !m.HasRSS() {
 		return
 	}
 
-	cron.AddFunc("@every 5m", func() {
-		items, err := m.pullRSS()
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to pull RSS feed")
-			return
-		}
+	indexers.RegisterRSSCronjob(cron, m)
+}
+
+// HasRSS reports whether the RSS feed is configured.
+func (m *MTeam) HasRSS() bool {
+	return m.config.RSS != ""
+}
 
-		rsshelper.SearchRSS(m, m.db, m.notify, items)
-	})
+func (m *MTeam) SearchRSS(index indexers.IIndexer, items []*indexers.RSSItem) {
+	rsshelper.SearchRSS(index, m.db, m.notify, m.downloader, items)
 }
 
-func (m *MTeam) pullRSS() ([]*indexers.RSSItem, error) {
+func (m *MTeam) PullRSS() ([]*indexers.RSSItem, error) {
 	u, _ := url.Parse(m.config.RSS)
 
 	fp := gofeed.NewParser()
@@ -49,11 +51,13 @@ func (m *MTeam) pullRSS() ([]*indexers.RSSItem, error) {
 func (m *MTeam) ParseRSSItem(item *gofeed.Item) *indexers.RSSItem {
 	category := ""
 	url := ""
+	size := uint64(0)
 	if len(item.Categories) > 0 {
 		category = item.Categories[0]
 	}
 	if len(item.Enclosures) > 0 {
 		url = item.Enclosures[0].URL
+		size, _ = strconv.ParseUint(item.Enclosures[0].Length, 10, 64)
 	}
 
 	if url == "" {
@@ -61,9 +65,10 @@ func (m *MTeam) ParseRSSItem(item *gofeed.Item) *indexers.RSSItem {
 	}
 
 	return &indexers.RSSItem{
-		ResID:     item.GUID,
-		Title:     item.Title,
-		Catergory: category,
-		URL:       url,
+		ResID:    item.GUID,
+		Title:    item.Title,
+		Category: category,
+		URL:      url,
+		Size:     size,
 	}
 }
@@ -23,15 +23,16 @@ func TestParseRSSItem(t *testing.T) {
 
 	m := NewMTeam(&Config{
 		APIKey: "api-key",
-	}, MTeamTypeNormal, "", nil, nil)
+	}, MTeamTypeNormal, nil, nil, nil)
 
 	got := m.ParseRSSItem(feed.Items[0])
 
 	want := &indexers.RSSItem{
-		ResID:     "111111",
-		Title:     "Match Search 1",
-		Catergory: "AV(無碼)/HD Uncensored",
-		URL:       "https://rss.m-team.cc/api/rss/dlv2?uid=111111",
+		ResID:    "111111",
+		Title:    "Match Search 1",
+		Category: "AV(無碼)/HD Uncensored",
+		URL:      "https://rss.m-team.cc/api/rss/dlv2?uid=111111",
+		Size:     10692015634,
 	}
 
 	assert.Equal(t, want, got)
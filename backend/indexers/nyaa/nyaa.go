@@ -53,10 +53,10 @@ func (c *Config) getProxyURL() string {
 type Client struct {
 	indexers.IndexerBasicInfo
 
-	config      *Config
-	torrentsDir string
-	db          *gorm.DB
-	notify      notify.INotifier
+	config     *Config
+	downloader indexers.IDownloader
+	db         *gorm.DB
+	notify     notify.INotifier
 
 	httpClient *http.Client
 
@@ -72,11 +72,11 @@ func (c *Client) getBaseURL() string {
 	return c.config.BaseURL
 }
 
-func NewClient(config *Config, torrentsDir string, db *gorm.DB, notify notify.INotifier) *Client {
+func NewClient(config *Config, downloader indexers.IDownloader, db *gorm.DB, notify notify.INotifier) *Client {
 	c := &Client{
 		IndexerBasicInfo: *indexers.NewIndexerBasicInfo("nyaa", config.Downloader, false),
 		config:           config,
-		torrentsDir:      torrentsDir,
+		downloader:       downloader,
 		db:               db,
 		notify:           notify,
 		httpClient:       http.DefaultClient,
@@ -168,6 +168,9 @@ func (c *Client) List(req *indexers.ListRequest) (*indexers.ListResult, *errors.
 			item.ID = strings.TrimPrefix(idLink, "/view/")
 		}
 
+		// Column 3: Links
+		item.InfoHash = infoHashFromMagnet(s.Find(`td:nth-child(3) a[href^="magnet:"]`).AttrOr("href", ""))
+
 		// Column 4: Size
 		item.Size, _ = humanSizeToBytes(s.Find("td:nth-child(4)").Text())
 
@@ -395,7 +398,7 @@ func parseFileList(s *goquery.Selection, currentPath string, fileList *[]indexer
 }
 
 // Download the torrent file to given dir or return the magnet link.
-func (c *Client) Download(id string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
+func (c *Client) Download(id, dir string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
 	fileName := fmt.Sprintf("%s.torrent", id)
 
 	url, err := url.JoinPath(c.getBaseURL(), "download", fileName)
@@ -403,17 +406,37 @@ func (c *Client) Download(id string) (*indexers.DownloadResult, *errors.HTTPStat
 		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, fmt.Sprintf("failed to join path: %v", err))
 	}
 
-	meta, _, err := helpers.DownloadTorrentFileFromURL(c.httpClient, url, filepath.Join(c.torrentsDir, fileName))
+	destFilePath := filepath.Join(dir, fileName)
+
+	meta, _, err := helpers.DownloadTorrentFileFromURL(c.httpClient, url, destFilePath)
 	if err != nil {
 		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
 	}
 
 	return &indexers.DownloadResult{
-		TorrentFilePath: filepath.Join(c.torrentsDir, fileName),
+		TorrentFilePath: destFilePath,
 		TorrentHash:     meta.HashInfoBytes().HexString(),
 	}, nil
 }
 
+// infoHashFromMagnet returns the lowercase hex info hash, empty if not found.
+func infoHashFromMagnet(magnet string) string {
+	u, err := url.Parse(magnet)
+	if err != nil || u.Scheme != "magnet" {
+		return ""
+	}
+	xt := u.Query().Get("xt")
+	if !strings.HasPrefix(xt, "urn:btih:") {
+		return ""
+	}
+	hash := strings.TrimPrefix(xt, "urn:btih:")
+	if len(hash) != 40 {
+		// base32 hashes are not used by nyaa.
+		return ""
+	}
+	return strings.ToLower(hash)
+}
+
 func humanSizeToBytes(sizeStr string) (uint64, error) {
 	if sizeStr == "" {
 		return 0, nil
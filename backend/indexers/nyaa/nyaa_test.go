@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"testing"
 
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
 	"github.com/charleshuang3/autoget/backend/indexers"
 	"github.com/charleshuang3/autoget/backend/internal/db"
 	"github.com/mmcdole/gofeed"
@@ -13,7 +14,7 @@ import (
 )
 
 func TestCategories(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil, nil)
 	got, err := n.Categories()
 	require.Nil(t, err)
 	assert.NotEmpty(t, got)
@@ -21,7 +22,7 @@ func TestCategories(t *testing.T) {
 }
 
 func TestDetail(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil, nil)
 	got, err := n.Detail("1980585", true)
 	require.Nil(t, err)
 
@@ -38,7 +39,7 @@ func TestDetail(t *testing.T) {
 }
 
 func TestDetailWithComplexFileLists(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil, nil)
 	got, err := n.Detail("1980395", true)
 	require.Nil(t, err)
 
@@ -50,6 +51,25 @@ func TestDetailWithComplexFileLists(t *testing.T) {
 	)
 }
 
+func TestInfoHashFromMagnet(t *testing.T) {
+	tests := []struct {
+		name   string
+		magnet string
+		want   string
+	}{
+		{"hex", "magnet:?xt=urn:btih:0123456789ABCDEF0123456789ABCDEF01234567&dn=test&tr=http%3A%2F%2Fnyaa.tracker.wf%3A7777%2Fannounce", "0123456789abcdef0123456789abcdef01234567"},
+		{"base32", "magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVSYTK6N54ASGRLH", ""},
+		{"not magnet", "/download/1.torrent", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, infoHashFromMagnet(tt.magnet))
+		})
+	}
+}
+
 func TestHumanSizeToBytes(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -103,7 +123,7 @@ func TestHumanSizeToBytes(t *testing.T) {
 }
 
 func TestList(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil, nil)
 
 	tests := []struct {
 		name     string
@@ -152,8 +172,8 @@ func TestList(t *testing.T) {
 
 func TestDownload(t *testing.T) {
 	dir := t.TempDir()
-	n := NewClient(&Config{UseProxy: true}, dir, nil, nil)
-	got, err := n.Download("1980585")
+	n := NewClient(&Config{UseProxy: true}, &fakeDownloader{torrentsDir: dir}, nil, nil)
+	got, err := n.Download("1980585", dir)
 	require.Nil(t, err)
 	assert.NotEmpty(t, got.TorrentFilePath)
 	assert.FileExists(t, got.TorrentFilePath)
@@ -161,8 +181,8 @@ func TestDownload(t *testing.T) {
 }
 
 func TestPullRSS(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
-	items, err := n.pullRSS()
+	n := NewClient(&Config{UseProxy: true}, nil, nil, nil)
+	items, err := n.PullRSS()
 	require.NoError(t, err)
 	assert.NotEmpty(t, items)
 
@@ -170,10 +190,24 @@ func TestPullRSS(t *testing.T) {
 		assert.NotEmpty(t, item.Title)
 		assert.NotEmpty(t, item.URL)
 		assert.NotEmpty(t, item.ResID)
-		assert.NotEmpty(t, item.Catergory)
+		assert.NotEmpty(t, item.Category)
 	}
 }
 
+type fakeDownloader struct {
+	torrentsDir string
+	added       []*lifecycle.NewTorrent
+}
+
+func (f *fakeDownloader) TorrentsDir() string {
+	return f.torrentsDir
+}
+
+func (f *fakeDownloader) AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error) {
+	f.added = append(f.added, t)
+	return &lifecycle.AddResult{}, nil
+}
+
 type fakeNotifier struct {
 	message string
 }
@@ -193,12 +227,32 @@ var (
 	rssResp string
 )
 
+func TestParseRSSItem(t *testing.T) {
+	fp := gofeed.NewParser()
+	feed, err := fp.ParseString(rssResp)
+	require.NoError(t, err)
+
+	n := NewClient(&Config{}, nil, nil, nil)
+	got := n.ParseRSSItem(feed.Items[0])
+
+	want := &indexers.RSSItem{
+		ResID:    "1981792",
+		Title:    "Match Search 1",
+		Category: "Anime - English",
+		URL:      "https://nyaa.si/download/1981792.torrent",
+		Size:     15784004812, // 14.7 GiB
+		Seeders:  1,
+	}
+	assert.Equal(t, want, got)
+}
+
 func TestSearchRSS(t *testing.T) {
 	dir := t.TempDir()
-	d, err := db.SqliteForTest()
+	d, err := db.ForTest(t)
 	require.NoError(t, err)
 	notifier := &fakeNotifier{}
-	n := NewClient(&Config{UseProxy: true}, dir, d, notifier)
+	downloader := &fakeDownloader{torrentsDir: dir}
+	n := NewClient(&Config{UseProxy: true}, downloader, d, notifier)
 
 	search1 := &db.RSSSearch{
 		Indexer: "nyaa",
@@ -224,10 +278,16 @@ func TestSearchRSS(t *testing.T) {
 		items = append(items, n.ParseRSSItem(item))
 	}
 
-	n.SearchRSS(items)
+	n.SearchRSS(n, items)
+
+	require.Len(t, downloader.added, 1)
+	assert.FileExists(t, downloader.added[0].FilePath)
+	assert.Equal(t, []string{"nyaa"}, downloader.added[0].Labels)
+	assert.Equal(t, "nyaa", downloader.added[0].Indexer)
 
+	// started downloads are notified by the download events.
 	assert.Contains(t, notifier.message, "# nyaa RSS")
-	assert.Contains(t, notifier.message, "## Download Started\n\n- Match Search 1")
+	assert.NotContains(t, notifier.message, "## Download Started")
 	assert.Contains(t, notifier.message, "## Download Pending to Start\n\n- Match Search 2")
 
 	search1After := &db.RSSSearch{}
@@ -239,6 +299,6 @@ func TestSearchRSS(t *testing.T) {
 	assert.NoError(t, d.First(&search2After).Error)
 	assert.Equal(t, "2015287", search2After.ResID)
 	assert.Equal(t, "Match Search 2", search2After.Title)
-	assert.Equal(t, "Anime - Non-English", search2After.Catergory)
+	assert.Equal(t, "Anime - Non-English", search2After.Category)
 	assert.Equal(t, "https://nyaa.si/download/2015287.torrent", search2After.URL)
 }
@@ -2,6 +2,7 @@ package nyaa
 
 import (
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/charleshuang3/autoget/backend/indexers"
@@ -11,18 +12,10 @@ import (
 )
 
 func (c *Client) RegisterRSSCronjob(cron *cron.Cron) {
-	cron.AddFunc("@every 5m", func() {
-		items, err := c.pullRSS()
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to pull RSS feed")
-			return
-		}
-
-		c.SearchRSS(items)
-	})
+	indexers.RegisterRSSCronjob(cron, c)
 }
 
-func (c *Client) pullRSS() ([]*indexers.RSSItem, error) {
+func (c *Client) PullRSS() ([]*indexers.RSSItem, error) {
 	u, _ := url.Parse(c.getBaseURL())
 	query := u.Query()
 	query.Set("page", "rss")
@@ -54,12 +47,28 @@ func (c *Client) ParseRSSItem(item *gofeed.Item) *indexers.RSSItem {
 			item.Extensions["nyaa"]["category"][0].Value)
 	}
 
-	return &indexers.RSSItem{
-		ResID:     getResourceIDFromRSSGUID(item.GUID),
-		Title:     item.Title,
-		URL:       item.Link,
-		Catergory: catergory,
+	res := &indexers.RSSItem{
+		ResID:    getResourceIDFromRSSGUID(item.GUID),
+		Title:    item.Title,
+		URL:      item.Link,
+		Category: catergory,
 	}
+
+	if ext := item.Extensions["nyaa"]; ext != nil {
+		if len(ext["size"]) > 0 {
+			size, err := humanSizeToBytes(ext["size"][0].Value)
+			if err != nil {
+				logger.Warn().Err(err).Str("guid", item.GUID).Msg("failed to parse RSS item size")
+			}
+			res.Size = size
+		}
+		if len(ext["seeders"]) > 0 {
+			seeders, _ := strconv.ParseUint(ext["seeders"][0].Value, 10, 32)
+			res.Seeders = uint32(seeders)
+		}
+	}
+
+	return res
 }
 
 func (c *Client) getCategoryFromRSSCategory(categoryID, category string) string {
@@ -75,6 +84,6 @@ func getResourceIDFromRSSGUID(guid string) string {
 	return parts[len(parts)-1]
 }
 
-func (c *Client) SearchRSS(items []*indexers.RSSItem) {
-	rsshelper.SearchRSS(c, c.db, c.notify, items)
+func (c *Client) SearchRSS(index indexers.IIndexer, items []*indexers.RSSItem) {
+	rsshelper.SearchRSS(index, c.db, c.notify, c.downloader, items)
 }
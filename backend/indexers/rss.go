@@ -0,0 +1,20 @@
+package indexers
+
+import (
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// RegisterRSSCronjob pulls the RSS feed of index every 5 minutes and searches
+// the items, the indexers and the instrumented wrapper share it.
+func RegisterRSSCronjob(cron *cron.Cron, index IIndexer) {
+	cron.AddFunc("@every 5m", func() {
+		items, err := index.PullRSS()
+		if err != nil {
+			log.Error().Err(err).Str("indexer", index.Name()).Msg("Failed to pull RSS feed")
+			return
+		}
+
+		index.SearchRSS(index, items)
+	})
+}
@@ -0,0 +1,66 @@
+package rsshelper
+
+import (
+	"fmt"
+
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"gorm.io/gorm"
+)
+
+// Resource to download.
+type Resource struct {
+	ID       string
+	Title    string
+	Title2   string
+	Category string
+}
+
+// StartDownload downloads the torrent of the resource to the torrents dir, adds
+// it to the downloader and creates its DownloadStatus, queued if the downloader is low
+// on disk space. record runs in the transaction creating the status, it can be
+// nil. The errors of the indexer are *errors.HTTPStatusError.
+func StartDownload(d *gorm.DB, index indexers.IIndexer, downloader indexers.IDownloader, r *Resource, record func(tx *gorm.DB, s *db.DownloadStatus) error) (*db.DownloadStatus, error) {
+	res, herr := index.Download(r.ID, downloader.TorrentsDir())
+	if herr != nil {
+		return nil, herr
+	}
+
+	added, err := downloader.AddTorrent(&lifecycle.NewTorrent{
+		FilePath: res.TorrentFilePath,
+		Labels:   []string{index.Name()},
+		Title:    r.Title,
+		Indexer:  index.Name(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &db.DownloadStatus{
+		ID:         res.TorrentHash,
+		Downloader: index.DownloaderName(),
+		State:      db.DownloadStarted,
+		ResTitle:   r.Title,
+		ResTitle2:  r.Title2,
+		ResIndexer: index.Name(),
+		Category:   r.Category,
+	}
+	if added.Queued {
+		s.State = db.DownloadQueued
+	}
+
+	err = d.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(s).Error; err != nil {
+			return err
+		}
+		if record != nil {
+			return record(tx, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("torrent %s added, failed to record: %w", s.ID, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,89 @@
+package rsshelper
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestStartDownload(t *testing.T) {
+	res := &Resource{ID: "1", Title: "Show 01", Title2: "Show", Category: "Anime"}
+
+	t.Run("success", func(t *testing.T) {
+		d, err := db.ForTest(t)
+		require.NoError(t, err)
+		downloader := &fakeDownloader{}
+
+		recorded := false
+		s, err := StartDownload(d, &fakeIndexer{}, downloader, res, func(tx *gorm.DB, s *db.DownloadStatus) error {
+			recorded = true
+			assert.Equal(t, "hash1", s.ID)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, recorded)
+		assert.Equal(t, []string{"/torrents/1.torrent"}, downloader.added)
+
+		got, err := db.GetDownloadStatus(d, "hash1")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadStarted, got.State)
+		assert.Equal(t, "test", got.Downloader)
+		assert.Equal(t, "nyaa", got.ResIndexer)
+		assert.Equal(t, "Show 01", got.ResTitle)
+		assert.Equal(t, "Show", got.ResTitle2)
+		assert.Equal(t, "Anime", got.Category)
+		assert.Equal(t, got.State, s.State)
+	})
+
+	t.Run("queued", func(t *testing.T) {
+		d, err := db.ForTest(t)
+		require.NoError(t, err)
+
+		s, err := StartDownload(d, &fakeIndexer{}, &fakeDownloader{queued: true}, res, nil)
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadQueued, s.State)
+
+		got, err := db.GetDownloadStatus(d, "hash1")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadQueued, got.State)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		downloadErr := errors.NewHTTPStatusError(404, "not found")
+		addErr := stderrors.New("rpc error")
+		recordErr := stderrors.New("record error")
+
+		tests := []struct {
+			name       string
+			index      *fakeIndexer
+			downloader *fakeDownloader
+			record     error
+			wantErr    error
+		}{
+			{name: "download", index: &fakeIndexer{downloadErr: downloadErr}, downloader: &fakeDownloader{}, wantErr: downloadErr},
+			{name: "add torrent", index: &fakeIndexer{}, downloader: &fakeDownloader{err: addErr}, wantErr: addErr},
+			{name: "record", index: &fakeIndexer{}, downloader: &fakeDownloader{}, record: recordErr, wantErr: recordErr},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				d, err := db.ForTest(t)
+				require.NoError(t, err)
+
+				_, err = StartDownload(d, tt.index, tt.downloader, res, func(tx *gorm.DB, s *db.DownloadStatus) error {
+					return tt.record
+				})
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				// the status is rolled back with the record.
+				_, err = db.GetDownloadStatus(d, "hash1")
+				assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+			})
+		}
+	})
+}
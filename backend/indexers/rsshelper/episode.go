@@ -0,0 +1,125 @@
+package rsshelper
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"gorm.io/gorm"
+)
+
+var (
+	// [Group] Show - 07 [1080p], [Group] Show - 07v2 (1080p)
+	episodeDashRe = regexp.MustCompile(`^\[([^\]]+)\]\s*(.+?)\s+-\s+(\d{1,4})(?:v\d+)?(?:\s|\[|\(|\.|$)`)
+	// [Group] Show S02E07 [1080p]
+	episodeSxxExxRe = regexp.MustCompile(`(?i)^\[([^\]]+)\]\s*(.+?)\s+S\d{1,2}E(\d{1,4})(?:v\d+)?\b`)
+
+	spacesRe = regexp.MustCompile(`\s+`)
+)
+
+// Episode parsed from a release title.
+type Episode struct {
+	Group  string
+	Show   string
+	Number int
+}
+
+// ParseEpisode parses fansub style titles, e.g. `[Group] Show - 07 [1080p]`.
+func ParseEpisode(title string) (*Episode, bool) {
+	title = strings.TrimSpace(title)
+	for _, re := range []*regexp.Regexp{episodeDashRe, episodeSxxExxRe} {
+		m := re.FindStringSubmatch(title)
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[3])
+		if err != nil {
+			continue
+		}
+		return &Episode{
+			Group:  strings.TrimSpace(m[1]),
+			Show:   strings.TrimSpace(m[2]),
+			Number: n,
+		}, true
+	}
+	return nil, false
+}
+
+func normalizeShow(s string) string {
+	return spacesRe.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), " ")
+}
+
+// MatchSubscription reports whether the episode belongs to the subscription.
+func MatchSubscription(sub *db.Subscription, ep *Episode, title string) bool {
+	if normalizeShow(sub.Show) != normalizeShow(ep.Show) {
+		return false
+	}
+	if sub.ReleaseGroup != "" && !strings.EqualFold(sub.ReleaseGroup, ep.Group) {
+		return false
+	}
+	if len(sub.Resolutions) > 0 && !slices.Contains(sub.Resolutions, ResolutionOf(title)) {
+		return false
+	}
+	return true
+}
+
+// checkSubscriptions downloads new episodes of subscriptions, returns titles started.
+func checkSubscriptions(index indexers.IIndexer, d *gorm.DB, downloader indexers.IDownloader, items []*indexers.RSSItem) []string {
+	subs, err := db.GetSubscriptionsByIndexer(d, index.Name())
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get subscriptions from database")
+		return nil
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	started := []string{}
+	for _, item := range items {
+		ep, ok := ParseEpisode(item.Title)
+		if !ok {
+			continue
+		}
+
+		for _, sub := range subs {
+			if !MatchSubscription(sub, ep, item.Title) {
+				continue
+			}
+
+			fetched, err := db.HasSubscriptionEpisode(d, sub.ID, ep.Number)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to check subscription episode")
+				continue
+			}
+			if fetched {
+				continue
+			}
+
+			// a queued episode is fetched again if its torrent is dropped.
+			_, err = StartDownload(d, index, downloader, &Resource{
+				ID:       item.ResID,
+				Title:    item.Title,
+				Category: item.Category,
+			}, func(tx *gorm.DB, s *db.DownloadStatus) error {
+				return db.AddSubscriptionEpisode(tx, &db.SubscriptionEpisode{
+					SubscriptionID: sub.ID,
+					Episode:        ep.Number,
+					ResID:          item.ResID,
+					Title:          item.Title,
+					TorrentHash:    s.ID,
+				})
+			})
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to start download")
+				continue
+			}
+
+			started = append(started, item.Title)
+		}
+	}
+
+	return started
+}
@@ -0,0 +1,214 @@
+package rsshelper
+
+import (
+	stderrors "errors"
+	"strconv"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/charleshuang3/autoget/backend/internal/hub"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEpisode(t *testing.T) {
+	tests := []struct {
+		title string
+		want  *Episode
+	}{
+		{"[SubsPlease] Show Name - 07 (1080p) [ABCD1234].mkv", &Episode{"SubsPlease", "Show Name", 7}},
+		{"[Erai-raws] Show - Part 2 - 12v2 [720p]", &Episode{"Erai-raws", "Show - Part 2", 12}},
+		{"[Group] One Piece - 1100 [1080p]", &Episode{"Group", "One Piece", 1100}},
+		{"[Group] Show S02E03 [1080p]", &Episode{"Group", "Show", 3}},
+		{"[Group] Show - 01", &Episode{"Group", "Show", 1}},
+		{"[Group] Show - 01 ~ 12 [BD 1080p]", &Episode{"Group", "Show", 1}},
+		{"Show - 07 [1080p]", nil},
+		{"[Group] Show [Batch]", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			got, ok := ParseEpisode(tt.title)
+			if tt.want == nil {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchSubscription(t *testing.T) {
+	title := "[SubsPlease] Show  Name - 07 (1080p)"
+	ep, ok := ParseEpisode(title)
+	require.True(t, ok)
+
+	assert.True(t, MatchSubscription(&db.Subscription{Show: "show name"}, ep, title))
+	assert.True(t, MatchSubscription(&db.Subscription{Show: "Show Name", ReleaseGroup: "subsplease"}, ep, title))
+	assert.True(t, MatchSubscription(&db.Subscription{Show: "Show Name", Resolutions: []string{indexers.Resolution1080p}}, ep, title))
+	assert.False(t, MatchSubscription(&db.Subscription{Show: "Show"}, ep, title))
+	assert.False(t, MatchSubscription(&db.Subscription{Show: "Show Name", ReleaseGroup: "Erai-raws"}, ep, title))
+	assert.False(t, MatchSubscription(&db.Subscription{Show: "Show Name", Resolutions: []string{indexers.Resolution720p}}, ep, title))
+}
+
+type fakeIndexer struct {
+	indexers.IIndexer
+	downloaded  []string
+	downloadErr *errors.HTTPStatusError
+}
+
+func (f *fakeIndexer) Name() string {
+	return "nyaa"
+}
+
+func (f *fakeIndexer) DownloaderName() string {
+	return "test"
+}
+
+func (f *fakeIndexer) Download(id, dir string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
+	f.downloaded = append(f.downloaded, id)
+	if f.downloadErr != nil {
+		return nil, f.downloadErr
+	}
+	return &indexers.DownloadResult{TorrentFilePath: dir + "/" + id + ".torrent", TorrentHash: "hash" + id}, nil
+}
+
+type fakeDownloader struct {
+	added  []string
+	queued bool
+	err    error
+}
+
+func (f *fakeDownloader) TorrentsDir() string {
+	return "/torrents"
+}
+
+func (f *fakeDownloader) AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.added = append(f.added, t.FilePath)
+	return &lifecycle.AddResult{Queued: f.queued}, nil
+}
+
+type fakeNotifier struct {
+	messages []string
+}
+
+func (f *fakeNotifier) SendMessage(msg string) error {
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func (f *fakeNotifier) SendMarkdownMessage(msg string) error {
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func TestSearchRSSSubscriptions(t *testing.T) {
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	sub := &db.Subscription{Indexer: "nyaa", Show: "Show", ReleaseGroup: "SubsPlease"}
+	require.NoError(t, db.AddSubscription(d, sub))
+	require.NoError(t, db.AddSubscriptionEpisode(d, &db.SubscriptionEpisode{SubscriptionID: sub.ID, Episode: 1, ResID: "1"}))
+
+	index := &fakeIndexer{}
+	downloader := &fakeDownloader{}
+	notifier := &fakeNotifier{}
+
+	SearchRSS(index, d, notifier, downloader, []*indexers.RSSItem{
+		{ResID: "1", Title: "[SubsPlease] Show - 01 (1080p)"},
+		{ResID: "2", Title: "[SubsPlease] Show - 02 (1080p)"},
+		{ResID: "3", Title: "[SubsPlease] Show - 02 (720p)"},
+		{ResID: "4", Title: "[Erai-raws] Show - 03 (1080p)"},
+		{ResID: "5", Title: "[SubsPlease] Other Show - 03 (1080p)"},
+		{ResID: "6", Title: "[SubsPlease] Show - 03 (1080p)"},
+	})
+
+	assert.Equal(t, []string{"2", "6"}, index.downloaded)
+	assert.Equal(t, []string{"/torrents/2.torrent", "/torrents/6.torrent"}, downloader.added)
+	// started downloads are notified by the download events.
+	assert.Empty(t, notifier.messages)
+
+	got, err := db.GetSubscription(d, sub.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Episodes, 3)
+	assert.Equal(t, "hash6", got.Episodes[2].TorrentHash)
+
+	s, err := db.GetDownloadStatus(d, "hash6")
+	require.NoError(t, err)
+	assert.Equal(t, "[SubsPlease] Show - 03 (1080p)", s.ResTitle)
+
+	// an episode seen again is not downloaded again.
+	SearchRSS(index, d, notifier, downloader, []*indexers.RSSItem{
+		{ResID: "7", Title: "[SubsPlease] Show - 03v2 (1080p)"},
+	})
+	assert.Len(t, index.downloaded, 2)
+
+	// an episode failed to start is not recorded.
+	item := &indexers.RSSItem{ResID: "8", Title: "[SubsPlease] Show - 04 (1080p)"}
+	SearchRSS(index, d, notifier, &fakeDownloader{err: stderrors.New("rpc error")}, []*indexers.RSSItem{item})
+	has, err := db.HasSubscriptionEpisode(d, sub.ID, 4)
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	// a queued episode is recorded with its queued status.
+	SearchRSS(index, d, notifier, &fakeDownloader{queued: true}, []*indexers.RSSItem{item})
+	has, err = db.HasSubscriptionEpisode(d, sub.ID, 4)
+	require.NoError(t, err)
+	assert.True(t, has)
+	s, err = db.GetDownloadStatus(d, "hash8")
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadQueued, s.State)
+}
+
+type fakeApprover struct {
+	fakeNotifier
+	pendings []*notify.PendingDownload
+}
+
+func (f *fakeApprover) SendPendingDownload(p *notify.PendingDownload) error {
+	f.pendings = append(f.pendings, p)
+	return nil
+}
+
+func TestSearchRSSPendingDownload(t *testing.T) {
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	search := &db.RSSSearch{Indexer: "nyaa", Text: "show", Action: "notification"}
+	require.NoError(t, db.AddSearch(d, search))
+
+	events, unsubscribe := hub.Default.Subscribe()
+	t.Cleanup(unsubscribe)
+
+	matched := metrics.RSSItemsMatched.WithLabelValues("nyaa", strconv.FormatUint(uint64(search.ID), 10))
+	matchedBefore := testutil.ToFloat64(matched)
+
+	notifier := &fakeApprover{}
+	SearchRSS(&fakeIndexer{}, d, notifier, &fakeDownloader{}, []*indexers.RSSItem{
+		{ResID: "1", Title: "Show 01", URL: "http://nyaa/1"},
+	})
+
+	require.Len(t, events, 2)
+	assert.Equal(t, &hub.Event{Type: hub.RSSMatch, Data: &hub.RSSMatchData{
+		Indexer: "nyaa", SearchID: search.ID, Action: "notification", ResID: "1", Title: "Show 01",
+	}}, <-events)
+	assert.Equal(t, &hub.Event{Type: hub.RSSPoll, Data: &hub.RSSPollData{
+		Indexer: "nyaa", Items: 1, DownloadStarted: []string{}, DownloadPendingToStart: []string{"Show 01"},
+	}}, <-events)
+	assert.Equal(t, matchedBefore+1, testutil.ToFloat64(matched))
+
+	require.Len(t, notifier.messages, 1)
+	assert.Equal(t, []*notify.PendingDownload{
+		{SearchID: search.ID, Indexer: "nyaa", Title: "Show 01", URL: "http://nyaa/1"},
+	}, notifier.pendings)
+}
@@ -0,0 +1,146 @@
+package rsshelper
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+)
+
+var (
+	errInvalidSizeRange = errors.New("min size is larger than max size")
+
+	validResolutions = []string{
+		indexers.Resolution8K,
+		indexers.Resolution4K,
+		indexers.Resolution1080p,
+		indexers.Resolution1080i,
+		indexers.Resolution720p,
+		indexers.ResolutionSD,
+	}
+)
+
+// resolutionPatterns are checked in order, the first match wins.
+var resolutionPatterns = []struct {
+	resolution string
+	re         *regexp.Regexp
+}{
+	{indexers.Resolution8K, regexp.MustCompile(`(?i)\b(8k|4320p)\b`)},
+	{indexers.Resolution4K, regexp.MustCompile(`(?i)\b(4k|uhd|2160p|3840x2160)\b`)},
+	{indexers.Resolution1080p, regexp.MustCompile(`(?i)\b(1080p|1920x1080)\b`)},
+	{indexers.Resolution1080i, regexp.MustCompile(`(?i)\b1080i\b`)},
+	{indexers.Resolution720p, regexp.MustCompile(`(?i)\b(720p|1280x720)\b`)},
+	{indexers.ResolutionSD, regexp.MustCompile(`(?i)\b(360p|480p|576p|sd)\b`)},
+}
+
+// ResolutionOf guesses the resolution from the title, empty if unknown.
+func ResolutionOf(title string) string {
+	for _, p := range resolutionPatterns {
+		if p.re.MatchString(title) {
+			return p.resolution
+		}
+	}
+	return ""
+}
+
+// ValidateConstraints checks the constraints of the search can be applied.
+func ValidateConstraints(search *db.RSSSearch) error {
+	for _, r := range search.IncludeRegexes {
+		if _, err := regexp.Compile(r); err != nil {
+			return err
+		}
+	}
+	if search.MaxSize != 0 && search.MinSize > search.MaxSize {
+		return errInvalidSizeRange
+	}
+	for _, r := range search.Resolutions {
+		if !slices.Contains(validResolutions, r) {
+			return fmt.Errorf("invalid resolution: %s", r)
+		}
+	}
+	return nil
+}
+
+// Matcher is a search with its include regexes compiled, to match many items.
+type Matcher struct {
+	search   *db.RSSSearch
+	includes []*regexp.Regexp
+}
+
+// NewMatcher compiles the include regexes of the search, they are checked by
+// ValidateConstraints when the search is created.
+func NewMatcher(search *db.RSSSearch) (*Matcher, error) {
+	m := &Matcher{search: search}
+	for _, r := range search.IncludeRegexes {
+		re, err := regexp.Compile("(?i)" + r)
+		if err != nil {
+			return nil, err
+		}
+		m.includes = append(m.includes, re)
+	}
+	return m, nil
+}
+
+// newMatchers of the searches, searches which fail to compile are logged and
+// skipped.
+func newMatchers(searches []*db.RSSSearch) []*Matcher {
+	matchers := []*Matcher{}
+	for _, search := range searches {
+		m, err := NewMatcher(search)
+		if err != nil {
+			logger.Error().Err(err).Uint("search", search.ID).Msg("Invalid include regex")
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
+
+// Match reports whether the item satisfies the text and all constraints of
+// the search. Size and resolution constraints fail if the item does not
+// provide them.
+func (m *Matcher) Match(item *indexers.RSSItem) bool {
+	search := m.search
+	title := strings.ToLower(item.Title)
+
+	if !strings.Contains(title, search.Text) {
+		return false
+	}
+
+	for _, re := range m.includes {
+		if !re.MatchString(item.Title) {
+			return false
+		}
+	}
+
+	for _, term := range search.ExcludeTerms {
+		if term != "" && strings.Contains(title, term) {
+			return false
+		}
+	}
+
+	if search.CategoryFilter != "" {
+		category := strings.ToLower(item.Category)
+		filter := strings.ToLower(search.CategoryFilter)
+		if category != filter && !strings.HasPrefix(category, filter+" - ") && !strings.HasPrefix(category, filter+"/") {
+			return false
+		}
+	}
+
+	if search.MinSize != 0 && item.Size < search.MinSize {
+		return false
+	}
+	if search.MaxSize != 0 && (item.Size == 0 || item.Size > search.MaxSize) {
+		return false
+	}
+
+	if len(search.Resolutions) > 0 && !slices.Contains(search.Resolutions, ResolutionOf(item.Title)) {
+		return false
+	}
+
+	return true
+}
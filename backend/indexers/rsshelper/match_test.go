@@ -0,0 +1,176 @@
+package rsshelper
+
+import (
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolutionOf(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"[SubsPlease] One Piece - 1100 (1080p) [ABCD1234].mkv", indexers.Resolution1080p},
+		{"One Piece 1100 WEB-DL 2160p HEVC", indexers.Resolution4K},
+		{"[Group] One Piece - 1100 [1280x720]", indexers.Resolution720p},
+		{"One Piece - 1100 (480p)", indexers.ResolutionSD},
+		{"One Piece - 1100", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.want, ResolutionOf(tt.title))
+		})
+	}
+}
+
+func TestValidateConstraints(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		assert.NoError(t, ValidateConstraints(&db.RSSSearch{
+			IncludeRegexes: []string{`- \d+`},
+			MinSize:        1,
+			MaxSize:        2,
+			Resolutions:    []string{indexers.Resolution1080p},
+		}))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			search  *db.RSSSearch
+			wantErr string
+		}{
+			{
+				name:    "invalid regex",
+				search:  &db.RSSSearch{IncludeRegexes: []string{`(`}},
+				wantErr: "missing closing )",
+			},
+			{
+				name:    "invalid size range",
+				search:  &db.RSSSearch{MinSize: 2, MaxSize: 1},
+				wantErr: "min size is larger than max size",
+			},
+			{
+				name:    "invalid resolution",
+				search:  &db.RSSSearch{Resolutions: []string{"1440p"}},
+				wantErr: "invalid resolution: 1440p",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.ErrorContains(t, ValidateConstraints(tt.search), tt.wantErr)
+			})
+		}
+	})
+}
+
+func TestMatch(t *testing.T) {
+	const gib = 1024 * 1024 * 1024
+
+	item := &indexers.RSSItem{
+		Title:    "[SubsPlease] One Piece - 1100 (1080p) [ABCD1234].mkv",
+		Category: "Anime - English-translated",
+		Size:     1 * gib,
+	}
+
+	tests := []struct {
+		name   string
+		search *db.RSSSearch
+		item   *indexers.RSSItem
+		want   bool
+	}{
+		{
+			name:   "text only",
+			search: &db.RSSSearch{Text: "one piece"},
+			want:   true,
+		},
+		{
+			name:   "text not match",
+			search: &db.RSSSearch{Text: "naruto"},
+			want:   false,
+		},
+		{
+			name:   "include regexes",
+			search: &db.RSSSearch{Text: "one piece", IncludeRegexes: []string{`^\[subsplease\]`, `- \d+ `}},
+			want:   true,
+		},
+		{
+			name:   "include regex not match",
+			search: &db.RSSSearch{Text: "one piece", IncludeRegexes: []string{`batch`}},
+			want:   false,
+		},
+		{
+			name:   "exclude terms",
+			search: &db.RSSSearch{Text: "one piece", ExcludeTerms: []string{"batch", "abcd1234"}},
+			want:   false,
+		},
+		{
+			name:   "category",
+			search: &db.RSSSearch{Text: "one piece", CategoryFilter: "anime - english-translated"},
+			want:   true,
+		},
+		{
+			name:   "parent category",
+			search: &db.RSSSearch{Text: "one piece", CategoryFilter: "Anime"},
+			want:   true,
+		},
+		{
+			name:   "category not match",
+			search: &db.RSSSearch{Text: "one piece", CategoryFilter: "Anime - Raw"},
+			want:   false,
+		},
+		{
+			name:   "size in range",
+			search: &db.RSSSearch{Text: "one piece", MinSize: 500 * 1024 * 1024, MaxSize: 2 * gib},
+			want:   true,
+		},
+		{
+			name:   "too small",
+			search: &db.RSSSearch{Text: "one piece", MinSize: 2 * gib},
+			want:   false,
+		},
+		{
+			name:   "too large",
+			search: &db.RSSSearch{Text: "one piece", MaxSize: 500 * 1024 * 1024},
+			want:   false,
+		},
+		{
+			name:   "unknown size",
+			search: &db.RSSSearch{Text: "one piece", MaxSize: 2 * gib},
+			item:   &indexers.RSSItem{Title: item.Title},
+			want:   false,
+		},
+		{
+			name:   "resolution",
+			search: &db.RSSSearch{Text: "one piece", Resolutions: []string{indexers.Resolution1080p, indexers.Resolution4K}},
+			want:   true,
+		},
+		{
+			name:   "resolution not match",
+			search: &db.RSSSearch{Text: "one piece", Resolutions: []string{indexers.Resolution4K}},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := item
+			if tt.item != nil {
+				i = tt.item
+			}
+			m, err := NewMatcher(tt.search)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m.Match(i))
+		})
+	}
+
+	t.Run("invalid include regex", func(t *testing.T) {
+		_, err := NewMatcher(&db.RSSSearch{Text: "one piece", IncludeRegexes: []string{`(`}})
+		assert.Error(t, err)
+	})
+}
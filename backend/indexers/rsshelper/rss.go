@@ -3,12 +3,16 @@ package rsshelper
 import (
 	"bytes"
 	_ "embed"
-	"strings"
+	"strconv"
 	"text/template"
+	"time"
 
 	"github.com/charleshuang3/autoget/backend/indexers"
 	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/hub"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
 	"github.com/charleshuang3/autoget/backend/internal/notify"
+	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 )
@@ -26,16 +30,16 @@ func init() {
 	}
 }
 
+// RSSResultTemplateData of the RSS message, started downloads are notified by
+// the download events.
 type RSSResultTemplateData struct {
 	Indexer                string
-	DownloadStarted        []string
 	DownloadPendingToStart []string
 }
 
-func RenderRSSResult(indexer string, downloadStarted []string, downloadPendingToStart []string) (string, error) {
+func RenderRSSResult(indexer string, downloadPendingToStart []string) (string, error) {
 	data := RSSResultTemplateData{
 		Indexer:                indexer,
-		DownloadStarted:        downloadStarted,
 		DownloadPendingToStart: downloadPendingToStart,
 	}
 
@@ -51,7 +55,155 @@ var (
 	logger = log.With().Str("module", "rsshelper").Logger()
 )
 
-func SearchRSS(index indexers.IIndexer, d *gorm.DB, notify notify.INotifier, items []*indexers.RSSItem) {
+// DefaultHistoryDays to keep RSS items.
+const DefaultHistoryDays = 30
+
+// RegisterHistoryCleanup deletes RSS items not seen in the days daily, 0 for
+// DefaultHistoryDays.
+func RegisterHistoryCleanup(cron *cron.Cron, d *gorm.DB, days int) {
+	if days == 0 {
+		days = DefaultHistoryDays
+	}
+
+	cron.AddFunc("@daily", func() {
+		n, err := db.DeleteRSSItemsBefore(d, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to clean up RSS history")
+			return
+		}
+		logger.Info().Int64("deleted", n).Msg("Cleaned up RSS history")
+	})
+}
+
+// saveHistory stores the items to the RSS history of the indexer.
+func saveHistory(d *gorm.DB, indexer string, items []*indexers.RSSItem) {
+	history := []*db.RSSItem{}
+	for _, item := range items {
+		history = append(history, &db.RSSItem{
+			ResID:    item.ResID,
+			Title:    item.Title,
+			Category: item.Category,
+			URL:      item.URL,
+			Size:     item.Size,
+			Seeders:  item.Seeders,
+
+			DownloadLink: item.DownloadLink,
+		})
+	}
+	if err := db.SaveRSSItems(d, indexer, history); err != nil {
+		logger.Error().Err(err).Msg("Failed to save RSS history")
+	}
+}
+
+// found records the item as the match of the search.
+func found(d *gorm.DB, indexer string, search *db.RSSSearch, item *indexers.RSSItem) error {
+	setMatch(search, item)
+	if err := db.UpdateSearch(d, search); err != nil {
+		return err
+	}
+
+	publishMatch(indexer, search)
+	return nil
+}
+
+func setMatch(search *db.RSSSearch, item *indexers.RSSItem) {
+	search.Title = item.Title
+	search.URL = item.URL
+	search.ResID = item.ResID
+	search.Category = item.Category
+}
+
+func publishMatch(indexer string, search *db.RSSSearch) {
+	metrics.RSSItemsMatched.WithLabelValues(indexer, strconv.FormatUint(uint64(search.ID), 10)).Inc()
+	hub.Publish(hub.RSSMatch, &hub.RSSMatchData{
+		Indexer:  indexer,
+		SearchID: search.ID,
+		Action:   search.Action,
+		ResID:    search.ResID,
+		Title:    search.Title,
+	})
+}
+
+// AddMatchedSearch adds the search matched by the item.
+func AddMatchedSearch(d *gorm.DB, search *db.RSSSearch, item *indexers.RSSItem) error {
+	setMatch(search, item)
+	if err := db.AddSearch(d, search); err != nil {
+		return err
+	}
+
+	publishMatch(search.Indexer, search)
+	return nil
+}
+
+// MatchHistory returns the newest item of the RSS history of the search's
+// indexer since the time matching the search, nil if no item matches.
+func MatchHistory(d *gorm.DB, search *db.RSSSearch, since time.Time) (*indexers.RSSItem, error) {
+	search.Normalize()
+	m, err := NewMatcher(search)
+	if err != nil {
+		return nil, err
+	}
+	history, err := db.GetRSSItemsSince(d, search.Indexer, since)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range history {
+		item := &indexers.RSSItem{
+			ResID:    h.ResID,
+			Title:    h.Title,
+			Category: h.Category,
+			URL:      h.URL,
+			Size:     h.Size,
+			Seeders:  h.Seeders,
+		}
+		if m.Match(item) {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
+// NotifyPending asks to approve the matched notification searches of the
+// indexer, the approver calls back handlers.Service.HandlePendingDownload.
+func NotifyPending(notifier notify.INotifier, indexer string, searches []*db.RSSSearch) {
+	if notifier == nil || len(searches) == 0 {
+		return
+	}
+
+	titles := []string{}
+	for _, search := range searches {
+		titles = append(titles, search.Title)
+	}
+	msg, err := RenderRSSResult(indexer, titles)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to render RSS result")
+		return
+	}
+	if err := notifier.SendMarkdownMessage(msg); err != nil {
+		logger.Error().Err(err).Msg("Failed to send RSS notification")
+	}
+
+	approver, ok := notifier.(notify.IApprover)
+	if !ok {
+		return
+	}
+	for _, search := range searches {
+		err := approver.SendPendingDownload(&notify.PendingDownload{
+			SearchID: search.ID,
+			Indexer:  indexer,
+			Title:    search.Title,
+			URL:      search.URL,
+		})
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to send pending download")
+		}
+	}
+}
+
+func SearchRSS(index indexers.IIndexer, d *gorm.DB, notifier notify.INotifier, downloader indexers.IDownloader, items []*indexers.RSSItem) {
+	saveHistory(d, index.Name(), items)
+
 	searchs, err := db.GetSearchsByIndexer(d, index.Name())
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to get searchs from database")
@@ -60,52 +212,57 @@ func SearchRSS(index indexers.IIndexer, d *gorm.DB, notify notify.INotifier, ite
 
 	downloadStarted := []string{}
 	downloadPendingToStart := []string{}
+	pendings := []*db.RSSSearch{}
 
+	matchers := newMatchers(searchs)
 	for _, item := range items {
-		for _, search := range searchs {
+		for _, m := range matchers {
+			search := m.search
 			if search.ResID != "" {
 				continue
 			}
-			if strings.Contains(strings.ToLower(item.Title), search.Text) {
-				search.Title = item.Title
-				search.URL = item.URL
-				search.ResID = item.ResID
-				search.Catergory = item.Catergory
-
-				err = db.UpdateSearch(d, search)
-				if err != nil {
-					logger.Error().Err(err).Msg("Failed to update search")
-					continue
-				}
-
-				if search.Action == "download" {
-					_, err := index.Download(search.ResID)
+			if m.Match(item) {
+				if search.Action == indexers.ActionDownload {
+					// the search is kept unmatched to retry if the download fails.
+					_, err := StartDownload(d, index, downloader, &Resource{
+						ID:       item.ResID,
+						Title:    item.Title,
+						Category: item.Category,
+					}, func(tx *gorm.DB, _ *db.DownloadStatus) error {
+						return db.DeleteSearch(tx, search.ID)
+					})
 					if err != nil {
-						logger.Error().Err(err).Msg("Failed to download torrent")
-						continue
-					}
-
-					if err := db.DeleteSearch(d, search.ID); err != nil {
-						logger.Error().Err(err).Msg("Failed to delete search")
+						logger.Error().Err(err).Msg("Failed to start download")
 						continue
 					}
+					setMatch(search, item)
+					publishMatch(index.Name(), search)
 
 					downloadStarted = append(downloadStarted, search.Title)
-				} else if search.Action == "notification" {
+					continue
+				}
+
+				if err := found(d, index.Name(), search, item); err != nil {
+					logger.Error().Err(err).Msg("Failed to update search")
+					continue
+				}
+
+				if search.Action == indexers.ActionNotification {
 					downloadPendingToStart = append(downloadPendingToStart, search.Title)
+					pendings = append(pendings, search)
 				}
 			}
 		}
 	}
 
-	if len(downloadStarted) > 0 || len(downloadPendingToStart) > 0 {
-		msg, err := RenderRSSResult(index.Name(), downloadStarted, downloadPendingToStart)
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to render RSS result")
-			return
-		}
-		if err := notify.SendMarkdownMessage(msg); err != nil {
-			logger.Error().Err(err).Msg("Failed to send RSS notification")
-		}
-	}
+	downloadStarted = append(downloadStarted, checkSubscriptions(index, d, downloader, items)...)
+
+	hub.Publish(hub.RSSPoll, &hub.RSSPollData{
+		Indexer:                index.Name(),
+		Items:                  len(items),
+		DownloadStarted:        downloadStarted,
+		DownloadPendingToStart: downloadPendingToStart,
+	})
+
+	NotifyPending(notifier, index.Name(), pendings)
 }
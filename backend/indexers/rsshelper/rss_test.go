@@ -1,45 +1,31 @@
 package rsshelper
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func TestRenderRSSResult(t *testing.T) {
 	tests := []struct {
 		name                   string
 		indexer                string
-		downloadStarted        []string
 		downloadPendingToStart []string
 		expectedSubstrings     []string
 		notExpectedSubstrings  []string
 	}{
 		{
-			name:    "Both lists populated",
+			name:    "DownloadPendingToStart populated",
 			indexer: "TestIndexer",
-			downloadStarted: []string{
-				"Item A",
-				"Item B",
-			},
-			downloadPendingToStart: []string{
-				"Item C",
-				"Item D",
-			},
-			expectedSubstrings: []string{
-				"# TestIndexer RSS",
-				"## Download Started",
-				"- Item A",
-				"- Item B",
-				"## Download Pending to Start",
-				"- Item C",
-				"- Item D",
-			},
-			notExpectedSubstrings: []string{},
-		},
-		{
-			name:            "DownloadStarted empty",
-			indexer:         "TestIndexer",
-			downloadStarted: []string{},
 			downloadPendingToStart: []string{
 				"Item C",
 				"Item D",
@@ -55,33 +41,13 @@ func TestRenderRSSResult(t *testing.T) {
 			},
 		},
 		{
-			name:    "DownloadPendingToStart empty",
-			indexer: "TestIndexer",
-			downloadStarted: []string{
-				"Item A",
-				"Item B",
-			},
-			downloadPendingToStart: []string{},
-			expectedSubstrings: []string{
-				"# TestIndexer RSS",
-				"## Download Started",
-				"- Item A",
-				"- Item B",
-			},
-			notExpectedSubstrings: []string{
-				"## Download Pending to Start",
-			},
-		},
-		{
-			name:                   "Both lists empty",
+			name:                   "DownloadPendingToStart empty",
 			indexer:                "TestIndexer",
-			downloadStarted:        []string{},
 			downloadPendingToStart: []string{},
 			expectedSubstrings: []string{
 				"# TestIndexer RSS",
 			},
 			notExpectedSubstrings: []string{
-				"## Download Started",
 				"## Download Pending to Start",
 			},
 		},
@@ -89,7 +55,7 @@ func TestRenderRSSResult(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := RenderRSSResult(tt.indexer, tt.downloadStarted, tt.downloadPendingToStart)
+			result, err := RenderRSSResult(tt.indexer, tt.downloadPendingToStart)
 			if err != nil {
 				t.Fatalf("RenderRSSResult returned an error: %v", err)
 			}
@@ -108,3 +74,101 @@ func TestRenderRSSResult(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchRSSHistory(t *testing.T) {
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	items := []*indexers.RSSItem{
+		{ResID: "1", Title: "Show 01", Category: "Anime", URL: "http://nyaa/1", Size: 100, Seeders: 5},
+		{ResID: "2", Title: "Show 02"},
+	}
+	SearchRSS(&fakeIndexer{}, d, &fakeNotifier{}, &fakeDownloader{}, items)
+	SearchRSS(&fakeIndexer{}, d, &fakeNotifier{}, &fakeDownloader{}, items[:1])
+
+	history, err := db.GetRSSItemsSince(d, "nyaa", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "2", history[0].ResID)
+	assert.Equal(t, "1", history[1].ResID)
+	assert.Equal(t, "nyaa", history[1].Indexer)
+	assert.Equal(t, "Anime", history[1].Category)
+	assert.Equal(t, uint64(100), history[1].Size)
+	assert.Equal(t, uint32(5), history[1].Seeders)
+}
+
+func TestMatchHistory(t *testing.T) {
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, item := range []*db.RSSItem{
+		{Indexer: "nyaa", ResID: "1", Title: "Show 01", CreatedAt: now.Add(-time.Hour), UpdatedAt: now.Add(-time.Hour)},
+		{Indexer: "nyaa", ResID: "2", Title: "Show 02", CreatedAt: now, UpdatedAt: now},
+		{Indexer: "nyaa", ResID: "3", Title: "Old Show", CreatedAt: now.AddDate(0, 0, -10), UpdatedAt: now.AddDate(0, 0, -10)},
+		{Indexer: "m-team", ResID: "4", Title: "Movie"},
+	} {
+		require.NoError(t, d.Create(item).Error)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		search := &db.RSSSearch{Indexer: "nyaa", Text: "show", Action: "notification"}
+
+		item, err := MatchHistory(d, search, now.AddDate(0, 0, -7))
+		require.NoError(t, err)
+		require.NotNil(t, item)
+
+		// the newest item matches.
+		assert.Equal(t, "2", item.ResID)
+		assert.Equal(t, "Show 02", item.Title)
+
+		require.NoError(t, AddMatchedSearch(d, search, item))
+		got, err := db.GetSearch(d, search.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "2", got.ResID)
+		assert.Equal(t, "Show 02", got.Title)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		for _, text := range []string{"old show", "movie"} {
+			search := &db.RSSSearch{Indexer: "nyaa", Text: text, Action: "notification"}
+
+			item, err := MatchHistory(d, search, now.AddDate(0, 0, -7))
+			require.NoError(t, err)
+			assert.Nil(t, item, text)
+		}
+	})
+}
+
+func TestSearchRSSDownload(t *testing.T) {
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+
+	search := &db.RSSSearch{Indexer: "nyaa", Text: "show", Action: "download"}
+	require.NoError(t, db.AddSearch(d, search))
+	items := []*indexers.RSSItem{{ResID: "1", Title: "Show 01", Category: "Anime"}}
+
+	// the search is kept unmatched if the download fails.
+	SearchRSS(&fakeIndexer{}, d, &fakeNotifier{}, &fakeDownloader{err: errors.New("rpc error")}, items)
+
+	got, err := db.GetSearch(d, search.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.ResID)
+
+	// downloads of the wrapped indexer are recorded.
+	requests := metrics.IndexerRequests.WithLabelValues("nyaa", "download")
+	requestsBefore := testutil.ToFloat64(requests)
+
+	downloader := &fakeDownloader{}
+	SearchRSS(indexers.Instrument(&fakeIndexer{}), d, &fakeNotifier{}, downloader, items)
+	assert.Equal(t, []string{"/torrents/1.torrent"}, downloader.added)
+	assert.Equal(t, requestsBefore+1, testutil.ToFloat64(requests))
+
+	_, err = db.GetSearch(d, search.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	s, err := db.GetDownloadStatus(d, "hash1")
+	require.NoError(t, err)
+	assert.Equal(t, "Show 01", s.ResTitle)
+	assert.Equal(t, "nyaa", s.ResIndexer)
+}
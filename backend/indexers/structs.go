@@ -1,6 +1,7 @@
 package indexers
 
 import (
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
 	"github.com/charleshuang3/autoget/backend/internal/errors"
 	"github.com/robfig/cron/v3"
 )
@@ -19,15 +20,31 @@ type IIndexer interface {
 	Detail(id string, fileList bool) (*ResourceDetail, *errors.HTTPStatusError)
 
 	// Download the torrent file to given dir or return the magnet link.
-	Download(id string) (*DownloadResult, *errors.HTTPStatusError)
+	Download(id, dir string) (*DownloadResult, *errors.HTTPStatusError)
 
-	// RegisterRSSCronjob
+	// PullRSS reads the latest items of the RSS feed.
+	PullRSS() ([]*RSSItem, error)
+
+	// SearchRSS matches the items against the RSS searches, matched resources
+	// are downloaded through index, the indexer itself or its wrapper.
+	SearchRSS(index IIndexer, items []*RSSItem)
+
+	// RegisterRSSCronjob pulls and searches the RSS feed periodically.
 	RegisterRSSCronjob(cron *cron.Cron)
 
 	// DownloaderName
 	DownloaderName() string
 }
 
+// IDownloader is the part of the downloader used by indexers.
+type IDownloader interface {
+	// TorrentsDir to store downloaded torrent files.
+	TorrentsDir() string
+
+	// AddTorrent to the torrent client, or queue it for disk space.
+	AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error)
+}
+
 type IndexerBasicInfo struct {
 	Name_           string
 	DownloaderName_ string
@@ -97,6 +114,7 @@ type ListResourceItem struct {
 	Images      []string  `json:"images,omitempty"`
 	Free        bool      `json:"free,omitempty"`
 	Labels      []string  `json:"labels,omitempty"`
+	InfoHash    string    `json:"infoHash,omitempty"` // lowercase hex, empty if unknown
 }
 
 type File struct {
@@ -137,8 +155,13 @@ type RSSSearch struct {
 }
 
 type RSSItem struct {
-	ResID     string `json:"res_id"`
-	Title     string `json:"title"`
-	Catergory string `json:"catergory"`
-	URL       string `json:"url"`
+	ResID    string `json:"res_id"`
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	URL      string `json:"url"`
+	Size     uint64 `json:"size"`    // in bytes, 0 if the feed does not provide it
+	Seeders  uint32 `json:"seeders"` // 0 if the feed does not provide it
+	// DownloadLink is kept in the RSS history for indexers which can not
+	// download by ResID.
+	DownloadLink string `json:"-"`
 }
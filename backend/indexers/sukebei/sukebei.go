@@ -1,6 +1,7 @@
 package sukebei
 
 import (
+	"github.com/charleshuang3/autoget/backend/indexers"
 	"github.com/charleshuang3/autoget/backend/indexers/nyaa"
 	"github.com/charleshuang3/autoget/backend/indexers/sukebei/prefetcheddata"
 	"github.com/charleshuang3/autoget/backend/internal/notify"
@@ -15,9 +16,9 @@ type Client struct {
 	nyaa.Client
 }
 
-func NewClient(config *nyaa.Config, torrentsDir string, db *gorm.DB, notify notify.INotifier) *Client {
+func NewClient(config *nyaa.Config, downloader indexers.IDownloader, db *gorm.DB, notify notify.INotifier) *Client {
 	c := &Client{}
-	c.Client = *nyaa.NewClient(config, torrentsDir, db, notify)
+	c.Client = *nyaa.NewClient(config, downloader, db, notify)
 	c.Name_ = "sukebei"
 	c.Client.DefaultBaseURL = defaultBaseURL
 	c.Client.CategoriesMap = prefetcheddata.Categories
@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"testing"
 
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
 	"github.com/charleshuang3/autoget/backend/indexers"
 	"github.com/charleshuang3/autoget/backend/indexers/nyaa"
 	"github.com/charleshuang3/autoget/backend/internal/db"
@@ -14,7 +15,7 @@ import (
 )
 
 func TestCategories(t *testing.T) {
-	n := NewClient(&nyaa.Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&nyaa.Config{UseProxy: true}, nil, nil, nil)
 	got, err := n.Categories()
 	require.Nil(t, err)
 	assert.NotEmpty(t, got)
@@ -22,7 +23,7 @@ func TestCategories(t *testing.T) {
 }
 
 func TestList(t *testing.T) {
-	n := NewClient(&nyaa.Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&nyaa.Config{UseProxy: true}, nil, nil, nil)
 
 	tests := []struct {
 		name     string
@@ -71,8 +72,8 @@ func TestList(t *testing.T) {
 
 func TestDownload(t *testing.T) {
 	dir := t.TempDir()
-	n := NewClient(&nyaa.Config{UseProxy: true}, dir, nil, nil)
-	got, err := n.Download("4322631")
+	n := NewClient(&nyaa.Config{UseProxy: true}, &fakeDownloader{torrentsDir: dir}, nil, nil)
+	got, err := n.Download("4322631", dir)
 	require.Nil(t, err)
 	assert.NotEmpty(t, got.TorrentFilePath)
 	assert.FileExists(t, got.TorrentFilePath)
@@ -80,7 +81,7 @@ func TestDownload(t *testing.T) {
 }
 
 func TestDetail(t *testing.T) {
-	n := NewClient(&nyaa.Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&nyaa.Config{UseProxy: true}, nil, nil, nil)
 	got, err := n.Detail("4322631", true)
 	require.Nil(t, err)
 
@@ -93,6 +94,20 @@ func TestDetail(t *testing.T) {
 	assert.NotEmpty(t, got.Files)
 }
 
+type fakeDownloader struct {
+	torrentsDir string
+	added       []*lifecycle.NewTorrent
+}
+
+func (f *fakeDownloader) TorrentsDir() string {
+	return f.torrentsDir
+}
+
+func (f *fakeDownloader) AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error) {
+	f.added = append(f.added, t)
+	return &lifecycle.AddResult{}, nil
+}
+
 type fakeNotifier struct {
 	message string
 }
@@ -114,10 +129,11 @@ var (
 
 func TestSearchRSS(t *testing.T) {
 	dir := t.TempDir()
-	d, err := db.SqliteForTest()
+	d, err := db.ForTest(t)
 	require.NoError(t, err)
 	notifier := &fakeNotifier{}
-	n := NewClient(&nyaa.Config{UseProxy: true}, dir, d, notifier)
+	downloader := &fakeDownloader{torrentsDir: dir}
+	n := NewClient(&nyaa.Config{UseProxy: true}, downloader, d, notifier)
 
 	search1 := &db.RSSSearch{
 		Indexer: "sukebei",
@@ -143,10 +159,16 @@ func TestSearchRSS(t *testing.T) {
 		items = append(items, n.ParseRSSItem(item))
 	}
 
-	n.SearchRSS(items)
+	n.SearchRSS(n, items)
+
+	require.Len(t, downloader.added, 1)
+	assert.FileExists(t, downloader.added[0].FilePath)
+	assert.Equal(t, []string{"sukebei"}, downloader.added[0].Labels)
+	assert.Equal(t, "sukebei", downloader.added[0].Indexer)
 
+	// started downloads are notified by the download events.
 	assert.Contains(t, notifier.message, "# sukebei RSS")
-	assert.Contains(t, notifier.message, "## Download Started\n\n- Match Search 1")
+	assert.NotContains(t, notifier.message, "## Download Started")
 	assert.Contains(t, notifier.message, "## Download Pending to Start\n\n- Match Search 2")
 
 	search1After := &db.RSSSearch{}
@@ -158,6 +180,6 @@ func TestSearchRSS(t *testing.T) {
 	assert.NoError(t, d.First(&search2After).Error)
 	assert.Equal(t, "4326217", search2After.ResID)
 	assert.Equal(t, "Match Search 2", search2After.Title)
-	assert.Equal(t, "Art - Pictures", search2After.Catergory)
+	assert.Equal(t, "Art - Pictures", search2After.Category)
 	assert.Equal(t, "https://sukebei.nyaa.si/download/4326217.torrent", search2After.URL)
 }
@@ -0,0 +1,122 @@
+package torznab
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+)
+
+// Torznab spec: https://torznab.github.io/spec-1.3-draft/torznab/Specification-v1.3.html
+
+type capsDoc struct {
+	XMLName    xml.Name      `xml:"caps"`
+	Categories []capCategory `xml:"categories>category"`
+}
+
+type capCategory struct {
+	ID      string        `xml:"id,attr"`
+	Name    string        `xml:"name,attr"`
+	Subcats []capCategory `xml:"subcat"`
+}
+
+type errorDoc struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        int      `xml:"code,attr"`
+	Description string   `xml:"description,attr"`
+}
+
+type feedDoc struct {
+	XMLName xml.Name `xml:"rss"`
+	Channel struct {
+		Response struct {
+			Offset int `xml:"offset,attr"`
+			Total  int `xml:"total,attr"`
+		} `xml:"http://torznab.com/schemas/2015/feed response"`
+		Items []feedItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type feedItem struct {
+	Title      string   `xml:"title"`
+	GUID       string   `xml:"guid"`
+	Link       string   `xml:"link"`
+	Comments   string   `xml:"comments"`
+	PubDate    string   `xml:"pubDate"`
+	Size       uint64   `xml:"size"`
+	Categories []string `xml:"category"`
+	Enclosure  struct {
+		URL    string `xml:"url,attr"`
+		Length uint64 `xml:"length,attr"`
+	} `xml:"enclosure"`
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"http://torznab.com/schemas/2015/feed attr"`
+}
+
+func (item *feedItem) attr(name string) string {
+	for _, a := range item.Attrs {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (item *feedItem) downloadLink() string {
+	if item.Enclosure.URL != "" {
+		return item.Enclosure.URL
+	}
+	return item.Link
+}
+
+func (item *feedItem) size() uint64 {
+	if item.Size > 0 {
+		return item.Size
+	}
+	if size, err := strconv.ParseUint(item.attr("size"), 10, 64); err == nil {
+		return size
+	}
+	return item.Enclosure.Length
+}
+
+// category returns the first category id, prefer the specific one from attrs.
+func (item *feedItem) category() string {
+	if cat := item.attr("category"); cat != "" {
+		return cat
+	}
+	if len(item.Categories) > 0 {
+		return item.Categories[0]
+	}
+	return ""
+}
+
+func (item *feedItem) createdDate() int64 {
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+		if t, err := time.Parse(layout, item.PubDate); err == nil {
+			return t.Unix()
+		}
+	}
+	return 0
+}
+
+func toCategories(caps []capCategory) []indexers.Category {
+	cats := []indexers.Category{}
+	for _, c := range caps {
+		cats = append(cats, indexers.Category{
+			ID:            c.ID,
+			Name:          c.Name,
+			SubCategories: toSubCategories(c.Subcats),
+		})
+	}
+	return cats
+}
+
+func toSubCategories(caps []capCategory) []indexers.Category {
+	if len(caps) == 0 {
+		return nil
+	}
+	return toCategories(caps)
+}
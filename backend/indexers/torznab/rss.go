@@ -0,0 +1,40 @@
+package torznab
+
+import (
+	"net/url"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/indexers/rsshelper"
+	"github.com/robfig/cron/v3"
+)
+
+func (c *Client) RegisterRSSCronjob(cron *cron.Cron) {
+	indexers.RegisterRSSCronjob(cron, c)
+}
+
+func (c *Client) SearchRSS(index indexers.IIndexer, items []*indexers.RSSItem) {
+	rsshelper.SearchRSS(index, c.db, c.notify, c.downloader, items)
+}
+
+// PullRSS reads the latest releases, a search without query.
+func (c *Client) PullRSS() ([]*indexers.RSSItem, error) {
+	feed, resources, err := c.search(url.Values{"t": {"search"}})
+	if err != nil {
+		return nil, err
+	}
+
+	items := []*indexers.RSSItem{}
+	for i, res := range resources {
+		items = append(items, &indexers.RSSItem{
+			ResID:    res.ID,
+			Title:    res.Title,
+			Category: res.Category,
+			URL:      feed.Channel.Items[i].Comments,
+			Size:     res.Size,
+			Seeders:  res.Seeders,
+
+			DownloadLink: feed.Channel.Items[i].downloadLink(),
+		})
+	}
+	return items, nil
+}
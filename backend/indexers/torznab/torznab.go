@@ -0,0 +1,335 @@
+package torznab
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/charleshuang3/autoget/backend/internal/helpers"
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	_ indexers.IIndexer = (*Client)(nil)
+
+	logger = log.With().Str("indexer", "torznab").Logger()
+)
+
+const (
+	defaultPageSize = 50
+
+	// resources seen in search results, torznab can not look up a resource by
+	// id. Resources seen in the RSS feed are also in the RSS history.
+	maxCachedResources = 5000
+)
+
+type Config struct {
+	Name       string `yaml:"name"`
+	BaseURL    string `yaml:"base_url"` // torznab api endpoint, e.g. http://jackett:9117/api/v2.0/indexers/xxx/results/torznab/
+	APIKey     string `yaml:"api_key"`
+	Downloader string `yaml:"downloader"`
+	Private    bool   `yaml:"private"`
+}
+
+type resource struct {
+	item indexers.ListResourceItem
+	link string
+}
+
+type Client struct {
+	indexers.IndexerBasicInfo
+
+	config     *Config
+	downloader indexers.IDownloader
+	db         *gorm.DB
+	notify     notify.INotifier
+
+	httpClient *http.Client
+
+	mu         sync.Mutex
+	categories []indexers.Category
+	resources  map[string]*resource
+	order      []string
+}
+
+func NewClient(config *Config, downloader indexers.IDownloader, db *gorm.DB, notify notify.INotifier) *Client {
+	return &Client{
+		IndexerBasicInfo: *indexers.NewIndexerBasicInfo(config.Name, config.Downloader, config.Private),
+		config:           config,
+		downloader:       downloader,
+		db:               db,
+		notify:           notify,
+		httpClient:       &http.Client{Timeout: 30 * time.Second},
+		resources:        map[string]*resource{},
+	}
+}
+
+// get calls the torznab api and decodes the response into v.
+func (c *Client) get(q url.Values, v any) *errors.HTTPStatusError {
+	u, err := url.Parse(c.config.BaseURL)
+	if err != nil {
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, fmt.Sprintf("failed to parse base url: %v", err))
+	}
+	if !strings.HasSuffix(u.Path, "/api") {
+		u = u.JoinPath("api")
+	}
+	q.Set("apikey", c.config.APIKey)
+	u.RawQuery = q.Encode()
+
+	resp, err := c.httpClient.Get(u.String())
+	if err != nil {
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, fmt.Sprintf("failed to call torznab api: %v", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, fmt.Sprintf("failed to read response body: %v", err))
+	}
+
+	// torznab reports errors in the body, often with status 200.
+	e := &errorDoc{}
+	if xml.Unmarshal(body, e) == nil {
+		return errors.NewHTTPStatusError(http.StatusBadGateway, fmt.Sprintf("torznab error %d: %s", e.Code, e.Description))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.NewHTTPStatusError(resp.StatusCode, fmt.Sprintf("torznab api status code: %d", resp.StatusCode))
+	}
+
+	if err := xml.Unmarshal(body, v); err != nil {
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, fmt.Sprintf("failed to parse XML: %v", err))
+	}
+	return nil
+}
+
+// Categories returns indexer's resource categories from the caps.
+func (c *Client) Categories() ([]indexers.Category, *errors.HTTPStatusError) {
+	c.mu.Lock()
+	cats := c.categories
+	c.mu.Unlock()
+	if cats != nil {
+		return cats, nil
+	}
+
+	caps := &capsDoc{}
+	if err := c.get(url.Values{"t": {"caps"}}, caps); err != nil {
+		return nil, err
+	}
+	cats = toCategories(caps.Categories)
+
+	c.mu.Lock()
+	c.categories = cats
+	c.mu.Unlock()
+	return cats, nil
+}
+
+// categoryName of id in cats, or id if it is unknown.
+func categoryName(cats []indexers.Category, id string) string {
+	if name, ok := findCategoryName(cats, id); ok {
+		return name
+	}
+	return id
+}
+
+func findCategoryName(cats []indexers.Category, id string) (string, bool) {
+	for _, cat := range cats {
+		if cat.ID == id {
+			return cat.Name, true
+		}
+		if name, ok := findCategoryName(cat.SubCategories, id); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (c *Client) search(q url.Values) (*feedDoc, []indexers.ListResourceItem, *errors.HTTPStatusError) {
+	feed := &feedDoc{}
+	if err := c.get(q, feed); err != nil {
+		return nil, nil, err
+	}
+
+	// resolve the categories once, a failed caps request is not retried for
+	// every item. Items then keep the category ids.
+	cats, _ := c.Categories()
+
+	items := []indexers.ListResourceItem{}
+	for i := range feed.Channel.Items {
+		items = append(items, c.remember(&feed.Channel.Items[i], cats))
+	}
+	return feed, items, nil
+}
+
+// remember caches the item for Detail and Download.
+func (c *Client) remember(fi *feedItem, cats []indexers.Category) indexers.ListResourceItem {
+	key := fi.GUID
+	if key == "" {
+		key = fi.downloadLink()
+	}
+	sum := sha1.Sum([]byte(key))
+
+	item := indexers.ListResourceItem{
+		ID:          hex.EncodeToString(sum[:8]),
+		Title:       fi.Title,
+		CreatedDate: fi.createdDate(),
+		Category:    categoryName(cats, fi.category()),
+		Size:        fi.size(),
+		Free:        fi.attr("downloadvolumefactor") == "0",
+		InfoHash:    strings.ToLower(fi.attr("infohash")),
+	}
+	if seeders, err := strconv.ParseUint(fi.attr("seeders"), 10, 32); err == nil {
+		item.Seeders = uint32(seeders)
+	}
+	if peers, err := strconv.ParseUint(fi.attr("peers"), 10, 32); err == nil && uint32(peers) > item.Seeders {
+		item.Leechers = uint32(peers) - item.Seeders
+	}
+	if imdb := fi.attr("imdb"); imdb != "" {
+		item.DBs = append(item.DBs, indexers.VideoDB{
+			DB:   "imdb",
+			Link: fmt.Sprintf("https://www.imdb.com/title/tt%07s/", strings.TrimPrefix(imdb, "tt")),
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.resources[item.ID]; !ok {
+		c.order = append(c.order, item.ID)
+	}
+	c.resources[item.ID] = &resource{item: item, link: fi.downloadLink()}
+	for len(c.order) > maxCachedResources {
+		delete(c.resources, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	return item
+}
+
+func (c *Client) lookup(id string) (*resource, *errors.HTTPStatusError) {
+	c.mu.Lock()
+	res, ok := c.resources[id]
+	c.mu.Unlock()
+	if ok {
+		return res, nil
+	}
+
+	// the cache is lost on restart, RSS items can be pending approval.
+	notFound := errors.NewHTTPStatusError(http.StatusNotFound, "resource not found, search it again")
+	if c.db == nil {
+		return nil, notFound
+	}
+	item, err := db.GetRSSItem(c.db, c.Name(), id)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, notFound
+	}
+	if err != nil {
+		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
+	}
+	if item.DownloadLink == "" {
+		return nil, notFound
+	}
+
+	return &resource{
+		item: indexers.ListResourceItem{
+			ID:          item.ResID,
+			Title:       item.Title,
+			CreatedDate: item.CreatedAt.Unix(),
+			Category:    item.Category,
+			Size:        item.Size,
+			Seeders:     item.Seeders,
+		},
+		link: item.DownloadLink,
+	}, nil
+}
+
+// List resources in given category and keyword (optional).
+func (c *Client) List(req *indexers.ListRequest) (*indexers.ListResult, *errors.HTTPStatusError) {
+	pageSize := req.PageSize
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	page := req.Page
+	if page == 0 {
+		page = 1
+	}
+
+	q := url.Values{
+		"t":      {"search"},
+		"offset": {strconv.Itoa(int((page - 1) * pageSize))},
+		"limit":  {strconv.Itoa(int(pageSize))},
+	}
+	if req.Keyword != "" {
+		q.Set("q", req.Keyword)
+	}
+	if req.Category != "" {
+		q.Set("cat", req.Category)
+	}
+
+	feed, items, err := c.search(q)
+	if err != nil {
+		return nil, err
+	}
+
+	total := uint32(feed.Channel.Response.Total)
+	if total == 0 {
+		// response is optional, assume no more pages.
+		total = (page-1)*pageSize + uint32(len(items))
+	}
+
+	return &indexers.ListResult{
+		Pagination: indexers.Pagination{
+			Page:       page,
+			TotalPages: (total + pageSize - 1) / pageSize,
+			PageSize:   pageSize,
+			Total:      total,
+		},
+		Resources: items,
+	}, nil
+}
+
+// Detail of a resource, only resources in recent search results are known.
+func (c *Client) Detail(id string, fileList bool) (*indexers.ResourceDetail, *errors.HTTPStatusError) {
+	res, err := c.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	return &indexers.ResourceDetail{ListResourceItem: res.item}, nil
+}
+
+// Download the torrent file to given dir.
+func (c *Client) Download(id, dir string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
+	res, herr := c.lookup(id)
+	if herr != nil {
+		return nil, herr
+	}
+	if strings.HasPrefix(res.link, "magnet:") {
+		return nil, errors.NewHTTPStatusError(http.StatusNotImplemented, "magnet links are not supported")
+	}
+
+	destFilePath := filepath.Join(dir, fmt.Sprintf("%s-%s.torrent", c.Name(), id))
+
+	meta, _, err := helpers.DownloadTorrentFileFromURL(c.httpClient, res.link, destFilePath)
+	if err != nil {
+		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
+	}
+
+	return &indexers.DownloadResult{
+		TorrentFilePath: destFilePath,
+		TorrentHash:     meta.HashInfoBytes().HexString(),
+	}, nil
+}
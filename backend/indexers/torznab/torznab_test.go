@@ -0,0 +1,298 @@
+package torznab
+
+import (
+	"bytes"
+	_ "embed"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/indexers/rsshelper"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	//go:embed test_data/caps.xml
+	capsXML string
+	//go:embed test_data/search.xml
+	searchXML string
+	//go:embed test_data/error.xml
+	errorXML string
+)
+
+type fakeDownloader struct {
+	torrentsDir string
+}
+
+func (f *fakeDownloader) TorrentsDir() string {
+	return f.torrentsDir
+}
+
+func (f *fakeDownloader) AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error) {
+	return &lifecycle.AddResult{}, nil
+}
+
+func testTorrent(t *testing.T) ([]byte, string) {
+	t.Helper()
+
+	info := metainfo.Info{
+		Name:        "test.txt",
+		PieceLength: 16 * 1024,
+		Length:      11,
+		Pieces:      make([]byte, 20),
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+	buf := &bytes.Buffer{}
+	require.NoError(t, mi.Write(buf))
+
+	return buf.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+type fakeTorznab struct {
+	server   *httptest.Server
+	torrent  []byte
+	requests []*http.Request
+	capsDown bool
+}
+
+func setup(t *testing.T) (*Client, *fakeTorznab) {
+	t.Helper()
+
+	fake := &fakeTorznab{}
+	fake.torrent, _ = testTorrent(t)
+	fake.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.requests = append(fake.requests, r)
+
+		if r.URL.Path == "/dl/1001.torrent" {
+			w.Write(fake.torrent)
+			return
+		}
+
+		if r.URL.Path != "/torznab/api" || r.URL.Query().Get("apikey") != "key" {
+			w.Write([]byte(errorXML))
+			return
+		}
+
+		switch r.URL.Query().Get("t") {
+		case "caps":
+			if fake.capsDown {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(capsXML))
+		case "search":
+			w.Write([]byte(strings.ReplaceAll(searchXML, "{{BASE}}", fake.server.URL)))
+		}
+	}))
+	t.Cleanup(fake.server.Close)
+
+	c := NewClient(&Config{
+		Name:       "tracker",
+		BaseURL:    fake.server.URL + "/torznab/",
+		APIKey:     "key",
+		Downloader: "transmission",
+	}, &fakeDownloader{torrentsDir: t.TempDir()}, nil, nil)
+
+	return c, fake
+}
+
+func TestCategories(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		c, fake := setup(t)
+
+		got, err := c.Categories()
+		require.Nil(t, err)
+		require.Len(t, got, 3)
+		assert.Equal(t, indexers.Category{
+			ID:   "5000",
+			Name: "TV",
+			SubCategories: []indexers.Category{
+				{ID: "5070", Name: "TV/Anime"},
+			},
+		}, got[1])
+
+		// caps are cached.
+		_, err = c.Categories()
+		require.Nil(t, err)
+		assert.Len(t, fake.requests, 1)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c, _ := setup(t)
+		c.config.APIKey = "wrong"
+
+		_, err := c.Categories()
+		require.NotNil(t, err)
+		assert.Equal(t, http.StatusBadGateway, err.Code)
+		assert.Equal(t, "torznab error 100: Invalid API Key", err.Message)
+	})
+}
+
+func TestList(t *testing.T) {
+	c, fake := setup(t)
+
+	got, err := c.List(&indexers.ListRequest{
+		Category: "5070",
+		Keyword:  "Show",
+		Page:     2,
+		PageSize: 20,
+	})
+	require.Nil(t, err)
+
+	q := fake.requests[0].URL.Query()
+	assert.Equal(t, "search", q.Get("t"))
+	assert.Equal(t, "Show", q.Get("q"))
+	assert.Equal(t, "5070", q.Get("cat"))
+	assert.Equal(t, "20", q.Get("offset"))
+	assert.Equal(t, "20", q.Get("limit"))
+
+	assert.Equal(t, indexers.Pagination{Page: 2, TotalPages: 6, PageSize: 20, Total: 120}, got.Pagination)
+	require.Len(t, got.Resources, 2)
+
+	first := got.Resources[0]
+	assert.Len(t, first.ID, 16)
+	assert.Equal(t, "[SubsPlease] Show - 07 (1080p) [ABCD1234].mkv", first.Title)
+	assert.Equal(t, "TV/Anime", first.Category)
+	assert.Equal(t, uint64(1450000000), first.Size)
+	assert.Equal(t, int64(1700000000), first.CreatedDate)
+	assert.Equal(t, uint32(120), first.Seeders)
+	assert.Equal(t, uint32(10), first.Leechers)
+	assert.True(t, first.Free)
+	assert.Equal(t, "aaaabbbbccccddddeeeeffff0000111122223333", first.InfoHash)
+
+	second := got.Resources[1]
+	assert.Equal(t, "Movies/HD", second.Category)
+	assert.Equal(t, uint64(8000000000), second.Size)
+	assert.Equal(t, uint32(0), second.Leechers)
+	assert.False(t, second.Free)
+	assert.Equal(t, []indexers.VideoDB{{DB: "imdb", Link: "https://www.imdb.com/title/tt1234567/"}}, second.DBs)
+}
+
+func TestListCapsFailed(t *testing.T) {
+	c, fake := setup(t)
+	fake.capsDown = true
+
+	got, err := c.List(&indexers.ListRequest{})
+	require.Nil(t, err)
+	require.Len(t, got.Resources, 2)
+	assert.Equal(t, "5070", got.Resources[0].Category)
+
+	// caps are requested once for the page, not for every item.
+	caps := 0
+	for _, r := range fake.requests {
+		if r.URL.Query().Get("t") == "caps" {
+			caps++
+		}
+	}
+	assert.Equal(t, 1, caps)
+}
+
+func TestDetail(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		c, _ := setup(t)
+		list, err := c.List(&indexers.ListRequest{})
+		require.Nil(t, err)
+
+		got, err := c.Detail(list.Resources[0].ID, true)
+		require.Nil(t, err)
+		assert.Equal(t, list.Resources[0], got.ListResourceItem)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c, _ := setup(t)
+
+		_, err := c.Detail("unknown", true)
+		require.NotNil(t, err)
+		assert.Equal(t, http.StatusNotFound, err.Code)
+	})
+}
+
+func TestDownload(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		c, _ := setup(t)
+		_, hash := testTorrent(t)
+		list, err := c.List(&indexers.ListRequest{})
+		require.Nil(t, err)
+
+		got, err := c.Download(list.Resources[0].ID, t.TempDir())
+		require.Nil(t, err)
+		assert.Equal(t, hash, got.TorrentHash)
+		assert.FileExists(t, got.TorrentFilePath)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c, _ := setup(t)
+		list, err := c.List(&indexers.ListRequest{})
+		require.Nil(t, err)
+
+		_, err = c.Download(list.Resources[1].ID, t.TempDir())
+		require.NotNil(t, err)
+		assert.Equal(t, http.StatusNotImplemented, err.Code)
+
+		_, err = c.Download("unknown", t.TempDir())
+		require.NotNil(t, err)
+		assert.Equal(t, http.StatusNotFound, err.Code)
+	})
+}
+
+func TestPullRSS(t *testing.T) {
+	c, fake := setup(t)
+
+	items, err := c.PullRSS()
+	require.NoError(t, err)
+
+	q := fake.requests[0].URL.Query()
+	assert.Empty(t, q.Get("q"))
+
+	require.Len(t, items, 2)
+	assert.Equal(t, "[SubsPlease] Show - 07 (1080p) [ABCD1234].mkv", items[0].Title)
+	assert.Equal(t, "https://tracker.example.com/view/1001", items[0].URL)
+	assert.Equal(t, "TV/Anime", items[0].Category)
+	assert.Equal(t, uint64(1450000000), items[0].Size)
+	assert.Equal(t, uint32(120), items[0].Seeders)
+
+	// RSS items can be downloaded.
+	_, herr := c.Download(items[0].ResID, t.TempDir())
+	assert.Nil(t, herr)
+}
+
+func TestLookupFromRSSHistory(t *testing.T) {
+	c, _ := setup(t)
+	d, err := db.ForTest(t)
+	require.NoError(t, err)
+	c.db = d
+	_, hash := testTorrent(t)
+
+	items, err := c.PullRSS()
+	require.NoError(t, err)
+	rsshelper.SearchRSS(c, d, nil, c.downloader, items)
+
+	// lost on restart.
+	c.mu.Lock()
+	c.resources = map[string]*resource{}
+	c.order = nil
+	c.mu.Unlock()
+
+	detail, herr := c.Detail(items[0].ResID, false)
+	require.Nil(t, herr)
+	assert.Equal(t, items[0].Title, detail.Title)
+	assert.Equal(t, items[0].Size, detail.Size)
+
+	got, herr := c.Download(items[0].ResID, t.TempDir())
+	require.Nil(t, herr)
+	assert.Equal(t, hash, got.TorrentHash)
+
+	_, herr = c.Download("unknown", t.TempDir())
+	require.NotNil(t, herr)
+	assert.Equal(t, http.StatusNotFound, herr.Code)
+}
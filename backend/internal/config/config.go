@@ -7,22 +7,113 @@ import (
 	dlconfig "github.com/charleshuang3/autoget/backend/downloaders/config"
 	"github.com/charleshuang3/autoget/backend/indexers/mteam"
 	"github.com/charleshuang3/autoget/backend/indexers/nyaa"
+	"github.com/charleshuang3/autoget/backend/indexers/torznab"
+	"github.com/charleshuang3/autoget/backend/internal/notify/discord"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"github.com/charleshuang3/autoget/backend/internal/notify/slack"
 	"github.com/charleshuang3/autoget/backend/internal/notify/telegram"
+	"github.com/charleshuang3/autoget/backend/internal/notify/webhook"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Port     string `yaml:"port"`
 	ProxyURL string `yaml:"proxy_url"`
-	PgDSN    string `yaml:"pg_dsn"`
+	// PgDSN is the postgres DSN, use Database for sqlite.
+	PgDSN    string          `yaml:"pg_dsn"`
+	Database *DatabaseConfig `yaml:"database"`
 
+	// Notifiers, all optional.
 	Telegram *telegram.Config `yaml:"telegram"`
+	Discord  *discord.Config  `yaml:"discord"`
+	Slack    *slack.Config    `yaml:"slack"`
+	Webhook  *webhook.Config  `yaml:"webhook"`
+
+	// DownloadEvents configures notifications of download lifecycle events.
+	DownloadEvents events.Config `yaml:"download_events"`
 
 	MTeam   *mteam.Config `yaml:"mteam"`
 	Nyaa    *nyaa.Config  `yaml:"nyaa"`
 	Sukebei *nyaa.Config  `yaml:"sukebei"`
 
+	// TorznabIndexers are generic indexers, e.g. Jackett or Prowlarr.
+	TorznabIndexers []*torznab.Config `yaml:"torznab_indexers"`
+	// RSSHistoryDays keeps RSS items seen in the days, default 30.
+	RSSHistoryDays int `yaml:"rss_history_days"`
+
 	Downloaders map[string]*dlconfig.DownloaderConfig `yaml:"downloaders"`
+
+	Torznab *TorznabConfig `yaml:"torznab"`
+
+	Auth *AuthConfig `yaml:"auth"`
+}
+
+const (
+	DatabasePostgres = "postgres"
+	DatabaseSqlite   = "sqlite"
+)
+
+type DatabaseConfig struct {
+	Type string `yaml:"type"` // postgres or sqlite
+	// DSN of postgres.
+	DSN string `yaml:"dsn"`
+	// Path of the sqlite file.
+	Path string `yaml:"path"`
+}
+
+func (c *DatabaseConfig) validate() error {
+	switch c.Type {
+	case DatabasePostgres:
+		if c.DSN == "" {
+			return fmt.Errorf("postgres DSN is required")
+		}
+	case DatabaseSqlite:
+		if c.Path == "" {
+			return fmt.Errorf("sqlite path is required")
+		}
+	default:
+		return fmt.Errorf("unknown database type: %s", c.Type)
+	}
+	return nil
+}
+
+// TorznabConfig enables the Torznab API for Sonarr/Radarr. APIKey is included
+// in the download links of search results, as torznab clients expect. The
+// indexer URL to add in Sonarr/Radarr is
+// http://<host>/api/v1/torznab/<indexer>, with API path /api.
+type TorznabConfig struct {
+	APIKey string `yaml:"api_key"`
+}
+
+// AuthConfig enables authentication of the API, API tokens are managed via
+// the API.
+type AuthConfig struct {
+	// Username and Password enable login with session cookies for the
+	// frontend, sessions have all scopes.
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	SessionTTLHours int    `yaml:"session_ttl_hours"` // default 7 days
+
+	// AdminToken is a static token with all scopes, to manage API tokens
+	// without login.
+	AdminToken string `yaml:"admin_token"`
+}
+
+func (c *AuthConfig) LoginEnabled() bool {
+	return c.Username != "" && c.Password != ""
+}
+
+func (c *AuthConfig) validate() error {
+	if (c.Username == "") != (c.Password == "") {
+		return fmt.Errorf("auth username and password are both required for login")
+	}
+	if !c.LoginEnabled() && c.AdminToken == "" {
+		return fmt.Errorf("auth requires login or admin token")
+	}
+	if c.SessionTTLHours < 0 {
+		return fmt.Errorf("invalid auth session TTL: %d", c.SessionTTLHours)
+	}
+	return nil
 }
 
 func ReadConfig(path string) (*Config, error) {
@@ -45,23 +136,48 @@ func ReadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if config.Database == nil {
+		config.Database = &DatabaseConfig{Type: DatabasePostgres, DSN: config.PgDSN}
+	}
+
 	return config, nil
 }
 
 func (c *Config) validate() error {
-	if c.PgDSN == "" {
+	if c.Database != nil {
+		if c.PgDSN != "" {
+			return fmt.Errorf("pg_dsn and database are exclusive")
+		}
+		if err := c.Database.validate(); err != nil {
+			return err
+		}
+	} else if c.PgDSN == "" {
 		return fmt.Errorf("postgres DSN is required")
 	}
 
-	if c.Telegram == nil {
-		return fmt.Errorf("telegram config is required")
+	if c.Telegram != nil {
+		if err := c.Telegram.Validate(); err != nil {
+			return err
+		}
 	}
-
-	if c.Telegram.Token == "" {
-		return fmt.Errorf("telegram token is required")
+	if c.Discord != nil {
+		if err := c.Discord.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Slack != nil {
+		if err := c.Slack.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Webhook != nil {
+		if err := c.Webhook.Validate(); err != nil {
+			return err
+		}
 	}
-	if c.Telegram.ChatID == "" {
-		return fmt.Errorf("telegram chat ID is required")
+
+	if err := c.DownloadEvents.Validate(); err != nil {
+		return err
 	}
 
 	if c.MTeam != nil {
@@ -97,6 +213,44 @@ func (c *Config) validate() error {
 		}
 	}
 
+	names := map[string]bool{"m-team": true, "m-team:adult": true, "nyaa": true, "sukebei": true}
+	for _, t := range c.TorznabIndexers {
+		if t.Name == "" {
+			return fmt.Errorf("torznab indexer name is required")
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate indexer name: %s", t.Name)
+		}
+		names[t.Name] = true
+
+		if t.BaseURL == "" {
+			return fmt.Errorf("torznab indexer %s base URL is required", t.Name)
+		}
+		if t.APIKey == "" {
+			return fmt.Errorf("torznab indexer %s API key is required", t.Name)
+		}
+		if t.Downloader == "" {
+			return fmt.Errorf("torznab indexer %s downloader is required", t.Name)
+		}
+		if _, ok := c.Downloaders[t.Downloader]; !ok {
+			return fmt.Errorf("unknown torznab indexer %s downloader: %s", t.Name, t.Downloader)
+		}
+	}
+
+	if c.RSSHistoryDays < 0 {
+		return fmt.Errorf("invalid rss history days: %d", c.RSSHistoryDays)
+	}
+
+	if c.Torznab != nil && c.Torznab.APIKey == "" {
+		return fmt.Errorf("torznab API key is required")
+	}
+
+	if c.Auth != nil {
+		if err := c.Auth.validate(); err != nil {
+			return err
+		}
+	}
+
 	for name, downloader := range c.Downloaders {
 		if err := downloader.Validate(); err != nil {
 			return fmt.Errorf("invalid downloader config for %s: %v", name, err)
@@ -2,13 +2,21 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	dlconfig "github.com/charleshuang3/autoget/backend/downloaders/config"
 	"github.com/charleshuang3/autoget/backend/indexers/mteam"
 	"github.com/charleshuang3/autoget/backend/indexers/nyaa"
+	"github.com/charleshuang3/autoget/backend/indexers/torznab"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/notify/discord"
+	"github.com/charleshuang3/autoget/backend/internal/notify/events"
+	"github.com/charleshuang3/autoget/backend/internal/notify/slack"
 	"github.com/charleshuang3/autoget/backend/internal/notify/telegram"
+	"github.com/charleshuang3/autoget/backend/internal/notify/webhook"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestReadConfig(t *testing.T) {
@@ -53,6 +61,7 @@ downloaders:
 
 		assert.Equal(t, "8080", cfg.Port)
 		assert.Equal(t, "http://localhost:8888", cfg.ProxyURL)
+		assert.Equal(t, &DatabaseConfig{Type: DatabasePostgres, DSN: "dsn"}, cfg.Database)
 		assert.NotNil(t, cfg.Telegram)
 		assert.Equal(t, "telegram_token", cfg.Telegram.Token)
 		assert.Equal(t, "telegram_chat_id", cfg.Telegram.ChatID)
@@ -128,6 +137,19 @@ downloaders:
 	})
 }
 
+func TestReadConfigSqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+database:
+  type: sqlite
+  path: /data/autoget.db
+`), 0644))
+
+	cfg, err := ReadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, &DatabaseConfig{Type: DatabaseSqlite, Path: "/data/autoget.db"}, cfg.Database)
+}
+
 func TestConfig_validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -166,7 +188,7 @@ func TestConfig_validate(t *testing.T) {
 			wantErr: "",
 		},
 		{
-			name: "Missing Telegram config",
+			name: "Telegram is optional",
 			config: &Config{
 				PgDSN: "dsn",
 				MTeam: &mteam.Config{
@@ -179,11 +201,139 @@ func TestConfig_validate(t *testing.T) {
 							URL:         "http://localhost:9091",
 							TorrentsDir: "/tmp/torrents",
 							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
 						},
 					},
 				},
 			},
-			wantErr: "telegram config is required",
+			wantErr: "",
+		},
+		{
+			name: "Other notifiers",
+			config: &Config{
+				PgDSN:   "dsn",
+				Discord: &discord.Config{WebhookURL: "http://discord"},
+				Slack:   &slack.Config{WebhookURL: "http://slack"},
+				Webhook: &webhook.Config{URL: "http://webhook"},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Discord missing webhook URL",
+			config: &Config{
+				PgDSN:   "dsn",
+				Discord: &discord.Config{},
+			},
+			wantErr: "discord webhook URL is required",
+		},
+		{
+			name: "Slack missing webhook URL",
+			config: &Config{
+				PgDSN: "dsn",
+				Slack: &slack.Config{},
+			},
+			wantErr: "slack webhook URL is required",
+		},
+		{
+			name: "Webhook missing URL",
+			config: &Config{
+				PgDSN:   "dsn",
+				Webhook: &webhook.Config{},
+			},
+			wantErr: "webhook URL is required",
+		},
+		{
+			name: "Download events",
+			config: &Config{
+				PgDSN: "dsn",
+				DownloadEvents: events.Config{
+					events.Started:   {Disabled: true},
+					events.Completed: {Template: "done: {{.Title}}"},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Download events unknown event",
+			config: &Config{
+				PgDSN:          "dsn",
+				DownloadEvents: events.Config{"finished": {}},
+			},
+			wantErr: "unknown download event: finished",
+		},
+		{
+			name: "Download events invalid template",
+			config: &Config{
+				PgDSN:          "dsn",
+				DownloadEvents: events.Config{events.Moved: {Template: "{{.Title"}},
+			},
+			wantErr: "invalid template of download event moved",
+		},
+		{
+			name: "Sqlite database",
+			config: &Config{
+				Database: &DatabaseConfig{Type: DatabaseSqlite, Path: "/data/autoget.db"},
+			},
+			wantErr: "",
+		},
+		{
+			name:    "Missing database",
+			config:  &Config{},
+			wantErr: "postgres DSN is required",
+		},
+		{
+			name: "Both pg_dsn and database",
+			config: &Config{
+				PgDSN:    "dsn",
+				Database: &DatabaseConfig{Type: DatabasePostgres, DSN: "dsn"},
+			},
+			wantErr: "pg_dsn and database are exclusive",
+		},
+		{
+			name: "Sqlite missing path",
+			config: &Config{
+				Database: &DatabaseConfig{Type: DatabaseSqlite},
+			},
+			wantErr: "sqlite path is required",
+		},
+		{
+			name: "Unknown database type",
+			config: &Config{
+				Database: &DatabaseConfig{Type: "mysql"},
+			},
+			wantErr: "unknown database type: mysql",
+		},
+		{
+			name: "Auth with login",
+			config: &Config{
+				PgDSN: "dsn",
+				Auth:  &AuthConfig{Username: "admin", Password: "secret"},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Auth with admin token",
+			config: &Config{
+				PgDSN: "dsn",
+				Auth:  &AuthConfig{AdminToken: "token"},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Auth missing password",
+			config: &Config{
+				PgDSN: "dsn",
+				Auth:  &AuthConfig{Username: "admin", AdminToken: "token"},
+			},
+			wantErr: "auth username and password are both required for login",
+		},
+		{
+			name: "Auth missing login and admin token",
+			config: &Config{
+				PgDSN: "dsn",
+				Auth:  &AuthConfig{},
+			},
+			wantErr: "auth requires login or admin token",
 		},
 		{
 			name: "Telegram missing token",
@@ -401,7 +551,7 @@ func TestConfig_validate(t *testing.T) {
 					"invalid_downloader": {}, // Missing Transmission config
 				},
 			},
-			wantErr: "invalid downloader config for invalid_downloader: transmission config is required",
+			wantErr: "invalid downloader config for invalid_downloader: transmission, qbittorrent or embedded config is required",
 		},
 		{
 			name: "Invalid downloader config (invalid transmission URL)",
@@ -423,6 +573,435 @@ func TestConfig_validate(t *testing.T) {
 			},
 			wantErr: "invalid downloader config for invalid_downloader: transmission RPC URL is required",
 		},
+		{
+			name: "Downloader transfer mode",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"transmission": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						TransferMode: db.TransferHardlink,
+					},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Invalid downloader config (unknown transfer mode)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						TransferMode: "rsync",
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: unknown transfer mode: rsync",
+		},
+		{
+			name: "Downloader disk space policy",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"transmission": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						DiskSpace: &dlconfig.DiskSpacePolicy{
+							DownloadDirMinFreeInGB: 10,
+							Queue:                  true,
+							Evict:                  dlconfig.EvictStopped,
+						},
+					},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Invalid downloader config (disk space policy without threshold)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						DiskSpace: &dlconfig.DiskSpacePolicy{Queue: true},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: min free space of download dir or finished dir is required",
+		},
+		{
+			name: "Invalid downloader config (unknown evict policy)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						DiskSpace: &dlconfig.DiskSpacePolicy{FinishedDirMinFreeInGB: 10, Evict: "all"},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: unknown evict policy: all",
+		},
+		{
+			name: "Downloader progress check policy",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"transmission": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						ProgressCheck: &dlconfig.ProgressCheckPolicy{IntervalInMinutes: 10, Busy: dlconfig.BusySpeed, BusySpeedInMB: 5},
+					},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Invalid downloader config (unknown busy policy)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						ProgressCheck: &dlconfig.ProgressCheckPolicy{Busy: "always"},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: unknown busy policy: always",
+		},
+		{
+			name: "Invalid downloader config (negative busy speed)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						ProgressCheck: &dlconfig.ProgressCheckPolicy{BusySpeedInMB: -1},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: busy speed should not be negative",
+		},
+		{
+			name: "Downloader seeding policy rules",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						SeedingPolicy: &dlconfig.SeedingPolicy{
+							IntervalInDays:    3,
+							UploadAtLeastInMB: 1,
+							UploadRules:       []dlconfig.UploadRule{{IntervalInDays: 14, UploadAtLeastInMB: 100}},
+							Indexers: map[string]*dlconfig.SeedingPolicy{
+								"mteam": {MinRatio: 1, MinSeedTimeInHours: 72, MaxSeedTimeInHours: 720},
+							},
+						},
+					},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Invalid downloader config (seeding policy without stop rule)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						SeedingPolicy: &dlconfig.SeedingPolicy{MinRatio: 1},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: upload rule or max seed time is required",
+		},
+		{
+			name: "Invalid downloader config (max seed time less than min)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						SeedingPolicy: &dlconfig.SeedingPolicy{MinSeedTimeInHours: 72, MaxSeedTimeInHours: 24},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: max seed time should not be less than min seed time",
+		},
+		{
+			name: "Invalid downloader config (invalid upload rule)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						SeedingPolicy: &dlconfig.SeedingPolicy{MaxSeedTimeInHours: 24, UploadRules: []dlconfig.UploadRule{{IntervalInDays: 3}}},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: upload at least in MB is required",
+		},
+		{
+			name: "Invalid downloader config (invalid indexer seeding policy)",
+			config: &Config{
+				PgDSN: "dsn",
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						SeedingPolicy: &dlconfig.SeedingPolicy{
+							MaxSeedTimeInHours: 24,
+							Indexers:           map[string]*dlconfig.SeedingPolicy{"mteam": {MinRatio: -1}},
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: seeding policy of indexer mteam: min ratio should not be negative",
+		},
+		{
+			name: "Valid qbittorrent downloader config",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"qbittorrent": {
+						QBittorrent: &dlconfig.QBittorrentConfig{
+							URL:         "http://localhost:8080",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Invalid downloader config (invalid qbittorrent URL)",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						QBittorrent: &dlconfig.QBittorrentConfig{
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: qbittorrent WebUI URL is required",
+		},
+		{
+			name: "Invalid downloader config (both transmission and qbittorrent)",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						QBittorrent: &dlconfig.QBittorrentConfig{
+							URL:         "http://localhost:8080",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: only one of transmission, qbittorrent or embedded config is allowed",
+		},
+		{
+			name: "Valid embedded downloader config",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"embedded": {
+						Embedded: &dlconfig.EmbeddedConfig{
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Invalid downloader config (invalid embedded listen port)",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Embedded: &dlconfig.EmbeddedConfig{
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+							ListenPort:  70000,
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: invalid listen port: 70000",
+		},
+		{
+			name: "Valid torznab indexer",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				TorznabIndexers: []*torznab.Config{
+					{Name: "jackett", BaseURL: "http://jackett", APIKey: "key", Downloader: "test_downloader"},
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"test_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "",
+		},
+		{
+			name: "Torznab indexer duplicate name",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				TorznabIndexers: []*torznab.Config{
+					{Name: "nyaa", BaseURL: "http://jackett", APIKey: "key", Downloader: "test_downloader"},
+				},
+			},
+			wantErr: "duplicate indexer name: nyaa",
+		},
+		{
+			name: "Torznab indexer unknown downloader",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				TorznabIndexers: []*torznab.Config{
+					{Name: "jackett", BaseURL: "http://jackett", APIKey: "key", Downloader: "unknown"},
+				},
+			},
+			wantErr: "unknown torznab indexer jackett downloader: unknown",
+		},
+		{
+			name: "Negative RSS history days",
+			config: &Config{
+				PgDSN:          "dsn",
+				RSSHistoryDays: -1,
+			},
+			wantErr: "invalid rss history days: -1",
+		},
+		{
+			name: "Torznab missing API key",
+			config: &Config{
+				PgDSN: "dsn",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Torznab: &TorznabConfig{},
+			},
+			wantErr: "torznab API key is required",
+		},
 	}
 
 	for _, tt := range tests {
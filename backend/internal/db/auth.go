@@ -0,0 +1,75 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIToken is a static token for API clients, only its hash is stored.
+type APIToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	Name string
+	// Hash is the hex sha256 of the token.
+	Hash   string   `gorm:"uniqueIndex"`
+	Scopes []string `gorm:"serializer:json"`
+}
+
+// Session is a login session of the frontend, only its hash is stored.
+type Session struct {
+	// ID is the hex sha256 of the session cookie.
+	ID        string `gorm:"primarykey"`
+	CreatedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+
+	Username string
+}
+
+func AddAPIToken(db *gorm.DB, token *APIToken) error {
+	return db.Create(token).Error
+}
+
+func GetAllAPITokens(db *gorm.DB) ([]*APIToken, error) {
+	var tokens []*APIToken
+	err := db.Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+func GetAPITokenByHash(db *gorm.DB, hash string) (*APIToken, error) {
+	token := &APIToken{}
+	err := db.Where("hash = ?", hash).First(token).Error
+	return token, err
+}
+
+// DeleteAPIToken returns gorm.ErrRecordNotFound if the token does not exist.
+func DeleteAPIToken(db *gorm.DB, id uint) error {
+	res := db.Delete(&APIToken{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddSession also deletes expired sessions.
+func AddSession(db *gorm.DB, session *Session) error {
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&Session{}).Error; err != nil {
+		return err
+	}
+	return db.Create(session).Error
+}
+
+// GetSession returns gorm.ErrRecordNotFound if the session does not exist or is expired.
+func GetSession(db *gorm.DB, id string) (*Session, error) {
+	session := &Session{}
+	err := db.Where("id = ? AND expires_at > ?", id, time.Now()).First(session).Error
+	return session, err
+}
+
+func DeleteSession(db *gorm.DB, id string) error {
+	return db.Delete(&Session{}, "id = ?", id).Error
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestAPIToken(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	token := &APIToken{Name: "sonarr", Hash: "hash1", Scopes: []string{"read", "download"}}
+	require.NoError(t, AddAPIToken(db, token))
+	require.NoError(t, AddAPIToken(db, &APIToken{Name: "ci", Hash: "hash2"}))
+
+	// hashes are unique.
+	assert.Error(t, AddAPIToken(db, &APIToken{Name: "dup", Hash: "hash1"}))
+
+	got, err := GetAPITokenByHash(db, "hash1")
+	require.NoError(t, err)
+	assert.Equal(t, "sonarr", got.Name)
+	assert.Equal(t, []string{"read", "download"}, got.Scopes)
+
+	all, err := GetAllAPITokens(db)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	require.NoError(t, DeleteAPIToken(db, token.ID))
+	_, err = GetAPITokenByHash(db, "hash1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, DeleteAPIToken(db, token.ID), gorm.ErrRecordNotFound)
+}
+
+func TestSession(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Create(&Session{ID: "expired", Username: "admin", ExpiresAt: time.Now().Add(-time.Hour)}).Error)
+	require.NoError(t, AddSession(db, &Session{ID: "s1", Username: "admin", ExpiresAt: time.Now().Add(time.Hour)}))
+
+	got, err := GetSession(db, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", got.Username)
+
+	// expired sessions are deleted on login.
+	var count int64
+	require.NoError(t, db.Model(&Session{}).Where("id = ?", "expired").Count(&count).Error)
+	assert.Zero(t, count)
+
+	require.NoError(t, DeleteSession(db, "s1"))
+	_, err = GetSession(db, "s1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -1,6 +1,14 @@
 package db
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
 	"time"
 
 	"github.com/glebarez/sqlite"
@@ -28,31 +36,103 @@ var (
 	}
 )
 
+// Pg opens the postgres database, see Migrate to apply migrations.
 func Pg(dsn string) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(dsn), gormConfig)
+	return gorm.Open(postgres.Open(dsn), gormConfig)
+}
+
+// sqlitePragmas for concurrent access of the cronjobs and handlers: WAL lets
+// readers run along a writer, writers wait for the lock up to the busy timeout
+// and take it at the start of the transaction to not fail on upgrading a read
+// lock.
+const sqlitePragmas = "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+
+// Sqlite opens the sqlite file at path, it is created if not exists. See
+// Migrate to apply migrations.
+func Sqlite(path string) (*gorm.DB, error) {
+	// the URI escapes ? and # of the path, windows paths are file:///C:/...
+	p := filepath.ToSlash(path)
+	if filepath.VolumeName(path) != "" {
+		p = "/" + p
+	}
+	u := &url.URL{Scheme: "file", Path: p, RawQuery: sqlitePragmas}
+	return gorm.Open(sqlite.Open(u.String()), gormConfig)
+}
+
+// testPgDSNEnv runs tests on postgres instead of sqlite, each ForTest uses a
+// new schema in the database, dropped when the test finishes.
+const testPgDSNEnv = "AUTOGET_TEST_PG_DSN"
+
+// ForTest returns an empty database for tests, in memory sqlite or
+// postgres if AUTOGET_TEST_PG_DSN is set.
+func ForTest(t testing.TB) (*gorm.DB, error) {
+	if dsn := os.Getenv(testPgDSNEnv); dsn != "" {
+		return pgForTest(t, dsn)
+	}
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), gormConfig)
 	if err != nil {
 		return nil, err
 	}
-	if err := migrate(db); err != nil {
+	if err := Migrate(db, 0); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
 
-func SqliteForTest() (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(":memory:"), gormConfig)
+func pgForTest(t testing.TB, dsn string) (*gorm.DB, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	schema := "autoget_test_" + hex.EncodeToString(b)
+
+	admin, err := gorm.Open(postgres.Open(dsn), gormConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		closeDB(admin)
+		return nil, err
+	}
+
+	var db *gorm.DB
+	t.Cleanup(func() {
+		if db != nil {
+			closeDB(db)
+		}
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Errorf("failed to drop test schema %s: %v", schema, err)
+		}
+		closeDB(admin)
+	})
+
+	db, err = Pg(withSearchPath(dsn, schema))
 	if err != nil {
 		return nil, err
 	}
-	if err := migrate(db); err != nil {
+	if err := Migrate(db, 0); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
 
-func migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&DownloadStatus{},
-		&RSSSearch{},
-	)
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// withSearchPath adds search_path to the postgres DSN in URL or key/value format.
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", schema)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return fmt.Sprintf("%s search_path=%s", dsn, schema)
 }
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autoget.db")
+	db, err := Sqlite(path)
+	require.NoError(t, err)
+	require.NoError(t, Migrate(db, 0))
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	var journalMode string
+	require.NoError(t, db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "wal", journalMode)
+
+	var busyTimeout int
+	require.NoError(t, db.Raw("PRAGMA busy_timeout").Scan(&busyTimeout).Error)
+	assert.Equal(t, 5000, busyTimeout)
+
+	// concurrent writers wait for the lock.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- SaveDownloadStatus(db, &DownloadStatus{ID: fmt.Sprint(i), Downloader: "a"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	counts, err := CountDownloadStatusByState(db, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), counts[DownloadStarted])
+
+	// migrate again on the existing file.
+	reopened, err := Sqlite(path)
+	require.NoError(t, err)
+	require.NoError(t, Migrate(reopened, 0))
+	t.Cleanup(func() {
+		sqlDB, _ := reopened.DB()
+		sqlDB.Close()
+	})
+	s, err := GetDownloadStatus(reopened, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "a", s.Downloader)
+}
+
+func TestSqliteURIPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auto?get#1.db")
+	db, err := Sqlite(path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	require.NoError(t, Migrate(db, 0))
+
+	assert.FileExists(t, path)
+	var journalMode string
+	require.NoError(t, db.Raw("PRAGMA journal_mode").Scan(&journalMode).Error)
+	assert.Equal(t, "wal", journalMode)
+}
+
+func TestWithSearchPath(t *testing.T) {
+	assert.Equal(t, "postgres://u:p@localhost:5432/autoget?search_path=s&sslmode=disable",
+		withSearchPath("postgres://u:p@localhost:5432/autoget?sslmode=disable", "s"))
+	assert.Equal(t, "host=localhost dbname=autoget search_path=s",
+		withSearchPath("host=localhost dbname=autoget", "s"))
+}
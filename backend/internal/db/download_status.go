@@ -17,8 +17,26 @@ const (
 	DownloadSeeding
 	DownloadStopped
 	DownloadDeleted
+	// DownloadQueued waits for disk space, see QueuedTorrent.
+	DownloadQueued
 )
 
+func (s DownloadState) String() string {
+	switch s {
+	case DownloadStarted:
+		return "started"
+	case DownloadSeeding:
+		return "seeding"
+	case DownloadStopped:
+		return "stopped"
+	case DownloadDeleted:
+		return "deleted"
+	case DownloadQueued:
+		return "queued"
+	}
+	return "unknown"
+}
+
 type MoveState uint
 
 const (
@@ -27,6 +45,48 @@ const (
 	Organized
 )
 
+// TransferMode of finished files from the download dir to the finished dir.
+type TransferMode string
+
+const (
+	TransferCopy     TransferMode = "copy"
+	TransferHardlink TransferMode = "hardlink"
+	// TransferReflink falls back to copy if the filesystem does not support it.
+	TransferReflink TransferMode = "reflink"
+	TransferSymlink TransferMode = "symlink"
+	// TransferMove moves files after seeding stops.
+	TransferMove TransferMode = "move"
+)
+
+// KeepsSource returns true if the finished files need the files in the
+// download dir, or they are moved away, so the data should not be deleted
+// with the torrent.
+func (m TransferMode) KeepsSource() bool {
+	return m == TransferSymlink || m == TransferMove
+}
+
+// StopReason is the seeding policy rule which stopped the torrent, or
+// StopUser.
+type StopReason string
+
+const (
+	StopMaxSeedTime StopReason = "max_seed_time"
+	StopUploadRule  StopReason = "upload_rule"
+	// StopUser when stopped by the user.
+	StopUser StopReason = "user"
+)
+
+// FileTransfer is the progress of a file transferred to the finished dir.
+type FileTransfer struct {
+	Size        int64 `json:"size"`
+	Transferred int64 `json:"transferred"`
+}
+
+// Done returns true if the whole file is transferred.
+func (t *FileTransfer) Done() bool {
+	return t != nil && t.Transferred == t.Size
+}
+
 type OrganizePlan struct {
 	From string `json:"from"`
 	To   string `json:"to"`
@@ -48,8 +108,14 @@ type DownloadStatus struct {
 	Downloader       string        `gorm:"index:idx_downloader_state"`
 	DownloadProgress int32         // in x/1000
 	State            DownloadState `gorm:"index:idx_downloader_state;index:idx_downloader_state_movestate"`
+	// Paused by user, the state is kept so it continues from where it was on resume.
+	Paused bool
 
 	UploadHistories map[string]int64 `gorm:"serializer:json"`
+	// StopReason is set when stopped by the seeding policy or the user.
+	StopReason StopReason
+	// SeedingSince is when the download completed.
+	SeedingSince *time.Time
 
 	ResIndexer string
 	ResTitle   string
@@ -58,6 +124,10 @@ type DownloadStatus struct {
 	FileList   []string `gorm:"serializer:json"`
 
 	MoveState MoveState `gorm:"index:idx_downloader_state_movestate"`
+	// TransferMode used to move the files, empty for copy before it was recorded.
+	TransferMode TransferMode
+	// FileTransfers by file name, to resume transfers.
+	FileTransfers map[string]*FileTransfer `gorm:"serializer:json"`
 
 	OrganizePlans      []OrganizePlan `gorm:"serializer:json"`
 	OrganizePlanAction OrganizePlanAction
@@ -93,7 +163,7 @@ func GetUnfinishedDownloadStatusByDownloader(db *gorm.DB, downloader string) ([]
 
 func GetFinishedUnmoveedDownloadStatusByDownloader(db *gorm.DB, downloader string) ([]DownloadStatus, error) {
 	var ss []DownloadStatus
-	err := db.Where("downloader = ?", downloader).Where("state >= ?", DownloadSeeding).Where("move_state = ?", UnMoved).Find(&ss).Error
+	err := db.Where("downloader = ?", downloader).Where("state IN ?", []DownloadState{DownloadSeeding, DownloadStopped, DownloadDeleted}).Where("move_state = ?", UnMoved).Find(&ss).Error
 	return ss, err
 }
 
@@ -103,6 +173,15 @@ func GetStoppedMovedDownloadStatusByDownloader(db *gorm.DB, downloader string) (
 	return ss, err
 }
 
+// GetEvictableDownloadStatusByDownloader returns moved statuses in the states,
+// stopped before seeding and the least recently updated first.
+func GetEvictableDownloadStatusByDownloader(db *gorm.DB, downloader string, states []DownloadState) ([]DownloadStatus, error) {
+	var ss []DownloadStatus
+	err := db.Where("downloader = ?", downloader).Where("state IN ?", states).Where("move_state >= ?", Moved).
+		Order("state DESC").Order("updated_at").Find(&ss).Error
+	return ss, err
+}
+
 func GetDownloadStatus(db *gorm.DB, hash string) (*DownloadStatus, error) {
 	s := &DownloadStatus{}
 	err := db.First(s, "id = ?", hash).Error
@@ -120,3 +199,61 @@ func RemoveDownloadStatus(db *gorm.DB, id string) error {
 func UpdateDownloadStateForStatuses(db *gorm.DB, ids []string, state DownloadState) error {
 	return db.Model(&DownloadStatus{}).Where("id IN ?", ids).Update("state", state).Error
 }
+
+func UpdateDownloadStopReason(db *gorm.DB, id string, reason StopReason) error {
+	return db.Model(&DownloadStatus{}).Where("id = ?", id).Update("stop_reason", reason).Error
+}
+
+// CountDownloadStatusByState of the downloader, states without downloads are
+// not included.
+func CountDownloadStatusByState(db *gorm.DB, downloader string) (map[DownloadState]int64, error) {
+	var rows []struct {
+		State DownloadState
+		Count int64
+	}
+	err := db.Model(&DownloadStatus{}).Select("state, count(*) AS count").
+		Where("downloader = ?", downloader).Group("state").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[DownloadState]int64{}
+	for _, r := range rows {
+		counts[r.State] = r.Count
+	}
+	return counts, nil
+}
+
+// DownloadStatusFilter filters ListDownloadStatuses, zero values match all.
+type DownloadStatusFilter struct {
+	Downloader string
+	State      *DownloadState
+	MoveState  *MoveState
+	ResIndexer string
+}
+
+// ListDownloadStatuses returns a page (starting from 1) of statuses, newest first, and the total count.
+func ListDownloadStatuses(db *gorm.DB, filter *DownloadStatusFilter, page, pageSize int) ([]DownloadStatus, int64, error) {
+	q := db.Model(&DownloadStatus{})
+	if filter.Downloader != "" {
+		q = q.Where("downloader = ?", filter.Downloader)
+	}
+	if filter.State != nil {
+		q = q.Where("state = ?", *filter.State)
+	}
+	if filter.MoveState != nil {
+		q = q.Where("move_state = ?", *filter.MoveState)
+	}
+	if filter.ResIndexer != "" {
+		q = q.Where("res_indexer = ?", filter.ResIndexer)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var ss []DownloadStatus
+	err := q.Order("created_at DESC").Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&ss).Error
+	return ss, total, err
+}
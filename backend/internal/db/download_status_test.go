@@ -9,7 +9,7 @@ import (
 )
 
 func TestStoreSeedingStatus(t *testing.T) {
-	db, err := SqliteForTest()
+	db, err := ForTest(t)
 	require.NoError(t, err)
 
 	want := &DownloadStatus{
@@ -105,3 +105,125 @@ func TestSeedingStatus_CleanupHistory(t *testing.T) {
 	assert.Contains(t, s.UploadHistories, recentDate2)
 	assert.Equal(t, int64(400), s.UploadHistories[recentDate2])
 }
+
+func TestListDownloadStatuses(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for i, s := range []*DownloadStatus{
+		{ID: "1", Downloader: "a", State: DownloadStarted, ResIndexer: "nyaa"},
+		{ID: "2", Downloader: "a", State: DownloadSeeding, ResIndexer: "nyaa", MoveState: Moved},
+		{ID: "3", Downloader: "b", State: DownloadSeeding, ResIndexer: "m-team"},
+		{ID: "4", Downloader: "a", State: DownloadSeeding, ResIndexer: "nyaa"},
+	} {
+		s.CreatedAt = now.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, db.Create(s).Error)
+	}
+
+	ids := func(ss []DownloadStatus) []string {
+		res := []string{}
+		for _, s := range ss {
+			res = append(res, s.ID)
+		}
+		return res
+	}
+
+	seeding := DownloadSeeding
+	unmoved := UnMoved
+
+	tests := []struct {
+		name      string
+		filter    *DownloadStatusFilter
+		page      int
+		pageSize  int
+		wantIDs   []string
+		wantTotal int64
+	}{
+		{
+			name:      "all",
+			filter:    &DownloadStatusFilter{},
+			page:      1,
+			pageSize:  10,
+			wantIDs:   []string{"4", "3", "2", "1"},
+			wantTotal: 4,
+		},
+		{
+			name:      "second page",
+			filter:    &DownloadStatusFilter{},
+			page:      2,
+			pageSize:  3,
+			wantIDs:   []string{"1"},
+			wantTotal: 4,
+		},
+		{
+			name:      "downloader and state",
+			filter:    &DownloadStatusFilter{Downloader: "a", State: &seeding},
+			page:      1,
+			pageSize:  10,
+			wantIDs:   []string{"4", "2"},
+			wantTotal: 2,
+		},
+		{
+			name:      "indexer and move state",
+			filter:    &DownloadStatusFilter{ResIndexer: "nyaa", MoveState: &unmoved},
+			page:      1,
+			pageSize:  10,
+			wantIDs:   []string{"4", "1"},
+			wantTotal: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := ListDownloadStatuses(db, tt.filter, tt.page, tt.pageSize)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantIDs, ids(got))
+			assert.Equal(t, tt.wantTotal, total)
+		})
+	}
+}
+
+func TestCountDownloadStatusByState(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	require.NoError(t, SaveDownloadStatus(db, &DownloadStatus{ID: "1", Downloader: "a", State: DownloadStarted}))
+	require.NoError(t, SaveDownloadStatus(db, &DownloadStatus{ID: "2", Downloader: "a", State: DownloadSeeding}))
+	require.NoError(t, SaveDownloadStatus(db, &DownloadStatus{ID: "3", Downloader: "a", State: DownloadSeeding}))
+	require.NoError(t, SaveDownloadStatus(db, &DownloadStatus{ID: "4", Downloader: "b", State: DownloadStopped}))
+
+	counts, err := CountDownloadStatusByState(db, "a")
+	require.NoError(t, err)
+	assert.Equal(t, map[DownloadState]int64{DownloadStarted: 1, DownloadSeeding: 2}, counts)
+}
+
+func TestGetEvictableDownloadStatusByDownloader(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, db.Create(&DownloadStatus{ID: "1", Downloader: "a", State: DownloadSeeding, MoveState: Moved, UpdatedAt: now.Add(-time.Hour)}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "2", Downloader: "a", State: DownloadStopped, MoveState: Moved, UpdatedAt: now}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "3", Downloader: "a", State: DownloadStopped, MoveState: Organized, UpdatedAt: now.Add(-time.Hour)}).Error)
+	// not moved, other downloader or deleted.
+	require.NoError(t, db.Create(&DownloadStatus{ID: "4", Downloader: "a", State: DownloadStopped, MoveState: UnMoved}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "5", Downloader: "b", State: DownloadStopped, MoveState: Moved}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "6", Downloader: "a", State: DownloadDeleted, MoveState: Moved}).Error)
+
+	ids := func(ss []DownloadStatus) []string {
+		got := []string{}
+		for _, s := range ss {
+			got = append(got, s.ID)
+		}
+		return got
+	}
+
+	ss, err := GetEvictableDownloadStatusByDownloader(db, "a", []DownloadState{DownloadStopped})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "2"}, ids(ss))
+
+	ss, err = GetEvictableDownloadStatusByDownloader(db, "a", []DownloadState{DownloadSeeding, DownloadStopped})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "2", "1"}, ids(ss))
+}
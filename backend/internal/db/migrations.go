@@ -0,0 +1,329 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration changes the schema or data, it is applied once in a transaction.
+type Migration struct {
+	// Version orders migrations, never change or reuse a released version.
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// schemaMigration records an applied migration.
+type schemaMigration struct {
+	Version   uint `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrations in version order. Models change along migrations, so migrations
+// must not use the models, use frozen copies or SQL instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		// The AutoMigrate of the models when migrations were introduced, it
+		// already has the search constraints, subscriptions, API tokens and
+		// sessions. Databases created by an earlier AutoMigrate get those
+		// columns and tables added, existing ones are kept as they are.
+		Up: func(tx *gorm.DB) error {
+			type DownloadStatus struct {
+				ID        string `gorm:"primarykey"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+
+				Downloader       string `gorm:"index:idx_downloader_state"`
+				DownloadProgress int32
+				State            uint `gorm:"index:idx_downloader_state;index:idx_downloader_state_movestate"`
+				Paused           bool
+
+				UploadHistories map[string]int64 `gorm:"serializer:json"`
+
+				ResIndexer string
+				ResTitle   string
+				ResTitle2  string
+				Category   string
+				FileList   []string `gorm:"serializer:json"`
+
+				MoveState uint `gorm:"index:idx_downloader_state_movestate"`
+
+				OrganizePlans      []OrganizePlan `gorm:"serializer:json"`
+				OrganizePlanAction uint
+			}
+
+			type RSSSearch struct {
+				gorm.Model
+				Indexer string
+				Text    string
+				Action  string
+
+				IncludeRegexes []string `gorm:"serializer:json"`
+				ExcludeTerms   []string `gorm:"serializer:json"`
+				CategoryFilter string
+				MinSize        uint64
+				MaxSize        uint64
+				Resolutions    []string `gorm:"serializer:json"`
+
+				ResID     string
+				Title     string
+				Catergory string
+				URL       string
+			}
+
+			type SubscriptionEpisode struct {
+				ID        uint `gorm:"primarykey"`
+				CreatedAt time.Time
+
+				SubscriptionID uint `gorm:"uniqueIndex:idx_subscription_episode"`
+				Episode        int  `gorm:"uniqueIndex:idx_subscription_episode"`
+
+				ResID       string
+				Title       string
+				TorrentHash string
+			}
+
+			type Subscription struct {
+				gorm.Model
+				Indexer      string `gorm:"index"`
+				Show         string
+				ReleaseGroup string
+				Resolutions  []string `gorm:"serializer:json"`
+
+				Episodes []SubscriptionEpisode
+			}
+
+			type APIToken struct {
+				ID        uint `gorm:"primarykey"`
+				CreatedAt time.Time
+
+				Name   string
+				Hash   string   `gorm:"uniqueIndex"`
+				Scopes []string `gorm:"serializer:json"`
+			}
+
+			type Session struct {
+				ID        string `gorm:"primarykey"`
+				CreatedAt time.Time
+				ExpiresAt time.Time `gorm:"index"`
+
+				Username string
+			}
+
+			if err := tx.Table("rss_search").AutoMigrate(&RSSSearch{}); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(
+				&DownloadStatus{},
+				&Subscription{},
+				&SubscriptionEpisode{},
+				&APIToken{},
+				&Session{},
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "rename rss_search catergory to category",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE rss_search RENAME COLUMN catergory TO category").Error
+		},
+	},
+	{
+		Version: 3,
+		Name:    "index rss_search indexer",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_rss_search_indexer ON rss_search (indexer)").Error
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add download_statuses transfer_mode",
+		Up: func(tx *gorm.DB) error {
+			type DownloadStatus struct {
+				TransferMode string
+			}
+			return tx.Migrator().AddColumn(&DownloadStatus{}, "TransferMode")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add queued_torrents",
+		Up: func(tx *gorm.DB) error {
+			type QueuedTorrent struct {
+				ID        uint `gorm:"primarykey"`
+				CreatedAt time.Time
+
+				Downloader  string `gorm:"index"`
+				MetaInfo    []byte
+				DownloadDir string
+				Labels      []string `gorm:"serializer:json"`
+				Title       string
+			}
+			return tx.AutoMigrate(&QueuedTorrent{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add download_statuses stop_reason",
+		Up: func(tx *gorm.DB) error {
+			type DownloadStatus struct {
+				StopReason string
+			}
+			return tx.Migrator().AddColumn(&DownloadStatus{}, "StopReason")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add download_statuses file_transfers",
+		Up: func(tx *gorm.DB) error {
+			type DownloadStatus struct {
+				FileTransfers map[string]any `gorm:"serializer:json"`
+			}
+			return tx.Migrator().AddColumn(&DownloadStatus{}, "FileTransfers")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add rss_items",
+		Up: func(tx *gorm.DB) error {
+			type RSSItem struct {
+				ID        uint `gorm:"primarykey"`
+				CreatedAt time.Time
+				UpdatedAt time.Time `gorm:"index"`
+
+				Indexer  string `gorm:"uniqueIndex:idx_rss_item_indexer_res_id"`
+				ResID    string `gorm:"uniqueIndex:idx_rss_item_indexer_res_id"`
+				Title    string
+				Category string
+				URL      string
+				Size     uint64
+				Seeders  uint32
+			}
+			return tx.AutoMigrate(&RSSItem{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add queued_torrents attempts",
+		Up: func(tx *gorm.DB) error {
+			type QueuedTorrent struct {
+				Attempts int
+			}
+			return tx.Migrator().AddColumn(&QueuedTorrent{}, "Attempts")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add rss_items download_link",
+		Up: func(tx *gorm.DB) error {
+			type RSSItem struct {
+				DownloadLink string
+			}
+			return tx.Migrator().AddColumn(&RSSItem{}, "DownloadLink")
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add download_statuses seeding_since",
+		Up: func(tx *gorm.DB) error {
+			type DownloadStatus struct {
+				SeedingSince *time.Time
+			}
+			return tx.Migrator().AddColumn(&DownloadStatus{}, "SeedingSince")
+		},
+	},
+}
+
+// LatestVersion of the schema.
+func LatestVersion() uint {
+	return migrations[len(migrations)-1].Version
+}
+
+func appliedMigrations(db *gorm.DB) (map[uint]*schemaMigration, error) {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var records []*schemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := map[uint]*schemaMigration{}
+	for _, r := range records {
+		if r.Version > LatestVersion() {
+			return nil, fmt.Errorf("database schema version %d is newer than supported version %d", r.Version, LatestVersion())
+		}
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Migrate applies pending migrations up to the version in order, 0 for all.
+func Migrate(db *gorm.DB, to uint) error {
+	if to > LatestVersion() {
+		return fmt.Errorf("unknown migration version %d, latest is %d", to, LatestVersion())
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if to != 0 && m.Version > to {
+			break
+		}
+		if applied[m.Version] != nil {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s failed: %w", m.Version, m.Name, err)
+		}
+		logger.Info().Uint("version", m.Version).Str("name", m.Name).Msg("applied migration")
+	}
+
+	return nil
+}
+
+type MigrationStatus struct {
+	Version uint
+	Name    string
+	// AppliedAt is nil if pending.
+	AppliedAt *time.Time
+}
+
+// MigrationStatuses of all migrations in version order.
+func MigrationStatuses(db *gorm.DB) ([]*MigrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*MigrationStatus{}
+	for _, m := range migrations {
+		s := &MigrationStatus{Version: m.Version, Name: m.Name}
+		if r := applied[m.Version]; r != nil {
+			s.AppliedAt = &r.AppliedAt
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
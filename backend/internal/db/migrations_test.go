@@ -0,0 +1,97 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func emptyDBForTest(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := Sqlite(filepath.Join(t.TempDir(), "autoget.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		db := emptyDBForTest(t)
+
+		require.NoError(t, Migrate(db, 0))
+
+		statuses, err := MigrationStatuses(db)
+		require.NoError(t, err)
+		require.Len(t, statuses, int(LatestVersion()))
+		for _, s := range statuses {
+			assert.NotNil(t, s.AppliedAt, "migration %d", s.Version)
+		}
+
+		assert.True(t, db.Migrator().HasColumn(&RSSSearch{}, "category"))
+		assert.False(t, db.Migrator().HasColumn(&RSSSearch{}, "catergory"))
+		assert.True(t, db.Migrator().HasIndex(&RSSSearch{}, "idx_rss_search_indexer"))
+
+		// models match the schema, changes of models need migrations.
+		for _, model := range []any{&DownloadStatus{}, &RSSSearch{}, &Subscription{}, &SubscriptionEpisode{}, &APIToken{}, &Session{}, &QueuedTorrent{}, &RSSItem{}} {
+			stmt := &gorm.Statement{DB: db}
+			require.NoError(t, stmt.Parse(model))
+			for _, f := range stmt.Schema.Fields {
+				if f.DBName != "" {
+					assert.True(t, db.Migrator().HasColumn(model, f.DBName), "%s.%s", stmt.Schema.Table, f.DBName)
+				}
+			}
+			for _, idx := range stmt.Schema.ParseIndexes() {
+				assert.True(t, db.Migrator().HasIndex(model, idx.Name), "%s %s", stmt.Schema.Table, idx.Name)
+			}
+		}
+
+		// migrate again is a no-op.
+		require.NoError(t, Migrate(db, 0))
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		db := emptyDBForTest(t)
+
+		require.NoError(t, Migrate(db, 1))
+
+		statuses, err := MigrationStatuses(db)
+		require.NoError(t, err)
+		assert.NotNil(t, statuses[0].AppliedAt)
+		assert.Nil(t, statuses[1].AppliedAt)
+		assert.True(t, db.Migrator().HasColumn(&RSSSearch{}, "catergory"))
+	})
+
+	t.Run("database before migrations", func(t *testing.T) {
+		db := emptyDBForTest(t)
+
+		// the schema was created by AutoMigrate without schema_migrations.
+		require.NoError(t, migrations[0].Up(db))
+		require.NoError(t, db.Exec("INSERT INTO rss_search (indexer, text, action, catergory) VALUES ('nyaa', 'show', 'download', 'anime')").Error)
+
+		require.NoError(t, Migrate(db, 0))
+
+		search, err := GetSearch(db, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "anime", search.Category)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		db := emptyDBForTest(t)
+
+		assert.EqualError(t, Migrate(db, LatestVersion()+1), "unknown migration version 12, latest is 11")
+
+		require.NoError(t, Migrate(db, 0))
+		require.NoError(t, db.Create(&schemaMigration{Version: LatestVersion() + 1, Name: "future"}).Error)
+		assert.EqualError(t, Migrate(db, 0), "database schema version 12 is newer than supported version 11")
+
+		_, err := MigrationStatuses(db)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// QueuedTorrent waits for disk space to be added to the downloader.
+type QueuedTorrent struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	Downloader  string `gorm:"index"`
+	MetaInfo    []byte
+	DownloadDir string
+	Labels      []string `gorm:"serializer:json"`
+	Title       string
+	// Attempts failed to start the torrent.
+	Attempts int
+}
+
+func AddQueuedTorrent(db *gorm.DB, t *QueuedTorrent) error {
+	return db.Create(t).Error
+}
+
+// GetQueuedTorrentsByDownloader returns the queued torrents, the oldest first.
+func GetQueuedTorrentsByDownloader(db *gorm.DB, downloader string) ([]*QueuedTorrent, error) {
+	var ts []*QueuedTorrent
+	err := db.Where("downloader = ?", downloader).Order("id").Find(&ts).Error
+	return ts, err
+}
+
+func DeleteQueuedTorrent(db *gorm.DB, id uint) error {
+	return db.Delete(&QueuedTorrent{}, id).Error
+}
+
+// IncQueuedTorrentAttempts records a failed attempt to start the torrent.
+func IncQueuedTorrentAttempts(db *gorm.DB, t *QueuedTorrent) error {
+	t.Attempts++
+	return db.Model(t).Update("attempts", t.Attempts).Error
+}
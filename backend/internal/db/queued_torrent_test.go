@@ -0,0 +1,38 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueuedTorrent(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	first := &QueuedTorrent{Downloader: "a", MetaInfo: []byte("d1"), Labels: []string{"nyaa"}, Title: "Title 1"}
+	require.NoError(t, AddQueuedTorrent(db, first))
+	require.NoError(t, AddQueuedTorrent(db, &QueuedTorrent{Downloader: "a", MetaInfo: []byte("d2"), Title: "Title 2"}))
+	require.NoError(t, AddQueuedTorrent(db, &QueuedTorrent{Downloader: "b", MetaInfo: []byte("d3"), Title: "Title 3"}))
+
+	ts, err := GetQueuedTorrentsByDownloader(db, "a")
+	require.NoError(t, err)
+	require.Len(t, ts, 2)
+	assert.Equal(t, "Title 1", ts[0].Title)
+	assert.Equal(t, []byte("d1"), ts[0].MetaInfo)
+	assert.Equal(t, []string{"nyaa"}, ts[0].Labels)
+	assert.Equal(t, "Title 2", ts[1].Title)
+
+	require.NoError(t, IncQueuedTorrentAttempts(db, ts[1]))
+	require.NoError(t, IncQueuedTorrentAttempts(db, ts[1]))
+	assert.Equal(t, 2, ts[1].Attempts)
+
+	require.NoError(t, DeleteQueuedTorrent(db, first.ID))
+
+	ts, err = GetQueuedTorrentsByDownloader(db, "a")
+	require.NoError(t, err)
+	require.Len(t, ts, 1)
+	assert.Equal(t, "Title 2", ts[0].Title)
+	assert.Equal(t, 2, ts[0].Attempts)
+}
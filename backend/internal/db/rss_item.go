@@ -0,0 +1,109 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RSSItem is an item seen in the RSS feed of an indexer.
+type RSSItem struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time // first seen
+	UpdatedAt time.Time `gorm:"index"` // last seen
+
+	Indexer  string `gorm:"uniqueIndex:idx_rss_item_indexer_res_id"`
+	ResID    string `gorm:"uniqueIndex:idx_rss_item_indexer_res_id"`
+	Title    string
+	Category string
+	URL      string
+	Size     uint64 // in bytes
+	Seeders  uint32
+	// DownloadLink of indexers which can not download by ResID.
+	DownloadLink string
+}
+
+// SaveRSSItems adds new items of the indexer and updates seen items, items
+// are deduplicated by ResID.
+func SaveRSSItems(db *gorm.DB, indexer string, items []*RSSItem) error {
+	seen := map[string]bool{}
+	toSave := []*RSSItem{}
+	for _, item := range items {
+		if item.ResID == "" || seen[item.ResID] {
+			continue
+		}
+		seen[item.ResID] = true
+		item.Indexer = indexer
+		toSave = append(toSave, item)
+	}
+	if len(toSave) == 0 {
+		return nil
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "indexer"}, {Name: "res_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "title", "category", "url", "size", "seeders", "download_link"}),
+	}).Create(&toSave).Error
+}
+
+// GetRSSItemsSince returns items of the indexer seen since the time, the
+// newest first.
+func GetRSSItemsSince(db *gorm.DB, indexer string, since time.Time) ([]*RSSItem, error) {
+	var items []*RSSItem
+	err := db.Where("indexer = ?", indexer).Where("updated_at >= ?", since).
+		Order("created_at DESC").Order("id DESC").Find(&items).Error
+	return items, err
+}
+
+// GetRSSItem of the indexer by ResID.
+func GetRSSItem(db *gorm.DB, indexer, resID string) (*RSSItem, error) {
+	item := &RSSItem{}
+	err := db.Where("indexer = ? AND res_id = ?", indexer, resID).First(item).Error
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// DeleteRSSItemsBefore deletes items not seen since the time, it returns the
+// number of deleted items.
+func DeleteRSSItemsBefore(db *gorm.DB, before time.Time) (int64, error) {
+	res := db.Where("updated_at < ?", before).Delete(&RSSItem{})
+	return res.RowsAffected, res.Error
+}
+
+// RSSItemFilter filters ListRSSItems, zero values match all.
+type RSSItemFilter struct {
+	Indexer  string
+	Category string
+	// Keyword in the title, case insensitive.
+	Keyword string
+}
+
+// likeEscaper escapes the wildcards of LIKE, so they match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListRSSItems returns a page (starting from 1) of items, newest first, and the total count.
+func ListRSSItems(db *gorm.DB, filter *RSSItemFilter, page, pageSize int) ([]RSSItem, int64, error) {
+	q := db.Model(&RSSItem{})
+	if filter.Indexer != "" {
+		q = q.Where("indexer = ?", filter.Indexer)
+	}
+	if filter.Category != "" {
+		q = q.Where("category = ?", filter.Category)
+	}
+	if filter.Keyword != "" {
+		q = q.Where(`LOWER(title) LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(strings.ToLower(filter.Keyword))+"%")
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []RSSItem
+	err := q.Order("created_at DESC").Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error
+	return items, total, err
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSaveRSSItems(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	require.NoError(t, SaveRSSItems(db, "nyaa", []*RSSItem{
+		{ResID: "1", Title: "Show - 01", Seeders: 1},
+		{ResID: "2", Title: "Show - 02"},
+		{ResID: "2", Title: "Show - 02 duplicated"},
+		{ResID: "", Title: "no id"},
+	}))
+	require.NoError(t, SaveRSSItems(db, "m-team", []*RSSItem{{ResID: "1", Title: "Movie"}}))
+
+	// seen again.
+	require.NoError(t, SaveRSSItems(db, "nyaa", []*RSSItem{{ResID: "1", Title: "Show - 01", Seeders: 10}}))
+	require.NoError(t, SaveRSSItems(db, "nyaa", nil))
+
+	items, err := GetRSSItemsSince(db, "nyaa", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "Show - 02", items[0].Title)
+	assert.Equal(t, "Show - 01", items[1].Title)
+	assert.Equal(t, uint32(10), items[1].Seeders)
+
+	var count int64
+	require.NoError(t, db.Model(&RSSItem{}).Count(&count).Error)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestGetRSSItem(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	require.NoError(t, SaveRSSItems(db, "tracker", []*RSSItem{{ResID: "1", Title: "Movie", DownloadLink: "http://tracker/dl/1"}}))
+	require.NoError(t, SaveRSSItems(db, "tracker", []*RSSItem{{ResID: "1", Title: "Movie", DownloadLink: "http://tracker/dl/1?new"}}))
+
+	t.Run("success", func(t *testing.T) {
+		item, err := GetRSSItem(db, "tracker", "1")
+		require.NoError(t, err)
+		assert.Equal(t, "Movie", item.Title)
+		assert.Equal(t, "http://tracker/dl/1?new", item.DownloadLink)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := GetRSSItem(db, "nyaa", "1")
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestDeleteRSSItemsBefore(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, db.Create(&RSSItem{Indexer: "nyaa", ResID: "1", UpdatedAt: now.AddDate(0, 0, -40)}).Error)
+	require.NoError(t, db.Create(&RSSItem{Indexer: "nyaa", ResID: "2", UpdatedAt: now}).Error)
+
+	n, err := DeleteRSSItemsBefore(db, now.AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	items, err := GetRSSItemsSince(db, "nyaa", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "2", items[0].ResID)
+
+	// not seen since.
+	items, err = GetRSSItemsSince(db, "nyaa", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestListRSSItems(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for i, item := range []*RSSItem{
+		{Indexer: "nyaa", ResID: "1", Title: "[Group] Show - 01", Category: "Anime"},
+		{Indexer: "nyaa", ResID: "2", Title: "[Group] Other - 01", Category: "Anime"},
+		{Indexer: "m-team", ResID: "3", Title: "Movie", Category: "Movie"},
+		{Indexer: "nyaa", ResID: "4", Title: "[Group] show - 02", Category: "Music"},
+	} {
+		item.CreatedAt = now.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, db.Create(item).Error)
+	}
+
+	resIDs := func(items []RSSItem) []string {
+		res := []string{}
+		for _, item := range items {
+			res = append(res, item.ResID)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name       string
+		filter     *RSSItemFilter
+		page       int
+		pageSize   int
+		wantResIDs []string
+		wantTotal  int64
+	}{
+		{
+			name:       "all",
+			filter:     &RSSItemFilter{},
+			page:       1,
+			pageSize:   10,
+			wantResIDs: []string{"4", "3", "2", "1"},
+			wantTotal:  4,
+		},
+		{
+			name:       "page",
+			filter:     &RSSItemFilter{},
+			page:       2,
+			pageSize:   3,
+			wantResIDs: []string{"1"},
+			wantTotal:  4,
+		},
+		{
+			name:       "indexer",
+			filter:     &RSSItemFilter{Indexer: "nyaa"},
+			page:       1,
+			pageSize:   10,
+			wantResIDs: []string{"4", "2", "1"},
+			wantTotal:  3,
+		},
+		{
+			name:       "keyword",
+			filter:     &RSSItemFilter{Keyword: "SHOW"},
+			page:       1,
+			pageSize:   10,
+			wantResIDs: []string{"4", "1"},
+			wantTotal:  2,
+		},
+		{
+			name:       "category and keyword",
+			filter:     &RSSItemFilter{Category: "Anime", Keyword: "show"},
+			page:       1,
+			pageSize:   10,
+			wantResIDs: []string{"1"},
+			wantTotal:  1,
+		},
+		{
+			name:       "keyword wildcards match literally",
+			filter:     &RSSItemFilter{Keyword: "%"},
+			page:       1,
+			pageSize:   10,
+			wantResIDs: []string{},
+			wantTotal:  0,
+		},
+		{
+			name:       "keyword underscore matches literally",
+			filter:     &RSSItemFilter{Keyword: "show_-"},
+			page:       1,
+			pageSize:   10,
+			wantResIDs: []string{},
+			wantTotal:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, total, err := ListRSSItems(db, tt.filter, tt.page, tt.pageSize)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantResIDs, resIDs(items))
+			assert.Equal(t, tt.wantTotal, total)
+		})
+	}
+}
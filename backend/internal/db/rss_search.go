@@ -8,21 +8,52 @@ import (
 
 type RSSSearch struct {
 	gorm.Model
-	Indexer string `gorm:"indexer,index"`
-	Text    string `gorm:"text"`
-	Action  string `gorm:"action"`
+	Indexer string `gorm:"index"`
+	Text    string
+	Action  string
+
+	// constraints, zero values for no constraint
+	IncludeRegexes []string `gorm:"serializer:json"` // all must match the title
+	ExcludeTerms   []string `gorm:"serializer:json"` // none can be in the title
+	CategoryFilter string   // the category or its parent category
+	MinSize        uint64   // in bytes
+	MaxSize        uint64   // in bytes
+	Resolutions    []string `gorm:"serializer:json"` // See indexers.Resolution* for options
 
 	// founded
-	ResID     string `gorm:"res_id"`
-	Title     string `gorm:"title"`
-	Catergory string `gorm:"category"`
-	URL       string `gorm:"url"`
+	ResID    string
+	Title    string
+	Category string
+	URL      string
 }
 
 func (s *RSSSearch) TableName() string {
 	return "rss_search"
 }
 
+// Rearm clears the founded resource, so the search matches again.
+func (s *RSSSearch) Rearm() {
+	s.ResID = ""
+	s.Title = ""
+	s.Category = ""
+	s.URL = ""
+}
+
+func GetAllSearchs(db *gorm.DB) ([]*RSSSearch, error) {
+	var searchs []*RSSSearch
+	err := db.Order("indexer").Order("id").Find(&searchs).Error
+	if err != nil {
+		return nil, err
+	}
+	return searchs, nil
+}
+
+func GetSearch(db *gorm.DB, id uint) (*RSSSearch, error) {
+	search := &RSSSearch{}
+	err := db.First(search, id).Error
+	return search, err
+}
+
 func GetSearchsByIndexer(db *gorm.DB, indexer string) ([]*RSSSearch, error) {
 	var searchs []*RSSSearch
 	err := db.Where("indexer = ?", indexer).Find(&searchs).Error
@@ -32,12 +63,21 @@ func GetSearchsByIndexer(db *gorm.DB, indexer string) ([]*RSSSearch, error) {
 	return searchs, nil
 }
 
+// Normalize the search for Match, it is done on save.
+func (s *RSSSearch) Normalize() {
+	s.Text = strings.ToLower(s.Text)
+	for i, term := range s.ExcludeTerms {
+		s.ExcludeTerms[i] = strings.ToLower(term)
+	}
+}
+
 func AddSearch(db *gorm.DB, search *RSSSearch) error {
-	search.Text = strings.ToLower(search.Text)
+	search.Normalize()
 	return db.Create(search).Error
 }
 
 func UpdateSearch(db *gorm.DB, search *RSSSearch) error {
+	search.Normalize()
 	return db.Save(search).Error
 }
 
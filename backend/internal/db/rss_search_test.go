@@ -9,7 +9,7 @@ import (
 )
 
 func TestAddSearch(t *testing.T) {
-	db, err := SqliteForTest()
+	db, err := ForTest(t)
 	require.NoError(t, err)
 
 	search := &RSSSearch{
@@ -32,7 +32,7 @@ func TestAddSearch(t *testing.T) {
 }
 
 func TestGetSearchsByIndexer(t *testing.T) {
-	db, err := SqliteForTest()
+	db, err := ForTest(t)
 	require.NoError(t, err)
 
 	// Add some test data
@@ -54,7 +54,7 @@ func TestGetSearchsByIndexer(t *testing.T) {
 }
 
 func TestDeleteSearch(t *testing.T) {
-	db, err := SqliteForTest()
+	db, err := ForTest(t)
 	require.NoError(t, err)
 
 	// Add a search to delete
@@ -79,3 +79,59 @@ func TestDeleteSearch(t *testing.T) {
 	err = DeleteSearch(db, 999) // Assuming 999 is a non-existent ID
 	assert.NoError(t, err)
 }
+
+func TestGetAllSearchs(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	db.Create(&RSSSearch{Indexer: "indexer2", Text: "text1"})
+	db.Create(&RSSSearch{Indexer: "indexer1", Text: "text2"})
+	db.Create(&RSSSearch{Indexer: "indexer1", Text: "text3"})
+
+	searchs, err := GetAllSearchs(db)
+	assert.NoError(t, err)
+	require.Len(t, searchs, 3)
+	assert.Equal(t, "text2", searchs[0].Text)
+	assert.Equal(t, "text3", searchs[1].Text)
+	assert.Equal(t, "text1", searchs[2].Text)
+}
+
+func TestGetSearch(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	search := &RSSSearch{Indexer: "indexer1", Text: "text1"}
+	db.Create(search)
+
+	got, err := GetSearch(db, search.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "text1", got.Text)
+
+	_, err = GetSearch(db, 999)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestRearmSearch(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	search := &RSSSearch{
+		Indexer:  "indexer1",
+		Text:     "text1",
+		ResID:    "1",
+		Title:    "Text1",
+		Category: "Anime",
+		URL:      "http://test.com",
+	}
+	db.Create(search)
+
+	search.Rearm()
+	require.NoError(t, UpdateSearch(db, search))
+
+	got, err := GetSearch(db, search.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.ResID)
+	assert.Empty(t, got.Title)
+	assert.Empty(t, got.Category)
+	assert.Empty(t, got.URL)
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Subscription follows an ongoing series, every new episode is downloaded once.
+type Subscription struct {
+	gorm.Model
+	Indexer string `gorm:"index"`
+	// Show name as in the title, matched case-insensitively.
+	Show string
+	// ReleaseGroup pins the group in the title, e.g. SubsPlease, empty for any group.
+	ReleaseGroup string
+	// Resolutions accepted, empty for any. See indexers.Resolution* for options.
+	Resolutions []string `gorm:"serializer:json"`
+
+	Episodes []SubscriptionEpisode
+}
+
+// SubscriptionEpisode records an episode fetched for a subscription.
+type SubscriptionEpisode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	SubscriptionID uint `gorm:"uniqueIndex:idx_subscription_episode"`
+	Episode        int  `gorm:"uniqueIndex:idx_subscription_episode"`
+
+	ResID       string
+	Title       string
+	TorrentHash string
+}
+
+func AddSubscription(db *gorm.DB, sub *Subscription) error {
+	return db.Create(sub).Error
+}
+
+func GetAllSubscriptions(db *gorm.DB) ([]*Subscription, error) {
+	var subs []*Subscription
+	err := db.Preload("Episodes", orderByEpisode).Order("indexer").Order("id").Find(&subs).Error
+	return subs, err
+}
+
+func GetSubscriptionsByIndexer(db *gorm.DB, indexer string) ([]*Subscription, error) {
+	var subs []*Subscription
+	err := db.Preload("Episodes", orderByEpisode).Where("indexer = ?", indexer).Order("id").Find(&subs).Error
+	return subs, err
+}
+
+func GetSubscription(db *gorm.DB, id uint) (*Subscription, error) {
+	sub := &Subscription{}
+	err := db.Preload("Episodes", orderByEpisode).First(sub, id).Error
+	return sub, err
+}
+
+func DeleteSubscription(db *gorm.DB, id uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", id).Delete(&SubscriptionEpisode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Subscription{}, id).Error
+	})
+}
+
+func orderByEpisode(db *gorm.DB) *gorm.DB {
+	return db.Order("episode")
+}
+
+// HasSubscriptionEpisode returns true if the episode is fetched already.
+func HasSubscriptionEpisode(db *gorm.DB, subscriptionID uint, episode int) (bool, error) {
+	var count int64
+	err := db.Model(&SubscriptionEpisode{}).
+		Where("subscription_id = ? AND episode = ?", subscriptionID, episode).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func AddSubscriptionEpisode(db *gorm.DB, ep *SubscriptionEpisode) error {
+	return db.Create(ep).Error
+}
+
+// DeleteSubscriptionEpisodesByTorrent so the episodes are fetched again.
+func DeleteSubscriptionEpisodesByTorrent(db *gorm.DB, hash string) error {
+	return db.Where("torrent_hash = ?", hash).Delete(&SubscriptionEpisode{}).Error
+}
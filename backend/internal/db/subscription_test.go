@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscription(t *testing.T) {
+	db, err := ForTest(t)
+	require.NoError(t, err)
+
+	sub := &Subscription{Indexer: "nyaa", Show: "Show", ReleaseGroup: "Group", Resolutions: []string{"1080p"}}
+	require.NoError(t, AddSubscription(db, sub))
+	require.NoError(t, AddSubscription(db, &Subscription{Indexer: "sukebei", Show: "Other"}))
+
+	require.NoError(t, AddSubscriptionEpisode(db, &SubscriptionEpisode{SubscriptionID: sub.ID, Episode: 2, ResID: "2", TorrentHash: "hash2"}))
+	require.NoError(t, AddSubscriptionEpisode(db, &SubscriptionEpisode{SubscriptionID: sub.ID, Episode: 1, ResID: "1"}))
+
+	// each episode is recorded once.
+	assert.Error(t, AddSubscriptionEpisode(db, &SubscriptionEpisode{SubscriptionID: sub.ID, Episode: 1, ResID: "3"}))
+
+	has, err := HasSubscriptionEpisode(db, sub.ID, 1)
+	require.NoError(t, err)
+	assert.True(t, has)
+	has, err = HasSubscriptionEpisode(db, sub.ID, 3)
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	subs, err := GetSubscriptionsByIndexer(db, "nyaa")
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	assert.Equal(t, []string{"1080p"}, subs[0].Resolutions)
+	require.Len(t, subs[0].Episodes, 2)
+	assert.Equal(t, 1, subs[0].Episodes[0].Episode)
+	assert.Equal(t, 2, subs[0].Episodes[1].Episode)
+
+	all, err := GetAllSubscriptions(db)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	require.NoError(t, DeleteSubscriptionEpisodesByTorrent(db, "hash2"))
+	has, err = HasSubscriptionEpisode(db, sub.ID, 2)
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	require.NoError(t, DeleteSubscription(db, sub.ID))
+	_, err = GetSubscription(db, sub.ID)
+	assert.Error(t, err)
+	has, err = HasSubscriptionEpisode(db, sub.ID, 1)
+	require.NoError(t, err)
+	assert.False(t, has)
+}
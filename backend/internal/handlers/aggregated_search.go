@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/indexers/rsshelper"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchTimeout  = 20 * time.Second
+	defaultSearchPageSize = 50
+	maxSearchPageSize     = 100
+
+	// maxSearchesPerIndexer in flight, List calls timed out keep running.
+	maxSearchesPerIndexer = 2
+)
+
+var resolutionRanks = map[string]int{
+	indexers.Resolution8K:    6,
+	indexers.Resolution4K:    5,
+	indexers.Resolution1080p: 4,
+	indexers.Resolution1080i: 3,
+	indexers.Resolution720p:  2,
+	indexers.ResolutionSD:    1,
+}
+
+type aggregatedSearchReq struct {
+	Keyword  string `form:"keyword" binding:"required"`
+	Indexers string `form:"indexers"` // comma separated, empty for all
+	PageSize uint32 `form:"pageSize"` // per indexer
+}
+
+type resourceRef struct {
+	Indexer string `json:"indexer"`
+	ID      string `json:"id"`
+}
+
+type aggregatedResource struct {
+	indexers.ListResourceItem
+	Indexer string `json:"indexer"`
+	// Duplicates are the same torrent found on other indexers.
+	Duplicates []resourceRef `json:"duplicates,omitempty"`
+}
+
+type aggregatedSearchResp struct {
+	Resources []*aggregatedResource `json:"resources"`
+	Errors    map[string]string     `json:"errors,omitempty"` // by indexer
+}
+
+// aggregatedSearch lists the keyword on indexers concurrently and merges the results.
+func (s *Service) aggregatedSearch(c *gin.Context) {
+	req := &aggregatedSearchReq{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	names := []string{}
+	if req.Indexers == "" {
+		for name := range s.indexers {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+	} else {
+		for _, name := range strings.Split(req.Indexers, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := s.indexers[name]; !ok {
+				c.JSON(404, gin.H{"error": fmt.Sprintf("Indexer not found: %s", name)})
+				return
+			}
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if req.PageSize == 0 {
+		req.PageSize = defaultSearchPageSize
+	}
+	if req.PageSize > maxSearchPageSize {
+		req.PageSize = maxSearchPageSize
+	}
+
+	timeout := s.searchTimeout
+	if timeout == 0 {
+		timeout = defaultSearchTimeout
+	}
+
+	resp := &aggregatedSearchResp{
+		Resources: []*aggregatedResource{},
+		Errors:    map[string]string{},
+	}
+	results := make([][]*aggregatedResource, len(names))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.listWithTimeout(name, req, timeout)
+			if err != nil {
+				mu.Lock()
+				resp.Errors[name] = err.Error()
+				mu.Unlock()
+				return
+			}
+			for _, item := range res.Resources {
+				results[i] = append(results[i], &aggregatedResource{ListResourceItem: item, Indexer: name})
+			}
+		}()
+	}
+	wg.Wait()
+
+	resp.Resources = rankResources(dedupeResources(slices.Concat(results...)))
+	c.JSON(200, resp)
+}
+
+// listWithTimeout gives up waiting for the indexer after timeout, the List call
+// itself can not be cancelled. Calls still running take the slots of the
+// indexer, the indexer is skipped if no slot is free.
+func (s *Service) listWithTimeout(name string, req *aggregatedSearchReq, timeout time.Duration) (*indexers.ListResult, error) {
+	v, _ := s.searchSlots.LoadOrStore(name, make(chan struct{}, maxSearchesPerIndexer))
+	slots := v.(chan struct{})
+	select {
+	case slots <- struct{}{}:
+	default:
+		return nil, fmt.Errorf("too many searches in flight")
+	}
+
+	type result struct {
+		res *indexers.ListResult
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		defer func() { <-slots }()
+		res, herr := s.indexers[name].List(&indexers.ListRequest{
+			Keyword:  req.Keyword,
+			Page:     1,
+			PageSize: req.PageSize,
+		})
+		if herr != nil {
+			ch <- result{err: fmt.Errorf("%s", herr.Message)}
+			return
+		}
+		ch <- result{res: res}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.res, r.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timeout after %s", timeout)
+	}
+}
+
+func resolutionRank(item *indexers.ListResourceItem) int {
+	r := item.Resolution
+	if r == "" {
+		r = rsshelper.ResolutionOf(item.Title)
+	}
+	return resolutionRanks[r]
+}
+
+// compareResources puts alive torrents first, then free, higher resolution and
+// more seeders.
+func compareResources(a, b *aggregatedResource) int {
+	alive := func(r *aggregatedResource) bool { return r.Seeders > 0 }
+	if alive(a) != alive(b) {
+		if alive(a) {
+			return -1
+		}
+		return 1
+	}
+	if a.Free != b.Free {
+		if a.Free {
+			return -1
+		}
+		return 1
+	}
+	if c := cmp.Compare(resolutionRank(&b.ListResourceItem), resolutionRank(&a.ListResourceItem)); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.Seeders, a.Seeders)
+}
+
+// dedupeResources keeps the best ranked resource of each info hash.
+func dedupeResources(resources []*aggregatedResource) []*aggregatedResource {
+	byHash := map[string]*aggregatedResource{}
+	deduped := []*aggregatedResource{}
+	for _, r := range resources {
+		if r.InfoHash == "" {
+			deduped = append(deduped, r)
+			continue
+		}
+
+		hash := strings.ToLower(r.InfoHash)
+		kept, ok := byHash[hash]
+		if !ok {
+			byHash[hash] = r
+			deduped = append(deduped, r)
+			continue
+		}
+
+		if compareResources(r, kept) < 0 {
+			r.Duplicates = append(kept.Duplicates, resourceRef{Indexer: kept.Indexer, ID: kept.ID})
+			*kept = *r
+		} else {
+			kept.Duplicates = append(kept.Duplicates, resourceRef{Indexer: r.Indexer, ID: r.ID})
+		}
+	}
+	return deduped
+}
+
+func rankResources(resources []*aggregatedResource) []*aggregatedResource {
+	slices.SortStableFunc(resources, compareResources)
+	return resources
+}
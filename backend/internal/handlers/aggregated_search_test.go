@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_aggregatedSearch(t *testing.T) {
+	setup := func(t *testing.T) (*Service, *httptest.ResponseRecorder, func(url string)) {
+		serv, router, m, _ := testSetup(t)
+		serv.searchTimeout = 100 * time.Millisecond
+
+		m.mockListResult = &indexers.ListResult{Resources: []indexers.ListResourceItem{
+			{ID: "m1", Title: "Show 720p", Seeders: 100, InfoHash: "aaaa"},
+			{ID: "m2", Title: "Show 1080p", Seeders: 10},
+			{ID: "m3", Title: "Show 2160p", Seeders: 0},
+		}}
+		serv.indexers["free"] = &indexerMock{mockName: "free", mockListResult: &indexers.ListResult{Resources: []indexers.ListResourceItem{
+			{ID: "f1", Title: "Show 720p", Seeders: 5, Free: true, InfoHash: "AAAA"},
+			{ID: "f2", Title: "Show 1080p", Seeders: 50},
+		}}}
+		serv.indexers["broken"] = &indexerMock{mockName: "broken", mockListErr: errors.NewHTTPStatusError(http.StatusBadGateway, "upstream down")}
+		serv.indexers["slow"] = &indexerMock{mockName: "slow", listDelay: time.Second, mockListResult: &indexers.ListResult{}}
+
+		w := httptest.NewRecorder()
+		return serv, w, func(url string) {
+			router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		_, w, get := setup(t)
+		get("/search?keyword=show")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &aggregatedSearchResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+
+		assert.Equal(t, map[string]string{
+			"broken": "upstream down",
+			"slow":   "timeout after 100ms",
+		}, resp.Errors)
+
+		ids := []string{}
+		for _, r := range resp.Resources {
+			ids = append(ids, r.Indexer+"/"+r.ID)
+		}
+		// free first, then resolution, then seeders, dead torrents last.
+		assert.Equal(t, []string{"free/f1", "free/f2", "mock/m2", "mock/m3"}, ids)
+		assert.Equal(t, []resourceRef{{Indexer: "mock", ID: "m1"}}, resp.Resources[0].Duplicates)
+	})
+
+	t.Run("slow indexer", func(t *testing.T) {
+		serv, _, _ := setup(t)
+		slow := &aggregatedSearchReq{Keyword: "show", PageSize: 10}
+
+		for range maxSearchesPerIndexer {
+			_, err := serv.listWithTimeout("slow", slow, 10*time.Millisecond)
+			assert.EqualError(t, err, "timeout after 10ms")
+		}
+		// the timed out calls are still running.
+		_, err := serv.listWithTimeout("slow", slow, 10*time.Millisecond)
+		assert.EqualError(t, err, "too many searches in flight")
+
+		// other indexers are not limited.
+		_, err = serv.listWithTimeout("free", slow, 10*time.Millisecond)
+		assert.NoError(t, err)
+
+		// slots are freed once the calls return.
+		time.Sleep(1500 * time.Millisecond)
+		_, err = serv.listWithTimeout("slow", slow, 10*time.Millisecond)
+		assert.EqualError(t, err, "timeout after 10ms")
+	})
+
+	t.Run("selected indexers", func(t *testing.T) {
+		_, w, get := setup(t)
+		get("/search?keyword=show&indexers=mock,free&pageSize=500")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &aggregatedSearchResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		assert.Empty(t, resp.Errors)
+		assert.Len(t, resp.Resources, 4)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			url          string
+			expectedCode int
+		}{
+			{"missing keyword", "/search", http.StatusBadRequest},
+			{"unknown indexer", "/search?keyword=show&indexers=mock,nonexistent", http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, w, get := setup(t)
+				get(tt.url)
+
+				assert.Equal(t, tt.expectedCode, w.Code)
+			})
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Scopes are hierarchical, admin includes download and download includes read.
+const (
+	ScopeRead     = "read"
+	ScopeDownload = "download"
+	ScopeAdmin    = "admin"
+)
+
+const (
+	sessionCookie     = "autoget_session"
+	defaultSessionTTL = 7 * 24 * time.Hour
+	tokenPrefix       = "ag_"
+	principalKey      = "principal"
+)
+
+var (
+	scopeLevels = map[string]int{
+		ScopeRead:     1,
+		ScopeDownload: 2,
+		ScopeAdmin:    3,
+	}
+
+	allScopes = []string{ScopeRead, ScopeDownload, ScopeAdmin}
+)
+
+// Principal is the authenticated user or API token.
+type Principal struct {
+	Name   string   `json:"name"`
+	Kind   string   `json:"kind"` // user, token or anonymous
+	Scopes []string `json:"scopes"`
+}
+
+func (p *Principal) hasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if scopeLevels[s] >= scopeLevels[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// secretEqual compares in constant time.
+func secretEqual(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+func (s *Service) authEnabled() bool {
+	return s.config != nil && s.config.Auth != nil
+}
+
+// authenticate returns nil if the request has no valid credentials.
+func (s *Service) authenticate(c *gin.Context) (*Principal, error) {
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && token != "" {
+		if s.config.Auth.AdminToken != "" && secretEqual(token, s.config.Auth.AdminToken) {
+			return &Principal{Name: "admin", Kind: "token", Scopes: allScopes}, nil
+		}
+
+		t, err := db.GetAPITokenByHash(s.db, hashSecret(token))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{Name: t.Name, Kind: "token", Scopes: t.Scopes}, nil
+	}
+
+	if cookie, err := c.Cookie(sessionCookie); err == nil && cookie != "" {
+		session, err := db.GetSession(s.db, hashSecret(cookie))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{Name: session.Username, Kind: "user", Scopes: allScopes}, nil
+	}
+
+	return nil, nil
+}
+
+// requireScope rejects requests without credentials of the scope, all
+// requests are allowed if auth is not configured.
+func (s *Service) requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.authEnabled() {
+			c.Next()
+			return
+		}
+
+		p, err := s.authenticate(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+			return
+		}
+		if p == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if !p.hasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (s *Service) login(c *gin.Context) {
+	if !s.authEnabled() || !s.config.Auth.LoginEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login is not enabled"})
+		return
+	}
+
+	req := &loginRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check both to not leak which one is wrong by timing.
+	userOK := secretEqual(req.Username, s.config.Auth.Username)
+	passOK := secretEqual(req.Password, s.config.Auth.Password)
+	if !userOK || !passOK {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	ttl := defaultSessionTTL
+	if s.config.Auth.SessionTTLHours > 0 {
+		ttl = time.Duration(s.config.Auth.SessionTTLHours) * time.Hour
+	}
+	session := &db.Session{
+		ID:        hashSecret(secret),
+		ExpiresAt: time.Now().Add(ttl),
+		Username:  req.Username,
+	}
+	if err := db.AddSession(s.db, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, secret, int(ttl.Seconds()), "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, &Principal{Name: session.Username, Kind: "user", Scopes: allScopes})
+}
+
+func (s *Service) logout(c *gin.Context) {
+	if cookie, err := c.Cookie(sessionCookie); err == nil && cookie != "" {
+		if err := db.DeleteSession(s.db, hashSecret(cookie)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session"})
+			return
+		}
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{"status": "logged out"})
+}
+
+func (s *Service) me(c *gin.Context) {
+	p, ok := c.Get(principalKey)
+	if !ok {
+		// auth is not configured.
+		c.JSON(http.StatusOK, &Principal{Name: "anonymous", Kind: "anonymous", Scopes: allScopes})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+type tokenResp struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Token is only returned on creation.
+	Token string `json:"token,omitempty"`
+}
+
+func toTokenResp(t *db.APIToken) *tokenResp {
+	return &tokenResp{
+		ID:        t.ID,
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+	}
+}
+
+func (s *Service) listTokens(c *gin.Context) {
+	tokens, err := db.GetAllAPITokens(s.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tokens"})
+		return
+	}
+
+	resp := []*tokenResp{}
+	for _, t := range tokens {
+		resp = append(resp, toTokenResp(t))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type createTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+func (s *Service) createToken(c *gin.Context) {
+	req := &createTokenRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scopes are required"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(allScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope: " + scope})
+			return
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	token := tokenPrefix + secret
+
+	t := &db.APIToken{
+		Name:   req.Name,
+		Hash:   hashSecret(token),
+		Scopes: req.Scopes,
+	}
+	if err := db.AddAPIToken(s.db, t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	resp := toTokenResp(t)
+	resp.Token = token
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Service) deleteToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	err = db.DeleteAPIToken(s.db, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/internal/config"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func authTestSetup(t *testing.T) (*Service, *gin.Engine, *gorm.DB) {
+	t.Helper()
+
+	serv, router, _, testDB := testSetup(t)
+	serv.config = &config.Config{
+		Auth: &config.AuthConfig{
+			Username:   "admin",
+			Password:   "secret",
+			AdminToken: "admin-token",
+		},
+	}
+	return serv, router, testDB
+}
+
+func addTestToken(t *testing.T, testDB *gorm.DB, token string, scopes ...string) {
+	t.Helper()
+	require.NoError(t, db.AddAPIToken(testDB, &db.APIToken{Name: token, Hash: hashSecret(token), Scopes: scopes}))
+}
+
+func TestRequireScope(t *testing.T) {
+	_, router, testDB := authTestSetup(t)
+	addTestToken(t, testDB, "read-token", ScopeRead)
+	addTestToken(t, testDB, "download-token", ScopeDownload)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		code   int
+	}{
+		{"no token", "GET", "/indexers", "", http.StatusUnauthorized},
+		{"invalid token", "GET", "/indexers", "invalid", http.StatusUnauthorized},
+		{"read", "GET", "/indexers", "read-token", http.StatusOK},
+		{"read cannot download", "POST", "/downloads/hash/pause", "read-token", http.StatusForbidden},
+		{"download includes read", "GET", "/indexers", "download-token", http.StatusOK},
+		{"download", "DELETE", "/indexers/mock/searches/1", "download-token", http.StatusNotFound},
+		{"download cannot admin", "GET", "/tokens", "download-token", http.StatusForbidden},
+		{"admin token", "GET", "/tokens", "admin-token", http.StatusOK},
+		{"image requires auth", "GET", "/image?url=https://img.m-team.cc/a.jpg", "", http.StatusUnauthorized},
+		{"torznab has own API key", "GET", "/torznab/mock/api?t=caps", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _ := authTestSetup(t)
+
+		req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"username":"admin","password":"secret"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		cookie := cookies[0]
+		assert.Equal(t, sessionCookie, cookie.Name)
+		assert.True(t, cookie.HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+		req = httptest.NewRequest("GET", "/auth/me", nil)
+		req.AddCookie(cookie)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		p := &Principal{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), p))
+		assert.Equal(t, &Principal{Name: "admin", Kind: "user", Scopes: allScopes}, p)
+
+		// sessions can manage tokens.
+		req = httptest.NewRequest("GET", "/tokens", nil)
+		req.AddCookie(cookie)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req = httptest.NewRequest("POST", "/auth/logout", nil)
+		req.AddCookie(cookie)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		req = httptest.NewRequest("GET", "/auth/me", nil)
+		req.AddCookie(cookie)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name string
+			auth *config.AuthConfig
+			body string
+			code int
+		}{
+			{"wrong password", nil, `{"username":"admin","password":"wrong"}`, http.StatusUnauthorized},
+			{"wrong username", nil, `{"username":"root","password":"secret"}`, http.StatusUnauthorized},
+			{"missing password", nil, `{"username":"admin"}`, http.StatusBadRequest},
+			{"login not enabled", &config.AuthConfig{AdminToken: "admin-token"}, `{"username":"admin","password":"secret"}`, http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				serv, router, _ := authTestSetup(t)
+				if tt.auth != nil {
+					serv.config.Auth = tt.auth
+				}
+
+				req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(tt.body))
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				assert.Equal(t, tt.code, w.Code)
+				assert.Empty(t, w.Result().Cookies())
+			})
+		}
+	})
+}
+
+func TestAuthDisabled(t *testing.T) {
+	_, router, _, _ := testSetup(t)
+
+	req := httptest.NewRequest("GET", "/auth/me", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"name":"anonymous","kind":"anonymous","scopes":["read","download","admin"]}`, w.Body.String())
+}
+
+func TestTokens(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, testDB := authTestSetup(t)
+
+		req := httptest.NewRequest("POST", "/tokens", strings.NewReader(`{"name":"sonarr","scopes":["download"]}`))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		created := &tokenResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), created))
+		assert.Equal(t, "sonarr", created.Name)
+		assert.Equal(t, []string{ScopeDownload}, created.Scopes)
+		assert.True(t, strings.HasPrefix(created.Token, tokenPrefix))
+
+		// only the hash is stored.
+		stored, err := db.GetAPITokenByHash(testDB, hashSecret(created.Token))
+		require.NoError(t, err)
+		assert.NotEqual(t, created.Token, stored.Hash)
+
+		// the new token works.
+		req = httptest.NewRequest("GET", "/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+created.Token)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"name":"sonarr","kind":"token","scopes":["download"]}`, w.Body.String())
+
+		req = httptest.NewRequest("GET", "/tokens", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var tokens []*tokenResp
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tokens))
+		require.Len(t, tokens, 1)
+		assert.Empty(t, tokens[0].Token)
+		assert.NotContains(t, w.Body.String(), stored.Hash)
+
+		req = httptest.NewRequest("DELETE", fmt.Sprintf("/tokens/%d", created.ID), nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		req = httptest.NewRequest("GET", "/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+created.Token)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			method string
+			path   string
+			body   string
+			code   int
+		}{
+			{"missing name", "POST", "/tokens", `{"scopes":["read"]}`, http.StatusBadRequest},
+			{"empty scopes", "POST", "/tokens", `{"name":"a","scopes":[]}`, http.StatusBadRequest},
+			{"invalid scope", "POST", "/tokens", `{"name":"a","scopes":["write"]}`, http.StatusBadRequest},
+			{"invalid id", "DELETE", "/tokens/abc", "", http.StatusBadRequest},
+			{"not found", "DELETE", "/tokens/99", "", http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, _ := authTestSetup(t)
+
+				req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+				req.Header.Set("Authorization", "Bearer admin-token")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				assert.Equal(t, tt.code, w.Code)
+			})
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+)
+
+// Methods below are used by the telegram bot commands.
+
+// SearchIndexer lists a page (starting from 1) of resources matching the keyword.
+func (s *Service) SearchIndexer(indexerName, keyword string, page, pageSize uint32) (*indexers.ListResult, error) {
+	indexer, ok := s.indexers[indexerName]
+	if !ok {
+		return nil, fmt.Errorf("indexer not found: %s", indexerName)
+	}
+
+	res, herr := indexer.List(&indexers.ListRequest{
+		Keyword:  keyword,
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if herr != nil {
+		return nil, herr
+	}
+	return res, nil
+}
+
+// DownloadResource starts the download of the resource.
+func (s *Service) DownloadResource(indexerName, resourceID string) error {
+	indexer, ok := s.indexers[indexerName]
+	if !ok {
+		return fmt.Errorf("indexer not found: %s", indexerName)
+	}
+
+	if _, herr := s.startDownload(indexer, resourceID, nil); herr != nil {
+		return herr
+	}
+	return nil
+}
+
+// ActiveDownloads returns up to limit downloading statuses, newest first, and
+// the total count.
+func (s *Service) ActiveDownloads(limit int) ([]db.DownloadStatus, int64, error) {
+	state := db.DownloadStarted
+	return db.ListDownloadStatuses(s.db, &db.DownloadStatusFilter{State: &state}, 1, limit)
+}
+
+// AddSearch registers a RSS search which asks before downloading the match.
+func (s *Service) AddSearch(indexerName, text string) (*db.RSSSearch, error) {
+	if _, ok := s.indexers[indexerName]; !ok {
+		return nil, fmt.Errorf("indexer not found: %s", indexerName)
+	}
+
+	search := &db.RSSSearch{
+		Indexer: indexerName,
+		Text:    text,
+		Action:  indexers.ActionNotification,
+	}
+	if err := db.AddSearch(s.db, search); err != nil {
+		return nil, err
+	}
+	return search, nil
+}
+
+// ListSearches returns all RSS searches.
+func (s *Service) ListSearches() ([]*db.RSSSearch, error) {
+	return db.GetAllSearchs(s.db)
+}
+
+// DeleteSearch deletes the RSS search.
+func (s *Service) DeleteSearch(id uint) error {
+	if _, err := db.GetSearch(s.db, id); err != nil {
+		return err
+	}
+	return db.DeleteSearch(s.db, id)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestService_SearchIndexer(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, _, m, _ := testSetup(t)
+		m.mockListResult = &indexers.ListResult{
+			Resources: []indexers.ListResourceItem{{ID: "1", Title: "Title"}},
+		}
+
+		res, err := serv.SearchIndexer("mock", "title", 2, 5)
+		require.NoError(t, err)
+		assert.Len(t, res.Resources, 1)
+		assert.Equal(t, &indexers.ListRequest{Keyword: "title", Page: 2, PageSize: 5}, m.listReq)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		serv, _, m, _ := testSetup(t)
+
+		_, err := serv.SearchIndexer("nonexistent", "title", 1, 5)
+		assert.EqualError(t, err, "indexer not found: nonexistent")
+
+		m.mockListErr = errors.NewHTTPStatusError(http.StatusInternalServerError, "mock list error")
+		_, err = serv.SearchIndexer("mock", "title", 1, 5)
+		assert.EqualError(t, err, "mock list error")
+	})
+}
+
+func TestService_DownloadResource(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, _, m, testDB := testSetup(t)
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{ID: "res-1", Title: "Resource 1"},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{
+			TorrentFilePath: "/torrents/res-1.torrent",
+			TorrentHash:     "hash-1",
+		}
+
+		require.NoError(t, serv.DownloadResource("mock", "res-1"))
+
+		s, err := db.GetDownloadStatus(testDB, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, "Resource 1", s.ResTitle)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		serv, _, m, _ := testSetup(t)
+
+		assert.EqualError(t, serv.DownloadResource("nonexistent", "res-1"), "indexer not found: nonexistent")
+
+		m.mockDetailErr = errors.NewHTTPStatusError(http.StatusNotFound, "resource not found")
+		assert.EqualError(t, serv.DownloadResource("mock", "res-1"), "resource not found")
+	})
+}
+
+func TestService_ActiveDownloads(t *testing.T) {
+	serv, _, _, testDB := testSetup(t)
+	require.NoError(t, db.SaveDownloadStatus(testDB, &db.DownloadStatus{ID: "1", State: db.DownloadStarted}))
+	require.NoError(t, db.SaveDownloadStatus(testDB, &db.DownloadStatus{ID: "2", State: db.DownloadStarted}))
+	require.NoError(t, db.SaveDownloadStatus(testDB, &db.DownloadStatus{ID: "3", State: db.DownloadSeeding}))
+
+	statuses, total, err := serv.ActiveDownloads(1)
+	require.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, int64(2), total)
+}
+
+func TestService_AddSearch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, _, _, testDB := testSetup(t)
+
+		search, err := serv.AddSearch("mock", "One Piece")
+		require.NoError(t, err)
+		assert.Equal(t, indexers.ActionNotification, search.Action)
+
+		searches, err := serv.ListSearches()
+		require.NoError(t, err)
+		require.Len(t, searches, 1)
+		assert.Equal(t, "one piece", searches[0].Text)
+
+		require.NoError(t, serv.DeleteSearch(search.ID))
+		_, err = db.GetSearch(testDB, search.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		serv, _, _, _ := testSetup(t)
+
+		_, err := serv.AddSearch("nonexistent", "One Piece")
+		assert.EqualError(t, err, "indexer not found: nonexistent")
+
+		assert.ErrorIs(t, serv.DeleteSearch(1), gorm.ErrRecordNotFound)
+	})
+}
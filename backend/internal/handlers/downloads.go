@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/charleshuang3/autoget/backend/downloaders"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDownloadsPageSize = 50
+	maxDownloadsPageSize     = 200
+)
+
+var (
+	downloadStates = []db.DownloadState{db.DownloadStarted, db.DownloadSeeding, db.DownloadStopped, db.DownloadDeleted, db.DownloadQueued}
+
+	moveStateNames = map[db.MoveState]string{
+		db.UnMoved:   "unmoved",
+		db.Moved:     "moved",
+		db.Organized: "organized",
+	}
+)
+
+func parseName[T comparable](names map[T]string, name string) (T, bool) {
+	for k, v := range names {
+		if v == name {
+			return k, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+func parseDownloadState(name string) (db.DownloadState, bool) {
+	for _, s := range downloadStates {
+		if s.String() == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+type downloadStatusResp struct {
+	Hash             string           `json:"hash"`
+	Downloader       string           `json:"downloader"`
+	DownloadProgress int32            `json:"downloadProgress"` // in x/1000
+	State            string           `json:"state"`
+	Paused           bool             `json:"paused"`
+	MoveState        string           `json:"moveState"`
+	StopReason       string           `json:"stopReason,omitempty"` // seeding policy rule or user stopped it
+	UploadHistories  map[string]int64 `json:"uploadHistories,omitempty"`
+	ResIndexer       string           `json:"resIndexer,omitempty"`
+	ResTitle         string           `json:"resTitle"`
+	ResTitle2        string           `json:"resTitle2,omitempty"`
+	Category         string           `json:"category,omitempty"`
+	FileList         []string         `json:"fileList,omitempty"`
+	CreatedAt        int64            `json:"createdAt"` // in unix timestamp
+	UpdatedAt        int64            `json:"updatedAt"` // in unix timestamp
+}
+
+func toDownloadStatusResp(s *db.DownloadStatus) *downloadStatusResp {
+	return &downloadStatusResp{
+		Hash:             s.ID,
+		Downloader:       s.Downloader,
+		DownloadProgress: s.DownloadProgress,
+		State:            s.State.String(),
+		Paused:           s.Paused,
+		MoveState:        moveStateNames[s.MoveState],
+		StopReason:       string(s.StopReason),
+		UploadHistories:  s.UploadHistories,
+		ResIndexer:       s.ResIndexer,
+		ResTitle:         s.ResTitle,
+		ResTitle2:        s.ResTitle2,
+		Category:         s.Category,
+		FileList:         s.FileList,
+		CreatedAt:        s.CreatedAt.Unix(),
+		UpdatedAt:        s.UpdatedAt.Unix(),
+	}
+}
+
+type listDownloadsReq struct {
+	Downloader string `form:"downloader"`
+	State      string `form:"state"`
+	MoveState  string `form:"moveState"`
+	Indexer    string `form:"indexer"`
+	Page       uint32 `form:"page"`
+	PageSize   uint32 `form:"pageSize"`
+}
+
+type listDownloadsResp struct {
+	Pagination indexers.Pagination   `json:"pagination"`
+	Downloads  []*downloadStatusResp `json:"downloads"`
+}
+
+func (s *Service) listDownloads(c *gin.Context) {
+	req := &listDownloadsReq{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := &db.DownloadStatusFilter{
+		Downloader: req.Downloader,
+		ResIndexer: req.Indexer,
+	}
+	if req.State != "" {
+		state, ok := parseDownloadState(req.State)
+		if !ok {
+			c.JSON(400, gin.H{"error": "Invalid state"})
+			return
+		}
+		filter.State = &state
+	}
+	if req.MoveState != "" {
+		moveState, ok := parseName(moveStateNames, req.MoveState)
+		if !ok {
+			c.JSON(400, gin.H{"error": "Invalid move state"})
+			return
+		}
+		filter.MoveState = &moveState
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultDownloadsPageSize
+	}
+	if req.PageSize > maxDownloadsPageSize {
+		req.PageSize = maxDownloadsPageSize
+	}
+
+	statuses, total, err := db.ListDownloadStatuses(s.db, filter, int(req.Page), int(req.PageSize))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := &listDownloadsResp{
+		Pagination: indexers.Pagination{
+			Page:       req.Page,
+			PageSize:   req.PageSize,
+			Total:      uint32(total),
+			TotalPages: (uint32(total) + req.PageSize - 1) / req.PageSize,
+		},
+		Downloads: []*downloadStatusResp{},
+	}
+	for i := range statuses {
+		resp.Downloads = append(resp.Downloads, toDownloadStatusResp(&statuses[i]))
+	}
+
+	c.JSON(200, resp)
+}
+
+// getDownloadStatus writes the error response if the status is not found.
+func (s *Service) getDownloadStatus(c *gin.Context) (*db.DownloadStatus, bool) {
+	status, err := db.GetDownloadStatus(s.db, c.Param("hash"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "Download not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return status, true
+}
+
+func (s *Service) downloadDetail(c *gin.Context) {
+	status, ok := s.getDownloadStatus(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, toDownloadStatusResp(status))
+}
+
+// downloadAction returns a handler which runs the action with the downloader of the status.
+func (s *Service) downloadAction(action func(dl downloaders.IDownloader, status *db.DownloadStatus, c *gin.Context) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, ok := s.getDownloadStatus(c)
+		if !ok {
+			return
+		}
+
+		if status.State == db.DownloadDeleted {
+			c.JSON(409, gin.H{"error": "Download is deleted"})
+			return
+		}
+
+		dl, ok := s.downloaders[status.Downloader]
+		if !ok {
+			c.JSON(500, gin.H{"error": "Downloader not found"})
+			return
+		}
+
+		if err := action(dl, status, c); err != nil {
+			if errors.Is(err, lifecycle.ErrTorrentNotFound) {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(200, toDownloadStatusResp(status))
+	}
+}
+
+func pauseDownload(dl downloaders.IDownloader, status *db.DownloadStatus, c *gin.Context) error {
+	return dl.PauseTorrent(status)
+}
+
+func resumeDownload(dl downloaders.IDownloader, status *db.DownloadStatus, c *gin.Context) error {
+	return dl.ResumeTorrent(status)
+}
+
+func stopDownload(dl downloaders.IDownloader, status *db.DownloadStatus, c *gin.Context) error {
+	return dl.StopTorrent(status)
+}
+
+func deleteDownload(dl downloaders.IDownloader, status *db.DownloadStatus, c *gin.Context) error {
+	return dl.DeleteTorrent(status, c.Query("deleteData") == "true")
+}
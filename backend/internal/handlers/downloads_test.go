@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func addDownloadStatuses(t *testing.T, d *gorm.DB) {
+	t.Helper()
+
+	now := time.Now()
+	for i, s := range []*db.DownloadStatus{
+		{ID: "1", Downloader: "mock", State: db.DownloadStarted, ResIndexer: "nyaa", ResTitle: "Title 1", DownloadProgress: 500},
+		{ID: "2", Downloader: "mock", State: db.DownloadSeeding, ResIndexer: "nyaa", ResTitle: "Title 2", MoveState: db.Moved},
+		{ID: "3", Downloader: "other", State: db.DownloadSeeding, ResIndexer: "m-team", ResTitle: "Title 3"},
+		{ID: "4", Downloader: "mock", State: db.DownloadDeleted, ResIndexer: "nyaa", ResTitle: "Title 4", StopReason: db.StopMaxSeedTime},
+	} {
+		s.CreatedAt = now.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, d.Create(s).Error)
+	}
+}
+
+func TestService_listDownloads(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			query     string
+			wantIDs   []string
+			wantTotal uint32
+			wantPages uint32
+		}{
+			{
+				name:      "all",
+				query:     "",
+				wantIDs:   []string{"4", "3", "2", "1"},
+				wantTotal: 4,
+				wantPages: 1,
+			},
+			{
+				name:      "filters",
+				query:     "?downloader=mock&state=seeding&moveState=moved&indexer=nyaa",
+				wantIDs:   []string{"2"},
+				wantTotal: 1,
+				wantPages: 1,
+			},
+			{
+				name:      "pagination",
+				query:     "?page=2&pageSize=3",
+				wantIDs:   []string{"1"},
+				wantTotal: 4,
+				wantPages: 2,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, _, testDB := testSetup(t)
+				addDownloadStatuses(t, testDB)
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/downloads"+tt.query, nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				resp := &listDownloadsResp{}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+
+				ids := []string{}
+				for _, d := range resp.Downloads {
+					ids = append(ids, d.Hash)
+				}
+				assert.Equal(t, tt.wantIDs, ids)
+				assert.Equal(t, tt.wantTotal, resp.Pagination.Total)
+				assert.Equal(t, tt.wantPages, resp.Pagination.TotalPages)
+			})
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			query       string
+			expectedMsg string
+		}{
+			{
+				name:        "invalid state",
+				query:       "?state=unknown",
+				expectedMsg: "Invalid state",
+			},
+			{
+				name:        "invalid move state",
+				query:       "?moveState=unknown",
+				expectedMsg: "Invalid move state",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, _, _ := testSetup(t)
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/downloads"+tt.query, nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedMsg, resp["error"])
+			})
+		}
+	})
+}
+
+func TestService_downloadDetail(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		addDownloadStatuses(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/downloads/1", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &downloadStatusResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		assert.Equal(t, "1", resp.Hash)
+		assert.Equal(t, "mock", resp.Downloader)
+		assert.Equal(t, "started", resp.State)
+		assert.Equal(t, "unmoved", resp.MoveState)
+		assert.Equal(t, int32(500), resp.DownloadProgress)
+		assert.Equal(t, "Title 1", resp.ResTitle)
+		assert.Empty(t, resp.StopReason)
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/downloads/4", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		resp = &downloadStatusResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		assert.Equal(t, "max_seed_time", resp.StopReason)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, _, _ := testSetup(t)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/downloads/unknown", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestService_downloadAction(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		tests := []struct {
+			method     string
+			path       string
+			wantAction string
+			wantState  string
+			wantPaused bool
+		}{
+			{
+				method:     "POST",
+				path:       "/downloads/1/pause",
+				wantAction: "pause:1",
+				wantState:  "started",
+				wantPaused: true,
+			},
+			{
+				method:     "POST",
+				path:       "/downloads/1/resume",
+				wantAction: "resume:1",
+				wantState:  "started",
+			},
+			{
+				method:     "POST",
+				path:       "/downloads/1/stop",
+				wantAction: "stop:1",
+				wantState:  "stopped",
+			},
+			{
+				method:     "DELETE",
+				path:       "/downloads/1?deleteData=true",
+				wantAction: "delete(true):1",
+				wantState:  "deleted",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.path, func(t *testing.T) {
+				serv, router, _, testDB := testSetup(t)
+				addDownloadStatuses(t, testDB)
+				dl := serv.downloaders["mock"].(*downloadersMock)
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(tt.method, tt.path, nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, []string{tt.wantAction}, dl.actions)
+
+				resp := &downloadStatusResp{}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+				assert.Equal(t, tt.wantState, resp.State)
+				assert.Equal(t, tt.wantPaused, resp.Paused)
+			})
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			path         string
+			actionErr    error
+			expectedCode int
+			expectedMsg  string
+		}{
+			{
+				name:         "download not found",
+				path:         "/downloads/unknown/pause",
+				expectedCode: http.StatusNotFound,
+				expectedMsg:  "Download not found",
+			},
+			{
+				name:         "deleted",
+				path:         "/downloads/4/pause",
+				expectedCode: http.StatusConflict,
+				expectedMsg:  "Download is deleted",
+			},
+			{
+				name:         "downloader not found",
+				path:         "/downloads/3/pause",
+				expectedCode: http.StatusInternalServerError,
+				expectedMsg:  "Downloader not found",
+			},
+			{
+				name:         "torrent not found",
+				path:         "/downloads/1/pause",
+				actionErr:    lifecycle.ErrTorrentNotFound,
+				expectedCode: http.StatusNotFound,
+				expectedMsg:  lifecycle.ErrTorrentNotFound.Error(),
+			},
+			{
+				name:         "downloader error",
+				path:         "/downloads/1/pause",
+				actionErr:    fmt.Errorf("rpc error"),
+				expectedCode: http.StatusInternalServerError,
+				expectedMsg:  "rpc error",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				serv, router, _, testDB := testSetup(t)
+				addDownloadStatuses(t, testDB)
+				serv.downloaders["mock"].(*downloadersMock).mockActionErr = tt.actionErr
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", tt.path, nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedCode, w.Code)
+
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedMsg, resp["error"])
+			})
+		}
+	})
+}
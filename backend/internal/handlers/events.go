@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeat keeps idle connections open through proxies.
+const sseHeartbeat = 30 * time.Second
+
+// events streams hub events as Server-Sent Events, the event name is the hub
+// event type and the data is JSON.
+func (s *Service) events(c *gin.Context) {
+	ch, unsubscribe := s.hub.Subscribe()
+	defer unsubscribe()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e := <-ch:
+			c.SSEvent(e.Type, e.Data)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
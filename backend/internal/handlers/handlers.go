@@ -1,15 +1,24 @@
 package handlers
 
 import (
+	stderrors "errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/charleshuang3/autoget/backend/downloaders"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
 	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/indexers/rsshelper"
 	"github.com/charleshuang3/autoget/backend/internal/config"
 	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/charleshuang3/autoget/backend/internal/hub"
+	"github.com/charleshuang3/autoget/backend/internal/notify"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -20,6 +29,16 @@ type Service struct {
 
 	indexers    map[string]indexers.IIndexer
 	downloaders map[string]downloaders.IDownloader
+
+	// searchTimeout per indexer of the aggregated search.
+	searchTimeout time.Duration
+	// searchSlots limits List calls in flight by indexer, see listWithTimeout.
+	searchSlots sync.Map
+
+	hub *hub.Hub
+
+	// notifier asks to approve searches matched by the backfill.
+	notifier notify.INotifier
 }
 
 func NewService(config *config.Config, db *gorm.DB, indexers map[string]indexers.IIndexer, downloaders map[string]downloaders.IDownloader) *Service {
@@ -28,22 +47,73 @@ func NewService(config *config.Config, db *gorm.DB, indexers map[string]indexers
 		db:          db,
 		indexers:    indexers,
 		downloaders: downloaders,
+
+		searchTimeout: defaultSearchTimeout,
+		hub:           hub.Default,
 	}
 
 	return s
 }
 
+// SetNotifier of the pending downloads, the RSS searches use the same.
+func (s *Service) SetNotifier(n notify.INotifier) {
+	s.notifier = n
+}
+
 func (s *Service) SetupRouter(router *gin.RouterGroup) {
-	router.GET("/indexers", s.listIndexers)
-	router.GET("/indexers/:indexer/categories", s.indexerCategories)
-	router.GET("/indexers/:indexer/resources", s.indexerListResources)
-	router.GET("/indexers/:indexer/resources/:resource", s.indexerResourceDetail)
-	router.GET("/indexers/:indexer/resources/:resource/download", s.indexerDownload)
-	router.GET("/indexers/:indexer/registerSearch", s.indexerRegisterSearch)
+	// Torznab has its own API key.
+	router.GET("/torznab/:indexer/api", s.torznabAPI)
+	router.GET("/torznab/:indexer/download/:resource", s.torznabDownload)
+
+	router.POST("/auth/login", s.login)
+	router.POST("/auth/logout", s.logout)
+
+	read := router.Group("", s.requireScope(ScopeRead))
+	download := router.Group("", s.requireScope(ScopeDownload))
+	admin := router.Group("", s.requireScope(ScopeAdmin))
+
+	read.GET("/auth/me", s.me)
+
+	read.GET("/indexers", s.listIndexers)
+	read.GET("/indexers/:indexer/categories", s.indexerCategories)
+	read.GET("/indexers/:indexer/resources", s.indexerListResources)
+	read.GET("/indexers/:indexer/resources/:resource", s.indexerResourceDetail)
+	download.POST("/indexers/:indexer/resources/:resource/download", s.indexerDownload)
+
+	read.GET("/search", s.aggregatedSearch)
+
+	read.GET("/rss-items", s.listRSSItems)
+
+	read.GET("/searches", s.listSearches)
+	read.GET("/indexers/:indexer/searches", s.indexerListSearches)
+	download.POST("/indexers/:indexer/searches", s.indexerRegisterSearch)
+	download.PUT("/indexers/:indexer/searches/:id", s.indexerUpdateSearch)
+	download.DELETE("/indexers/:indexer/searches/:id", s.indexerDeleteSearch)
+	download.POST("/indexers/:indexer/searches/:id/rearm", s.indexerRearmSearch)
+
+	read.GET("/subscriptions", s.listSubscriptions)
+	read.GET("/indexers/:indexer/subscriptions", s.indexerListSubscriptions)
+	download.POST("/indexers/:indexer/subscriptions", s.indexerSubscribe)
+	read.GET("/indexers/:indexer/subscriptions/:id", s.indexerSubscriptionDetail)
+	download.DELETE("/indexers/:indexer/subscriptions/:id", s.indexerUnsubscribe)
+
+	read.GET("/downloaders", s.listDownloaders)
+	download.POST("/downloaders/:name/check", s.checkDownloader)
+
+	read.GET("/downloads", s.listDownloads)
+	read.GET("/downloads/:hash", s.downloadDetail)
+	download.POST("/downloads/:hash/pause", s.downloadAction(pauseDownload))
+	download.POST("/downloads/:hash/resume", s.downloadAction(resumeDownload))
+	download.POST("/downloads/:hash/stop", s.downloadAction(stopDownload))
+	download.DELETE("/downloads/:hash", s.downloadAction(deleteDownload))
 
-	router.GET("/downloaders", s.listDownloaders)
+	read.GET("/events", s.events)
 
-	router.GET("/image", s.image)
+	read.GET("/image", s.image)
+
+	admin.GET("/tokens", s.listTokens)
+	admin.POST("/tokens", s.createToken)
+	admin.DELETE("/tokens/:id", s.deleteToken)
 }
 
 func (s *Service) listIndexers(c *gin.Context) {
@@ -139,69 +209,73 @@ func (s *Service) indexerDownload(c *gin.Context) {
 		return
 	}
 
-	resourceID := c.Param("resource")
-
-	detail, err := indexer.Detail(resourceID, true)
+	status, err := s.startDownload(indexer, c.Param("resource"), nil)
 	if err != nil {
 		c.JSON(err.Code, gin.H{"error": err.Message})
 		return
 	}
 
-	res, err := indexer.Download(resourceID)
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
-	}
+	c.JSON(200, gin.H{"status": status.State.String()})
+}
 
-	downloadStatus := &db.DownloadStatus{
-		ID:         res.TorrentHash,
-		Downloader: indexer.DownloaderName(),
-		State:      db.DownloadStarted,
-		ResTitle:   detail.Title,
-		ResTitle2:  detail.Title2,
-		ResIndexer: indexerName,
-		Category:   detail.Category,
+// startDownload starts the download of the resource with the downloader of the
+// indexer, see rsshelper.StartDownload for record.
+func (s *Service) startDownload(indexer indexers.IIndexer, resourceID string, record func(tx *gorm.DB, s *db.DownloadStatus) error) (*db.DownloadStatus, *errors.HTTPStatusError) {
+	detail, herr := indexer.Detail(resourceID, true)
+	if herr != nil {
+		return nil, herr
 	}
-	if err := s.db.Create(downloadStatus).Error; err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+
+	downloader, ok := s.downloaders[indexer.DownloaderName()]
+	if !ok {
+		return nil, errors.NewHTTPStatusError(500, "Downloader not found")
 	}
 
-	c.JSON(200, gin.H{"status": "started"})
-}
+	status, err := rsshelper.StartDownload(s.db, indexer, downloader, &rsshelper.Resource{
+		ID:       resourceID,
+		Title:    detail.Title,
+		Title2:   detail.Title2,
+		Category: detail.Category,
+	}, record)
+	if err != nil {
+		if stderrors.As(err, &herr) {
+			return nil, herr
+		}
+		if stderrors.Is(err, lifecycle.ErrLowDiskSpace) {
+			return nil, errors.NewHTTPStatusError(http.StatusInsufficientStorage, err.Error())
+		}
+		return nil, errors.NewHTTPStatusError(500, err.Error())
+	}
 
-type indexerRegisterSearchReq struct {
-	Text   string `json:"text" binding:"required"`
-	Action string `json:"action" binding:"required"`
+	return status, nil
 }
 
-func (s *Service) indexerRegisterSearch(c *gin.Context) {
-	indexerName := c.Param("indexer")
-	if _, ok := s.indexers[indexerName]; !ok {
-		c.JSON(404, gin.H{"error": "Indexer not found"})
-		return
+// HandlePendingDownload starts the download of a matched notification search
+// and deletes the search, ignoring keeps the search as matched.
+func (s *Service) HandlePendingDownload(searchID uint, download bool) error {
+	search, err := db.GetSearch(s.db, searchID)
+	if err != nil {
+		return err
 	}
-
-	req := &indexerRegisterSearchReq{}
-	if err := c.ShouldBindJSON(req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
-		return
+	if !download {
+		return nil
 	}
 
-	if req.Action != indexers.ActionDownload &&
-		req.Action != indexers.ActionNotification {
-		c.JSON(400, gin.H{"error": "Invalid action"})
-		return
+	if search.ResID == "" {
+		return fmt.Errorf("search %d has no match", searchID)
+	}
+	indexer, ok := s.indexers[search.Indexer]
+	if !ok {
+		return fmt.Errorf("indexer not found: %s", search.Indexer)
 	}
 
-	if err := db.AddSearch(s.db, &db.RSSSearch{
-		Indexer: indexerName,
-		Text:    req.Text,
-		Action:  req.Action,
-	}); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+	_, herr := s.startDownload(indexer, search.ResID, func(tx *gorm.DB, _ *db.DownloadStatus) error {
+		return db.DeleteSearch(tx, search.ID)
+	})
+	if herr != nil {
+		return herr
 	}
+	return nil
 }
 
 type listDownloadersRespItem struct {
@@ -224,6 +298,44 @@ func (s *Service) listDownloaders(c *gin.Context) {
 	c.JSON(200, listDownloadersResp{Map: m})
 }
 
+type checkDownloaderResp struct {
+	Updated   []string `json:"updated"`
+	Completed []string `json:"completed"`
+	Moved     []string `json:"moved"`
+	Failed    []string `json:"failed"`
+	Postponed []string `json:"postponed"`
+	Busy      bool     `json:"busy"`
+}
+
+// checkDownloader runs a progress check of the downloader and returns what it
+// did.
+func (s *Service) checkDownloader(c *gin.Context) {
+	dl, ok := s.downloaders[c.Param("name")]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Downloader not found"})
+		return
+	}
+
+	res, err := dl.ProgressChecker()
+	if stderrors.Is(err, lifecycle.ErrCheckRunning) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, checkDownloaderResp{
+		Updated:   append([]string{}, res.Updated...),
+		Completed: append([]string{}, res.Completed...),
+		Moved:     append([]string{}, res.Moved...),
+		Failed:    append([]string{}, res.Failed...),
+		Postponed: append([]string{}, res.Postponed...),
+		Busy:      res.Busy,
+	})
+}
+
 func (s *Service) image(c *gin.Context) {
 	// m-team image require "referer" to request
 	u, ok := c.GetQuery("url")
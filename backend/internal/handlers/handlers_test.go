@@ -2,15 +2,21 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/charleshuang3/autoget/backend/downloaders"
+	"github.com/charleshuang3/autoget/backend/downloaders/lifecycle"
 	"github.com/charleshuang3/autoget/backend/indexers"
 	"github.com/charleshuang3/autoget/backend/internal/db"
 	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/charleshuang3/autoget/backend/internal/hub"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/assert"
@@ -24,10 +30,16 @@ type indexerMock struct {
 	mockCategoriesErr  *errors.HTTPStatusError
 	mockListResult     *indexers.ListResult
 	mockListErr        *errors.HTTPStatusError
+	mockListPages      map[uint32]*indexers.ListResult // by page if set
+	listReq            *indexers.ListRequest
+	listDelay          time.Duration
 	mockDetailResult   *indexers.ResourceDetail
 	mockDetailErr      *errors.HTTPStatusError
 	mockDownloadResult *indexers.DownloadResult
 	mockDownloadErr    *errors.HTTPStatusError
+	// mockTorrent is written to the dir given to Download if set.
+	mockTorrent []byte
+	downloadDir string
 }
 
 func (i *indexerMock) Name() string {
@@ -39,6 +51,11 @@ func (i *indexerMock) Categories() ([]indexers.Category, *errors.HTTPStatusError
 }
 
 func (i *indexerMock) List(req *indexers.ListRequest) (*indexers.ListResult, *errors.HTTPStatusError) {
+	i.listReq = req
+	time.Sleep(i.listDelay)
+	if i.mockListPages != nil {
+		return i.mockListPages[req.Page], i.mockListErr
+	}
 	return i.mockListResult, i.mockListErr
 }
 
@@ -46,19 +63,76 @@ func (i *indexerMock) Detail(id string, fileList bool) (*indexers.ResourceDetail
 	return i.mockDetailResult, i.mockDetailErr
 }
 
-func (i *indexerMock) Download(id string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
+func (i *indexerMock) Download(id, dir string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
+	i.downloadDir = dir
+	if i.mockTorrent != nil {
+		path := filepath.Join(dir, id+".torrent")
+		if err := os.WriteFile(path, i.mockTorrent, 0644); err != nil {
+			return nil, errors.NewHTTPStatusError(500, err.Error())
+		}
+		return &indexers.DownloadResult{TorrentFilePath: path, TorrentHash: "hash"}, nil
+	}
 	return i.mockDownloadResult, i.mockDownloadErr
 }
 
+func (i *indexerMock) PullRSS() ([]*indexers.RSSItem, error) {
+	return nil, nil
+}
+
+func (i *indexerMock) SearchRSS(index indexers.IIndexer, items []*indexers.RSSItem) {}
+
 func (i *indexerMock) RegisterRSSCronjob(cron *cron.Cron) {}
 
 func (i *indexerMock) DownloaderName() string {
-	return "mock-downloader"
+	return "mock"
 }
 
 type downloadersMock struct {
 	mockTorrentsDir string
 	mockDownloadDir string
+
+	mockAddTorrentErr error
+	mockQueued        bool
+	added             []*lifecycle.NewTorrent
+
+	mockActionErr error
+	actions       []string
+
+	mockCheckResult *lifecycle.CheckResult
+	mockCheckErr    error
+}
+
+func (d *downloadersMock) action(name string, s *db.DownloadStatus, update func()) error {
+	if d.mockActionErr != nil {
+		return d.mockActionErr
+	}
+	d.actions = append(d.actions, name+":"+s.ID)
+	update()
+	return nil
+}
+
+func (d *downloadersMock) PauseTorrent(s *db.DownloadStatus) error {
+	return d.action("pause", s, func() { s.Paused = true })
+}
+
+func (d *downloadersMock) ResumeTorrent(s *db.DownloadStatus) error {
+	return d.action("resume", s, func() { s.Paused = false })
+}
+
+func (d *downloadersMock) StopTorrent(s *db.DownloadStatus) error {
+	return d.action("stop", s, func() { s.State = db.DownloadStopped })
+}
+
+func (d *downloadersMock) DeleteTorrent(s *db.DownloadStatus, deleteData bool) error {
+	return d.action(fmt.Sprintf("delete(%t)", deleteData), s, func() { s.State = db.DownloadDeleted })
+}
+
+func (d *downloadersMock) AddTorrent(t *lifecycle.NewTorrent) (*lifecycle.AddResult, error) {
+	if d.mockAddTorrentErr != nil {
+		return nil, d.mockAddTorrentErr
+	}
+	d.added = append(d.added, t)
+	return &lifecycle.AddResult{Queued: d.mockQueued}, nil
 }
 
 func (d *downloadersMock) TorrentsDir() string {
@@ -71,13 +145,16 @@ func (d *downloadersMock) DownloadDir() string {
 
 func (d *downloadersMock) RegisterCronjobs(cron *cron.Cron)            {}
 func (d *downloadersMock) RegisterDailySeedingChecker(cron *cron.Cron) {}
-func (d *downloadersMock) ProgressChecker()                            {}
+
+func (d *downloadersMock) ProgressChecker() (*lifecycle.CheckResult, error) {
+	return d.mockCheckResult, d.mockCheckErr
+}
 
 func testSetup(t *testing.T) (*Service, *gin.Engine, *indexerMock, *gorm.DB) {
 	t.Helper()
 
 	gin.SetMode(gin.TestMode)
-	testDB, err := db.SqliteForTest()
+	testDB, err := db.ForTest(t)
 	require.NoError(t, err)
 
 	m := &indexerMock{
@@ -95,6 +172,7 @@ func testSetup(t *testing.T) (*Service, *gin.Engine, *indexerMock, *gorm.DB) {
 				mockDownloadDir: "/downloads",
 			},
 		},
+		hub: hub.New(),
 	}
 
 	router := gin.Default()
@@ -268,6 +346,186 @@ func TestService_indexerResourceDetail(t *testing.T) {
 	})
 }
 
+func TestService_indexerDownload(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, router, m, testDB := testSetup(t)
+		dl := serv.downloaders["mock"].(*downloadersMock)
+
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{
+				ID:       "res-1",
+				Title:    "Resource 1",
+				Category: "Anime",
+			},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{
+			TorrentFilePath: "/torrents/res-1.torrent",
+			TorrentHash:     "hash-1",
+		}
+
+		w := httptest.NewRecorder()
+
+		req := httptest.NewRequest("POST", "/indexers/mock/resources/res-1/download", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		require.Len(t, dl.added, 1)
+		assert.Equal(t, "/torrents/res-1.torrent", dl.added[0].FilePath)
+		assert.Equal(t, []string{"mock"}, dl.added[0].Labels)
+
+		s, err := db.GetDownloadStatus(testDB, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, "mock", s.Downloader)
+		assert.Equal(t, db.DownloadStarted, s.State)
+		assert.Equal(t, "Resource 1", s.ResTitle)
+		assert.JSONEq(t, `{"status":"started"}`, w.Body.String())
+	})
+
+	t.Run("queued", func(t *testing.T) {
+		serv, router, m, testDB := testSetup(t)
+		serv.downloaders["mock"].(*downloadersMock).mockQueued = true
+
+		m.mockDetailResult = &indexers.ResourceDetail{}
+		m.mockDownloadResult = &indexers.DownloadResult{
+			TorrentFilePath: "/torrents/res-1.torrent",
+			TorrentHash:     "hash-1",
+		}
+
+		w := httptest.NewRecorder()
+
+		req := httptest.NewRequest("POST", "/indexers/mock/resources/res-1/download", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"queued"}`, w.Body.String())
+
+		s, err := db.GetDownloadStatus(testDB, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadQueued, s.State)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			downloadErr   *errors.HTTPStatusError
+			addTorrentErr error
+			expectedCode  int
+			expectedMsg   string
+		}{
+			{
+				name:         "indexer download error",
+				downloadErr:  errors.NewHTTPStatusError(http.StatusInternalServerError, "mock download error"),
+				expectedCode: http.StatusInternalServerError,
+				expectedMsg:  "mock download error",
+			},
+			{
+				name:          "add torrent error",
+				addTorrentErr: fmt.Errorf("rpc error"),
+				expectedCode:  http.StatusInternalServerError,
+				expectedMsg:   "rpc error",
+			},
+			{
+				name:          "low disk space",
+				addTorrentErr: fmt.Errorf("downloader mock: %w", lifecycle.ErrLowDiskSpace),
+				expectedCode:  http.StatusInsufficientStorage,
+				expectedMsg:   "downloader mock: low disk space",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				serv, router, m, testDB := testSetup(t)
+				serv.downloaders["mock"].(*downloadersMock).mockAddTorrentErr = tt.addTorrentErr
+
+				m.mockDetailResult = &indexers.ResourceDetail{}
+				m.mockDownloadErr = tt.downloadErr
+				if tt.downloadErr == nil {
+					m.mockDownloadResult = &indexers.DownloadResult{
+						TorrentFilePath: "/torrents/res-1.torrent",
+						TorrentHash:     "hash-1",
+					}
+				}
+
+				w := httptest.NewRecorder()
+
+				req := httptest.NewRequest("POST", "/indexers/mock/resources/res-1/download", nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedCode, w.Code)
+
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedMsg, resp["error"])
+
+				// no download status if the torrent is not added.
+				_, err := db.GetDownloadStatus(testDB, "hash-1")
+				assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+			})
+		}
+	})
+}
+
+func TestService_HandlePendingDownload(t *testing.T) {
+	addMatchedSearch := func(t *testing.T, d *gorm.DB) *db.RSSSearch {
+		search := &db.RSSSearch{Indexer: "mock", Text: "resource", Action: "notification", ResID: "res-1", Title: "Resource 1"}
+		require.NoError(t, db.AddSearch(d, search))
+		return search
+	}
+
+	t.Run("success", func(t *testing.T) {
+		serv, _, m, testDB := testSetup(t)
+		dl := serv.downloaders["mock"].(*downloadersMock)
+		search := addMatchedSearch(t, testDB)
+
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{ID: "res-1", Title: "Resource 1"},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{
+			TorrentFilePath: "/torrents/res-1.torrent",
+			TorrentHash:     "hash-1",
+		}
+
+		require.NoError(t, serv.HandlePendingDownload(search.ID, true))
+
+		require.Len(t, dl.added, 1)
+		s, err := db.GetDownloadStatus(testDB, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, "Resource 1", s.ResTitle)
+
+		_, err = db.GetSearch(testDB, search.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		serv, _, _, testDB := testSetup(t)
+		dl := serv.downloaders["mock"].(*downloadersMock)
+		search := addMatchedSearch(t, testDB)
+
+		require.NoError(t, serv.HandlePendingDownload(search.ID, false))
+
+		assert.Empty(t, dl.added)
+		got, err := db.GetSearch(testDB, search.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "res-1", got.ResID)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		serv, _, m, testDB := testSetup(t)
+		search := addMatchedSearch(t, testDB)
+
+		assert.ErrorIs(t, serv.HandlePendingDownload(search.ID+1, true), gorm.ErrRecordNotFound)
+
+		m.mockDetailResult = &indexers.ResourceDetail{}
+		m.mockDownloadErr = errors.NewHTTPStatusError(http.StatusInternalServerError, "mock download error")
+		assert.EqualError(t, serv.HandlePendingDownload(search.ID, true), "mock download error")
+
+		// the search is kept to retry.
+		_, err := db.GetSearch(testDB, search.ID)
+		assert.NoError(t, err)
+	})
+}
+
 func TestService_indexerListResources(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		_, router, m, _ := testSetup(t)
@@ -361,7 +619,7 @@ func TestService_indexerRegisterSearch(t *testing.T) {
 
 		w := httptest.NewRecorder()
 		reqBody := `{"text": "test search", "action": "download"}`
-		req := httptest.NewRequest("GET", "/indexers/mock/registerSearch", strings.NewReader(reqBody))
+		req := httptest.NewRequest("POST", "/indexers/mock/searches", strings.NewReader(reqBody))
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
@@ -381,7 +639,7 @@ func TestService_indexerRegisterSearch(t *testing.T) {
 
 		w := httptest.NewRecorder()
 		reqBody := `{"text": "another search", "action": "notification"}`
-		req := httptest.NewRequest("GET", "/indexers/mock/registerSearch", strings.NewReader(reqBody))
+		req := httptest.NewRequest("POST", "/indexers/mock/searches", strings.NewReader(reqBody))
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
@@ -401,7 +659,7 @@ func TestService_indexerRegisterSearch(t *testing.T) {
 
 		w := httptest.NewRecorder()
 		reqBody := `{"text": "test", "action": "download"}`
-		req := httptest.NewRequest("GET", "/indexers/nonexistent/registerSearch", strings.NewReader(reqBody))
+		req := httptest.NewRequest("POST", "/indexers/nonexistent/searches", strings.NewReader(reqBody))
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
@@ -444,7 +702,7 @@ func TestService_indexerRegisterSearch(t *testing.T) {
 				_, router, _, _ := testSetup(t)
 
 				w := httptest.NewRecorder()
-				req := httptest.NewRequest("GET", "/indexers/mock/registerSearch", strings.NewReader(tt.reqBody))
+				req := httptest.NewRequest("POST", "/indexers/mock/searches", strings.NewReader(tt.reqBody))
 				req.Header.Set("Content-Type", "application/json")
 				router.ServeHTTP(w, req)
 
@@ -461,7 +719,7 @@ func TestService_indexerRegisterSearch(t *testing.T) {
 
 		w := httptest.NewRecorder()
 		reqBody := `{"text": "test", "action": "invalid_action"}`
-		req := httptest.NewRequest("GET", "/indexers/mock/registerSearch", strings.NewReader(reqBody))
+		req := httptest.NewRequest("POST", "/indexers/mock/searches", strings.NewReader(reqBody))
 		req.Header.Set("Content-Type", "application/json")
 		router.ServeHTTP(w, req)
 
@@ -488,3 +746,79 @@ func TestListDownloaders(t *testing.T) {
 	assert.Equal(t, "/torrents", resp.Map["mock"].TorrentsDir)
 	assert.Equal(t, "/downloads", resp.Map["mock"].DownloadDir)
 }
+
+func TestService_checkDownloader(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, router, _, _ := testSetup(t)
+		serv.downloaders["mock"].(*downloadersMock).mockCheckResult = &lifecycle.CheckResult{
+			Updated: []string{"hash-1", "hash-2"},
+			Moved:   []string{"hash-2"},
+		}
+
+		w := httptest.NewRecorder()
+
+		req := httptest.NewRequest("POST", "/downloaders/mock/check", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp checkDownloaderResp
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, checkDownloaderResp{
+			Updated:   []string{"hash-1", "hash-2"},
+			Completed: []string{},
+			Moved:     []string{"hash-2"},
+			Failed:    []string{},
+			Postponed: []string{},
+		}, resp)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			downloader   string
+			checkErr     error
+			expectedCode int
+			expectedMsg  string
+		}{
+			{
+				name:         "downloader not found",
+				downloader:   "nonexistent",
+				expectedCode: http.StatusNotFound,
+				expectedMsg:  "Downloader not found",
+			},
+			{
+				name:         "check running",
+				downloader:   "mock",
+				checkErr:     lifecycle.ErrCheckRunning,
+				expectedCode: http.StatusConflict,
+				expectedMsg:  "progress check is running",
+			},
+			{
+				name:         "check error",
+				downloader:   "mock",
+				checkErr:     fmt.Errorf("rpc error"),
+				expectedCode: http.StatusInternalServerError,
+				expectedMsg:  "rpc error",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				serv, router, _, _ := testSetup(t)
+				serv.downloaders["mock"].(*downloadersMock).mockCheckErr = tt.checkErr
+
+				w := httptest.NewRecorder()
+
+				req := httptest.NewRequest("POST", "/downloaders/"+tt.downloader+"/check", nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedCode, w.Code)
+
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedMsg, resp["error"])
+			})
+		}
+	})
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import (
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// SetupMetricsRouter serves /metrics for Prometheus, it requires the read
+// scope if auth is enabled.
+func (s *Service) SetupMetricsRouter(router gin.IRoutes) {
+	router.GET("/metrics", s.requireScope(ScopeRead), gin.WrapH(metrics.Handler()))
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, router, _, _ := testSetup(t)
+		serv.SetupMetricsRouter(router)
+		metrics.IndexerRequests.WithLabelValues("mock", "list").Inc()
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `autoget_indexer_requests_total{indexer="mock",op="list"}`)
+		assert.Contains(t, w.Body.String(), "go_goroutines")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		serv, router, _ := authTestSetup(t)
+		serv.SetupMetricsRouter(router)
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
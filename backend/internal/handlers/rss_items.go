@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRSSItemsPageSize = 50
+	maxRSSItemsPageSize     = 200
+)
+
+type rssItemResp struct {
+	Indexer   string `json:"indexer"`
+	ResID     string `json:"resId"`
+	Title     string `json:"title"`
+	Category  string `json:"category"`
+	URL       string `json:"url"`
+	Size      uint64 `json:"size"`
+	Seeders   uint32 `json:"seeders"`
+	FirstSeen int64  `json:"firstSeen"`
+	LastSeen  int64  `json:"lastSeen"`
+}
+
+func toRSSItemResp(item *db.RSSItem) *rssItemResp {
+	return &rssItemResp{
+		Indexer:   item.Indexer,
+		ResID:     item.ResID,
+		Title:     item.Title,
+		Category:  item.Category,
+		URL:       item.URL,
+		Size:      item.Size,
+		Seeders:   item.Seeders,
+		FirstSeen: item.CreatedAt.Unix(),
+		LastSeen:  item.UpdatedAt.Unix(),
+	}
+}
+
+type listRSSItemsReq struct {
+	Indexer  string `form:"indexer"`
+	Category string `form:"category"`
+	Keyword  string `form:"keyword"`
+	Page     uint32 `form:"page"`
+	PageSize uint32 `form:"pageSize"`
+}
+
+type listRSSItemsResp struct {
+	Pagination indexers.Pagination `json:"pagination"`
+	Items      []*rssItemResp      `json:"items"`
+}
+
+func (s *Service) listRSSItems(c *gin.Context) {
+	req := &listRSSItemsReq{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Indexer != "" {
+		if _, ok := s.indexers[req.Indexer]; !ok {
+			c.JSON(404, gin.H{"error": "Indexer not found"})
+			return
+		}
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = defaultRSSItemsPageSize
+	}
+	if req.PageSize > maxRSSItemsPageSize {
+		req.PageSize = maxRSSItemsPageSize
+	}
+
+	filter := &db.RSSItemFilter{
+		Indexer:  req.Indexer,
+		Category: req.Category,
+		Keyword:  req.Keyword,
+	}
+	items, total, err := db.ListRSSItems(s.db, filter, int(req.Page), int(req.PageSize))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := &listRSSItemsResp{
+		Pagination: indexers.Pagination{
+			Page:       req.Page,
+			PageSize:   req.PageSize,
+			Total:      uint32(total),
+			TotalPages: (uint32(total) + req.PageSize - 1) / req.PageSize,
+		},
+		Items: []*rssItemResp{},
+	}
+	for i := range items {
+		resp.Items = append(resp.Items, toRSSItemResp(&items[i]))
+	}
+
+	c.JSON(200, resp)
+}
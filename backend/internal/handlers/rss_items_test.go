@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func addRSSItems(t *testing.T, d *gorm.DB) {
+	t.Helper()
+
+	for _, item := range []*db.RSSItem{
+		{ResID: "1", Title: "One Piece 1000", Category: "Anime"},
+		{ResID: "2", Title: "Naruto 1", Category: "Anime"},
+		{ResID: "3", Title: "One Piece Film", Category: "Movie"},
+	} {
+		require.NoError(t, db.SaveRSSItems(d, "mock", []*db.RSSItem{item}))
+	}
+	require.NoError(t, db.SaveRSSItems(d, "other", []*db.RSSItem{
+		{ResID: "4", Title: "One Piece 1001", Category: "Anime"},
+	}))
+}
+
+func TestService_listRSSItems(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			query     string
+			wantIDs   []string
+			wantTotal uint32
+			wantPages uint32
+		}{
+			{
+				name:      "all",
+				query:     "",
+				wantIDs:   []string{"4", "3", "2", "1"},
+				wantTotal: 4,
+				wantPages: 1,
+			},
+			{
+				name:      "filters",
+				query:     "?indexer=mock&category=Anime&keyword=one%20piece",
+				wantIDs:   []string{"1"},
+				wantTotal: 1,
+				wantPages: 1,
+			},
+			{
+				name:      "pagination",
+				query:     "?page=2&pageSize=3",
+				wantIDs:   []string{"1"},
+				wantTotal: 4,
+				wantPages: 2,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, _, testDB := testSetup(t)
+				addRSSItems(t, testDB)
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/rss-items"+tt.query, nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				resp := &listRSSItemsResp{}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+
+				ids := []string{}
+				for _, item := range resp.Items {
+					ids = append(ids, item.ResID)
+				}
+				assert.Equal(t, tt.wantIDs, ids)
+				assert.Equal(t, tt.wantTotal, resp.Pagination.Total)
+				assert.Equal(t, tt.wantPages, resp.Pagination.TotalPages)
+			})
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, _, _ := testSetup(t)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/rss-items?indexer=nonexistent", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "Indexer not found", resp["error"])
+	})
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/indexers/rsshelper"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type searchResp struct {
+	ID      uint   `json:"id"`
+	Indexer string `json:"indexer"`
+	Text    string `json:"text"`
+	Action  string `json:"action"`
+
+	IncludeRegexes []string `json:"includeRegexes,omitempty"`
+	ExcludeTerms   []string `json:"excludeTerms,omitempty"`
+	CategoryFilter string   `json:"categoryFilter,omitempty"`
+	MinSize        uint64   `json:"minSize,omitempty"`
+	MaxSize        uint64   `json:"maxSize,omitempty"`
+	Resolutions    []string `json:"resolutions,omitempty"`
+
+	ResID     string `json:"resId,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Category  string `json:"category,omitempty"`
+	URL       string `json:"url,omitempty"`
+	CreatedAt int64  `json:"createdAt"` // in unix timestamp
+	UpdatedAt int64  `json:"updatedAt"` // in unix timestamp
+}
+
+// registerSearchResp of a registered search, Download is set if the backfill
+// started the download of a download search, which is not added then.
+type registerSearchResp struct {
+	Search   *searchResp         `json:"search"`
+	Download *downloadStatusResp `json:"download,omitempty"`
+}
+
+func toSearchResp(search *db.RSSSearch) *searchResp {
+	return &searchResp{
+		ID:      search.ID,
+		Indexer: search.Indexer,
+		Text:    search.Text,
+		Action:  search.Action,
+
+		IncludeRegexes: search.IncludeRegexes,
+		ExcludeTerms:   search.ExcludeTerms,
+		CategoryFilter: search.CategoryFilter,
+		MinSize:        search.MinSize,
+		MaxSize:        search.MaxSize,
+		Resolutions:    search.Resolutions,
+
+		ResID:     search.ResID,
+		Title:     search.Title,
+		Category:  search.Category,
+		URL:       search.URL,
+		CreatedAt: search.CreatedAt.Unix(),
+		UpdatedAt: search.UpdatedAt.Unix(),
+	}
+}
+
+func toSearchesResp(searches []*db.RSSSearch) []*searchResp {
+	resp := []*searchResp{}
+	for _, search := range searches {
+		resp = append(resp, toSearchResp(search))
+	}
+	return resp
+}
+
+func (s *Service) listSearches(c *gin.Context) {
+	searches, err := db.GetAllSearchs(s.db)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, toSearchesResp(searches))
+}
+
+func (s *Service) indexerListSearches(c *gin.Context) {
+	indexerName := c.Param("indexer")
+	if _, ok := s.indexers[indexerName]; !ok {
+		c.JSON(404, gin.H{"error": "Indexer not found"})
+		return
+	}
+
+	searches, err := db.GetSearchsByIndexer(s.db, indexerName)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, toSearchesResp(searches))
+}
+
+type indexerRegisterSearchReq struct {
+	Text   string `json:"text" binding:"required"`
+	Action string `json:"action" binding:"required"`
+
+	// constraints, see db.RSSSearch
+	IncludeRegexes []string `json:"includeRegexes"`
+	ExcludeTerms   []string `json:"excludeTerms"`
+	CategoryFilter string   `json:"categoryFilter"`
+	MinSize        uint64   `json:"minSize"`
+	MaxSize        uint64   `json:"maxSize"`
+	Resolutions    []string `json:"resolutions"`
+
+	// BackfillDays matches the RSS history of the days on create.
+	BackfillDays uint `json:"backfillDays"`
+}
+
+func (req *indexerRegisterSearchReq) applyTo(search *db.RSSSearch) {
+	search.Text = req.Text
+	search.Action = req.Action
+	search.IncludeRegexes = req.IncludeRegexes
+	search.ExcludeTerms = req.ExcludeTerms
+	search.CategoryFilter = req.CategoryFilter
+	search.MinSize = req.MinSize
+	search.MaxSize = req.MaxSize
+	search.Resolutions = req.Resolutions
+}
+
+// bindSearchReq writes the error response if the request is invalid.
+func bindSearchReq(c *gin.Context) (*indexerRegisterSearchReq, bool) {
+	req := &indexerRegisterSearchReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if req.Action != indexers.ActionDownload &&
+		req.Action != indexers.ActionNotification {
+		c.JSON(400, gin.H{"error": "Invalid action"})
+		return nil, false
+	}
+
+	if err := rsshelper.ValidateConstraints(&db.RSSSearch{
+		IncludeRegexes: req.IncludeRegexes,
+		MinSize:        req.MinSize,
+		MaxSize:        req.MaxSize,
+		Resolutions:    req.Resolutions,
+	}); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return req, true
+}
+
+func (s *Service) indexerRegisterSearch(c *gin.Context) {
+	indexerName := c.Param("indexer")
+	indexer, ok := s.indexers[indexerName]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Indexer not found"})
+		return
+	}
+
+	req, ok := bindSearchReq(c)
+	if !ok {
+		return
+	}
+
+	search := &db.RSSSearch{Indexer: indexerName}
+	req.applyTo(search)
+
+	// the backfill runs before the search is added, a matched download search
+	// is not added at all.
+	var item *indexers.RSSItem
+	if req.BackfillDays > 0 {
+		since := time.Now().AddDate(0, 0, -int(req.BackfillDays))
+		var err error
+		item, err = rsshelper.MatchHistory(s.db, search, since)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if item == nil {
+		if err := db.AddSearch(s.db, search); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, &registerSearchResp{Search: toSearchResp(search)})
+		return
+	}
+
+	if search.Action == indexers.ActionDownload {
+		status, herr := s.startDownload(indexer, item.ResID, nil)
+		if herr != nil {
+			c.JSON(herr.Code, gin.H{"error": herr.Message})
+			return
+		}
+		c.JSON(200, &registerSearchResp{Search: toSearchResp(search), Download: toDownloadStatusResp(status)})
+		return
+	}
+
+	if err := rsshelper.AddMatchedSearch(s.db, search, item); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	rsshelper.NotifyPending(s.notifier, indexerName, []*db.RSSSearch{search})
+
+	c.JSON(200, &registerSearchResp{Search: toSearchResp(search)})
+}
+
+// getIndexerSearch writes the error response if the indexer or the search is not found.
+func (s *Service) getIndexerSearch(c *gin.Context) (*db.RSSSearch, bool) {
+	indexerName := c.Param("indexer")
+	if _, ok := s.indexers[indexerName]; !ok {
+		c.JSON(404, gin.H{"error": "Indexer not found"})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid search id"})
+		return nil, false
+	}
+
+	search, err := db.GetSearch(s.db, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && search.Indexer != indexerName) {
+		c.JSON(404, gin.H{"error": "Search not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return search, true
+}
+
+func (s *Service) indexerUpdateSearch(c *gin.Context) {
+	search, ok := s.getIndexerSearch(c)
+	if !ok {
+		return
+	}
+
+	req, ok := bindSearchReq(c)
+	if !ok {
+		return
+	}
+
+	// a changed text looks for a different resource.
+	if !strings.EqualFold(search.Text, req.Text) {
+		search.Rearm()
+	}
+	req.applyTo(search)
+
+	if err := db.UpdateSearch(s.db, search); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, toSearchResp(search))
+}
+
+func (s *Service) indexerDeleteSearch(c *gin.Context) {
+	search, ok := s.getIndexerSearch(c)
+	if !ok {
+		return
+	}
+
+	if err := db.DeleteSearch(s.db, search.ID); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "deleted"})
+}
+
+func (s *Service) indexerRearmSearch(c *gin.Context) {
+	search, ok := s.getIndexerSearch(c)
+	if !ok {
+		return
+	}
+
+	search.Rearm()
+	if err := db.UpdateSearch(s.db, search); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, toSearchResp(search))
+}
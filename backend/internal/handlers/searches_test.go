@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func addSearches(t *testing.T, d *gorm.DB) (*db.RSSSearch, *db.RSSSearch) {
+	t.Helper()
+
+	found := &db.RSSSearch{
+		Indexer:  "mock",
+		Text:     "found",
+		Action:   "notification",
+		ResID:    "1",
+		Title:    "Found",
+		Category: "Anime",
+		URL:      "http://test.com/1",
+	}
+	require.NoError(t, db.AddSearch(d, found))
+
+	other := &db.RSSSearch{Indexer: "other", Text: "other", Action: "download"}
+	require.NoError(t, db.AddSearch(d, other))
+
+	return found, other
+}
+
+func TestService_listSearches(t *testing.T) {
+	_, router, _, testDB := testSetup(t)
+	addSearches(t, testDB)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/searches", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	resp := []*searchResp{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp, 2)
+	assert.Equal(t, "mock", resp[0].Indexer)
+	assert.Equal(t, "1", resp[0].ResID)
+	assert.Equal(t, "Anime", resp[0].Category)
+	assert.Equal(t, "other", resp[1].Indexer)
+}
+
+func TestService_indexerListSearches(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		addSearches(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/indexers/mock/searches", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := []*searchResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp, 1)
+		assert.Equal(t, "found", resp[0].Text)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, _, _ := testSetup(t)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/indexers/nonexistent/searches", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestService_indexerUpdateSearch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			reqBody   string
+			wantText  string
+			wantResID string
+		}{
+			{
+				name:      "change action",
+				reqBody:   `{"text": "Found", "action": "download"}`,
+				wantText:  "found",
+				wantResID: "1",
+			},
+			{
+				name:      "change text rearms",
+				reqBody:   `{"text": "Fixed Typo", "action": "notification"}`,
+				wantText:  "fixed typo",
+				wantResID: "",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, _, testDB := testSetup(t)
+				found, _ := addSearches(t, testDB)
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("PUT", fmt.Sprintf("/indexers/mock/searches/%d", found.ID), strings.NewReader(tt.reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				got, err := db.GetSearch(testDB, found.ID)
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantText, got.Text)
+				assert.Equal(t, tt.wantResID, got.ResID)
+			})
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			path         func(found, other *db.RSSSearch) string
+			reqBody      string
+			expectedCode int
+			expectedMsg  string
+		}{
+			{
+				name: "indexer not found",
+				path: func(found, other *db.RSSSearch) string {
+					return fmt.Sprintf("/indexers/nonexistent/searches/%d", found.ID)
+				},
+				reqBody:      `{"text": "test", "action": "download"}`,
+				expectedCode: http.StatusNotFound,
+				expectedMsg:  "Indexer not found",
+			},
+			{
+				name:         "invalid id",
+				path:         func(found, other *db.RSSSearch) string { return "/indexers/mock/searches/abc" },
+				reqBody:      `{"text": "test", "action": "download"}`,
+				expectedCode: http.StatusBadRequest,
+				expectedMsg:  "Invalid search id",
+			},
+			{
+				name:         "search not found",
+				path:         func(found, other *db.RSSSearch) string { return "/indexers/mock/searches/999" },
+				reqBody:      `{"text": "test", "action": "download"}`,
+				expectedCode: http.StatusNotFound,
+				expectedMsg:  "Search not found",
+			},
+			{
+				name:         "search of other indexer",
+				path:         func(found, other *db.RSSSearch) string { return fmt.Sprintf("/indexers/mock/searches/%d", other.ID) },
+				reqBody:      `{"text": "test", "action": "download"}`,
+				expectedCode: http.StatusNotFound,
+				expectedMsg:  "Search not found",
+			},
+			{
+				name:         "invalid action",
+				path:         func(found, other *db.RSSSearch) string { return fmt.Sprintf("/indexers/mock/searches/%d", found.ID) },
+				reqBody:      `{"text": "test", "action": "invalid"}`,
+				expectedCode: http.StatusBadRequest,
+				expectedMsg:  "Invalid action",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, _, testDB := testSetup(t)
+				found, other := addSearches(t, testDB)
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("PUT", tt.path(found, other), strings.NewReader(tt.reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedCode, w.Code)
+
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedMsg, resp["error"])
+			})
+		}
+	})
+}
+
+func TestService_indexerDeleteSearch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		found, _ := addSearches(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/indexers/mock/searches/%d", found.ID), nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		_, err := db.GetSearch(testDB, found.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		_, other := addSearches(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/indexers/mock/searches/%d", other.ID), nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		_, err := db.GetSearch(testDB, other.ID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestService_indexerRearmSearch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		found, _ := addSearches(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", fmt.Sprintf("/indexers/mock/searches/%d/rearm", found.ID), nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		got, err := db.GetSearch(testDB, found.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "found", got.Text)
+		assert.Empty(t, got.ResID)
+		assert.Empty(t, got.URL)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, _, _ := testSetup(t)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/indexers/mock/searches/999/rearm", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestService_indexerRegisterSearchConstraints(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+
+		w := httptest.NewRecorder()
+		reqBody := `{
+			"text": "One Piece",
+			"action": "download",
+			"includeRegexes": ["^\\[SubsPlease\\]"],
+			"excludeTerms": ["Batch"],
+			"categoryFilter": "Anime",
+			"minSize": 100,
+			"maxSize": 200,
+			"resolutions": ["1080p"]
+		}`
+		req := httptest.NewRequest("POST", "/indexers/mock/searches", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &registerSearchResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+
+		got, err := db.GetSearch(testDB, resp.Search.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "one piece", got.Text)
+		assert.Equal(t, []string{`^\[SubsPlease\]`}, got.IncludeRegexes)
+		assert.Equal(t, []string{"batch"}, got.ExcludeTerms)
+		assert.Equal(t, "Anime", got.CategoryFilter)
+		assert.Equal(t, uint64(100), got.MinSize)
+		assert.Equal(t, uint64(200), got.MaxSize)
+		assert.Equal(t, []string{"1080p"}, got.Resolutions)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			reqBody     string
+			expectedMsg string
+		}{
+			{
+				name:        "invalid regex",
+				reqBody:     `{"text": "test", "action": "download", "includeRegexes": ["("]}`,
+				expectedMsg: "missing closing )",
+			},
+			{
+				name:        "invalid size range",
+				reqBody:     `{"text": "test", "action": "download", "minSize": 2, "maxSize": 1}`,
+				expectedMsg: "min size is larger than max size",
+			},
+			{
+				name:        "invalid resolution",
+				reqBody:     `{"text": "test", "action": "download", "resolutions": ["1440p"]}`,
+				expectedMsg: "invalid resolution: 1440p",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, _, _ := testSetup(t)
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "/indexers/mock/searches", strings.NewReader(tt.reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Contains(t, resp["error"], tt.expectedMsg)
+			})
+		}
+	})
+}
+
+type fakeApprover struct {
+	messages []string
+	pendings []*notify.PendingDownload
+}
+
+func (f *fakeApprover) SendMessage(msg string) error {
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func (f *fakeApprover) SendMarkdownMessage(msg string) error {
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func (f *fakeApprover) SendPendingDownload(p *notify.PendingDownload) error {
+	f.pendings = append(f.pendings, p)
+	return nil
+}
+
+func TestService_indexerRegisterSearchBackfill(t *testing.T) {
+	addHistory := func(t *testing.T, d *gorm.DB) {
+		t.Helper()
+		require.NoError(t, db.SaveRSSItems(d, "mock", []*db.RSSItem{
+			{ResID: "res-1", Title: "One Piece 1000", Category: "Anime", URL: "http://test.com/1"},
+		}))
+	}
+
+	register := func(t *testing.T, router http.Handler, reqBody string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/indexers/mock/searches", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("success - notification action", func(t *testing.T) {
+		serv, router, _, testDB := testSetup(t)
+		approver := &fakeApprover{}
+		serv.SetNotifier(approver)
+		addHistory(t, testDB)
+
+		w := register(t, router, `{"text": "One Piece", "action": "notification", "backfillDays": 7}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &registerSearchResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		assert.Equal(t, "res-1", resp.Search.ResID)
+
+		got, err := db.GetSearch(testDB, resp.Search.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "One Piece 1000", got.Title)
+
+		// asked to approve like the RSS searches.
+		require.Len(t, approver.messages, 1)
+		assert.Contains(t, approver.messages[0], "One Piece 1000")
+		assert.Equal(t, []*notify.PendingDownload{
+			{SearchID: resp.Search.ID, Indexer: "mock", Title: "One Piece 1000", URL: "http://test.com/1"},
+		}, approver.pendings)
+	})
+
+	t.Run("success - download action", func(t *testing.T) {
+		serv, router, m, testDB := testSetup(t)
+		dl := serv.downloaders["mock"].(*downloadersMock)
+		addHistory(t, testDB)
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{ID: "res-1", Title: "One Piece 1000"},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{
+			TorrentFilePath: "/torrents/res-1.torrent",
+			TorrentHash:     "hash-1",
+		}
+
+		w := register(t, router, `{"text": "One Piece", "action": "download", "backfillDays": 7}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// the download is returned, the search is not added.
+		resp := &registerSearchResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		assert.Zero(t, resp.Search.ID)
+		assert.Equal(t, "one piece", resp.Search.Text)
+		require.NotNil(t, resp.Download)
+		assert.Equal(t, "hash-1", resp.Download.Hash)
+		assert.Equal(t, "started", resp.Download.State)
+		assert.Equal(t, "One Piece 1000", resp.Download.ResTitle)
+
+		require.Len(t, dl.added, 1)
+		var searches []db.RSSSearch
+		require.NoError(t, testDB.Unscoped().Find(&searches).Error)
+		assert.Empty(t, searches)
+	})
+
+	t.Run("success - no match", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		addHistory(t, testDB)
+
+		w := register(t, router, `{"text": "Naruto", "action": "download", "backfillDays": 7}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &registerSearchResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		assert.Empty(t, resp.Search.ResID)
+		assert.Nil(t, resp.Download)
+	})
+
+	t.Run("success - no backfill", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		addHistory(t, testDB)
+
+		w := register(t, router, `{"text": "One Piece", "action": "notification"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &registerSearchResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		assert.Empty(t, resp.Search.ResID)
+		assert.Nil(t, resp.Download)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, m, testDB := testSetup(t)
+		addHistory(t, testDB)
+		m.mockDetailResult = &indexers.ResourceDetail{}
+		m.mockDownloadErr = errors.NewHTTPStatusError(http.StatusInternalServerError, "mock download error")
+
+		w := register(t, router, `{"text": "One Piece", "action": "download", "backfillDays": 7}`)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "mock download error", resp["error"])
+
+		// nothing is added, the request can be retried.
+		var searches []db.RSSSearch
+		require.NoError(t, testDB.Unscoped().Find(&searches).Error)
+		assert.Empty(t, searches)
+	})
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charleshuang3/autoget/backend/indexers/rsshelper"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type subscriptionEpisodeResp struct {
+	Episode     int    `json:"episode"`
+	ResID       string `json:"resId"`
+	Title       string `json:"title"`
+	TorrentHash string `json:"torrentHash,omitempty"`
+	CreatedAt   int64  `json:"createdAt"` // in unix timestamp
+}
+
+type subscriptionResp struct {
+	ID           uint                       `json:"id"`
+	Indexer      string                     `json:"indexer"`
+	Show         string                     `json:"show"`
+	ReleaseGroup string                     `json:"releaseGroup,omitempty"`
+	Resolutions  []string                   `json:"resolutions,omitempty"`
+	Episodes     []*subscriptionEpisodeResp `json:"episodes"`
+	CreatedAt    int64                      `json:"createdAt"` // in unix timestamp
+	UpdatedAt    int64                      `json:"updatedAt"` // in unix timestamp
+}
+
+func toSubscriptionResp(sub *db.Subscription) *subscriptionResp {
+	resp := &subscriptionResp{
+		ID:           sub.ID,
+		Indexer:      sub.Indexer,
+		Show:         sub.Show,
+		ReleaseGroup: sub.ReleaseGroup,
+		Resolutions:  sub.Resolutions,
+		Episodes:     []*subscriptionEpisodeResp{},
+		CreatedAt:    sub.CreatedAt.Unix(),
+		UpdatedAt:    sub.UpdatedAt.Unix(),
+	}
+	for _, ep := range sub.Episodes {
+		resp.Episodes = append(resp.Episodes, &subscriptionEpisodeResp{
+			Episode:     ep.Episode,
+			ResID:       ep.ResID,
+			Title:       ep.Title,
+			TorrentHash: ep.TorrentHash,
+			CreatedAt:   ep.CreatedAt.Unix(),
+		})
+	}
+	return resp
+}
+
+func toSubscriptionsResp(subs []*db.Subscription) []*subscriptionResp {
+	resp := []*subscriptionResp{}
+	for _, sub := range subs {
+		resp = append(resp, toSubscriptionResp(sub))
+	}
+	return resp
+}
+
+func (s *Service) listSubscriptions(c *gin.Context) {
+	subs, err := db.GetAllSubscriptions(s.db)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, toSubscriptionsResp(subs))
+}
+
+func (s *Service) indexerListSubscriptions(c *gin.Context) {
+	indexerName := c.Param("indexer")
+	if _, ok := s.indexers[indexerName]; !ok {
+		c.JSON(404, gin.H{"error": "Indexer not found"})
+		return
+	}
+
+	subs, err := db.GetSubscriptionsByIndexer(s.db, indexerName)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, toSubscriptionsResp(subs))
+}
+
+type indexerSubscribeReq struct {
+	Show         string   `json:"show" binding:"required"`
+	ReleaseGroup string   `json:"releaseGroup"`
+	Resolutions  []string `json:"resolutions"`
+}
+
+func (s *Service) indexerSubscribe(c *gin.Context) {
+	indexerName := c.Param("indexer")
+	if _, ok := s.indexers[indexerName]; !ok {
+		c.JSON(404, gin.H{"error": "Indexer not found"})
+		return
+	}
+
+	req := &indexerSubscribeReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	show := strings.TrimSpace(req.Show)
+	if show == "" {
+		c.JSON(400, gin.H{"error": "Invalid show"})
+		return
+	}
+
+	if err := rsshelper.ValidateConstraints(&db.RSSSearch{Resolutions: req.Resolutions}); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub := &db.Subscription{
+		Indexer:      indexerName,
+		Show:         show,
+		ReleaseGroup: strings.TrimSpace(req.ReleaseGroup),
+		Resolutions:  slices.Clone(req.Resolutions),
+	}
+	if err := db.AddSubscription(s.db, sub); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, toSubscriptionResp(sub))
+}
+
+// getIndexerSubscription writes the error response if the indexer or the subscription is not found.
+func (s *Service) getIndexerSubscription(c *gin.Context) (*db.Subscription, bool) {
+	indexerName := c.Param("indexer")
+	if _, ok := s.indexers[indexerName]; !ok {
+		c.JSON(404, gin.H{"error": "Indexer not found"})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid subscription id"})
+		return nil, false
+	}
+
+	sub, err := db.GetSubscription(s.db, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && sub.Indexer != indexerName) {
+		c.JSON(404, gin.H{"error": "Subscription not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return sub, true
+}
+
+func (s *Service) indexerSubscriptionDetail(c *gin.Context) {
+	sub, ok := s.getIndexerSubscription(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, toSubscriptionResp(sub))
+}
+
+func (s *Service) indexerUnsubscribe(c *gin.Context) {
+	sub, ok := s.getIndexerSubscription(c)
+	if !ok {
+		return
+	}
+
+	if err := db.DeleteSubscription(s.db, sub.ID); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "deleted"})
+}
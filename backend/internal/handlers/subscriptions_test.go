@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func addSubscriptions(t *testing.T, d *gorm.DB) (*db.Subscription, *db.Subscription) {
+	t.Helper()
+
+	found := &db.Subscription{Indexer: "mock", Show: "Show", ReleaseGroup: "SubsPlease"}
+	require.NoError(t, db.AddSubscription(d, found))
+	require.NoError(t, db.AddSubscriptionEpisode(d, &db.SubscriptionEpisode{
+		SubscriptionID: found.ID,
+		Episode:        1,
+		ResID:          "1",
+		Title:          "[SubsPlease] Show - 01 (1080p)",
+	}))
+
+	other := &db.Subscription{Indexer: "other", Show: "Other"}
+	require.NoError(t, db.AddSubscription(d, other))
+
+	return found, other
+}
+
+func TestService_listSubscriptions(t *testing.T) {
+	_, router, _, testDB := testSetup(t)
+	addSubscriptions(t, testDB)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/subscriptions", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	resp := []*subscriptionResp{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp, 2)
+	assert.Equal(t, "mock", resp[0].Indexer)
+	require.Len(t, resp[0].Episodes, 1)
+	assert.Equal(t, 1, resp[0].Episodes[0].Episode)
+	assert.Equal(t, "other", resp[1].Indexer)
+	assert.Empty(t, resp[1].Episodes)
+}
+
+func TestService_indexerListSubscriptions(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		addSubscriptions(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/indexers/mock/subscriptions", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := []*subscriptionResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp, 1)
+		assert.Equal(t, "Show", resp[0].Show)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, _, _ := testSetup(t)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/indexers/nonexistent/subscriptions", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestService_indexerSubscribe(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+
+		w := httptest.NewRecorder()
+		reqBody := `{"show": " Show ", "releaseGroup": "SubsPlease", "resolutions": ["1080p"]}`
+		req := httptest.NewRequest("POST", "/indexers/mock/subscriptions", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &subscriptionResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+
+		got, err := db.GetSubscription(testDB, resp.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "mock", got.Indexer)
+		assert.Equal(t, "Show", got.Show)
+		assert.Equal(t, "SubsPlease", got.ReleaseGroup)
+		assert.Equal(t, []string{"1080p"}, got.Resolutions)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			indexer      string
+			reqBody      string
+			expectedCode int
+			expectedMsg  string
+		}{
+			{
+				name:         "indexer not found",
+				indexer:      "nonexistent",
+				reqBody:      `{"show": "Show"}`,
+				expectedCode: http.StatusNotFound,
+				expectedMsg:  "Indexer not found",
+			},
+			{
+				name:         "blank show",
+				indexer:      "mock",
+				reqBody:      `{"show": "  "}`,
+				expectedCode: http.StatusBadRequest,
+				expectedMsg:  "Invalid show",
+			},
+			{
+				name:         "invalid resolution",
+				indexer:      "mock",
+				reqBody:      `{"show": "Show", "resolutions": ["999p"]}`,
+				expectedCode: http.StatusBadRequest,
+				expectedMsg:  "invalid resolution: 999p",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, _, _ := testSetup(t)
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", fmt.Sprintf("/indexers/%s/subscriptions", tt.indexer), strings.NewReader(tt.reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedCode, w.Code)
+
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedMsg, resp["error"])
+			})
+		}
+	})
+}
+
+func TestService_indexerSubscriptionDetail(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		found, _ := addSubscriptions(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/indexers/mock/subscriptions/%d", found.ID), nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &subscriptionResp{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), resp))
+		require.Len(t, resp.Episodes, 1)
+		assert.Equal(t, "[SubsPlease] Show - 01 (1080p)", resp.Episodes[0].Title)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		_, other := addSubscriptions(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/indexers/mock/subscriptions/%d", other.ID), nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestService_indexerUnsubscribe(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+		found, _ := addSubscriptions(t, testDB)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/indexers/mock/subscriptions/%d", found.ID), nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		_, err := db.GetSubscription(testDB, found.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, router, _, _ := testSetup(t)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("DELETE", "/indexers/mock/subscriptions/abc", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// Torznab spec: https://torznab.github.io/spec-1.3-draft/torznab/Specification-v1.3.html
+
+const (
+	torznabNamespace = "http://torznab.com/schemas/2015/feed"
+
+	// Torznab reserves ids from 100000 for site specific categories.
+	torznabCustomCategoryBase = 100000
+
+	defaultTorznabLimit = 50
+	maxTorznabLimit     = 100
+)
+
+// Torznab error codes.
+const (
+	torznabErrIncorrectCredentials = 100
+	torznabErrMissingParameter     = 200
+	torznabErrIncorrectParameter   = 201
+	torznabErrNoSuchFunction       = 202
+	torznabErrUnknown              = 900
+)
+
+var imdbIDRe = regexp.MustCompile(`tt(\d+)`)
+
+type torznabError struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        int      `xml:"code,attr"`
+	Description string   `xml:"description,attr"`
+}
+
+type torznabCaps struct {
+	XMLName    xml.Name              `xml:"caps"`
+	Server     torznabServer         `xml:"server"`
+	Limits     torznabLimits         `xml:"limits"`
+	Searching  torznabSearching      `xml:"searching"`
+	Categories []torznabCapsCategory `xml:"categories>category"`
+}
+
+type torznabServer struct {
+	Title string `xml:"title,attr"`
+}
+
+type torznabLimits struct {
+	Max     int `xml:"max,attr"`
+	Default int `xml:"default,attr"`
+}
+
+type torznabSearching struct {
+	Search      torznabSearchCap `xml:"search"`
+	TVSearch    torznabSearchCap `xml:"tv-search"`
+	MovieSearch torznabSearchCap `xml:"movie-search"`
+}
+
+type torznabSearchCap struct {
+	Available       string `xml:"available,attr"`
+	SupportedParams string `xml:"supportedParams,attr"`
+}
+
+type torznabCapsCategory struct {
+	ID      int                   `xml:"id,attr"`
+	Name    string                `xml:"name,attr"`
+	Subcats []torznabCapsCategory `xml:"subcat,omitempty"`
+}
+
+type torznabFeed struct {
+	XMLName      xml.Name       `xml:"rss"`
+	Version      string         `xml:"version,attr"`
+	XMLNSTorznab string         `xml:"xmlns:torznab,attr"`
+	Channel      torznabChannel `xml:"channel"`
+}
+
+type torznabChannel struct {
+	Title    string          `xml:"title"`
+	Response torznabResponse `xml:"torznab:response"`
+	Items    []torznabItem   `xml:"item"`
+}
+
+type torznabResponse struct {
+	Offset int `xml:"offset,attr"`
+	Total  int `xml:"total,attr"`
+}
+
+type torznabItem struct {
+	Title      string           `xml:"title"`
+	GUID       string           `xml:"guid"`
+	Link       string           `xml:"link"`
+	PubDate    string           `xml:"pubDate,omitempty"`
+	Size       uint64           `xml:"size"`
+	Categories []int            `xml:"category"`
+	Enclosure  torznabEnclosure `xml:"enclosure"`
+	Attrs      []torznabAttr    `xml:"torznab:attr"`
+}
+
+type torznabEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length uint64 `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type torznabAttr struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func torznabXML(c *gin.Context, code int, v any) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(code, "application/xml; charset=utf-8", append([]byte(xml.Header), b...))
+}
+
+func torznabFail(c *gin.Context, httpCode int, code int, description string) {
+	torznabXML(c, httpCode, &torznabError{Code: code, Description: description})
+}
+
+// torznabIndexer writes the error response if torznab is disabled, the api key
+// is wrong or the indexer is not found.
+func (s *Service) torznabIndexer(c *gin.Context) (indexers.IIndexer, bool) {
+	if s.config == nil || s.config.Torznab == nil {
+		torznabFail(c, http.StatusNotFound, torznabErrNoSuchFunction, "Torznab is disabled")
+		return nil, false
+	}
+
+	if !secretEqual(c.Query("apikey"), s.config.Torznab.APIKey) {
+		torznabFail(c, http.StatusUnauthorized, torznabErrIncorrectCredentials, "Incorrect user credentials")
+		return nil, false
+	}
+
+	indexer, ok := s.indexers[c.Param("indexer")]
+	if !ok {
+		torznabFail(c, http.StatusNotFound, torznabErrIncorrectParameter, "Indexer not found")
+		return nil, false
+	}
+
+	return indexer, true
+}
+
+// torznabCategories maps indexer categories to torznab ids. The top level
+// categories become torznab categories, all their descendants are subcats.
+type torznabCategories struct {
+	caps   []torznabCapsCategory
+	toID   map[string]int // by indexer category name
+	fromID map[int]string // to indexer category id
+}
+
+func newTorznabCategories(cats []indexers.Category) *torznabCategories {
+	tc := &torznabCategories{
+		toID:   map[string]int{},
+		fromID: map[int]string{},
+	}
+
+	next := torznabCustomCategoryBase
+	add := func(cat *indexers.Category) torznabCapsCategory {
+		next++
+		if _, ok := tc.toID[cat.Name]; !ok {
+			tc.toID[cat.Name] = next
+		}
+		tc.fromID[next] = cat.ID
+		return torznabCapsCategory{ID: next, Name: cat.Name}
+	}
+
+	var addSubcats func(parent *torznabCapsCategory, cats []indexers.Category)
+	addSubcats = func(parent *torznabCapsCategory, cats []indexers.Category) {
+		for i := range cats {
+			parent.Subcats = append(parent.Subcats, add(&cats[i]))
+			addSubcats(parent, cats[i].SubCategories)
+		}
+	}
+
+	for i := range cats {
+		top := add(&cats[i])
+		addSubcats(&top, cats[i].SubCategories)
+		tc.caps = append(tc.caps, top)
+	}
+
+	return tc
+}
+
+func (s *Service) torznabAPI(c *gin.Context) {
+	indexer, ok := s.torznabIndexer(c)
+	if !ok {
+		return
+	}
+
+	cats, herr := indexer.Categories()
+	if herr != nil {
+		torznabFail(c, herr.Code, torznabErrUnknown, herr.Message)
+		return
+	}
+	tc := newTorznabCategories(cats)
+
+	switch c.Query("t") {
+	case "caps":
+		torznabXML(c, http.StatusOK, &torznabCaps{
+			Server: torznabServer{Title: "AutoGet " + indexer.Name()},
+			Limits: torznabLimits{Max: maxTorznabLimit, Default: defaultTorznabLimit},
+			Searching: torznabSearching{
+				Search:      torznabSearchCap{Available: "yes", SupportedParams: "q"},
+				TVSearch:    torznabSearchCap{Available: "yes", SupportedParams: "q,season,ep"},
+				MovieSearch: torznabSearchCap{Available: "yes", SupportedParams: "q"},
+			},
+			Categories: tc.caps,
+		})
+	case "search", "tvsearch", "movie":
+		s.torznabSearch(c, indexer, tc)
+	case "":
+		torznabFail(c, http.StatusBadRequest, torznabErrMissingParameter, "Missing parameter (t)")
+	default:
+		torznabFail(c, http.StatusBadRequest, torznabErrNoSuchFunction, "No such function")
+	}
+}
+
+type torznabSearchReq struct {
+	Query  string `form:"q"`
+	Cat    string `form:"cat"`
+	Season string `form:"season"`
+	Ep     string `form:"ep"`
+	Offset uint32 `form:"offset"`
+	Limit  uint32 `form:"limit"`
+}
+
+// keyword appends the season and episode of tv search as SxxEyy.
+func (req *torznabSearchReq) keyword() string {
+	keyword := strings.TrimSpace(req.Query)
+	season, serr := strconv.Atoi(req.Season)
+	ep, eerr := strconv.Atoi(req.Ep)
+	switch {
+	case serr == nil && eerr == nil:
+		keyword += fmt.Sprintf(" S%02dE%02d", season, ep)
+	case serr == nil:
+		keyword += fmt.Sprintf(" S%02d", season)
+	}
+	return strings.TrimSpace(keyword)
+}
+
+func (s *Service) torznabSearch(c *gin.Context, indexer indexers.IIndexer, tc *torznabCategories) {
+	req := &torznabSearchReq{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		torznabFail(c, http.StatusBadRequest, torznabErrIncorrectParameter, err.Error())
+		return
+	}
+
+	if req.Limit == 0 {
+		req.Limit = defaultTorznabLimit
+	}
+	if req.Limit > maxTorznabLimit {
+		req.Limit = maxTorznabLimit
+	}
+
+	// indexers list one category, use the first known one.
+	category := ""
+	for _, id := range strings.Split(req.Cat, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			continue
+		}
+		if cat, ok := tc.fromID[n]; ok {
+			category = cat
+			break
+		}
+	}
+
+	total, resources, herr := torznabList(indexer, &indexers.ListRequest{
+		Category: category,
+		Keyword:  req.keyword(),
+	}, req.Offset, req.Limit)
+	if herr != nil {
+		torznabFail(c, herr.Code, torznabErrUnknown, herr.Message)
+		return
+	}
+
+	base := torznabBaseURL(c)
+	apikey := url.Values{"apikey": {c.Query("apikey")}}.Encode()
+
+	feed := &torznabFeed{
+		Version:      "2.0",
+		XMLNSTorznab: torznabNamespace,
+		Channel: torznabChannel{
+			Title: "AutoGet " + indexer.Name(),
+			Response: torznabResponse{
+				Offset: int(req.Offset),
+				Total:  int(total),
+			},
+			Items: []torznabItem{},
+		},
+	}
+	for i := range resources {
+		feed.Channel.Items = append(feed.Channel.Items, toTorznabItem(&resources[i], tc, base, apikey))
+	}
+
+	torznabXML(c, http.StatusOK, feed)
+}
+
+// torznabList lists limit resources from offset. Indexers list by page, a
+// misaligned offset takes the tail of the page containing it and the head of
+// the next page.
+func torznabList(indexer indexers.IIndexer, req *indexers.ListRequest, offset, limit uint32) (uint32, []indexers.ListResourceItem, *errors.HTTPStatusError) {
+	req.Page = offset/limit + 1
+	req.PageSize = limit
+	result, herr := indexer.List(req)
+	if herr != nil {
+		return 0, nil, herr
+	}
+
+	skip := int(offset % limit)
+	resources := append([]indexers.ListResourceItem{}, result.Resources[min(skip, len(result.Resources)):]...)
+	if skip > 0 && req.Page < result.Pagination.TotalPages {
+		next := *req
+		next.Page++
+		more, herr := indexer.List(&next)
+		if herr != nil {
+			return 0, nil, herr
+		}
+		resources = append(resources, more.Resources[:min(skip, len(more.Resources))]...)
+	}
+
+	return result.Pagination.Total, resources, nil
+}
+
+// torznabBaseURL is the absolute url of /torznab/:indexer of the request.
+func torznabBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	path := strings.TrimSuffix(c.Request.URL.Path, "/api")
+	return scheme + "://" + c.Request.Host + path
+}
+
+// toTorznabItem links the download with the api key of the request, torznab
+// clients fetch the link as it is. The key only grants the torznab API.
+func toTorznabItem(res *indexers.ListResourceItem, tc *torznabCategories, base, apikey string) torznabItem {
+	link := base + "/download/" + url.PathEscape(res.ID) + "?" + apikey
+
+	item := torznabItem{
+		Title: res.Title,
+		GUID:  link,
+		Link:  link,
+		Size:  res.Size,
+		Enclosure: torznabEnclosure{
+			URL:    link,
+			Length: res.Size,
+			Type:   "application/x-bittorrent",
+		},
+	}
+	if res.CreatedDate > 0 {
+		item.PubDate = time.Unix(res.CreatedDate, 0).UTC().Format(time.RFC1123Z)
+	}
+
+	downloadFactor := "1"
+	if res.Free {
+		downloadFactor = "0"
+	}
+	item.Attrs = []torznabAttr{
+		{Name: "size", Value: strconv.FormatUint(res.Size, 10)},
+		{Name: "seeders", Value: strconv.FormatUint(uint64(res.Seeders), 10)},
+		{Name: "peers", Value: strconv.FormatUint(uint64(res.Seeders)+uint64(res.Leechers), 10)},
+		{Name: "downloadvolumefactor", Value: downloadFactor},
+		{Name: "uploadvolumefactor", Value: "1"},
+	}
+
+	if id, ok := tc.toID[res.Category]; ok {
+		item.Categories = append(item.Categories, id)
+		item.Attrs = append(item.Attrs, torznabAttr{Name: "category", Value: strconv.Itoa(id)})
+	}
+
+	for _, db := range res.DBs {
+		if db.DB != "imdb" {
+			continue
+		}
+		if m := imdbIDRe.FindStringSubmatch(db.Link); m != nil {
+			item.Attrs = append(item.Attrs, torznabAttr{Name: "imdb", Value: m[1]})
+		}
+	}
+
+	return item
+}
+
+// torznabDownload serves the torrent file downloaded by the indexer. The file
+// is downloaded to a temp dir, the torrents dir of the downloader may be
+// watched by the torrent client.
+func (s *Service) torznabDownload(c *gin.Context) {
+	indexer, ok := s.torznabIndexer(c)
+	if !ok {
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "autoget-torznab-")
+	if err != nil {
+		torznabFail(c, http.StatusInternalServerError, torznabErrUnknown, err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	resourceID := c.Param("resource")
+	res, herr := indexer.Download(resourceID, dir)
+	if herr != nil {
+		torznabFail(c, herr.Code, torznabErrUnknown, herr.Message)
+		return
+	}
+	if res.TorrentFilePath == "" {
+		torznabFail(c, http.StatusInternalServerError, torznabErrUnknown, "Torrent file not found")
+		return
+	}
+
+	c.Header("Content-Type", "application/x-bittorrent")
+	c.FileAttachment(res.TorrentFilePath, resourceID+".torrent")
+}
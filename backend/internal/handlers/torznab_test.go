@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/config"
+	"github.com/charleshuang3/autoget/backend/internal/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var torznabTestCategories = []indexers.Category{
+	{ID: "normal", Name: "Normal", SubCategories: []indexers.Category{
+		{ID: "401", Name: "Movie", SubCategories: []indexers.Category{
+			{ID: "419", Name: "Movie HD"},
+		}},
+		{ID: "402", Name: "TV Series"},
+	}},
+	{ID: "adult", Name: "Adult"},
+}
+
+func torznabTestSetup(t *testing.T) (*gin.Engine, *indexerMock) {
+	t.Helper()
+
+	serv, router, m, _ := testSetup(t)
+	serv.config = &config.Config{Torznab: &config.TorznabConfig{APIKey: "key"}}
+	m.mockCategories = torznabTestCategories
+
+	return router, m
+}
+
+// torznabDownloadSetup gives the downloader of the indexer an empty torrents dir.
+func torznabDownloadSetup(t *testing.T) (*gin.Engine, *indexerMock, *downloadersMock) {
+	t.Helper()
+
+	serv, router, m, _ := testSetup(t)
+	serv.config = &config.Config{Torznab: &config.TorznabConfig{APIKey: "key"}}
+	d := serv.downloaders["mock"].(*downloadersMock)
+	d.mockTorrentsDir = t.TempDir()
+
+	return router, m, d
+}
+
+func parseTorznabError(t *testing.T, w *httptest.ResponseRecorder) *torznabError {
+	t.Helper()
+
+	resp := &torznabError{}
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), resp))
+	return resp
+}
+
+func TestNewTorznabCategories(t *testing.T) {
+	tc := newTorznabCategories(torznabTestCategories)
+
+	require.Len(t, tc.caps, 2)
+	assert.Equal(t, torznabCapsCategory{ID: 100001, Name: "Normal", Subcats: []torznabCapsCategory{
+		{ID: 100002, Name: "Movie"},
+		{ID: 100003, Name: "Movie HD"},
+		{ID: 100004, Name: "TV Series"},
+	}}, tc.caps[0])
+	assert.Equal(t, torznabCapsCategory{ID: 100005, Name: "Adult"}, tc.caps[1])
+
+	assert.Equal(t, 100003, tc.toID["Movie HD"])
+	assert.Equal(t, "402", tc.fromID[100004])
+}
+
+func TestService_torznabAPI(t *testing.T) {
+	t.Run("caps", func(t *testing.T) {
+		router, _ := torznabTestSetup(t)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/torznab/mock/api?t=caps&apikey=key", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		resp := &torznabCaps{}
+		require.NoError(t, xml.Unmarshal(w.Body.Bytes(), resp))
+		assert.Equal(t, "AutoGet mock", resp.Server.Title)
+		assert.Equal(t, "q,season,ep", resp.Searching.TVSearch.SupportedParams)
+		require.Len(t, resp.Categories, 2)
+		assert.Len(t, resp.Categories[0].Subcats, 3)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		router, m := torznabTestSetup(t)
+		m.mockListResult = &indexers.ListResult{
+			Pagination: indexers.Pagination{Total: 1},
+			Resources: []indexers.ListResourceItem{
+				{
+					ID:          "1",
+					Title:       "Show S01E02 1080p",
+					CreatedDate: 1700000000,
+					Category:    "TV Series",
+					Size:        1024,
+					Seeders:     10,
+					Leechers:    2,
+					Free:        true,
+					DBs:         []indexers.VideoDB{{DB: "imdb", Link: "https://www.imdb.com/title/tt1234567/"}},
+				},
+			},
+		}
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/torznab/mock/api?t=tvsearch&apikey=key&q=Show&season=1&ep=2&cat=5000,100004&offset=20&limit=10", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, &indexers.ListRequest{
+			Category: "402",
+			Keyword:  "Show S01E02",
+			Page:     3,
+			PageSize: 10,
+		}, m.listReq)
+
+		body := w.Body.String()
+		assert.Contains(t, body, `xmlns:torznab="http://torznab.com/schemas/2015/feed"`)
+		assert.Contains(t, body, `<torznab:response offset="20" total="1">`)
+		assert.Contains(t, body, `<title>Show S01E02 1080p</title>`)
+		assert.Contains(t, body, `<enclosure url="http://example.com/torznab/mock/download/1?apikey=key" length="1024" type="application/x-bittorrent">`)
+		assert.Contains(t, body, `<category>100004</category>`)
+		assert.Contains(t, body, `<torznab:attr name="seeders" value="10">`)
+		assert.Contains(t, body, `<torznab:attr name="peers" value="12">`)
+		assert.Contains(t, body, `<torznab:attr name="downloadvolumefactor" value="0">`)
+		assert.Contains(t, body, `<torznab:attr name="imdb" value="1234567">`)
+	})
+
+	t.Run("misaligned offset", func(t *testing.T) {
+		router, m := torznabTestSetup(t)
+		page := func(ids ...string) *indexers.ListResult {
+			res := &indexers.ListResult{Pagination: indexers.Pagination{Total: 6, TotalPages: 3}}
+			for _, id := range ids {
+				res.Resources = append(res.Resources, indexers.ListResourceItem{ID: id, Title: "Title " + id})
+			}
+			return res
+		}
+		m.mockListPages = map[uint32]*indexers.ListResult{
+			1: page("1", "2"),
+			2: page("3", "4"),
+			3: page("5", "6"),
+		}
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/torznab/mock/api?t=search&apikey=key&offset=3&limit=2", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		body := w.Body.String()
+		assert.Contains(t, body, `<torznab:response offset="3" total="6">`)
+		assert.Equal(t, 2, strings.Count(body, "<item>"))
+		assert.Contains(t, body, `<title>Title 4</title>`)
+		assert.Contains(t, body, `<title>Title 5</title>`)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			url          string
+			disabled     bool
+			listErr      *errors.HTTPStatusError
+			expectedHTTP int
+			expectedCode int
+		}{
+			{
+				name:         "disabled",
+				url:          "/torznab/mock/api?t=caps&apikey=key",
+				disabled:     true,
+				expectedHTTP: http.StatusNotFound,
+				expectedCode: torznabErrNoSuchFunction,
+			},
+			{
+				name:         "wrong api key",
+				url:          "/torznab/mock/api?t=caps&apikey=wrong",
+				expectedHTTP: http.StatusUnauthorized,
+				expectedCode: torznabErrIncorrectCredentials,
+			},
+			{
+				name:         "indexer not found",
+				url:          "/torznab/nonexistent/api?t=caps&apikey=key",
+				expectedHTTP: http.StatusNotFound,
+				expectedCode: torznabErrIncorrectParameter,
+			},
+			{
+				name:         "missing function",
+				url:          "/torznab/mock/api?apikey=key",
+				expectedHTTP: http.StatusBadRequest,
+				expectedCode: torznabErrMissingParameter,
+			},
+			{
+				name:         "unknown function",
+				url:          "/torznab/mock/api?t=music&apikey=key",
+				expectedHTTP: http.StatusBadRequest,
+				expectedCode: torznabErrNoSuchFunction,
+			},
+			{
+				name:         "list error",
+				url:          "/torznab/mock/api?t=search&apikey=key&q=test",
+				listErr:      errors.NewHTTPStatusError(http.StatusBadGateway, "upstream"),
+				expectedHTTP: http.StatusBadGateway,
+				expectedCode: torznabErrUnknown,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				serv, router, m, _ := testSetup(t)
+				if !tt.disabled {
+					serv.config = &config.Config{Torznab: &config.TorznabConfig{APIKey: "key"}}
+				}
+				m.mockCategories = torznabTestCategories
+				m.mockListErr = tt.listErr
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", tt.url, nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedHTTP, w.Code)
+				assert.Equal(t, tt.expectedCode, parseTorznabError(t, w).Code)
+			})
+		}
+	})
+}
+
+func TestService_torznabDownload(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		router, m, d := torznabDownloadSetup(t)
+		m.mockTorrent = []byte("torrent")
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/torznab/mock/download/1?apikey=key", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "torrent", w.Body.String())
+		assert.Equal(t, "application/x-bittorrent", w.Header().Get("Content-Type"))
+
+		// the torrent is not left for the client watching the torrents dir.
+		assert.NotEqual(t, d.TorrentsDir(), m.downloadDir)
+		assert.NoDirExists(t, m.downloadDir)
+		entries, err := os.ReadDir(d.TorrentsDir())
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		router, m := torznabTestSetup(t)
+		m.mockDownloadErr = errors.NewHTTPStatusError(http.StatusNotFound, "not found")
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/torznab/mock/download/1?apikey=key", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, torznabErrUnknown, parseTorznabError(t, w).Code)
+	})
+}
@@ -0,0 +1,110 @@
+// Package hub is an in-process pub/sub of events for the events stream.
+package hub
+
+import (
+	"sync"
+)
+
+// Event types.
+const (
+	// DownloadProgress is published by the progress checker, with DownloadProgressData.
+	DownloadProgress = "download_progress"
+	// DownloadEvent is a download lifecycle event, with DownloadEventData.
+	DownloadEvent = "download_event"
+	// RSSPoll is published after RSS items are searched, with RSSPollData.
+	RSSPoll = "rss_poll"
+	// RSSMatch is published when a RSS search matches, with RSSMatchData.
+	RSSMatch = "rss_match"
+)
+
+// subscriberBuffer events are kept for a slow subscriber, later events are dropped.
+const subscriberBuffer = 64
+
+type Event struct {
+	Type string
+	Data any
+}
+
+type DownloadProgressData struct {
+	ID         string `json:"id"`
+	Downloader string `json:"downloader"`
+	Title      string `json:"title"`
+	Progress   int32  `json:"progress"` // in x/1000
+	State      string `json:"state"`    // See db.DownloadState.String
+}
+
+type DownloadEventData struct {
+	Type       string `json:"type"` // See events.Type
+	ID         string `json:"id"`
+	Downloader string `json:"downloader"`
+	Title      string `json:"title"`
+	Indexer    string `json:"indexer,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Reason     string `json:"reason,omitempty"` // See events.Event
+}
+
+type RSSPollData struct {
+	Indexer                string   `json:"indexer"`
+	Items                  int      `json:"items"`
+	DownloadStarted        []string `json:"downloadStarted"`
+	DownloadPendingToStart []string `json:"downloadPendingToStart"`
+}
+
+type RSSMatchData struct {
+	Indexer  string `json:"indexer"`
+	SearchID uint   `json:"searchId"`
+	Action   string `json:"action"`
+	ResID    string `json:"resId"`
+	Title    string `json:"title"`
+}
+
+type Hub struct {
+	mu   sync.Mutex
+	subs map[chan *Event]struct{}
+}
+
+func New() *Hub {
+	return &Hub{
+		subs: map[chan *Event]struct{}{},
+	}
+}
+
+// Default hub subsystems publish to.
+var Default = New()
+
+// Publish to the Default hub.
+func Publish(typ string, data any) {
+	Default.Publish(typ, data)
+}
+
+// Publish the event to all subscribers without blocking.
+func (h *Hub) Publish(typ string, data any) {
+	e := &Event{Type: typ, Data: data}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the events channel and the func to unsubscribe.
+func (h *Hub) Subscribe() (<-chan *Event, func()) {
+	ch := make(chan *Event, subscriberBuffer)
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+		})
+	}
+}
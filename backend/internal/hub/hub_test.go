@@ -0,0 +1,40 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		h := New()
+		a, unsubscribeA := h.Subscribe()
+		b, unsubscribeB := h.Subscribe()
+		t.Cleanup(unsubscribeB)
+
+		h.Publish(RSSPoll, "data")
+		assert.Equal(t, &Event{Type: RSSPoll, Data: "data"}, <-a)
+		assert.Equal(t, &Event{Type: RSSPoll, Data: "data"}, <-b)
+
+		// unsubscribed channels get no more events.
+		unsubscribeA()
+		unsubscribeA()
+		h.Publish(RSSMatch, "data")
+		assert.Empty(t, a)
+		assert.Equal(t, RSSMatch, (<-b).Type)
+	})
+
+	t.Run("slow subscriber", func(t *testing.T) {
+		h := New()
+		ch, unsubscribe := h.Subscribe()
+		t.Cleanup(unsubscribe)
+
+		// publish never blocks, events beyond the buffer are dropped.
+		for i := 0; i < subscriberBuffer+10; i++ {
+			h.Publish(DownloadProgress, i)
+		}
+		assert.Len(t, ch, subscriberBuffer)
+		assert.Equal(t, 0, (<-ch).Data)
+	})
+}
@@ -0,0 +1,141 @@
+// Package metrics defines the Prometheus metrics of AutoGet. Indexers,
+// downloaders and notifiers are instrumented by wrappers next to their
+// interfaces, see indexers.Instrument, downloaders.Instrument and
+// notify.Instrument.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "autoget"
+
+// Registry of all metrics, with Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	IndexerRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "indexer_requests_total",
+		Help:      "Requests to indexers by operation.",
+	}, []string{"indexer", "op"})
+
+	IndexerErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "indexer_errors_total",
+		Help:      "Failed requests to indexers by operation.",
+	}, []string{"indexer", "op"})
+
+	IndexerDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "indexer_request_duration_seconds",
+		Help:      "Latency of requests to indexers by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"indexer", "op"})
+
+	RSSItemsSeen = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rss_items_seen_total",
+		Help:      "RSS items pulled from indexers.",
+	}, []string{"indexer"})
+
+	RSSItemsMatched = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rss_items_matched_total",
+		Help:      "RSS items matched by searches.",
+	}, []string{"indexer", "search"})
+
+	DownloaderRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloader_requests_total",
+		Help:      "Requests to downloaders by operation.",
+	}, []string{"downloader", "op"})
+
+	DownloaderErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloader_errors_total",
+		Help:      "Failed requests to downloaders by operation.",
+	}, []string{"downloader", "op"})
+
+	ProgressCheckDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "progress_check_duration_seconds",
+		Help:      "Duration of the progress checker, including copying finished files.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"downloader"})
+
+	Downloads = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "downloads",
+		Help:      "Downloads by state, updated by the progress checker.",
+	}, []string{"downloader", "state"})
+
+	CopyBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "copy_bytes_total",
+		Help:      "Bytes of finished downloads copied to the finished dir.",
+	}, []string{"downloader"})
+
+	CopyDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "copy_duration_seconds",
+		Help:      "Duration of copying a finished download to the finished dir.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8), // 1s to ~4.5h
+	}, []string{"downloader"})
+
+	SeedingPolicyActions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "seeding_policy_actions_total",
+		Help:      "Torrents stopped or removed by the seeding policy, or evicted by the disk space policy.",
+	}, []string{"downloader", "action"})
+
+	NotifierFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifier_send_failures_total",
+		Help:      "Failed notifier sends.",
+	}, []string{"notifier"})
+)
+
+// Seeding policy and disk space policy actions.
+const (
+	ActionStop   = "stop"
+	ActionRemove = "remove"
+	ActionEvict  = "evict"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// ObserveIndexer records an indexer request started at start.
+func ObserveIndexer(indexer, op string, start time.Time, failed bool) {
+	IndexerRequests.WithLabelValues(indexer, op).Inc()
+	IndexerDuration.WithLabelValues(indexer, op).Observe(time.Since(start).Seconds())
+	if failed {
+		IndexerErrors.WithLabelValues(indexer, op).Inc()
+	}
+}
+
+// ObserveDownloader records a downloader request.
+func ObserveDownloader(downloader, op string, err error) {
+	DownloaderRequests.WithLabelValues(downloader, op).Inc()
+	if err != nil {
+		DownloaderErrors.WithLabelValues(downloader, op).Inc()
+	}
+}
+
+// Handler serves the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,56 @@
+package discord
+
+import (
+	"fmt"
+
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+)
+
+// Discord rejects longer message content.
+const maxContentLength = 2000
+
+type Config struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Username   string `yaml:"username"` // optional, overrides the webhook name
+}
+
+func (c *Config) Validate() error {
+	if c.WebhookURL == "" {
+		return fmt.Errorf("discord webhook URL is required")
+	}
+	return nil
+}
+
+var _ notify.INotifier = (*Notifier)(nil)
+
+type Notifier struct {
+	config *Config
+}
+
+func New(config *Config) *Notifier {
+	return &Notifier{config: config}
+}
+
+type payload struct {
+	Content  string `json:"content"`
+	Username string `json:"username,omitempty"`
+}
+
+func (n *Notifier) send(content string) error {
+	if r := []rune(content); len(r) > maxContentLength {
+		content = string(r[:maxContentLength-1]) + "…"
+	}
+	return notify.PostJSON(n.config.WebhookURL, nil, &payload{
+		Content:  content,
+		Username: n.config.Username,
+	})
+}
+
+func (n *Notifier) SendMessage(message string) error {
+	return n.send(message)
+}
+
+// SendMarkdownMessage sends as is, discord renders markdown.
+func (n *Notifier) SendMarkdownMessage(message string) error {
+	return n.send(message)
+}
@@ -0,0 +1,57 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T, status int) (*Notifier, *[]payload) {
+	t.Helper()
+
+	received := &[]payload{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		p := payload{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		*received = append(*received, p)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return New(&Config{WebhookURL: server.URL, Username: "AutoGet"}), received
+}
+
+func TestSendMessage(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		n, received := setup(t, http.StatusNoContent)
+
+		require.NoError(t, n.SendMessage("hello"))
+		require.NoError(t, n.SendMarkdownMessage("# title\n- item"))
+
+		assert.Equal(t, []payload{
+			{Content: "hello", Username: "AutoGet"},
+			{Content: "# title\n- item", Username: "AutoGet"},
+		}, *received)
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		n, received := setup(t, http.StatusNoContent)
+
+		require.NoError(t, n.SendMessage(strings.Repeat("a", 3000)))
+		assert.Len(t, []rune((*received)[0].Content), maxContentLength)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		n, _ := setup(t, http.StatusBadRequest)
+
+		assert.ErrorContains(t, n.SendMessage("hello"), "webhook status code: 400")
+	})
+}
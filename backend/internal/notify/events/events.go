@@ -0,0 +1,173 @@
+// Package events notifies download lifecycle events with configurable
+// templates.
+package events
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"text/template"
+
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+	"github.com/rs/zerolog/log"
+)
+
+type Type string
+
+const (
+	Started    Type = "started"
+	Completed  Type = "completed"
+	Moved      Type = "moved"
+	MoveFailed Type = "move_failed"
+	// Stopped by the seeding policy or the user.
+	Stopped Type = "stopped"
+	// Deleted by the seeding policy, the disk space policy or the user.
+	Deleted Type = "deleted"
+	// LowDiskSpace when the free space of a dir falls below the threshold of
+	// the disk space policy.
+	LowDiskSpace Type = "low_disk_space"
+	// DiskSpaceRecovered when the free space is back above the threshold.
+	DiskSpaceRecovered Type = "disk_space_recovered"
+	// StartFailed when a torrent queued for disk space is dropped after
+	// failing to start.
+	StartFailed Type = "start_failed"
+)
+
+// Reasons of stopped and deleted events besides the seeding policy rules.
+const (
+	ReasonDiskSpace = "disk_space"
+	ReasonUser      = "user"
+)
+
+var (
+	AllTypes = []Type{Started, Completed, Moved, MoveFailed, Stopped, Deleted, LowDiskSpace, DiskSpaceRecovered, StartFailed}
+
+	logger = log.With().Str("component", "events").Logger()
+)
+
+//go:embed events.md
+var defaultTemplatesContent string
+
+var defaultTemplates *template.Template
+
+func init() {
+	var err error
+	defaultTemplates, err = template.New("events").Parse(defaultTemplatesContent)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse events template")
+	}
+}
+
+type Event struct {
+	Type       Type
+	Downloader string
+	Hash       string
+	Title      string
+	Indexer    string
+	Error      string
+	// Reason of stopped and deleted events, the seeding policy rule,
+	// ReasonDiskSpace or ReasonUser.
+	Reason string
+	// Dir and its Free space for disk space events.
+	Dir  string
+	Free string
+}
+
+// IEventNotifier receives download lifecycle events.
+type IEventNotifier interface {
+	Notify(e *Event)
+}
+
+type EventConfig struct {
+	Disabled bool `yaml:"disabled"`
+	// Template in text/template markdown, see events.md for the defaults and
+	// Event for the fields.
+	Template string `yaml:"template"`
+}
+
+// Config by event type, events are enabled with the default template if not
+// configured.
+type Config map[Type]*EventConfig
+
+func (c Config) Validate() error {
+	for typ, ec := range c {
+		if defaultTemplates.Lookup(string(typ)) == nil {
+			return fmt.Errorf("unknown download event: %s", typ)
+		}
+		if ec == nil || ec.Template == "" {
+			continue
+		}
+		if _, err := template.New(string(typ)).Parse(ec.Template); err != nil {
+			return fmt.Errorf("invalid template of download event %s: %v", typ, err)
+		}
+	}
+	return nil
+}
+
+var _ IEventNotifier = (*Notifier)(nil)
+
+// Notifier renders events and sends them to the notifier.
+type Notifier struct {
+	notifier  notify.INotifier
+	templates map[Type]*template.Template
+}
+
+func New(config Config, notifier notify.INotifier) (*Notifier, error) {
+	n := &Notifier{
+		notifier:  notifier,
+		templates: map[Type]*template.Template{},
+	}
+
+	for _, typ := range AllTypes {
+		ec := config[typ]
+		if ec == nil {
+			n.templates[typ] = defaultTemplates.Lookup(string(typ))
+			continue
+		}
+		if ec.Disabled {
+			continue
+		}
+		if ec.Template == "" {
+			n.templates[typ] = defaultTemplates.Lookup(string(typ))
+			continue
+		}
+
+		t, err := template.New(string(typ)).Parse(ec.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template of download event %s: %v", typ, err)
+		}
+		n.templates[typ] = t
+	}
+
+	return n, nil
+}
+
+// Render the event, false if the event is disabled.
+func (n *Notifier) Render(e *Event) (string, bool, error) {
+	t, ok := n.templates[e.Type]
+	if !ok {
+		return "", false, nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, e); err != nil {
+		return "", false, err
+	}
+	return buf.String(), true, nil
+}
+
+// Notify sends the event if it is enabled, errors are logged.
+func (n *Notifier) Notify(e *Event) {
+	msg, ok, err := n.Render(e)
+	if err != nil {
+		logger.Error().Err(err).Str("event", string(e.Type)).Msg("Failed to render download event")
+		return
+	}
+	if !ok {
+		return
+	}
+
+	if err := n.notifier.SendMarkdownMessage(msg); err != nil {
+		logger.Error().Err(err).Str("event", string(e.Type)).Msg("Failed to send download event")
+	}
+}
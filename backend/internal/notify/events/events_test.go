@@ -0,0 +1,84 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotifier struct {
+	err      error
+	messages []string
+}
+
+func (f *fakeNotifier) SendMessage(message string) error {
+	f.messages = append(f.messages, message)
+	return f.err
+}
+
+func (f *fakeNotifier) SendMarkdownMessage(message string) error {
+	f.messages = append(f.messages, message)
+	return f.err
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	n, err := New(nil, &fakeNotifier{})
+	require.NoError(t, err)
+
+	for _, typ := range AllTypes {
+		t.Run(string(typ), func(t *testing.T) {
+			msg, ok, err := n.Render(&Event{Type: typ, Title: "Title", Error: "copy failed", Dir: "/downloads", Free: "1.0 GB"})
+			require.NoError(t, err)
+			assert.True(t, ok)
+			switch typ {
+			case LowDiskSpace, DiskSpaceRecovered:
+				assert.Contains(t, msg, "/downloads has 1.0 GB free")
+			case MoveFailed, StartFailed:
+				assert.Contains(t, msg, "Title")
+				assert.Contains(t, msg, "copy failed")
+			default:
+				assert.Contains(t, msg, "Title")
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		n, err := New(Config{
+			Started:   {Disabled: true},
+			Completed: {Template: "{{.Indexer}}: {{.Title}} done"},
+			Moved:     {},
+		}, notifier)
+		require.NoError(t, err)
+
+		n.Notify(&Event{Type: Started, Title: "Title"})
+		n.Notify(&Event{Type: Completed, Title: "Title", Indexer: "nyaa"})
+		n.Notify(&Event{Type: Moved, Title: "Title"})
+
+		require.Len(t, notifier.messages, 2)
+		assert.Equal(t, "nyaa: Title done", notifier.messages[0])
+		assert.Equal(t, "# Download Moved\n\nTitle", notifier.messages[1])
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := New(Config{Moved: {Template: "{{.Title"}}, &fakeNotifier{})
+		assert.ErrorContains(t, err, "invalid template of download event moved")
+
+		// send errors are logged.
+		notifier := &fakeNotifier{err: errors.New("failed")}
+		n, err := New(nil, notifier)
+		require.NoError(t, err)
+		n.Notify(&Event{Type: Deleted, Title: "Title"})
+		assert.Len(t, notifier.messages, 1)
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, Config{Started: {Disabled: true}, Completed: nil}.Validate())
+	assert.EqualError(t, Config{"finished": {}}.Validate(), "unknown download event: finished")
+	assert.ErrorContains(t, Config{Moved: {Template: "{{.Title"}}.Validate(), "invalid template of download event moved")
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"errors"
+)
+
+var (
+	_ INotifier = (*Fanout)(nil)
+	_ IApprover = (*Fanout)(nil)
+)
+
+// Fanout sends messages to all notifiers, an empty Fanout drops messages.
+type Fanout struct {
+	notifiers []INotifier
+}
+
+func NewFanout(notifiers ...INotifier) *Fanout {
+	return &Fanout{notifiers: notifiers}
+}
+
+func (f *Fanout) SendMessage(message string) error {
+	var errs []error
+	for _, n := range f.notifiers {
+		errs = append(errs, n.SendMessage(message))
+	}
+	return errors.Join(errs...)
+}
+
+func (f *Fanout) SendMarkdownMessage(message string) error {
+	var errs []error
+	for _, n := range f.notifiers {
+		errs = append(errs, n.SendMarkdownMessage(message))
+	}
+	return errors.Join(errs...)
+}
+
+// SendPendingDownload to notifiers which can approve downloads.
+func (f *Fanout) SendPendingDownload(p *PendingDownload) error {
+	var errs []error
+	for _, n := range f.notifiers {
+		if a, ok := n.(IApprover); ok {
+			errs = append(errs, a.SendPendingDownload(p))
+		}
+	}
+	return errors.Join(errs...)
+}
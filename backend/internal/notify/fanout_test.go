@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNotifier struct {
+	err      error
+	messages []string
+}
+
+func (f *fakeNotifier) SendMessage(message string) error {
+	f.messages = append(f.messages, "text:"+message)
+	return f.err
+}
+
+func (f *fakeNotifier) SendMarkdownMessage(message string) error {
+	f.messages = append(f.messages, "md:"+message)
+	return f.err
+}
+
+func TestFanout(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		a, b := &fakeNotifier{}, &fakeNotifier{}
+		f := NewFanout(a, b)
+
+		assert.NoError(t, f.SendMessage("hello"))
+		assert.NoError(t, f.SendMarkdownMessage("*hello*"))
+
+		assert.Equal(t, []string{"text:hello", "md:*hello*"}, a.messages)
+		assert.Equal(t, a.messages, b.messages)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		assert.NoError(t, NewFanout().SendMessage("hello"))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		failed := &fakeNotifier{err: errors.New("failed")}
+		ok := &fakeNotifier{}
+		f := NewFanout(failed, ok)
+
+		err := f.SendMessage("hello")
+		assert.ErrorContains(t, err, "failed")
+		// other notifiers still get the message.
+		assert.Equal(t, []string{"text:hello"}, ok.messages)
+	})
+}
+
+type fakeApprover struct {
+	fakeNotifier
+	pendings []*PendingDownload
+}
+
+func (f *fakeApprover) SendPendingDownload(p *PendingDownload) error {
+	f.pendings = append(f.pendings, p)
+	return f.err
+}
+
+func TestFanoutSendPendingDownload(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		a := &fakeApprover{}
+		f := NewFanout(&fakeNotifier{}, a)
+
+		p := &PendingDownload{SearchID: 1, Title: "title"}
+		assert.NoError(t, f.SendPendingDownload(p))
+		assert.Equal(t, []*PendingDownload{p}, a.pendings)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		a := &fakeApprover{fakeNotifier: fakeNotifier{err: errors.New("failed")}}
+		f := NewFanout(a)
+
+		assert.ErrorContains(t, f.SendPendingDownload(&PendingDownload{}), "failed")
+	})
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+)
+
+var (
+	_ INotifier = (*instrumented)(nil)
+	_ IApprover = (*instrumentedApprover)(nil)
+)
+
+// instrumented records send failures of the notifier.
+type instrumented struct {
+	INotifier
+	name string
+}
+
+type instrumentedApprover struct {
+	*instrumented
+	approver IApprover
+}
+
+// Instrument wraps the notifier to record send failures, the wrapper is an
+// IApprover if the notifier is.
+func Instrument(name string, n INotifier) INotifier {
+	i := &instrumented{INotifier: n, name: name}
+	if a, ok := n.(IApprover); ok {
+		return &instrumentedApprover{instrumented: i, approver: a}
+	}
+	return i
+}
+
+func (n *instrumented) observe(err error) error {
+	if err != nil {
+		metrics.NotifierFailures.WithLabelValues(n.name).Inc()
+	}
+	return err
+}
+
+func (n *instrumented) SendMessage(message string) error {
+	return n.observe(n.INotifier.SendMessage(message))
+}
+
+func (n *instrumented) SendMarkdownMessage(message string) error {
+	return n.observe(n.INotifier.SendMarkdownMessage(message))
+}
+
+func (n *instrumentedApprover) SendPendingDownload(p *PendingDownload) error {
+	return n.observe(n.approver.SendPendingDownload(p))
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		n := &fakeNotifier{}
+		i := Instrument("instrument-ok", n)
+
+		assert.NoError(t, i.SendMessage("hello"))
+		assert.NoError(t, i.SendMarkdownMessage("*hello*"))
+		assert.Equal(t, []string{"text:hello", "md:*hello*"}, n.messages)
+		assert.Equal(t, float64(0), testutil.ToFloat64(metrics.NotifierFailures.WithLabelValues("instrument-ok")))
+
+		_, ok := i.(IApprover)
+		assert.False(t, ok)
+
+		a := &fakeApprover{}
+		i = Instrument("instrument-ok", a)
+		approver, ok := i.(IApprover)
+		if assert.True(t, ok) {
+			assert.NoError(t, approver.SendPendingDownload(&PendingDownload{SearchID: 1}))
+			assert.Len(t, a.pendings, 1)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		i := Instrument("instrument-failed", &fakeApprover{fakeNotifier: fakeNotifier{err: errors.New("failed")}})
+
+		assert.ErrorContains(t, i.SendMessage("hello"), "failed")
+		assert.ErrorContains(t, i.(IApprover).SendPendingDownload(&PendingDownload{}), "failed")
+		assert.Equal(t, float64(2), testutil.ToFloat64(metrics.NotifierFailures.WithLabelValues("instrument-failed")))
+	})
+}
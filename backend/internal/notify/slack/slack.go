@@ -0,0 +1,56 @@
+package slack
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+)
+
+var (
+	headingRe = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+	boldRe    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	linkRe    = regexp.MustCompile(`\[([^\]]+)\]\((\S+?)\)`)
+)
+
+type Config struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+func (c *Config) Validate() error {
+	if c.WebhookURL == "" {
+		return fmt.Errorf("slack webhook URL is required")
+	}
+	return nil
+}
+
+var _ notify.INotifier = (*Notifier)(nil)
+
+type Notifier struct {
+	config *Config
+}
+
+func New(config *Config) *Notifier {
+	return &Notifier{config: config}
+}
+
+type payload struct {
+	Text   string `json:"text"`
+	Mrkdwn bool   `json:"mrkdwn"`
+}
+
+func (n *Notifier) SendMessage(message string) error {
+	return notify.PostJSON(n.config.WebhookURL, nil, &payload{Text: message})
+}
+
+func (n *Notifier) SendMarkdownMessage(message string) error {
+	return notify.PostJSON(n.config.WebhookURL, nil, &payload{Text: toMrkdwn(message), Mrkdwn: true})
+}
+
+// toMrkdwn converts the markdown we send to slack mrkdwn.
+func toMrkdwn(md string) string {
+	md = boldRe.ReplaceAllString(md, "*$1*")
+	md = headingRe.ReplaceAllString(md, "*$1*")
+	md = linkRe.ReplaceAllString(md, "<$2|$1>")
+	return md
+}
@@ -0,0 +1,46 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T, status int) (*Notifier, *[]payload) {
+	t.Helper()
+
+	received := &[]payload{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := payload{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		*received = append(*received, p)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return New(&Config{WebhookURL: server.URL}), received
+}
+
+func TestSendMessage(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		n, received := setup(t, http.StatusOK)
+
+		require.NoError(t, n.SendMessage("**not converted**"))
+		require.NoError(t, n.SendMarkdownMessage("# nyaa RSS\n\n## Download Started\n- **Show** [link](http://example.com)"))
+
+		assert.Equal(t, []payload{
+			{Text: "**not converted**"},
+			{Text: "*nyaa RSS*\n\n*Download Started*\n- *Show* <http://example.com|link>", Mrkdwn: true},
+		}, *received)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		n, _ := setup(t, http.StatusForbidden)
+
+		assert.ErrorContains(t, n.SendMarkdownMessage("hello"), "webhook status code: 403")
+	})
+}
@@ -5,3 +5,16 @@ type INotifier interface {
 
 	SendMarkdownMessage(message string) error
 }
+
+// PendingDownload is a RSS match waiting for the user to start the download.
+type PendingDownload struct {
+	SearchID uint
+	Indexer  string
+	Title    string
+	URL      string
+}
+
+// IApprover asks the user to approve pending downloads.
+type IApprover interface {
+	SendPendingDownload(p *PendingDownload) error
+}
@@ -0,0 +1,338 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	searchPageSize    = 5
+	maxSearchQueries  = 100
+	maxDownloadsShown = 20
+
+	// callback data: search:<query id>:<page>
+	callbackSearchPage = "search:"
+	// callback data: dl:<query id>:<resource id>
+	callbackSearchDownload = "dl:"
+	// callback data: unsub:<search id>
+	callbackUnsubscribe = "unsub:"
+)
+
+// IService runs the bot commands.
+type IService interface {
+	SearchIndexer(indexer, keyword string, page, pageSize uint32) (*indexers.ListResult, error)
+	DownloadResource(indexer, resourceID string) error
+	ActiveDownloads(limit int) ([]db.DownloadStatus, int64, error)
+	AddSearch(indexer, text string) (*db.RSSSearch, error)
+	ListSearches() ([]*db.RSSSearch, error)
+	DeleteSearch(id uint) error
+}
+
+// searchQuery is kept for the buttons of search results, callback data is
+// limited to 64 bytes.
+type searchQuery struct {
+	indexer string
+	keyword string
+}
+
+// SetService enables the bot commands.
+func (n *Notifier) SetService(s IService) {
+	n.service = s
+}
+
+func (n *Notifier) commandOptions() []bot.Option {
+	return []bot.Option{
+		bot.WithMessageTextHandler("search", bot.MatchTypeCommandStartOnly, n.command(n.handleSearch)),
+		bot.WithMessageTextHandler("downloads", bot.MatchTypeCommandStartOnly, n.command(n.handleDownloads)),
+		bot.WithMessageTextHandler("subscribe", bot.MatchTypeCommandStartOnly, n.command(n.handleSubscribe)),
+		bot.WithMessageTextHandler("unsubscribe", bot.MatchTypeCommandStartOnly, n.command(n.handleUnsubscribe)),
+		bot.WithCallbackQueryDataHandler(callbackSearchPage, bot.MatchTypePrefix, n.callback(n.handleSearchPage)),
+		bot.WithCallbackQueryDataHandler(callbackSearchDownload, bot.MatchTypePrefix, n.callback(n.handleSearchDownload)),
+		bot.WithCallbackQueryDataHandler(callbackUnsubscribe, bot.MatchTypePrefix, n.callback(n.handleUnsubscribeButton)),
+	}
+}
+
+func (n *Notifier) allowed(chatID int64) bool {
+	return strconv.FormatInt(chatID, 10) == n.config.ChatID
+}
+
+// commandFunc returns the reply of the command.
+type commandFunc func(args []string) (string, models.ReplyMarkup)
+
+// command only serves the configured chat.
+func (n *Notifier) command(f commandFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		msg := update.Message
+		if !n.allowed(msg.Chat.ID) {
+			return
+		}
+
+		var text string
+		var markup models.ReplyMarkup
+		if n.service == nil {
+			text = "Commands are not available"
+		} else {
+			text, markup = f(strings.Fields(msg.Text)[1:])
+		}
+
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      msg.Chat.ID,
+			Text:        text,
+			ReplyMarkup: markup,
+		}); err != nil {
+			logger.Error().Err(err).Msg("Failed to reply command")
+		}
+	}
+}
+
+// callbackFunc returns the answer of the button, and the new message if changed.
+type callbackFunc func(data string) (answer string, edit *bot.EditMessageTextParams)
+
+// callback only serves the configured chat.
+func (n *Notifier) callback(f callbackFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		q := update.CallbackQuery
+		msg := q.Message.Message
+
+		var text string
+		var edit *bot.EditMessageTextParams
+		switch {
+		case msg == nil || !n.allowed(msg.Chat.ID):
+			text = "Not allowed"
+		case n.service == nil:
+			text = "Commands are not available"
+		default:
+			text, edit = f(q.Data)
+		}
+
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: q.ID,
+			Text:            text,
+		}); err != nil {
+			logger.Error().Err(err).Msg("Failed to answer callback query")
+		}
+
+		if edit == nil {
+			return
+		}
+		edit.ChatID = msg.Chat.ID
+		edit.MessageID = msg.ID
+		if _, err := b.EditMessageText(ctx, edit); err != nil {
+			logger.Error().Err(err).Msg("Failed to edit message")
+		}
+	}
+}
+
+func (n *Notifier) addQuery(q *searchQuery) uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.nextQueryID++
+	id := n.nextQueryID
+	n.queries[id] = q
+	delete(n.queries, id-maxSearchQueries)
+	return id
+}
+
+func (n *Notifier) getQuery(id string) (uint64, *searchQuery, bool) {
+	qid, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, nil, false
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	q, ok := n.queries[qid]
+	return qid, q, ok
+}
+
+// /search <indexer> <keyword>
+func (n *Notifier) handleSearch(args []string) (string, models.ReplyMarkup) {
+	if len(args) < 2 {
+		return "Usage: /search <indexer> <keyword>", nil
+	}
+
+	q := &searchQuery{indexer: args[0], keyword: strings.Join(args[1:], " ")}
+	return n.renderSearch(n.addQuery(q), q, 1)
+}
+
+func (n *Notifier) renderSearch(qid uint64, q *searchQuery, page uint32) (string, models.ReplyMarkup) {
+	res, err := n.service.SearchIndexer(q.indexer, q.keyword, page, searchPageSize)
+	if err != nil {
+		return "Search failed: " + err.Error(), nil
+	}
+	if len(res.Resources) == 0 {
+		return fmt.Sprintf("%s: no results for %s", q.indexer, q.keyword), nil
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s: %s (page %d/%d)\n", q.indexer, q.keyword, res.Pagination.Page, res.Pagination.TotalPages)
+
+	downloads := []models.InlineKeyboardButton{}
+	for i, r := range res.Resources {
+		fmt.Fprintf(sb, "\n%d. %s\n    %s, %d seeders", i+1, r.Title, formatSize(r.Size), r.Seeders)
+		if r.Free {
+			sb.WriteString(", free")
+		}
+		downloads = append(downloads, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("⬇ %d", i+1),
+			CallbackData: fmt.Sprintf("%s%d:%s", callbackSearchDownload, qid, r.ID),
+		})
+	}
+
+	nav := []models.InlineKeyboardButton{}
+	if page > 1 {
+		nav = append(nav, models.InlineKeyboardButton{
+			Text:         "« Prev",
+			CallbackData: fmt.Sprintf("%s%d:%d", callbackSearchPage, qid, page-1),
+		})
+	}
+	if page < res.Pagination.TotalPages {
+		nav = append(nav, models.InlineKeyboardButton{
+			Text:         "Next »",
+			CallbackData: fmt.Sprintf("%s%d:%d", callbackSearchPage, qid, page+1),
+		})
+	}
+
+	keyboard := [][]models.InlineKeyboardButton{downloads}
+	if len(nav) > 0 {
+		keyboard = append(keyboard, nav)
+	}
+	return sb.String(), &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+func (n *Notifier) handleSearchPage(data string) (string, *bot.EditMessageTextParams) {
+	qidStr, pageStr, _ := strings.Cut(strings.TrimPrefix(data, callbackSearchPage), ":")
+	page, err := strconv.ParseUint(pageStr, 10, 32)
+	if err != nil || page == 0 {
+		return "Unknown action", nil
+	}
+	qid, q, ok := n.getQuery(qidStr)
+	if !ok {
+		return "Search expired, search again", nil
+	}
+
+	text, markup := n.renderSearch(qid, q, uint32(page))
+	return "", &bot.EditMessageTextParams{Text: text, ReplyMarkup: markup}
+}
+
+func (n *Notifier) handleSearchDownload(data string) (string, *bot.EditMessageTextParams) {
+	qidStr, resID, _ := strings.Cut(strings.TrimPrefix(data, callbackSearchDownload), ":")
+	if resID == "" {
+		return "Unknown action", nil
+	}
+	_, q, ok := n.getQuery(qidStr)
+	if !ok {
+		return "Search expired, search again", nil
+	}
+
+	if err := n.service.DownloadResource(q.indexer, resID); err != nil {
+		return "Failed: " + err.Error(), nil
+	}
+	return "Download started", nil
+}
+
+// /downloads
+func (n *Notifier) handleDownloads(args []string) (string, models.ReplyMarkup) {
+	statuses, total, err := n.service.ActiveDownloads(maxDownloadsShown)
+	if err != nil {
+		return "Failed: " + err.Error(), nil
+	}
+	if len(statuses) == 0 {
+		return "No active downloads", nil
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteString("Downloading:\n")
+	for i, s := range statuses {
+		fmt.Fprintf(sb, "\n%d. %s\n    %.1f%%", i+1, s.ResTitle, float64(s.DownloadProgress)/10)
+		if s.Paused {
+			sb.WriteString(", paused")
+		}
+	}
+	if more := total - int64(len(statuses)); more > 0 {
+		fmt.Fprintf(sb, "\n\n... and %d more", more)
+	}
+	return sb.String(), nil
+}
+
+// /subscribe <indexer> <text>
+func (n *Notifier) handleSubscribe(args []string) (string, models.ReplyMarkup) {
+	if len(args) < 2 {
+		return "Usage: /subscribe <indexer> <text>", nil
+	}
+
+	search, err := n.service.AddSearch(args[0], strings.Join(args[1:], " "))
+	if err != nil {
+		return "Failed: " + err.Error(), nil
+	}
+	return fmt.Sprintf("Subscribed #%d: %s %s", search.ID, search.Indexer, search.Text), nil
+}
+
+// /unsubscribe [search id], lists searches to pick from without id.
+func (n *Notifier) handleUnsubscribe(args []string) (string, models.ReplyMarkup) {
+	if len(args) == 0 {
+		return n.renderSearches()
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return "Usage: /unsubscribe [search id]", nil
+	}
+	if err := n.service.DeleteSearch(uint(id)); err != nil {
+		return "Failed: " + err.Error(), nil
+	}
+	return fmt.Sprintf("Unsubscribed #%d", id), nil
+}
+
+func (n *Notifier) renderSearches() (string, models.ReplyMarkup) {
+	searches, err := n.service.ListSearches()
+	if err != nil {
+		return "Failed: " + err.Error(), nil
+	}
+	if len(searches) == 0 {
+		return "No subscriptions", nil
+	}
+
+	keyboard := [][]models.InlineKeyboardButton{}
+	for _, s := range searches {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("#%d %s: %s", s.ID, s.Indexer, s.Text),
+			CallbackData: fmt.Sprintf("%s%d", callbackUnsubscribe, s.ID),
+		}})
+	}
+	return "Pick the subscription to remove:", &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+func (n *Notifier) handleUnsubscribeButton(data string) (string, *bot.EditMessageTextParams) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(data, callbackUnsubscribe), 10, 64)
+	if err != nil {
+		return "Unknown action", nil
+	}
+	if err := n.service.DeleteSearch(uint(id)); err != nil {
+		return "Failed: " + err.Error(), nil
+	}
+
+	text, markup := n.renderSearches()
+	return fmt.Sprintf("Unsubscribed #%d", id), &bot.EditMessageTextParams{Text: text, ReplyMarkup: markup}
+}
+
+func formatSize(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,245 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/charleshuang3/autoget/backend/indexers"
+	"github.com/charleshuang3/autoget/backend/internal/db"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type fakeService struct {
+	searches   []*db.RSSSearch
+	downloads  []db.DownloadStatus
+	downloaded []string
+	listPages  []uint32
+	err        error
+}
+
+func (f *fakeService) SearchIndexer(indexer, keyword string, page, pageSize uint32) (*indexers.ListResult, error) {
+	f.listPages = append(f.listPages, page)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &indexers.ListResult{
+		Pagination: indexers.Pagination{Page: page, TotalPages: 3, PageSize: pageSize},
+		Resources: []indexers.ListResourceItem{
+			{ID: fmt.Sprintf("%d-1", page), Title: keyword + " 1", Size: 1536 * 1024 * 1024, Seeders: 10},
+			{ID: fmt.Sprintf("%d-2", page), Title: keyword + " 2", Size: 512, Free: true},
+		},
+	}, nil
+}
+
+func (f *fakeService) DownloadResource(indexer, resourceID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.downloaded = append(f.downloaded, indexer+"/"+resourceID)
+	return nil
+}
+
+func (f *fakeService) ActiveDownloads(limit int) ([]db.DownloadStatus, int64, error) {
+	return f.downloads, int64(len(f.downloads)) + 1, f.err
+}
+
+func (f *fakeService) AddSearch(indexer, text string) (*db.RSSSearch, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	s := &db.RSSSearch{Indexer: indexer, Text: text}
+	s.ID = uint(len(f.searches) + 1)
+	f.searches = append(f.searches, s)
+	return s, nil
+}
+
+func (f *fakeService) ListSearches() ([]*db.RSSSearch, error) {
+	return f.searches, f.err
+}
+
+func (f *fakeService) DeleteSearch(id uint) error {
+	for i, s := range f.searches {
+		if s.ID == id {
+			f.searches = append(f.searches[:i], f.searches[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func commandUpdate(chatID int64, text string) *models.Update {
+	command, _, _ := strings.Cut(text, " ")
+	return &models.Update{
+		ID: 1,
+		Message: &models.Message{
+			ID:   5,
+			Chat: models.Chat{ID: chatID},
+			Text: text,
+			Entities: []models.MessageEntity{
+				{Type: models.MessageEntityTypeBotCommand, Offset: 0, Length: len(command)},
+			},
+		},
+	}
+}
+
+func inlineKeyboard(t *testing.T, call apiCall) [][]models.InlineKeyboardButton {
+	markup := &models.InlineKeyboardMarkup{}
+	require.NoError(t, json.Unmarshal([]byte(call.form["reply_markup"]), markup))
+	return markup.InlineKeyboard
+}
+
+func TestCommandSearch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv, calls := fakeAPI(t)
+		n := newTestNotifier(t, srv)
+		s := &fakeService{}
+		n.SetService(s)
+
+		n.bot.ProcessUpdate(context.Background(), commandUpdate(42, "/search nyaa one piece"))
+
+		require.Len(t, *calls, 1)
+		call := (*calls)[0]
+		assert.Equal(t, "sendMessage", call.method)
+		assert.Equal(t, "nyaa: one piece (page 1/3)\n\n1. one piece 1\n    1.5 GiB, 10 seeders\n2. one piece 2\n    512 B, 0 seeders, free", call.form["text"])
+
+		keyboard := inlineKeyboard(t, call)
+		require.Len(t, keyboard, 2)
+		assert.Equal(t, "dl:1:1-1", keyboard[0][0].CallbackData)
+		assert.Equal(t, "dl:1:1-2", keyboard[0][1].CallbackData)
+		require.Len(t, keyboard[1], 1)
+		assert.Equal(t, "search:1:2", keyboard[1][0].CallbackData)
+
+		// next page edits the message.
+		n.bot.ProcessUpdate(context.Background(), callbackUpdate(42, "search:1:2"))
+		require.Len(t, *calls, 3)
+		assert.Equal(t, "answerCallbackQuery", (*calls)[1].method)
+		assert.Equal(t, "editMessageText", (*calls)[2].method)
+		assert.Contains(t, (*calls)[2].form["text"], "(page 2/3)")
+		keyboard = inlineKeyboard(t, (*calls)[2])
+		assert.Equal(t, "dl:1:2-1", keyboard[0][0].CallbackData)
+		assert.Equal(t, "search:1:1", keyboard[1][0].CallbackData)
+		assert.Equal(t, "search:1:3", keyboard[1][1].CallbackData)
+		assert.Equal(t, []uint32{1, 2}, s.listPages)
+
+		// download button.
+		n.bot.ProcessUpdate(context.Background(), callbackUpdate(42, "dl:1:2-1"))
+		require.Len(t, *calls, 4)
+		assert.Equal(t, "Download started", (*calls)[3].form["text"])
+		assert.Equal(t, []string{"nyaa/2-1"}, s.downloaded)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			text  string
+			err   error
+			reply string
+		}{
+			{"missing keyword", "/search nyaa", nil, "Usage: /search <indexer> <keyword>"},
+			{"service error", "/search nyaa one piece", fmt.Errorf("indexer not found: nyaa"), "Search failed: indexer not found: nyaa"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				srv, calls := fakeAPI(t)
+				n := newTestNotifier(t, srv)
+				n.SetService(&fakeService{err: tt.err})
+
+				n.bot.ProcessUpdate(context.Background(), commandUpdate(42, tt.text))
+
+				require.Len(t, *calls, 1)
+				assert.Equal(t, tt.reply, (*calls)[0].form["text"])
+			})
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		srv, calls := fakeAPI(t)
+		n := newTestNotifier(t, srv)
+		s := &fakeService{}
+		n.SetService(s)
+
+		n.bot.ProcessUpdate(context.Background(), callbackUpdate(42, "dl:9:1-1"))
+
+		require.Len(t, *calls, 1)
+		assert.Equal(t, "Search expired, search again", (*calls)[0].form["text"])
+		assert.Empty(t, s.downloaded)
+	})
+}
+
+func TestCommandDownloads(t *testing.T) {
+	srv, calls := fakeAPI(t)
+	n := newTestNotifier(t, srv)
+	n.SetService(&fakeService{downloads: []db.DownloadStatus{
+		{ResTitle: "Title 1", DownloadProgress: 456},
+		{ResTitle: "Title 2", DownloadProgress: 10, Paused: true},
+	}})
+
+	n.bot.ProcessUpdate(context.Background(), commandUpdate(42, "/downloads"))
+
+	require.Len(t, *calls, 1)
+	assert.Equal(t, "Downloading:\n\n1. Title 1\n    45.6%\n2. Title 2\n    1.0%, paused\n\n... and 1 more", (*calls)[0].form["text"])
+}
+
+func TestCommandSubscribe(t *testing.T) {
+	srv, calls := fakeAPI(t)
+	n := newTestNotifier(t, srv)
+	s := &fakeService{}
+	n.SetService(s)
+
+	n.bot.ProcessUpdate(context.Background(), commandUpdate(42, "/subscribe nyaa one piece"))
+	n.bot.ProcessUpdate(context.Background(), commandUpdate(42, "/subscribe nyaa bleach"))
+	require.Len(t, *calls, 2)
+	assert.Equal(t, "Subscribed #1: nyaa one piece", (*calls)[0].form["text"])
+	require.Len(t, s.searches, 2)
+
+	// list to pick from.
+	n.bot.ProcessUpdate(context.Background(), commandUpdate(42, "/unsubscribe"))
+	require.Len(t, *calls, 3)
+	keyboard := inlineKeyboard(t, (*calls)[2])
+	require.Len(t, keyboard, 2)
+	assert.Equal(t, "#1 nyaa: one piece", keyboard[0][0].Text)
+	assert.Equal(t, "unsub:1", keyboard[0][0].CallbackData)
+
+	n.bot.ProcessUpdate(context.Background(), callbackUpdate(42, "unsub:1"))
+	require.Len(t, *calls, 5)
+	assert.Equal(t, "Unsubscribed #1", (*calls)[3].form["text"])
+	assert.Equal(t, "editMessageText", (*calls)[4].method)
+	assert.Len(t, inlineKeyboard(t, (*calls)[4]), 1)
+
+	n.bot.ProcessUpdate(context.Background(), commandUpdate(42, "/unsubscribe 2"))
+	require.Len(t, *calls, 6)
+	assert.Equal(t, "Unsubscribed #2", (*calls)[5].form["text"])
+	assert.Empty(t, s.searches)
+
+	n.bot.ProcessUpdate(context.Background(), commandUpdate(42, "/unsubscribe 2"))
+	require.Len(t, *calls, 7)
+	assert.Equal(t, "Failed: record not found", (*calls)[6].form["text"])
+}
+
+func TestCommandNotAllowed(t *testing.T) {
+	srv, calls := fakeAPI(t)
+	n := newTestNotifier(t, srv)
+	s := &fakeService{}
+	n.SetService(s)
+
+	n.bot.ProcessUpdate(context.Background(), commandUpdate(1, "/subscribe nyaa one piece"))
+	assert.Empty(t, *calls)
+	assert.Empty(t, s.searches)
+
+	n.bot.ProcessUpdate(context.Background(), callbackUpdate(1, "unsub:1"))
+	require.Len(t, *calls, 1)
+	assert.Equal(t, "Not allowed", (*calls)[0].form["text"])
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "100 B", formatSize(100))
+	assert.Equal(t, "1.0 KiB", formatSize(1024))
+	assert.Equal(t, "1.5 GiB", formatSize(1536*1024*1024))
+}
@@ -2,34 +2,90 @@ package telegram
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/charleshuang3/autoget/backend/internal/notify"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	"github.com/rs/zerolog/log"
 )
 
+const (
+	// callback data: pending:<download|ignore>:<search id>
+	callbackPrefix = "pending:"
+	actionDownload = "download"
+	actionIgnore   = "ignore"
+)
+
+var logger = log.With().Str("component", "telegram").Logger()
+
 type Config struct {
 	Token  string `yaml:"token"`
 	ChatID string `yaml:"chat_id"`
 }
 
-var _ notify.INotifier = (*Notifier)(nil)
+func (c *Config) Validate() error {
+	if c.Token == "" {
+		return fmt.Errorf("telegram token is required")
+	}
+	if c.ChatID == "" {
+		return fmt.Errorf("telegram chat ID is required")
+	}
+	return nil
+}
+
+var (
+	_ notify.INotifier = (*Notifier)(nil)
+	_ notify.IApprover = (*Notifier)(nil)
+)
+
+// PendingDownloadHandler starts or ignores the download of the matched search.
+type PendingDownloadHandler func(searchID uint, download bool) error
 
 type Notifier struct {
 	config *Config
 	bot    *bot.Bot
+
+	pendingHandler PendingDownloadHandler
+	service        IService
+
+	mu          sync.Mutex
+	queries     map[uint64]*searchQuery
+	nextQueryID uint64
 }
 
 func New(config *Config) (*Notifier, error) {
-	b, err := bot.New(config.Token)
+	return newNotifier(config)
+}
+
+func newNotifier(config *Config, opts ...bot.Option) (*Notifier, error) {
+	n := &Notifier{
+		config:  config,
+		queries: map[uint64]*searchQuery{},
+	}
+
+	opts = append(opts, bot.WithCallbackQueryDataHandler(callbackPrefix, bot.MatchTypePrefix, n.handleCallback))
+	opts = append(opts, n.commandOptions()...)
+	b, err := bot.New(config.Token, opts...)
 	if err != nil {
 		return nil, err
 	}
+	n.bot = b
+
+	return n, nil
+}
+
+// SetPendingDownloadHandler handles the buttons of pending downloads.
+func (n *Notifier) SetPendingDownloadHandler(h PendingDownloadHandler) {
+	n.pendingHandler = h
+}
 
-	return &Notifier{
-		config: config,
-		bot:    b,
-	}, nil
+// Start long polling updates, blocks until ctx is done.
+func (n *Notifier) Start(ctx context.Context) {
+	n.bot.Start(ctx)
 }
 
 func (n *Notifier) SendMessage(message string) error {
@@ -50,3 +106,84 @@ func (n *Notifier) SendMarkdownMessage(message string) error {
 
 	return err
 }
+
+// SendPendingDownload sends the match with Download and Ignore buttons.
+func (n *Notifier) SendPendingDownload(p *notify.PendingDownload) error {
+	text := fmt.Sprintf("%s: %s", p.Indexer, p.Title)
+	if p.URL != "" {
+		text += "\n" + p.URL
+	}
+
+	id := strconv.FormatUint(uint64(p.SearchID), 10)
+	_, err := n.bot.SendMessage(context.Background(), &bot.SendMessageParams{
+		ChatID: n.config.ChatID,
+		Text:   text,
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{{
+				{Text: "Download", CallbackData: callbackPrefix + actionDownload + ":" + id},
+				{Text: "Ignore", CallbackData: callbackPrefix + actionIgnore + ":" + id},
+			}},
+		},
+	})
+
+	return err
+}
+
+func parseCallbackData(data string) (action string, searchID uint, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(data, callbackPrefix), ":")
+	if len(parts) != 2 || (parts[0] != actionDownload && parts[0] != actionIgnore) {
+		return "", 0, false
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[0], uint(id), true
+}
+
+func (n *Notifier) handleCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	q := update.CallbackQuery
+	msg := q.Message.Message
+
+	answer := func(text string) {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: q.ID,
+			Text:            text,
+		}); err != nil {
+			logger.Error().Err(err).Msg("Failed to answer callback query")
+		}
+	}
+
+	// only the configured chat can approve downloads.
+	if msg == nil || !n.allowed(msg.Chat.ID) {
+		answer("Not allowed")
+		return
+	}
+
+	action, searchID, ok := parseCallbackData(q.Data)
+	if !ok || n.pendingHandler == nil {
+		answer("Unknown action")
+		return
+	}
+
+	if err := n.pendingHandler(searchID, action == actionDownload); err != nil {
+		logger.Error().Err(err).Uint("search", searchID).Msg("Failed to handle pending download")
+		answer("Failed: " + err.Error())
+		return
+	}
+
+	status := "Download started"
+	if action == actionIgnore {
+		status = "Ignored"
+	}
+	answer(status)
+
+	// replace the buttons with the result.
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    msg.Chat.ID,
+		MessageID: msg.ID,
+		Text:      msg.Text + "\n\n" + status,
+	}); err != nil {
+		logger.Error().Err(err).Msg("Failed to edit pending download message")
+	}
+}
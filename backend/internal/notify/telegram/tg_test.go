@@ -1,9 +1,20 @@
 package telegram
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"sync"
 	"testing"
 
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,3 +52,164 @@ func TestSendMarkdownMessage(t *testing.T) {
 	bot.SendMarkdownMessage(`*title*:
   test message`)
 }
+
+type apiCall struct {
+	method string
+	form   map[string]string
+}
+
+// fakeAPI records the bot API calls and replies ok.
+func fakeAPI(t *testing.T) (*httptest.Server, *[]apiCall) {
+	var mu sync.Mutex
+	calls := []apiCall{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		form := map[string]string{}
+		for k, v := range r.MultipartForm.Value {
+			form[k] = v[0]
+		}
+
+		mu.Lock()
+		calls = append(calls, apiCall{method: path.Base(r.URL.Path), form: form})
+		mu.Unlock()
+
+		result := `{"message_id":1,"date":0,"chat":{"id":1,"type":"private"}}`
+		if path.Base(r.URL.Path) == "answerCallbackQuery" {
+			result = "true"
+		}
+		w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newTestNotifier(t *testing.T, srv *httptest.Server) *Notifier {
+	n, err := newNotifier(&Config{Token: "token", ChatID: "42"},
+		bot.WithServerURL(srv.URL), bot.WithSkipGetMe(), bot.WithNotAsyncHandlers())
+	require.NoError(t, err)
+	return n
+}
+
+func TestSendPendingDownload(t *testing.T) {
+	srv, calls := fakeAPI(t)
+	n := newTestNotifier(t, srv)
+
+	err := n.SendPendingDownload(&notify.PendingDownload{SearchID: 7, Indexer: "nyaa", Title: "Title", URL: "http://nyaa/7"})
+	require.NoError(t, err)
+
+	require.Len(t, *calls, 1)
+	call := (*calls)[0]
+	assert.Equal(t, "sendMessage", call.method)
+	assert.Equal(t, "42", call.form["chat_id"])
+	assert.Equal(t, "nyaa: Title\nhttp://nyaa/7", call.form["text"])
+
+	markup := &models.InlineKeyboardMarkup{}
+	require.NoError(t, json.Unmarshal([]byte(call.form["reply_markup"]), markup))
+	require.Len(t, markup.InlineKeyboard, 1)
+	assert.Equal(t, "pending:download:7", markup.InlineKeyboard[0][0].CallbackData)
+	assert.Equal(t, "pending:ignore:7", markup.InlineKeyboard[0][1].CallbackData)
+}
+
+func TestParseCallbackData(t *testing.T) {
+	action, id, ok := parseCallbackData("pending:download:12")
+	assert.True(t, ok)
+	assert.Equal(t, actionDownload, action)
+	assert.Equal(t, uint(12), id)
+
+	action, id, ok = parseCallbackData("pending:ignore:3")
+	assert.True(t, ok)
+	assert.Equal(t, actionIgnore, action)
+	assert.Equal(t, uint(3), id)
+
+	for _, data := range []string{"pending:download", "pending:delete:1", "pending:download:x", "pending:download:1:2"} {
+		_, _, ok := parseCallbackData(data)
+		assert.False(t, ok, data)
+	}
+}
+
+func callbackUpdate(chatID int64, data string) *models.Update {
+	return &models.Update{
+		ID: 1,
+		CallbackQuery: &models.CallbackQuery{
+			ID:   "q",
+			Data: data,
+			Message: models.MaybeInaccessibleMessage{
+				Type:    models.MaybeInaccessibleMessageTypeMessage,
+				Message: &models.Message{ID: 5, Chat: models.Chat{ID: chatID}, Text: "nyaa: Title"},
+			},
+		},
+	}
+}
+
+func TestHandleCallback(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv, calls := fakeAPI(t)
+		n := newTestNotifier(t, srv)
+
+		var gotID uint
+		var gotDownload bool
+		n.SetPendingDownloadHandler(func(searchID uint, download bool) error {
+			gotID, gotDownload = searchID, download
+			return nil
+		})
+
+		n.bot.ProcessUpdate(context.Background(), callbackUpdate(42, "pending:download:7"))
+
+		assert.Equal(t, uint(7), gotID)
+		assert.True(t, gotDownload)
+		require.Len(t, *calls, 2)
+		assert.Equal(t, "answerCallbackQuery", (*calls)[0].method)
+		assert.Equal(t, "Download started", (*calls)[0].form["text"])
+		assert.Equal(t, "editMessageText", (*calls)[1].method)
+		assert.Equal(t, "nyaa: Title\n\nDownload started", (*calls)[1].form["text"])
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		srv, calls := fakeAPI(t)
+		n := newTestNotifier(t, srv)
+
+		gotDownload := true
+		n.SetPendingDownloadHandler(func(searchID uint, download bool) error {
+			gotDownload = download
+			return nil
+		})
+
+		n.bot.ProcessUpdate(context.Background(), callbackUpdate(42, "pending:ignore:7"))
+
+		assert.False(t, gotDownload)
+		require.Len(t, *calls, 2)
+		assert.Equal(t, "nyaa: Title\n\nIgnored", (*calls)[1].form["text"])
+	})
+
+	tests := []struct {
+		name   string
+		chatID int64
+		data   string
+		err    error
+		answer string
+	}{
+		{"other chat", 1, "pending:download:7", nil, "Not allowed"},
+		{"unknown action", 42, "pending:delete:7", nil, "Unknown action"},
+		{"handler error", 42, "pending:download:7", fmt.Errorf("boom"), "Failed: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := fakeAPI(t)
+			n := newTestNotifier(t, srv)
+
+			called := false
+			n.SetPendingDownloadHandler(func(searchID uint, download bool) error {
+				called = true
+				return tt.err
+			})
+
+			n.bot.ProcessUpdate(context.Background(), callbackUpdate(tt.chatID, tt.data))
+
+			assert.Equal(t, tt.err != nil, called)
+			require.Len(t, *calls, 1)
+			assert.Equal(t, "answerCallbackQuery", (*calls)[0].method)
+			assert.Equal(t, tt.answer, (*calls)[0].form["text"])
+		})
+	}
+}
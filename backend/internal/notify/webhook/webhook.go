@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"fmt"
+
+	"github.com/charleshuang3/autoget/backend/internal/notify"
+)
+
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+)
+
+type Config struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"` // e.g. Authorization
+}
+
+func (c *Config) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("webhook URL is required")
+	}
+	return nil
+}
+
+var _ notify.INotifier = (*Notifier)(nil)
+
+// Notifier posts {"message": "...", "format": "text|markdown"}.
+type Notifier struct {
+	config *Config
+}
+
+func New(config *Config) *Notifier {
+	return &Notifier{config: config}
+}
+
+type Payload struct {
+	Message string `json:"message"`
+	Format  string `json:"format"`
+}
+
+func (n *Notifier) SendMessage(message string) error {
+	return notify.PostJSON(n.config.URL, n.config.Headers, &Payload{Message: message, Format: FormatText})
+}
+
+func (n *Notifier) SendMarkdownMessage(message string) error {
+	return notify.PostJSON(n.config.URL, n.config.Headers, &Payload{Message: message, Format: FormatMarkdown})
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendMessage(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		received := []Payload{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+			p := Payload{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+			received = append(received, p)
+		}))
+		t.Cleanup(server.Close)
+
+		n := New(&Config{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+		require.NoError(t, n.SendMessage("hello"))
+		require.NoError(t, n.SendMarkdownMessage("*hello*"))
+
+		assert.Equal(t, []Payload{
+			{Message: "hello", Format: FormatText},
+			{Message: "*hello*", Format: FormatMarkdown},
+		}, received)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("boom"))
+		}))
+		t.Cleanup(server.Close)
+
+		n := New(&Config{URL: server.URL})
+		assert.ErrorContains(t, n.SendMessage("hello"), "webhook status code: 500, body: boom")
+	})
+}
@@ -102,7 +102,7 @@ export class ResourceList extends LitElement {
   private async handleDownloadClick(indexerId: string, resourceId: string) {
     const url = `/api/v1/indexers/${indexerId}/resources/${resourceId}/download`;
     try {
-      const response = await fetch(url, { method: 'GET' });
+      const response = await fetch(url, { method: 'POST' });
       if (!response.ok) {
         throw new Error(`HTTP error! status: ${response.status}`);
       }